@@ -0,0 +1,180 @@
+package profilefed
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// AccessLogSink receives field-level access records from [Handler].
+// LogAccess is called synchronously while serving the request,
+// so implementations that do slow I/O should buffer records.
+type AccessLogSink interface {
+	LogAccess(rec AccessRecord)
+}
+
+// AccessLogSinkFunc is an adapter that allows the use of an ordinary
+// function as an [AccessLogSink].
+type AccessLogSinkFunc func(rec AccessRecord)
+
+// LogAccess implements the [AccessLogSink] interface
+func (f AccessLogSinkFunc) LogAccess(rec AccessRecord) {
+	f(rec)
+}
+
+// AccessRecord records which fields of a descriptor were disclosed to a client.
+type AccessRecord struct {
+	// Time is the time at which the descriptor was served.
+	Time time.Time `json:"time"`
+	// Path is the request path.
+	Path string `json:"path"`
+	// DescriptorID is the ID of the disclosed descriptor.
+	DescriptorID string `json:"descriptor_id"`
+	// Visibility is the visibility tier that was served.
+	Visibility Visibility `json:"visibility"`
+	// Client identifies the authenticated client the descriptor was disclosed to.
+	// It's empty for anonymous requests.
+	Client string `json:"client,omitempty"`
+	// RemoteAddr is the remote address of the request.
+	RemoteAddr string `json:"remote_addr"`
+	// Fields contains the JSON names of all non-empty top-level fields that were disclosed.
+	Fields []string `json:"fields"`
+	// Extras contains the namespace and type of every extra object that was disclosed.
+	Extras []ExtraRef `json:"extras,omitempty"`
+}
+
+// ExtraRef identifies a kind of extra data object.
+type ExtraRef struct {
+	Namespace string `json:"namespace"`
+	Type      string `json:"type"`
+}
+
+// newAccessRecord creates an access record for a descriptor served in response to req.
+func newAccessRecord(req *http.Request, desc *Descriptor) AccessRecord {
+	rec := AccessRecord{
+		Time:         time.Now(),
+		Path:         req.URL.Path,
+		DescriptorID: desc.ID,
+		Visibility:   RequestVisibility(req),
+		RemoteAddr:   req.RemoteAddr,
+		Fields:       disclosedFields(desc),
+	}
+
+	if ti, ok := TokenFromContext(req.Context()); ok {
+		rec.Client = ti.ClientID
+		if rec.Client == "" {
+			rec.Client = ti.Subject
+		}
+	}
+
+	for _, extra := range desc.Extra {
+		rec.Extras = append(rec.Extras, ExtraRef{Namespace: extra.Namespace, Type: extra.Type})
+	}
+
+	return rec
+}
+
+// disclosedFields returns the JSON names of the non-empty top-level fields of desc.
+func disclosedFields(desc *Descriptor) []string {
+	data, err := json.Marshal(desc)
+	if err != nil {
+		return nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil
+	}
+
+	out := make([]string, 0, len(fields))
+	for name, value := range fields {
+		switch string(value) {
+		case "null", `""`, "[]", "{}", "false", "0":
+			continue
+		}
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// logAccess sends an access record for desc to the handler's sink, if it has one.
+func (h Handler) logAccess(req *http.Request, desc *Descriptor) {
+	if h.AccessLog == nil || desc == nil {
+		return
+	}
+	h.AccessLog.LogAccess(newAccessRecord(req, desc))
+}
+
+// AccessLog is an in-memory [AccessLogSink] that keeps all the records it
+// receives and provides helpers to aggregate them. It's safe for concurrent use.
+type AccessLog struct {
+	mtx     sync.Mutex
+	records []AccessRecord
+}
+
+// LogAccess implements the [AccessLogSink] interface
+func (al *AccessLog) LogAccess(rec AccessRecord) {
+	al.mtx.Lock()
+	defer al.mtx.Unlock()
+	al.records = append(al.records, rec)
+}
+
+// Records returns a copy of all the records in the log.
+func (al *AccessLog) Records() []AccessRecord {
+	al.mtx.Lock()
+	defer al.mtx.Unlock()
+	return append([]AccessRecord(nil), al.records...)
+}
+
+// FieldsByClient returns, for each client, the number of times each field was disclosed
+// to it. Anonymous clients are aggregated under the empty string.
+func (al *AccessLog) FieldsByClient() map[string]map[string]int {
+	out := map[string]map[string]int{}
+	for _, rec := range al.Records() {
+		counts, ok := out[rec.Client]
+		if !ok {
+			counts = map[string]int{}
+			out[rec.Client] = counts
+		}
+		for _, field := range rec.Fields {
+			counts[field]++
+		}
+	}
+	return out
+}
+
+// ClientsByDescriptor returns, for each descriptor ID, the set of
+// authenticated clients that it was disclosed to.
+func (al *AccessLog) ClientsByDescriptor() map[string][]string {
+	seen := map[string]map[string]struct{}{}
+	for _, rec := range al.Records() {
+		if rec.Client == "" {
+			continue
+		}
+		if seen[rec.DescriptorID] == nil {
+			seen[rec.DescriptorID] = map[string]struct{}{}
+		}
+		seen[rec.DescriptorID][rec.Client] = struct{}{}
+	}
+
+	out := make(map[string][]string, len(seen))
+	for id, clients := range seen {
+		for client := range clients {
+			out[id] = append(out[id], client)
+		}
+		sort.Strings(out[id])
+	}
+	return out
+}
+
+// CountByVisibility returns the number of descriptors served at each visibility tier.
+func (al *AccessLog) CountByVisibility() map[Visibility]int {
+	out := map[Visibility]int{}
+	for _, rec := range al.Records() {
+		out[rec.Visibility]++
+	}
+	return out
+}
@@ -0,0 +1,72 @@
+package profilefed
+
+import (
+	"context"
+	"crypto/ed25519"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestHandlerAccessLog(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey error: %s", err)
+	}
+
+	desc := &Descriptor{ID: "main", Username: "user", DisplayName: "User", Bio: "Bio"}
+	if err := desc.AddActor("https://example.test/users/user"); err != nil {
+		t.Fatalf("AddActor error: %s", err)
+	}
+
+	var records []AccessRecord
+	h := Handler{
+		PrivateKey: priv,
+		DescriptorFunc: func(req *Request) (*Descriptor, error) {
+			return desc, nil
+		},
+		TokenValidator: TokenValidatorFunc(func(ctx context.Context, token string) (*TokenInfo, error) {
+			return &TokenInfo{ClientID: "app", Subject: "someone"}, nil
+		}),
+		AccessLog: AccessLogSinkFunc(func(rec AccessRecord) {
+			records = append(records, rec)
+		}),
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/pfd/user", nil))
+
+	req := httptest.NewRequest(http.MethodGet, "/pfd/user", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 records, got %d", len(records))
+	}
+
+	anon, authed := records[0], records[1]
+	if anon.Visibility != VisibilityPublic || anon.Client != "" {
+		t.Errorf("Unexpected anonymous record: %#v", anon)
+	}
+	if authed.Visibility != VisibilityAuthenticated || authed.Client != "app" {
+		t.Errorf("Unexpected authenticated record: %#v", authed)
+	}
+
+	for _, r := range records {
+		if r.Path != "/pfd/user" || r.DescriptorID != "main" || r.RemoteAddr == "" || r.Time.IsZero() {
+			t.Errorf("Unexpected record metadata: %#v", r)
+		}
+
+		expected := []string{"bio", "display_name", "extra", "id", "namespaces", "username"}
+		if !reflect.DeepEqual(r.Fields, expected) {
+			t.Errorf("Unexpected fields: %q", r.Fields)
+		}
+
+		extras := []ExtraRef{{Namespace: ActivityPubNamespace, Type: ActorExtraType}}
+		if !reflect.DeepEqual(r.Extras, extras) {
+			t.Errorf("Unexpected extras: %#v", r.Extras)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package profilefed
+
+import (
+	"encoding/json"
+	"errors"
+	"html"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+const (
+	// ActivityPubNamespace is the namespace used for extras that link a profile to
+	// ActivityPub actors.
+	ActivityPubNamespace = "https://www.w3.org/ns/activitystreams"
+	// ActorExtraType is the extra type used to link a profile to an ActivityPub actor.
+	// Its data is the actor's ID URL as a JSON string.
+	ActorExtraType = "actor"
+)
+
+// ErrNoActor signifies that a descriptor doesn't link to an ActivityPub actor.
+var ErrNoActor = errors.New("descriptor does not link to an activitypub actor")
+
+// ActorLink contains the result of cross-verifying a profile's ActivityPub actor link.
+type ActorLink struct {
+	// ActorURL is the ID URL of the linked actor.
+	ActorURL string
+	// Verified is true if the actor links back to the profile.
+	Verified bool
+	// Evidence describes where the back link was found, such as
+	// "alsoKnownAs" or "attachment". It's empty if Verified is false.
+	Evidence string
+}
+
+// AddActor is a convenience function that links the descriptor to an ActivityPub actor.
+func (d *Descriptor) AddActor(actorURL string) error {
+	return d.AddExtra(ActivityPubNamespace, ActorExtraType, actorURL)
+}
+
+// Actor returns the URL of the ActivityPub actor the descriptor links to, if any.
+func (d *Descriptor) Actor() (string, bool) {
+	for _, extra := range d.Extra {
+		if extra.Namespace != ActivityPubNamespace || extra.Type != ActorExtraType {
+			continue
+		}
+
+		var actorURL string
+		if err := json.Unmarshal(extra.Data, &actorURL); err == nil && actorURL != "" {
+			return actorURL, true
+		}
+	}
+	return "", false
+}
+
+// CrossVerifyActor verifies that the ActivityPub actor linked from desc links back
+// to the profile. The actor links back if its alsoKnownAs contains the given resource
+// (such as acct:user@example.com) or one of the given profile URLs, or if one of its
+// attachments links to one of the profile URLs. Profile URLs can be things like the
+// descriptor URL or the user's profile page.
+//
+// A link in only one direction isn't an error; it results in an unverified [ActorLink].
+func (c Client) CrossVerifyActor(desc *Descriptor, resource string, profileURLs ...string) (*ActorLink, error) {
+	actorURL, ok := desc.Actor()
+	if !ok {
+		return nil, ErrNoActor
+	}
+
+	actor, err := c.fetchActor(actorURL)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &ActorLink{ActorURL: actorURL}
+	for _, aka := range actor.AlsoKnownAs {
+		if aka == resource || slices.Contains(profileURLs, aka) {
+			out.Verified, out.Evidence = true, "alsoKnownAs"
+			return out, nil
+		}
+	}
+
+	for _, att := range actor.Attachment {
+		// Mastodon-style profile metadata uses PropertyValue attachments
+		// whose value is an HTML snippet containing the link.
+		for _, profileURL := range profileURLs {
+			if att.Href == profileURL || strings.Contains(att.Value, `href="`+html.EscapeString(profileURL)+`"`) {
+				out.Verified, out.Evidence = true, "attachment"
+				return out, nil
+			}
+		}
+	}
+
+	return out, nil
+}
+
+// activityPubActor contains the members of an ActivityPub actor
+// relevant to cross-verification.
+type activityPubActor struct {
+	ID          string                  `json:"id"`
+	AlsoKnownAs oneOrMany[string]       `json:"alsoKnownAs"`
+	Attachment  oneOrMany[apAttachment] `json:"attachment"`
+}
+
+type apAttachment struct {
+	Type  string `json:"type"`
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	Href  string `json:"href"`
+}
+
+// oneOrMany decodes JSON-LD members that may either
+// contain a single value or an array of values.
+type oneOrMany[T any] []T
+
+func (om *oneOrMany[T]) UnmarshalJSON(data []byte) error {
+	var many []T
+	if err := json.Unmarshal(data, &many); err == nil {
+		*om = many
+		return nil
+	}
+
+	var one T
+	if err := json.Unmarshal(data, &one); err != nil {
+		return err
+	}
+	*om = oneOrMany[T]{one}
+	return nil
+}
+
+// fetchActor fetches the ActivityPub actor at actorURL.
+func (c Client) fetchActor(actorURL string) (*activityPubActor, error) {
+	req, err := http.NewRequest(http.MethodGet, actorURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.checkURL(req.URL); err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", `application/activity+json, application/ld+json; profile="https://www.w3.org/ns/activitystreams"`)
+
+	res, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if err := checkResp(res, "fetchActor"); err != nil {
+		return nil, err
+	}
+
+	actor := &activityPubActor{}
+	err = json.NewDecoder(io.LimitReader(res.Body, responseSizeLimit)).Decode(actor)
+	if err != nil {
+		return nil, err
+	}
+
+	if actor.ID != actorURL {
+		return nil, errors.New("actor id does not match requested url")
+	}
+
+	return actor, nil
+}
@@ -0,0 +1,104 @@
+package profilefed
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCrossVerifyActor(t *testing.T) {
+	const (
+		resource   = "acct:user@example.com"
+		profileURL = "https://example.com/@user"
+	)
+
+	var srv *httptest.Server
+	actors := map[string]func(id string) any{
+		"/aka": func(id string) any {
+			return map[string]any{"id": id, "alsoKnownAs": []string{"acct:other@example.net", resource}}
+		},
+		"/aka-single": func(id string) any {
+			return map[string]any{"id": id, "alsoKnownAs": profileURL}
+		},
+		"/attachment": func(id string) any {
+			return map[string]any{"id": id, "attachment": []map[string]any{{
+				"type":  "PropertyValue",
+				"name":  "Profile",
+				"value": `<a href="` + profileURL + `" rel="me">example.com/@user</a>`,
+			}}}
+		},
+		"/mismatch": func(id string) any {
+			return map[string]any{
+				"id":          id,
+				"alsoKnownAs": []string{"acct:user@example.net"},
+				"attachment": map[string]any{
+					"type":  "PropertyValue",
+					"value": `<a href="https://example.net/@user">example.net/@user</a>`,
+				},
+			}
+		},
+		"/wrong-id": func(id string) any {
+			return map[string]any{"id": srv.URL + "/aka", "alsoKnownAs": []string{resource}}
+		},
+	}
+
+	srv = httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		actor, ok := actors[req.URL.Path]
+		if !ok {
+			http.NotFound(res, req)
+			return
+		}
+		res.Header().Set("Content-Type", "application/activity+json")
+		json.NewEncoder(res).Encode(actor(srv.URL + req.URL.Path))
+	}))
+	defer srv.Close()
+
+	c := DefaultClient()
+	for path, expected := range map[string]string{
+		"/aka":        "alsoKnownAs",
+		"/aka-single": "alsoKnownAs",
+		"/attachment": "attachment",
+		"/mismatch":   "",
+	} {
+		desc := &Descriptor{ID: "main", Username: "user"}
+		if err := desc.AddActor(srv.URL + path); err != nil {
+			t.Fatalf("AddActor error: %s", err)
+		}
+
+		link, err := c.CrossVerifyActor(desc, resource, profileURL)
+		if err != nil {
+			t.Fatalf("%s: CrossVerifyActor error: %s", path, err)
+		}
+
+		if link.ActorURL != srv.URL+path {
+			t.Errorf("%s: unexpected actor URL %q", path, link.ActorURL)
+		}
+		if link.Verified != (expected != "") || link.Evidence != expected {
+			t.Errorf("%s: expected evidence %q, got %+v", path, expected, link)
+		}
+	}
+
+	// An actor whose ID doesn't match the linked URL must not be trusted
+	desc := &Descriptor{ID: "main", Username: "user"}
+	if err := desc.AddActor(srv.URL + "/wrong-id"); err != nil {
+		t.Fatalf("AddActor error: %s", err)
+	}
+	if _, err := c.CrossVerifyActor(desc, resource, profileURL); err == nil {
+		t.Error("Expected an error for an actor with the wrong ID")
+	}
+
+	desc = &Descriptor{ID: "main", Username: "user"}
+	if err := desc.AddActor(srv.URL + "/missing"); err != nil {
+		t.Fatalf("AddActor error: %s", err)
+	}
+	var herr *HTTPError
+	if _, err := c.CrossVerifyActor(desc, resource, profileURL); !errors.As(err, &herr) || herr.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected a 404 HTTPError for a missing actor, got %v", err)
+	}
+
+	if _, err := c.CrossVerifyActor(&Descriptor{ID: "main"}, resource); !errors.Is(err, ErrNoActor) {
+		t.Errorf("Expected ErrNoActor, got %v", err)
+	}
+}
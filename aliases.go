@@ -0,0 +1,82 @@
+package profilefed
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"slices"
+)
+
+// serverName returns the name under which the key for the given host is
+// pinned. That's the primary server name if the host is a known alternate
+// name, and the host itself otherwise.
+func (c Client) serverName(host string) (string, error) {
+	if c.GetAlias == nil {
+		return host, nil
+	}
+
+	primary, err := c.GetAlias(host)
+	if err != nil {
+		return "", err
+	}
+
+	if primary == "" {
+		return host, nil
+	}
+	return primary, nil
+}
+
+// trustAlias handles the first contact with a host whose server info claims
+// that it's an alternate name of another server. The claim is only accepted
+// if the primary server confirms it by listing the host as one of its own
+// alternate names, with the same key. If it does, the host is saved as an
+// alias of the primary server, and the primary server's key is used for it.
+func (c Client) trustAlias(scheme, alias string, info serverInfoData) (ed25519.PublicKey, error) {
+	primary := info.ServerName
+	if err := c.checkQuarantine(primary); err != nil {
+		return nil, err
+	}
+
+	data, sig, prevSigs, err := c.getServerInfo(scheme, primary)
+	if err != nil {
+		return nil, err
+	}
+
+	var primaryInfo serverInfoData
+	err = json.Unmarshal(data, &primaryInfo)
+	if err != nil {
+		return nil, err
+	}
+	primaryInfo.normalize()
+
+	// Only a server that isn't itself an alias can confirm alternate names,
+	// so that aliases can't be chained.
+	if primaryInfo.ServerName != primary ||
+		primaryInfo.PublicKey != info.PublicKey ||
+		!slices.Contains(primaryInfo.AlternateNames, alias) {
+		return nil, ErrAliasNotConfirmed
+	}
+
+	pubkey, err := c.getPubkey(primary)
+	if errors.Is(err, ErrPubkeyNotFound) {
+		pubkey, err = c.trustInfo(primary, primaryInfo, data, sig, prevSigs)
+		if err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	} else if !verify(pubkey, data, sig) {
+		// If the primary server's pinned key doesn't match, its confirmation can't
+		// be trusted. If it has rotated its key, the rotation has to be accepted
+		// via the primary name before the alias is.
+		c.observe(primary, OutcomeMismatchInitial)
+		return nil, ErrSignatureMismatch
+	}
+
+	c.tracef("treating %s as an alternate name of %s", alias, primary)
+	if err := c.SaveAlias(alias, primary); err != nil {
+		return nil, err
+	}
+
+	return pubkey, nil
+}
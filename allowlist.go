@@ -0,0 +1,193 @@
+package profilefed
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrHostNotAllowed signifies that a request was blocked
+// because its host isn't allowed by [Client.AllowHost].
+var ErrHostNotAllowed = errors.New("host is not in the allowlist")
+
+// HostNotAllowedError is returned when a client in allowlist mode
+// refuses to contact a host. See [Client.AllowHost].
+type HostNotAllowedError struct {
+	// Host is the host that was blocked.
+	Host string
+}
+
+func (hna HostNotAllowedError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrHostNotAllowed, hna.Host)
+}
+
+// Is allows HostNotAllowedError to be matched with [errors.Is] against [ErrHostNotAllowed].
+func (hna HostNotAllowedError) Is(target error) bool {
+	return target == ErrHostNotAllowed
+}
+
+// AllowHosts returns a function that can be used as [Client.AllowHost] to only
+// allow the given hosts. A host may start with "*." to allow every subdomain
+// of a domain, and hosts without a port are allowed on any port.
+func AllowHosts(hosts ...string) func(host string) bool {
+	patterns := normalizeHosts(hosts)
+	return func(host string) bool {
+		return matchHost(patterns, host)
+	}
+}
+
+// matchHost reports whether host matches one of the normalized patterns.
+func matchHost(patterns []string, host string) bool {
+	host = normalizeHost(host)
+	hostname := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		hostname = h
+	}
+
+	for _, pattern := range patterns {
+		if suffix, ok := strings.CutPrefix(pattern, "*"); ok {
+			if strings.HasSuffix(hostname, suffix) {
+				return true
+			}
+		} else if host == pattern || hostname == strings.Trim(pattern, "[]") {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultAllowlistCheckInterval is how often a [HostAllowlist] checks
+// whether its file has changed if its CheckInterval is zero.
+const DefaultAllowlistCheckInterval = 5 * time.Second
+
+// HostAllowlist is a list of allowed hosts loaded from a file, which is
+// reloaded whenever the file changes, so that peers can be added to a closed
+// federation without restarting. Its Allowed method can be used as
+// [Client.AllowHost] and as [webfinger.Client.AllowHost].
+//
+// The file contains one host per line, in the format accepted by [AllowHosts].
+// Empty lines and lines starting with # are ignored.
+type HostAllowlist struct {
+	// Path is the path of the allowlist file.
+	Path string
+	// CheckInterval is the minimum time between checks for changes to the file.
+	// If it's zero, [DefaultAllowlistCheckInterval] is used.
+	CheckInterval time.Duration
+
+	mtx      sync.Mutex
+	patterns []string
+	modTime  time.Time
+	checked  time.Time
+}
+
+// LoadHostAllowlist loads the allowlist file at path.
+func LoadHostAllowlist(path string) (*HostAllowlist, error) {
+	al := &HostAllowlist{Path: path}
+	if err := al.Reload(); err != nil {
+		return nil, err
+	}
+	return al, nil
+}
+
+// Reload reloads the allowlist file. If it fails, the previously
+// loaded hosts are kept.
+func (al *HostAllowlist) Reload() error {
+	al.mtx.Lock()
+	defer al.mtx.Unlock()
+	return al.reload()
+}
+
+// reload reloads the allowlist file. The caller must hold al.mtx.
+func (al *HostAllowlist) reload() error {
+	al.checked = time.Now()
+
+	fl, err := os.Open(al.Path)
+	if err != nil {
+		return err
+	}
+	defer fl.Close()
+
+	stat, err := fl.Stat()
+	if err != nil {
+		return err
+	}
+
+	var hosts []string
+	s := bufio.NewScanner(fl)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		hosts = append(hosts, line)
+	}
+	if err := s.Err(); err != nil {
+		return err
+	}
+
+	al.patterns, al.modTime = normalizeHosts(hosts), stat.ModTime()
+	return nil
+}
+
+// Allowed reports whether host is in the allowlist. If the file has changed
+// since it was last loaded, it's reloaded first. If the file can't be
+// reloaded, the previously loaded hosts are used.
+func (al *HostAllowlist) Allowed(host string) bool {
+	al.mtx.Lock()
+	defer al.mtx.Unlock()
+
+	interval := al.CheckInterval
+	if interval == 0 {
+		interval = DefaultAllowlistCheckInterval
+	}
+
+	if time.Since(al.checked) >= interval {
+		al.checked = time.Now()
+		if stat, err := os.Stat(al.Path); err == nil && !stat.ModTime().Equal(al.modTime) {
+			al.reload()
+		}
+	}
+
+	return matchHost(al.patterns, host)
+}
+
+// allowlistTransport is an [http.RoundTripper] that
+// blocks requests to hosts that aren't allowed.
+type allowlistTransport struct {
+	transport http.RoundTripper
+	allow     func(host string) bool
+}
+
+// RoundTrip implements the [http.RoundTripper] interface
+func (at allowlistTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !at.allow(req.URL.Host) {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, HostNotAllowedError{Host: req.URL.Host}
+	}
+
+	transport := at.transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return transport.RoundTrip(req)
+}
+
+// withAllowlist returns a copy of hc that only sends requests to the
+// hosts allowed by allow, or hc itself if allow is nil.
+func withAllowlist(hc *http.Client, allow func(host string) bool) *http.Client {
+	if allow == nil {
+		return hc
+	}
+
+	out := *hc
+	out.Transport = allowlistTransport{transport: hc.Transport, allow: allow}
+	return &out
+}
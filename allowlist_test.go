@@ -0,0 +1,54 @@
+package profilefed
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAllowHost(t *testing.T) {
+	mt := &MemoryTransport{}
+	mt.Register("allowed.test", newTenant(t, "allowed.test", &Descriptor{ID: "main", Username: "user", DisplayName: "User"}))
+	mt.Register("other.test", newTenant(t, "other.test", &Descriptor{ID: "main", Username: "user", DisplayName: "User"}))
+
+	path := filepath.Join(t.TempDir(), "allowlist")
+	if err := os.WriteFile(path, []byte("# peers\nallowed.test\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile error: %s", err)
+	}
+
+	al, err := LoadHostAllowlist(path)
+	if err != nil {
+		t.Fatalf("LoadHostAllowlist error: %s", err)
+	}
+	al.CheckInterval = time.Nanosecond
+
+	c := mt.Client()
+	c.AllowHost = al.Allowed
+	if _, err := c.Lookup("user@allowed.test"); err != nil {
+		t.Fatalf("Lookup error: %s", err)
+	}
+
+	var hnaErr HostNotAllowedError
+	if _, err := c.Lookup("user@other.test"); !errors.As(err, &hnaErr) || hnaErr.Host != "other.test" {
+		t.Fatalf("Expected HostNotAllowedError for other.test, got %v", err)
+	}
+
+	// Make sure the modification time changes on filesystems with coarse timestamps
+	later := time.Now().Add(time.Minute)
+	if err := os.WriteFile(path, []byte("*.test\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile error: %s", err)
+	}
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatalf("Chtimes error: %s", err)
+	}
+
+	if _, err := c.Lookup("user@other.test"); err != nil {
+		t.Errorf("Lookup error after reload: %s", err)
+	}
+
+	if allow := AllowHosts("example.com"); !allow("Example.com:8443") || allow("sub.example.com") {
+		t.Error("AllowHosts doesn't match hosts as expected")
+	}
+}
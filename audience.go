@@ -0,0 +1,82 @@
+package profilefed
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Audience represents the audience a profile is suitable for.
+type Audience string
+
+// Audience ratings, from least to most restricted
+const (
+	// AudienceGeneral profiles are suitable for everyone. Profiles
+	// without an audience rating are treated as general.
+	AudienceGeneral Audience = "general"
+	// AudienceMature profiles may contain content some readers want to avoid,
+	// but that isn't restricted to adults.
+	AudienceMature Audience = "mature"
+	// AudienceAdult profiles are only suitable for adults.
+	AudienceAdult Audience = "adult"
+)
+
+// ErrAudienceRestricted signifies that a descriptor's audience
+// rating exceeds the one allowed by [Client.MaxAudience].
+var ErrAudienceRestricted = errors.New("descriptor audience exceeds allowed audience")
+
+// rank returns the position of the audience in the list of ratings.
+// Unknown ratings are ranked above every known one, so that they're
+// treated as the most restricted.
+func (a Audience) rank() int {
+	switch a {
+	case "", AudienceGeneral:
+		return 0
+	case AudienceMature:
+		return 1
+	case AudienceAdult:
+		return 2
+	default:
+		return 3
+	}
+}
+
+// Allows reports whether a profile with the given rating may be shown
+// to readers for whom a is the most restricted audience allowed.
+func (a Audience) Allows(rating Audience) bool {
+	return rating.rank() <= a.rank()
+}
+
+// ValidateAudience returns an error if a isn't empty
+// and isn't one of the known audience ratings.
+func ValidateAudience(a Audience) error {
+	if a != "" && a.rank() > AudienceAdult.rank() {
+		return fmt.Errorf("unknown audience: %q", a)
+	}
+	return nil
+}
+
+// filterAudience checks the descriptors in dest, which must be a descriptor or
+// a map of descriptors, against the client's MaxAudience, if it's set. Descriptors
+// in a map that aren't allowed are removed from it, while a single descriptor
+// that isn't allowed results in [ErrAudienceRestricted].
+func (c Client) filterAudience(host string, dest any) error {
+	if c.MaxAudience == "" {
+		return nil
+	}
+
+	switch dest := dest.(type) {
+	case *Descriptor:
+		if !c.MaxAudience.Allows(dest.Audience) {
+			c.tracef("descriptor from %s is rated %q, which exceeds %q", host, dest.Audience, c.MaxAudience)
+			return ErrAudienceRestricted
+		}
+	case *map[string]*Descriptor:
+		for id, desc := range *dest {
+			if desc != nil && !c.MaxAudience.Allows(desc.Audience) {
+				c.tracef("descriptor %s from %s is rated %q, which exceeds %q", id, host, desc.Audience, c.MaxAudience)
+				delete(*dest, id)
+			}
+		}
+	}
+	return nil
+}
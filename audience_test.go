@@ -0,0 +1,45 @@
+package profilefed
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestClientMaxAudience(t *testing.T) {
+	descs := map[string]*Descriptor{
+		"main":  {ID: "main", Username: "user"},
+		"adult": {ID: "adult", Username: "user", Audience: AudienceAdult},
+	}
+
+	mt := &MemoryTransport{}
+	mt.Register("example.test", newTenant(t, "example.test", descs["adult"], func(h *Handler) {
+		h.AllDescriptorsFunc = func(req *Request) (map[string]*Descriptor, error) {
+			return descs, nil
+		}
+	}))
+	mt.Register("invalid.test", newTenant(t, "invalid.test", &Descriptor{ID: "main", Audience: "everyone"}))
+
+	c := mt.Client()
+	c.MaxAudience = AudienceMature
+	if _, err := c.Lookup("user@example.test"); !errors.Is(err, ErrAudienceRestricted) {
+		t.Errorf("Expected ErrAudienceRestricted, got %v", err)
+	}
+
+	all, err := c.LookupAll("user@example.test")
+	if err != nil {
+		t.Fatalf("LookupAll error: %s", err)
+	}
+
+	if len(all) != 1 || all["main"] == nil {
+		t.Errorf("Expected only the general descriptor, got %#v", all)
+	}
+
+	c.MaxAudience = AudienceAdult
+	if _, err := c.Lookup("user@example.test"); err != nil {
+		t.Fatalf("Lookup error: %s", err)
+	}
+
+	if _, err := c.Lookup("user@invalid.test"); err == nil {
+		t.Error("Expected handler to refuse descriptor with unknown audience")
+	}
+}
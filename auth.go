@@ -0,0 +1,173 @@
+package profilefed
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrTokenRequired signifies that a bearer token is required to view a descriptor.
+	ErrTokenRequired = errors.New("bearer token required")
+	// ErrInvalidToken signifies that a bearer token was rejected by the token validator.
+	ErrInvalidToken = errors.New("invalid bearer token")
+)
+
+// TokenValidator validates bearer tokens presented to a [Handler].
+type TokenValidator interface {
+	// ValidateToken validates the given token and returns information about it.
+	// If the token is invalid or expired, it should return [ErrInvalidToken].
+	ValidateToken(ctx context.Context, token string) (*TokenInfo, error)
+}
+
+// TokenValidatorFunc is an adapter that allows the use of an ordinary
+// function as a [TokenValidator].
+type TokenValidatorFunc func(ctx context.Context, token string) (*TokenInfo, error)
+
+// ValidateToken implements the [TokenValidator] interface
+func (f TokenValidatorFunc) ValidateToken(ctx context.Context, token string) (*TokenInfo, error) {
+	return f(ctx, token)
+}
+
+// TokenInfo contains information about a validated bearer token.
+type TokenInfo struct {
+	// Subject is the subject the token was issued to.
+	Subject string
+	// ClientID is the ID of the application the token was issued to.
+	ClientID string
+	// Scopes contains the scopes granted to the token.
+	Scopes []string
+	// Expiry is the time at which the token expires.
+	Expiry time.Time
+}
+
+// HasScope reports whether the token was granted the given scope.
+func (ti *TokenInfo) HasScope(scope string) bool {
+	return slices.Contains(ti.Scopes, scope)
+}
+
+type tokenInfoKey struct{}
+
+// TokenFromContext returns the validated token info attached to
+// a request's context by [Handler], if any.
+func TokenFromContext(ctx context.Context) (*TokenInfo, bool) {
+	ti, ok := ctx.Value(tokenInfoKey{}).(*TokenInfo)
+	return ti, ok
+}
+
+// bearerToken extracts the bearer token from the request's Authorization header.
+func bearerToken(req *http.Request) string {
+	scheme, token, ok := strings.Cut(req.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// authenticate validates the request's bearer token if there is one, and
+// returns the request with the token info attached to its context.
+func (h Handler) authenticate(req *http.Request) (*http.Request, error) {
+	token := bearerToken(req)
+	if token == "" {
+		// A valid share token stands in for a bearer token
+		if _, ok := ShareGrantFromContext(req.Context()); ok {
+			return req, nil
+		}
+		if h.RequireToken != nil && h.RequireToken(req) {
+			return nil, ErrTokenRequired
+		}
+		return req, nil
+	}
+
+	if h.TokenValidator == nil {
+		// Without a validator, no token can be valid
+		if h.RequireToken != nil && h.RequireToken(req) {
+			return nil, ErrInvalidToken
+		}
+		return req, nil
+	}
+
+	ti, err := h.TokenValidator.ValidateToken(req.Context(), token)
+	if err != nil {
+		return nil, err
+	}
+
+	return req.WithContext(context.WithValue(req.Context(), tokenInfoKey{}, ti)), nil
+}
+
+// IntrospectionValidator is a [TokenValidator] that validates tokens using
+// an OAuth 2.0 token introspection endpoint, as defined by RFC 7662. Most
+// OIDC providers expose such an endpoint.
+type IntrospectionValidator struct {
+	// Endpoint is the URL of the introspection endpoint.
+	Endpoint string
+	// ClientID and ClientSecret are used to authenticate to the endpoint.
+	ClientID     string
+	ClientSecret string
+	// HTTPClient is the client used to make requests. If nil,
+	// [http.DefaultClient] is used.
+	HTTPClient *http.Client
+}
+
+// ValidateToken implements the [TokenValidator] interface
+func (iv IntrospectionValidator) ValidateToken(ctx context.Context, token string) (*TokenInfo, error) {
+	form := url.Values{"token": {token}, "token_type_hint": {"access_token"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, iv.Endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(iv.ClientID), url.QueryEscape(iv.ClientSecret))
+
+	client := iv.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if err := checkResp(res, "introspectToken"); err != nil {
+		return nil, err
+	}
+
+	var ir struct {
+		Active   bool   `json:"active"`
+		Scope    string `json:"scope"`
+		ClientID string `json:"client_id"`
+		Subject  string `json:"sub"`
+		Expiry   int64  `json:"exp"`
+	}
+	err = json.NewDecoder(io.LimitReader(res.Body, responseSizeLimit)).Decode(&ir)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ir.Active {
+		return nil, ErrInvalidToken
+	}
+
+	ti := &TokenInfo{
+		Subject:  ir.Subject,
+		ClientID: ir.ClientID,
+		Scopes:   strings.Fields(ir.Scope),
+	}
+	if ir.Expiry != 0 {
+		ti.Expiry = time.Unix(ir.Expiry, 0)
+		if time.Now().After(ti.Expiry) {
+			return nil, ErrInvalidToken
+		}
+	}
+
+	return ti, nil
+}
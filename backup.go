@@ -0,0 +1,269 @@
+package profilefed
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"io"
+	"slices"
+)
+
+const (
+	backupMagic = "PFDBAK1\n"
+
+	backupPlain     byte = 0
+	backupEncrypted byte = 1
+
+	backupSaltSize   = 16
+	backupIterations = 600_000
+)
+
+var (
+	// ErrInvalidBackup signifies that the data isn't a valid ProfileFed backup.
+	ErrInvalidBackup = errors.New("invalid backup archive")
+	// ErrPassphraseRequired signifies that a backup is encrypted but no passphrase was given.
+	ErrPassphraseRequired = errors.New("backup is encrypted, passphrase required")
+	// ErrWrongPassphrase signifies that a backup couldn't be decrypted with the given passphrase.
+	ErrWrongPassphrase = errors.New("wrong backup passphrase")
+)
+
+// ServerState contains all the state needed to move a ProfileFed server to a new host.
+type ServerState struct {
+	// ServerName is the name of the server when the backup was made.
+	ServerName string `json:"server_name"`
+	// PreviousNames contains the names the server used before ServerName.
+	PreviousNames []string `json:"previous_names,omitempty"`
+
+	// PrivateKey is the server's current private key. It's optional, since
+	// some operators prefer to move keys separately or generate new ones.
+	PrivateKey ed25519.PrivateKey `json:"private_key,omitempty"`
+	// PreviousKeys contains the server's previously-used private keys.
+	PreviousKeys []ed25519.PrivateKey `json:"previous_keys,omitempty"`
+
+	// Profiles maps resources to the descriptors served for them, keyed by descriptor ID.
+	// The privacy mode of every descriptor is kept in the archive, even though
+	// it isn't part of the descriptor's JSON.
+	Profiles map[string]map[string]*Descriptor `json:"profiles,omitempty"`
+
+	// KnownKeys contains the public keys this server has pinned for remote servers.
+	KnownKeys map[string]ed25519.PublicKey `json:"known_keys,omitempty"`
+}
+
+// serverStateFields has the same fields as [ServerState], but none of its
+// methods, so that it can be encoded without recursing into them.
+type serverStateFields ServerState
+
+// serverStateJSON is the encoded form of a [ServerState].
+type serverStateJSON struct {
+	serverStateFields
+	// ProfilePrivacy contains the privacy modes of the profiles that don't
+	// use [PrivacyDefault], keyed like Profiles, since they aren't encoded
+	// along with the descriptors.
+	ProfilePrivacy map[string]map[string]Privacy `json:"profile_privacy,omitempty"`
+}
+
+// MarshalJSON implements the [json.Marshaler] interface
+func (s ServerState) MarshalJSON() ([]byte, error) {
+	out := serverStateJSON{serverStateFields: serverStateFields(s)}
+	for resource, descs := range s.Profiles {
+		for id, desc := range descs {
+			if desc == nil || desc.Privacy == PrivacyDefault {
+				continue
+			}
+
+			if out.ProfilePrivacy == nil {
+				out.ProfilePrivacy = map[string]map[string]Privacy{}
+			}
+			if out.ProfilePrivacy[resource] == nil {
+				out.ProfilePrivacy[resource] = map[string]Privacy{}
+			}
+			out.ProfilePrivacy[resource][id] = desc.Privacy
+		}
+	}
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON implements the [json.Unmarshaler] interface
+func (s *ServerState) UnmarshalJSON(data []byte) error {
+	var in serverStateJSON
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+
+	*s = ServerState(in.serverStateFields)
+	for resource, ids := range in.ProfilePrivacy {
+		for id, privacy := range ids {
+			if desc := s.Profiles[resource][id]; desc != nil {
+				desc.Privacy = privacy
+			}
+		}
+	}
+	return nil
+}
+
+// WriteBackup writes the given server state to w as a single archive. If passphrase
+// is non-empty, the archive is encrypted with AES-256-GCM using a key derived from it.
+func WriteBackup(w io.Writer, state *ServerState, passphrase []byte) error {
+	buf := &bytes.Buffer{}
+	gw := gzip.NewWriter(buf)
+	err := json.NewEncoder(gw).Encode(state)
+	if err != nil {
+		return err
+	}
+
+	if err := gw.Close(); err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString(backupMagic)
+
+	if len(passphrase) == 0 {
+		bw.WriteByte(backupPlain)
+		bw.Write(buf.Bytes())
+		return bw.Flush()
+	}
+
+	salt := make([]byte, backupSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+
+	aead, err := backupCipher(passphrase, salt)
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	bw.WriteByte(backupEncrypted)
+	bw.Write(salt)
+	bw.Write(nonce)
+	// The header is authenticated along with the contents
+	bw.Write(aead.Seal(nil, nonce, buf.Bytes(), []byte(backupMagic)))
+	return bw.Flush()
+}
+
+// ReadBackup reads a server state archive written by [WriteBackup].
+// If the archive is encrypted, passphrase is used to decrypt it. If a
+// passphrase is given, unencrypted archives are rejected with
+// [ErrInvalidBackup], so that an archive can't be swapped for a forged
+// unencrypted one without being noticed.
+func ReadBackup(r io.Reader, passphrase []byte) (*ServerState, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	rest, ok := bytes.CutPrefix(data, []byte(backupMagic))
+	if !ok || len(rest) == 0 {
+		return nil, ErrInvalidBackup
+	}
+
+	mode, rest := rest[0], rest[1:]
+	switch mode {
+	case backupPlain:
+		if len(passphrase) > 0 {
+			return nil, ErrInvalidBackup
+		}
+	case backupEncrypted:
+		if len(passphrase) == 0 {
+			return nil, ErrPassphraseRequired
+		}
+
+		if len(rest) < backupSaltSize {
+			return nil, ErrInvalidBackup
+		}
+		salt, rest2 := rest[:backupSaltSize], rest[backupSaltSize:]
+
+		aead, err := backupCipher(passphrase, salt)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(rest2) < aead.NonceSize() {
+			return nil, ErrInvalidBackup
+		}
+		nonce, ciphertext := rest2[:aead.NonceSize()], rest2[aead.NonceSize():]
+
+		rest, err = aead.Open(nil, nonce, ciphertext, []byte(backupMagic))
+		if err != nil {
+			return nil, ErrWrongPassphrase
+		}
+	default:
+		return nil, ErrInvalidBackup
+	}
+
+	gr, err := gzip.NewReader(bytes.NewReader(rest))
+	if err != nil {
+		return nil, err
+	}
+
+	state := &ServerState{}
+	err = json.NewDecoder(gr).Decode(state)
+	if err != nil {
+		return nil, err
+	}
+
+	return state, nil
+}
+
+// RestoreTo returns a copy of the state adjusted for a server that's been moved
+// to newName, and which will sign its responses with newKey. If the name or key
+// changed, the old ones are added to PreviousNames and PreviousKeys, so that
+// clients that pinned the old server can verify the move. If newKey is nil,
+// the existing private key is kept.
+func (s *ServerState) RestoreTo(newName string, newKey ed25519.PrivateKey) *ServerState {
+	out := *s
+	out.PreviousNames = slices.Clone(s.PreviousNames)
+	out.PreviousKeys = slices.Clone(s.PreviousKeys)
+
+	if newName != "" && newName != s.ServerName {
+		if !slices.Contains(out.PreviousNames, s.ServerName) {
+			out.PreviousNames = append(out.PreviousNames, s.ServerName)
+		}
+		out.ServerName = newName
+	}
+
+	if newKey != nil && !newKey.Equal(s.PrivateKey) {
+		if s.PrivateKey != nil {
+			out.PreviousKeys = append(out.PreviousKeys, s.PrivateKey)
+		}
+		out.PrivateKey = newKey
+	}
+
+	return &out
+}
+
+// ServerInfoHandler returns a server info handler configured using the state.
+func (s *ServerState) ServerInfoHandler() ServerInfoHandler {
+	sih := ServerInfoHandler{
+		ServerName:    s.ServerName,
+		PreviousNames: s.PreviousNames,
+		PrivateKey:    s.PrivateKey,
+		PreviousKeys:  s.PreviousKeys,
+	}
+	if s.PrivateKey != nil {
+		sih.PublicKey = s.PrivateKey.Public().(ed25519.PublicKey)
+	}
+	return sih
+}
+
+// backupCipher derives an AES-256-GCM cipher from the passphrase and salt.
+func backupCipher(passphrase, salt []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(pbkdf2Key(sha256.New, passphrase, salt, backupIterations, 32))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
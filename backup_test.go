@@ -0,0 +1,86 @@
+package profilefed
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestPBKDF2(t *testing.T) {
+	key := pbkdf2Key(sha256.New, []byte("password"), []byte("salt"), 2, 32)
+	expected := "ae4d0c95af6b46d32d0adff928f06dd02a303f8ef3c251dfd6e2d85a95474c43"
+	if hex.EncodeToString(key) != expected {
+		t.Errorf("Unexpected key: %x", key)
+	}
+}
+
+func TestBackup(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey error: %s", err)
+	}
+
+	state := &ServerState{
+		ServerName: "old.example.com",
+		PrivateKey: priv,
+		Profiles: map[string]map[string]*Descriptor{
+			"acct:user@old.example.com": {
+				"main": {ID: "main", Username: "user", Role: RoleUser},
+				"alt":  {ID: "alt", Username: "user", Bio: "Private", Privacy: PrivacyMinimal},
+			},
+		},
+		KnownKeys: map[string]ed25519.PublicKey{
+			"remote.example.com": priv.Public().(ed25519.PublicKey),
+		},
+	}
+
+	buf := &bytes.Buffer{}
+	err = WriteBackup(buf, state, []byte("hunter2"))
+	if err != nil {
+		t.Fatalf("WriteBackup error: %s", err)
+	}
+
+	_, err = ReadBackup(bytes.NewReader(buf.Bytes()), []byte("wrong"))
+	if !errors.Is(err, ErrWrongPassphrase) {
+		t.Fatalf("Expected ErrWrongPassphrase, got %v", err)
+	}
+
+	restored, err := ReadBackup(bytes.NewReader(buf.Bytes()), []byte("hunter2"))
+	if err != nil {
+		t.Fatalf("ReadBackup error: %s", err)
+	}
+
+	if !reflect.DeepEqual(state, restored) {
+		t.Errorf("States are not equal:\n%#v\n\n%#v", state, restored)
+	}
+
+	// An unencrypted archive must not be accepted in place of an encrypted one
+	plain := &bytes.Buffer{}
+	if err := WriteBackup(plain, state, nil); err != nil {
+		t.Fatalf("WriteBackup error: %s", err)
+	}
+	if _, err := ReadBackup(bytes.NewReader(plain.Bytes()), []byte("hunter2")); !errors.Is(err, ErrInvalidBackup) {
+		t.Errorf("Expected ErrInvalidBackup for unencrypted archive, got %v", err)
+	}
+	if _, err := ReadBackup(bytes.NewReader(plain.Bytes()), nil); err != nil {
+		t.Errorf("ReadBackup error for unencrypted archive: %s", err)
+	}
+
+	_, newPriv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey error: %s", err)
+	}
+
+	moved := restored.RestoreTo("new.example.com", newPriv)
+	if moved.ServerName != "new.example.com" || !reflect.DeepEqual(moved.PreviousNames, []string{"old.example.com"}) {
+		t.Errorf("Unexpected names: %q, %q", moved.ServerName, moved.PreviousNames)
+	}
+
+	if len(moved.PreviousKeys) != 1 || !moved.PreviousKeys[0].Equal(priv) {
+		t.Errorf("Old key was not added to previous keys")
+	}
+}
@@ -0,0 +1,131 @@
+package profilefed
+
+import (
+	"bytes"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrCacheMiss should be returned by [DescriptorCache.Get] when no entry
+	// exists for the given key.
+	ErrCacheMiss = errors.New("cache miss")
+
+	// errNotModified is returned by fetchDescriptor when the server
+	// confirms that a cached response is still current.
+	errNotModified = errors.New("descriptor not modified")
+)
+
+// DescriptorCache stores verified descriptor responses so that
+// they can be reused by later lookups.
+//
+// Cached entries are always re-verified against the server's pinned
+// public key before they're used, so implementations don't have to
+// be trusted to preserve the integrity of the data. Once an entry is
+// older than [Client.CacheMaxAge], the client revalidates it by sending
+// its ETag in an If-None-Match header, and keeps using it if the server
+// responds with 304 Not Modified.
+//
+// Entries are keyed by the URL they were fetched from, since the content of
+// a response isn't known until it's fetched, so the same profile fetched via
+// different aliases is stored under several keys. Every entry records its
+// ContentHash, so that implementations can store identical responses only once.
+// Responses fetched with a bearer token from [Client.TokenFunc] are keyed by
+// the URL with a fragment containing a hash of the token, so that they're
+// never served to clients that use a different token or none at all.
+type DescriptorCache interface {
+	// Get returns the entry stored under key. If there is no
+	// such entry, Get should return [ErrCacheMiss].
+	Get(key string) (*CacheEntry, error)
+	// Put stores entry under key, replacing any existing entry.
+	Put(key string, entry *CacheEntry) error
+}
+
+// CacheEntry represents a cached descriptor response.
+type CacheEntry struct {
+	// Data is the raw response body.
+	Data []byte `json:"data"`
+	// Signature is the server signature of Data.
+	Signature []byte `json:"sig"`
+	// SignedData is the data covered by Signature if the response was signed
+	// using an HTTP message signature, which is the signature base. It's empty
+	// if Signature covers Data directly.
+	SignedData []byte `json:"signed_data,omitempty"`
+	// ETag is the entity tag returned by the server, if any.
+	ETag string `json:"etag,omitempty"`
+	// Envelope is the signed timestamp returned by the server, if any.
+	Envelope string `json:"envelope,omitempty"`
+	// KeyCertificate is the certificate of the key that signed the response,
+	// if it wasn't signed by the server's identity key.
+	KeyCertificate string `json:"key_cert,omitempty"`
+	// FetchedAt is the time at which the response was fetched.
+	FetchedAt time.Time `json:"fetched_at"`
+	// ContentHash is the canonical content hash of the response.
+	// See [ContentHash] for details.
+	ContentHash string `json:"content_hash,omitempty"`
+}
+
+// getCached returns the cached entry for key if its signature still matches
+// pubkey, and whether it's fresh. Stale entries can be revalidated using their
+// ETag. If there's no usable entry, it returns nil.
+func (c Client) getCached(key string, pubkey []byte) (entry *CacheEntry, fresh bool) {
+	if c.Cache == nil {
+		return nil, false
+	}
+
+	entry, err := c.Cache.Get(key)
+	if err != nil {
+		return nil, false
+	}
+
+	// Entries whose key certificate has expired have to be fetched again
+	signingKey, err := certifiedKey(pubkey, entry.KeyCertificate)
+	if err != nil || !verify(signingKey, entry.signedData(), entry.Signature) {
+		return nil, false
+	}
+
+	// A signature base only covers the data via its digest
+	if entry.SignedData != nil && !httpSigBody(entry.SignedData, entry.Data) {
+		return nil, false
+	}
+
+	// Entries whose signed timestamp has expired have to be revalidated
+	fresh = time.Since(entry.FetchedAt) <= c.CacheMaxAge && c.checkEnvelope("", signingKey, entry.Data, entry.Envelope, time.Time{}) == nil
+	return entry, fresh
+}
+
+// putCached stores a verified response in the cache, if there is one.
+// Cache errors are ignored since caching is best-effort.
+func (c Client) putCached(key string, fr *fetchResult) {
+	if c.Cache == nil {
+		return
+	}
+
+	_ = c.Cache.Put(key, &CacheEntry{
+		Data:           fr.data,
+		Signature:      fr.sig,
+		SignedData:     signedData(fr.data, fr.signed),
+		ETag:           fr.etag,
+		Envelope:       fr.envelope,
+		KeyCertificate: fr.keyCert,
+		FetchedAt:      fr.fetchedAt,
+		ContentHash:    fr.contentHash,
+	})
+}
+
+// signedData returns the data covered by the entry's signature.
+func (e *CacheEntry) signedData() []byte {
+	if e.SignedData != nil {
+		return e.SignedData
+	}
+	return e.Data
+}
+
+// signedData returns signed if it differs from data, and nil otherwise,
+// so that signatures that cover the data directly don't store it twice.
+func signedData(data, signed []byte) []byte {
+	if bytes.Equal(data, signed) {
+		return nil
+	}
+	return signed
+}
@@ -0,0 +1,109 @@
+package profilefed
+
+import (
+	"crypto"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// capabilityPrefix is prepended to capability payloads before they're signed,
+// so that their signatures can't be mistaken for signatures of responses.
+const capabilityPrefix = "profilefed-capability:"
+
+var (
+	// ErrInvalidCapability signifies that a capability token is malformed, isn't
+	// meant for the verifying server, or doesn't match its issuer's key.
+	ErrInvalidCapability = errors.New("invalid capability token")
+	// ErrCapabilityExpired signifies that a capability token has expired.
+	ErrCapabilityExpired = errors.New("capability token expired")
+)
+
+// Capability contains the claims of a capability token. A subscriber mints a
+// capability token to authorize a publisher to deliver updates to its callback
+// URL, and the publisher verifies it using [Client.VerifyCapability] before
+// delivering anything.
+type Capability struct {
+	// Issuer is the server name of the subscriber that minted the token.
+	Issuer string `json:"iss"`
+	// Audience is the server name of the publisher the token is meant for.
+	Audience string `json:"aud"`
+	// Callback is the URL that updates may be delivered to. Its host must be the issuer.
+	Callback string `json:"callback"`
+	// Resource, if set, limits the token to updates about the given resource.
+	Resource string `json:"resource,omitempty"`
+	// Expiry is the time at which the token expires.
+	Expiry time.Time `json:"exp"`
+}
+
+// NewCapabilityToken mints a capability token containing the given claims,
+// signed using the subscriber's server key. If the server uses a [KeyRotator],
+// signer should hold its current key, since publishers only accept tokens signed
+// by the key they've pinned for the issuer or by a key it has rotated to.
+func NewCapabilityToken(signer crypto.Signer, capability Capability) (string, error) {
+	capability.Expiry = capability.Expiry.UTC()
+	payload, err := json.Marshal(capability)
+	if err != nil {
+		return "", err
+	}
+
+	sig, err := sign(signer, append([]byte(capabilityPrefix), payload...))
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// VerifyCapability verifies a capability token presented to the publisher named
+// audience. The token is verified using the key pinned for its issuer, which is
+// trusted on first use if the issuer hasn't been contacted before. If the issuer
+// has rotated its key since, the rotation is verified and accepted the same way
+// as during lookups, so tokens minted with the new key keep working.
+func (c Client) VerifyCapability(token, audience string) (*Capability, error) {
+	payloadStr, sigStr, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrInvalidCapability
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(payloadStr)
+	if err != nil {
+		return nil, ErrInvalidCapability
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(sigStr)
+	if err != nil {
+		return nil, ErrInvalidCapability
+	}
+
+	var capability Capability
+	if err := json.Unmarshal(payload, &capability); err != nil {
+		return nil, ErrInvalidCapability
+	}
+
+	if capability.Audience != audience {
+		return nil, ErrInvalidCapability
+	}
+
+	if time.Now().After(capability.Expiry) {
+		return nil, ErrCapabilityExpired
+	}
+
+	// Issuers can only authorize deliveries to themselves, so that
+	// tokens can't be used to direct updates at other servers.
+	callback, err := url.Parse(capability.Callback)
+	if err != nil || callback.Host != capability.Issuer || (callback.Scheme != "https" && callback.Scheme != "http") {
+		return nil, ErrInvalidCapability
+	}
+
+	err = c.verifyServerSignature(callback.Scheme, callback.Host, append([]byte(capabilityPrefix), payload...), sig)
+	if errors.Is(err, ErrSignatureMismatch) {
+		return nil, ErrInvalidCapability
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &capability, nil
+}
@@ -0,0 +1,86 @@
+package profilefed
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestVerifyCapability(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey error: %s", err)
+	}
+
+	kr, err := LoadKeyRotator(filepath.Join(t.TempDir(), "keys.json"), priv)
+	if err != nil {
+		t.Fatalf("LoadKeyRotator error: %s", err)
+	}
+
+	mt := &MemoryTransport{}
+	mt.Register("subscriber.test", ServerInfoHandler{ServerName: "subscriber.test", Rotator: kr})
+	c := mt.Client()
+
+	capability := Capability{
+		Issuer:   "subscriber.test",
+		Audience: "publisher.test",
+		Callback: "http://subscriber.test/callback",
+		Expiry:   time.Now().Add(time.Hour),
+	}
+
+	token, err := NewCapabilityToken(kr.PrivateKey(), capability)
+	if err != nil {
+		t.Fatalf("NewCapabilityToken error: %s", err)
+	}
+
+	got, err := c.VerifyCapability(token, "publisher.test")
+	if err != nil {
+		t.Fatalf("VerifyCapability error: %s", err)
+	}
+
+	if got.Callback != capability.Callback {
+		t.Errorf("Unexpected callback: %q", got.Callback)
+	}
+
+	if _, err = c.VerifyCapability(token, "other.test"); !errors.Is(err, ErrInvalidCapability) {
+		t.Errorf("Expected ErrInvalidCapability for wrong audience, got %v", err)
+	}
+
+	// Tokens minted with a rotated key are accepted once the rotation is verified
+	if _, err := kr.Rotate(); err != nil {
+		t.Fatalf("Rotate error: %s", err)
+	}
+
+	token, err = NewCapabilityToken(kr.PrivateKey(), capability)
+	if err != nil {
+		t.Fatalf("NewCapabilityToken error: %s", err)
+	}
+
+	if _, err = c.VerifyCapability(token, "publisher.test"); err != nil {
+		t.Fatalf("VerifyCapability error after rotation: %s", err)
+	}
+
+	// Issuers can't authorize deliveries to other hosts
+	capability.Callback = "http://victim.test/callback"
+	token, err = NewCapabilityToken(kr.PrivateKey(), capability)
+	if err != nil {
+		t.Fatalf("NewCapabilityToken error: %s", err)
+	}
+
+	if _, err = c.VerifyCapability(token, "publisher.test"); !errors.Is(err, ErrInvalidCapability) {
+		t.Errorf("Expected ErrInvalidCapability for foreign callback, got %v", err)
+	}
+
+	capability.Callback = "http://subscriber.test/callback"
+	capability.Expiry = time.Now().Add(-time.Minute)
+	token, err = NewCapabilityToken(kr.PrivateKey(), capability)
+	if err != nil {
+		t.Fatalf("NewCapabilityToken error: %s", err)
+	}
+
+	if _, err = c.VerifyCapability(token, "publisher.test"); !errors.Is(err, ErrCapabilityExpired) {
+		t.Errorf("Expected ErrCapabilityExpired, got %v", err)
+	}
+}
@@ -2,15 +2,21 @@ package profilefed
 
 import (
 	"bytes"
+	"cmp"
 	"crypto/ed25519"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"slices"
+	"strings"
 	"sync"
+	"time"
 
 	"queerdevs.org/profilefed/webfinger"
 )
@@ -24,32 +30,28 @@ var (
 	ErrNoSignature = errors.New("response contains no signature")
 	// ErrSignatureMismatch signifies that the message does not match the server signature.
 	ErrSignatureMismatch = errors.New("message does not match server signature")
+	// ErrHostQuarantined signifies that a server has been quarantined and its responses are rejected.
+	ErrHostQuarantined = errors.New("server is quarantined")
+	// ErrAliasNotConfirmed signifies that a server claimed to be an alternate name
+	// of another server, but the other server didn't confirm the claim.
+	ErrAliasNotConfirmed = errors.New("alternate name not confirmed by primary server")
+	// ErrKeyNotConfirmed signifies that the key of a server contacted for the
+	// first time was rejected by [Client.ConfirmNewKey].
+	ErrKeyNotConfirmed = errors.New("new server key not confirmed")
 )
 
 // DefaultClient returns a default client for ProfileFed.
 //
-// It uses an in-memory synchronized map to store public keys.
-// For production, it's highly recommended to implement a custom
-// client that persists the keys to a database or similar, so that
-// restarting your app doesn't provide opportunities for malicious servers.
+// It uses a [MemoryKeyStore] to store public keys.
+// For production, it's highly recommended to persist the keys,
+// for example using the pfdstore package with [Client.WithKeyStore],
+// so that restarting your app doesn't provide opportunities for
+// malicious servers.
+//
+// It requires descriptors to have a signed timestamp that's at most
+// [DefaultMaxDescriptorAge] old, which every [Handler] sends.
 func DefaultClient() Client {
-	defaultMap := sync.Map{}
-	return Client{
-		SavePubkey: func(serverName string, previousNames []string, pubkey ed25519.PublicKey) error {
-			defaultMap.Store(serverName, pubkey)
-			for _, name := range previousNames {
-				defaultMap.Delete(name)
-			}
-			return nil
-		},
-		GetPubkey: func(serverName string) (ed25519.PublicKey, error) {
-			pubkey, ok := defaultMap.Load(serverName)
-			if !ok {
-				return nil, ErrPubkeyNotFound
-			}
-			return pubkey.(ed25519.PublicKey), nil
-		},
-	}
+	return Client{Group: &LookupGroup{}, MaxDescriptorAge: DefaultMaxDescriptorAge}.WithKeyStore(&MemoryKeyStore{})
 }
 
 // Client represents a ProfileFed client
@@ -60,229 +62,957 @@ type Client struct {
 	// GetPubkey retrieves the public key for a given server.
 	// If the key isn't found, GetPubkey should return [ErrPubkeyNotFound]
 	GetPubkey func(serverName string) (ed25519.PublicKey, error)
+
+	// ConfirmNewKey, if set, is called with the [Fingerprint] of a server's key
+	// before it's trusted on first use, so that users or policies can decide
+	// whether to trust it. If it returns false, the key isn't saved and the
+	// lookup fails with [ErrKeyNotConfirmed]. It isn't called for keys of
+	// renamed servers that were verified using the key pinned for their
+	// previous name.
+	ConfirmNewKey func(serverName string, fingerprint string) (bool, error)
+
+	// OnKeyChange, if set, is called whenever a server's pinned key is about to
+	// be replaced, either because the server rotated its key or because it was
+	// renamed and uses a different key under its new name. It receives the old
+	// and new keys and the evidence used to accept the change. If it returns an
+	// error, the new key isn't saved and the lookup fails with that error, so
+	// it can be used to require manual review of key changes.
+	OnKeyChange func(change KeyChange) error
+
+	// SetQuarantined persists whether the given server is quarantined.
+	// See [Client.QuarantineHost].
+	SetQuarantined func(serverName string, quarantined bool) error
+	// IsQuarantined reports whether the given server is quarantined.
+	// If it's nil, no server is ever considered quarantined.
+	IsQuarantined func(serverName string) (bool, error)
+
+	// SaveAlias records that alias is an alternate name of the given server,
+	// so that both names share a single pinned key.
+	SaveAlias func(alias, serverName string) error
+	// GetAlias returns the name of the server that alias is an alternate name
+	// of, or an empty string if it isn't one. If GetAlias or SaveAlias is nil,
+	// alternate names are treated as separate servers.
+	GetAlias func(alias string) (string, error)
+
+	// MarkVerified, if set, records that a response from the given server
+	// was verified using its pinned key at the given time, so that it can
+	// be reported by [Client.GetKeyInfo].
+	MarkVerified func(serverName string, at time.Time) error
+
+	// SaveEndpoint, if set, records that the descriptor endpoint at oldURL
+	// has permanently moved to newURL, after the client has verified a
+	// signed redirect. The URLs don't include the query parameters
+	// the client adds for lookups, such as id.
+	SaveEndpoint func(oldURL, newURL string) error
+	// GetEndpoint returns the URL that the descriptor endpoint at u has moved
+	// to, or an empty string if it hasn't moved. If it's nil, moved endpoints
+	// are only known once the old endpoint has redirected the client.
+	GetEndpoint func(u string) (string, error)
+
+	// Group, if set, coalesces concurrent identical lookups so that
+	// they share a single network round trip and verification.
+	Group *LookupGroup
+
+	// Cache, if set, stores verified descriptor responses so that
+	// repeated lookups don't have to hit the network.
+	Cache DescriptorCache
+	// CacheMaxAge is the maximum age of a cached response before
+	// it's revalidated with the server. See [DescriptorCache].
+	CacheMaxAge time.Duration
+
+	// TokenFunc, if set, returns a bearer token to attach to descriptor requests
+	// sent to the given host. If it returns an empty string, no token is sent.
+	// It's also used to keep the responses for different tokens apart in the
+	// lookup group and cache, so it may be called more than once per lookup.
+	TokenFunc func(host string) (string, error)
+
+	// HTTPClient is the client used to make all requests. If nil,
+	// [http.DefaultClient] is used.
+	HTTPClient *http.Client
+	// UserAgent is the User-Agent header sent with every request that
+	// doesn't set one. If empty, [DefaultUserAgent] is used.
+	UserAgent string
+	// Policy, if set, configures security requirements such as
+	// HTTPS-only connections for all requests made by the client.
+	Policy *TransportPolicy
+	// AllowHost, if set, enables allowlist mode for closed federations.
+	// Every request to a host for which it returns false, including
+	// WebFinger lookups and redirects, fails with a [HostNotAllowedError]
+	// before a connection is made. See [AllowHosts] and [HostAllowlist].
+	AllowHost func(host string) bool
+
+	// OptimisticFetch makes the client request the server info and the descriptor
+	// concurrently when contacting a server for the first time, which saves a round
+	// trip. The descriptor is still only accepted once the server info is verified.
+	OptimisticFetch bool
+
+	// KeyCache, if set, caches decoded public keys and their fingerprints
+	// in memory, in front of GetPubkey and SavePubkey.
+	KeyCache *KeyCache
+
+	// Events, if set, receives key lifecycle events, such as when a server
+	// is trusted for the first time or rotates its key.
+	Events KeyEventSink
+
+	// Pins, if set, detects changes to critical descriptor fields, such as
+	// the display name, that aren't signed by the profile's owner.
+	Pins *DescriptorPins
+
+	// Metrics, if set, receives the outcome of every verification step,
+	// including the reasons verification failed.
+	Metrics MetricsSink
+
+	// MaxClockSkew is the maximum difference tolerated between the local clock
+	// and the clock of a server. The signed timestamps of responses are accepted
+	// if they're off by up to this much. Responses that were signed in the future,
+	// or whose Date header agrees with their signed timestamp but not with the
+	// local clock, are rejected with a [ClockSkewError]. If zero, clock skew
+	// isn't tolerated or diagnosed.
+	MaxClockSkew time.Duration
+
+	// MaxDescriptorAge is the maximum age of the signed timestamp of a
+	// descriptor. If it's set, descriptors without a signed timestamp or
+	// with one that's older are rejected with [ErrStaleDescriptor], which
+	// limits how long an attacker can replay an old descriptor. Descriptors
+	// whose signed timestamp has expired are always rejected. Without it,
+	// an attacker replaying a descriptor can strip its signed timestamp, so
+	// only clients that talk to servers which don't send one should leave it
+	// unset. [DefaultClient] sets it to [DefaultMaxDescriptorAge].
+	MaxDescriptorAge time.Duration
+
+	// MinCosigners, if set, requires server infos to declare a co-signing
+	// policy with at least this many required co-signatures, and to meet it.
+	// Server infos that declare a policy always have to meet it, but without
+	// MinCosigners, a server could drop its policy when its key changes.
+	MinCosigners int
+
+	// MaxAudience, if set, is the most restricted audience rating of descriptors
+	// returned by lookups. Looking up a descriptor with a more restricted rating
+	// fails with [ErrAudienceRestricted], and such descriptors are left out of
+	// lookups that return several. Unknown ratings are treated as more
+	// restricted than [AudienceAdult].
+	MaxAudience Audience
+
+	// Trace, if set, is called with a description of every verification
+	// step the client takes. See [Client.WithTrace].
+	Trace func(msg string)
+
+	// keyStore is the keystore set using [Client.WithKeyStore],
+	// which is used to list and manage pinned keys.
+	keyStore KeyStore
+}
+
+// webfinger returns the WebFinger client used for lookups.
+func (c Client) webfinger() webfinger.Client {
+	wf := webfinger.Client{HTTPClient: c.httpClient()}
+	if c.Policy != nil && c.Policy.RequireHTTPS {
+		wf.Scheme = "https"
+	}
+	return wf
 }
 
 // Lookup looks up the profile descriptor for the given resource.
 func (c Client) Lookup(resource string) (*Descriptor, error) {
-	wfdesc, err := webfinger.LookupAcct(resource)
+	wfdesc, err := c.webfinger().LookupAcct(resource)
 	if err != nil {
 		return nil, err
 	}
 
 	out := &Descriptor{}
-	return out, c.lookup(wfdesc, "", false, out)
+	_, err = c.lookup(wfdesc, lookupParams{}, out)
+	return out, err
 }
 
 // LookupID looks up the profile descriptor that matches the given ID
 // for the given resource.
 func (c Client) LookupID(resource, id string) (*Descriptor, error) {
-	wfdesc, err := webfinger.LookupAcct(resource)
+	wfdesc, err := c.webfinger().LookupAcct(resource)
 	if err != nil {
 		return nil, err
 	}
 
 	out := &Descriptor{}
-	return out, c.lookup(wfdesc, id, false, out)
+	_, err = c.lookup(wfdesc, lookupParams{id: id}, out)
+	return out, err
 }
 
 // Lookup looks up all the available profile descriptors for the given resource.
 func (c Client) LookupAll(resource string) (map[string]*Descriptor, error) {
-	wfdesc, err := webfinger.LookupAcct(resource)
+	wfdesc, err := c.webfinger().LookupAcct(resource)
 	if err != nil {
 		return nil, err
 	}
 
 	out := map[string]*Descriptor{}
-	return out, c.lookup(wfdesc, "", true, &out)
+	_, err = c.lookup(wfdesc, lookupParams{all: true}, &out)
+	return out, err
+}
+
+// LookupResource is the same as [Client.Lookup], but it accepts any WebFinger
+// resource rather than just acct handles. Supported resources are acct handles,
+// http(s) URLs, mailto URIs, and did:web DIDs. The server used for the WebFinger
+// lookup is inferred from the resource.
+func (c Client) LookupResource(resource string) (*Descriptor, error) {
+	scheme, _, ok := strings.Cut(resource, ":")
+	if !ok || strings.Contains(scheme, "@") {
+		// Bare handles like user@example.com are treated as acct resources
+		resource = "acct:" + resource
+	}
+
+	server, err := resourceServer(resource)
+	if err != nil {
+		return nil, err
+	}
+
+	wfdesc, err := c.webfinger().Lookup(resource, server)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &Descriptor{}
+	_, err = c.lookup(wfdesc, lookupParams{}, out)
+	return out, err
+}
+
+// resourceServer returns the server that should be queried
+// for the given WebFinger resource.
+func resourceServer(resource string) (string, error) {
+	scheme, rest, _ := strings.Cut(resource, ":")
+	switch strings.ToLower(scheme) {
+	case "acct", "mailto":
+		i := strings.LastIndex(rest, "@")
+		if i < 0 || i == len(rest)-1 {
+			return "", fmt.Errorf("invalid %s resource: %q", scheme, resource)
+		}
+		return normalizeHost(rest[i+1:]), nil
+	case "http", "https":
+		u, err := url.Parse(resource)
+		if err != nil {
+			return "", err
+		}
+		if u.Host == "" {
+			return "", fmt.Errorf("invalid url resource: %q", resource)
+		}
+		return normalizeHost(u.Host), nil
+	case "did":
+		docURL, err := DIDWebURL(resource)
+		if err != nil {
+			return "", err
+		}
+		u, err := url.Parse(docURL)
+		if err != nil {
+			return "", err
+		}
+		return u.Host, nil
+	default:
+		return "", fmt.Errorf("unsupported resource scheme: %q", scheme)
+	}
 }
 
 // LookupWebFinger is the same as [Client.Lookup], but it accepts an existing WebFinger
 // descriptor rather than looking one up.
 func (c Client) LookupWebFinger(wfdesc *webfinger.Descriptor) (*Descriptor, error) {
 	out := &Descriptor{}
-	return out, c.lookup(wfdesc, "", false, out)
+	_, err := c.lookup(wfdesc, lookupParams{}, out)
+	return out, err
 }
 
 // LookupWebFingerID is the same as [Client.LookupID], but it accepts an existing WebFinger
 // descriptor rather than looking one up.
 func (c Client) LookupWebFingerID(wfdesc *webfinger.Descriptor, id string) (*Descriptor, error) {
 	out := &Descriptor{}
-	return out, c.lookup(wfdesc, id, false, out)
+	_, err := c.lookup(wfdesc, lookupParams{id: id}, out)
+	return out, err
 }
 
 // LookupAllWebFinger is the same as [Client.LookupAll], but it accepts an existing WebFinger
 // descriptor rather than looking one up.
 func (c Client) LookupAllWebFinger(wfdesc *webfinger.Descriptor) (map[string]*Descriptor, error) {
 	out := map[string]*Descriptor{}
-	return out, c.lookup(wfdesc, "", true, &out)
+	_, err := c.lookup(wfdesc, lookupParams{all: true}, &out)
+	return out, err
 }
 
-func (c Client) lookup(wfdesc *webfinger.Descriptor, id string, all bool, dest any) error {
+func (c Client) lookup(wfdesc *webfinger.Descriptor, params lookupParams, dest any) (*Provenance, error) {
 	pfdLink, ok := wfdesc.LinkByType("application/x-pfd+json")
 	if !ok {
-		return errors.New("server does not support the profilefed protocol")
+		return nil, errors.New("server does not support the profilefed protocol")
 	}
 
 	pfdURL, err := url.Parse(pfdLink.Href)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	pfdURL.Host = normalizeHost(pfdURL.Host)
 
-	pubkeySaved := false
-	pubkey, err := c.GetPubkey(pfdURL.Host)
-	if errors.Is(err, ErrPubkeyNotFound) {
-		data, sig, prevSigs, err := getServerInfo(pfdURL.Scheme, pfdURL.Host)
-		if err != nil {
-			return err
+	pfdURL, err = c.movedEndpoint(pfdURL)
+	if err != nil {
+		return nil, err
+	}
+
+	// The resource's host is only needed for policy checks, so
+	// descriptors without a valid subject are only rejected there.
+	resourceHost, _ := resourceServer(wfdesc.Subject)
+
+	var fr *fetchResult
+	for redirects := 0; ; redirects++ {
+		pfdURL.Host = normalizeHost(pfdURL.Host)
+		if err := c.checkSite(resourceHost, pfdURL); err != nil {
+			return nil, err
 		}
 
-		var info serverInfoData
-		err = json.Unmarshal(data, &info)
+		// Responses to requests with a bearer token must
+		// never be shared with requests without it.
+		params.tokenHash, err = c.tokenHash(pfdURL.Host)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
-		// If this server is advertising previous names, make sure
-		// we verify that it's telling the truth by checking the whether
-		// any of its signatures match using the pubkeys of the previous names.
-		if len(info.PreviousNames) > 0 {
-			for _, prevName := range info.PreviousNames {
-				pubkey, err = c.GetPubkey(prevName)
-				if errors.Is(err, ErrPubkeyNotFound) {
-					continue
-				} else if err != nil {
-					return err
-				}
-
-				if ed25519.Verify(pubkey, data, sig) {
-					break
-				}
-
-				for _, prevSig := range prevSigs {
-					if ed25519.Verify(pubkey, data, prevSig) {
-						break
-					}
-				}
-
-				// If we haven't broken out of the loop by now, this
-				// name could not be verified, so return an error.
-				return ErrSignatureMismatch
-			}
+		if c.Group != nil {
+			key := lookupKey{host: pfdURL.Host, resource: pfdURL.String(), params: params}
+			fr, err = c.Group.do(key, func() (*fetchResult, error) {
+				return c.fetch(pfdURL, params)
+			})
+		} else {
+			fr, err = c.fetch(pfdURL, params)
+		}
+
+		var moved *movedError
+		if !errors.As(err, &moved) {
+			break
+		}
+
+		if redirects == maxRedirects {
+			return nil, ErrTooManyRedirects
 		}
+		pfdURL = moved.location
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(fr.data, dest)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.filterAudience(pfdURL.Host, dest); err != nil {
+		return nil, err
+	}
 
-		pubkey, err = base64.StdEncoding.DecodeString(info.PublicKey)
+	// Partial views of a descriptor can't be compared to the pinned version
+	if params.fields == "" && params.share == "" {
+		err = c.checkPins(cmp.Or(wfdesc.Subject, pfdLink.Href), pfdURL.Host, dest)
 		if err != nil {
-			return err
+			return nil, err
 		}
+	}
+	c.checkDeprecated(cmp.Or(wfdesc.Subject, pfdLink.Href), pfdURL.Host, dest)
+
+	return &Provenance{
+		Resource:    wfdesc.Subject,
+		Host:        pfdURL.Host,
+		URL:         fr.url,
+		FetchedAt:   fr.fetchedAt,
+		FromCache:   fr.cached,
+		ContentHash: fr.contentHash,
+	}, nil
+}
+
+// lookupParams contains the query parameters of a descriptor request.
+type lookupParams struct {
+	id     string
+	all    bool
+	fields string // comma-separated
+	share  string
+	// tokenHash is the hash of the bearer token attached to the
+	// request by the client's TokenFunc, or empty if there isn't one.
+	tokenHash string
+}
+
+// fetchResult contains a verified descriptor response.
+type fetchResult struct {
+	url         string
+	data        []byte
+	sig         []byte
+	signed      []byte
+	etag        string
+	envelope    string
+	keyCert     string
+	fetchedAt   time.Time
+	cached      bool
+	contentHash string
+}
+
+// fetch retrieves the profile descriptor data at pfdURL and verifies its signature.
+func (c Client) fetch(pfdURL *url.URL, params lookupParams) (*fetchResult, error) {
+	q := pfdURL.Query()
+	if params.all {
+		q.Set("all", "1")
+	} else if params.id != "" {
+		q.Set("id", params.id)
+	}
+	if params.fields != "" {
+		q.Set("fields", params.fields)
+	}
+	if params.share != "" {
+		q.Set(ShareParam, params.share)
+	}
+	pfdURL.RawQuery = q.Encode()
+	cacheKey := pfdURL.String()
+	if params.tokenHash != "" {
+		cacheKey += "#token=" + params.tokenHash
+	}
+
+	serverName, err := c.serverName(pfdURL.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.checkQuarantine(pfdURL.Host, serverName); err != nil {
+		return nil, err
+	}
 
-		err = c.SavePubkey(pfdURL.Host, info.PreviousNames, pubkey)
+	var (
+		resp   *descriptorResponse
+		cached *CacheEntry
+	)
+	pubkeySaved, moved, notModified := false, false, false
+	pubkey, err := c.getPubkey(serverName)
+	if errors.Is(err, ErrPubkeyNotFound) {
+		c.tracef("no pinned key for %s, contacting server for the first time", pfdURL.Host)
+		if c.OptimisticFetch {
+			pubkey, resp, err = c.firstContactConcurrent(pfdURL)
+			if errors.Is(err, errMoved) {
+				moved, err = true, nil
+			}
+		} else {
+			pubkey, err = c.trustServer(pfdURL)
+		}
 		if err != nil {
-			return err
+			return nil, err
 		}
 		pubkeySaved = true
 	} else if err != nil {
+		return nil, err
+	} else if entry, fresh := c.getCached(cacheKey, pubkey); fresh {
+		c.tracef("using cached response for %s fetched at %s, signature verified", redactURL(pfdURL), entry.FetchedAt)
+		c.observe(serverName, OutcomeVerified)
+		return &fetchResult{
+			url:         pfdURL.String(),
+			data:        entry.Data,
+			sig:         entry.Signature,
+			signed:      entry.signedData(),
+			etag:        entry.ETag,
+			keyCert:     entry.KeyCertificate,
+			fetchedAt:   entry.FetchedAt,
+			cached:      true,
+			contentHash: cmp.Or(entry.ContentHash, contentHashJSON(entry.Data, params.all)),
+		}, nil
+	} else {
+		cached = entry
+	}
+
+	if resp == nil {
+		resp, err = c.fetchDescriptor(pfdURL, cached)
+		if errors.Is(err, errMoved) {
+			moved = true
+		} else if errors.Is(err, errNotModified) {
+			c.tracef("server responded with 304 Not Modified, reusing cached response for %s", redactURL(pfdURL))
+			notModified = true
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	data, sig := resp.data, resp.sig
+
+	signingKey, err := certifiedKey(pubkey, resp.keyCert)
+	if err != nil || !verify(signingKey, resp.signed, sig) {
+		c.tracef("descriptor signature does not match key %s", FingerprintHex(pubkey))
+
+		// If the pubkey was just saved in the current request, we probably
+		// already have the newest one, so just return a mismatch error.
+		if pubkeySaved {
+			c.observe(serverName, OutcomeMismatchInitial)
+			return nil, cmp.Or(err, ErrSignatureMismatch)
+		}
+
+		newPubkey, err := c.rotateKey(pfdURL.Scheme, pfdURL.Host, serverName, pubkey)
+		if err != nil {
+			return nil, err
+		}
+
+		signingKey, err = certifiedKey(newPubkey, resp.keyCert)
+		if err != nil || !verify(signingKey, resp.signed, sig) {
+			c.tracef("descriptor signature does not match new key")
+			c.observe(serverName, OutcomeMismatchRotation)
+			return nil, cmp.Or(err, ErrSignatureMismatch)
+		}
+		pubkey = newPubkey
+	}
+	if signingKey.Equal(pubkey) {
+		c.tracef("descriptor signature verified")
+	} else {
+		c.tracef("descriptor signature verified using signing key %s certified by %s", FingerprintHex(signingKey), FingerprintHex(pubkey))
+	}
+	c.observe(serverName, OutcomeVerified)
+
+	if c.MarkVerified != nil {
+		if err := c.MarkVerified(serverName, time.Now()); err != nil {
+			return nil, err
+		}
+	}
+
+	if moved {
+		return nil, c.followRedirect(pfdURL, data)
+	}
+
+	if err := c.checkEnvelope(pfdURL.Host, signingKey, data, resp.envelope, resp.date); err != nil {
+		c.tracef("descriptor signed timestamp rejected: %s", err)
+		return nil, err
+	}
+
+	fr := &fetchResult{
+		url:         pfdURL.String(),
+		data:        data,
+		sig:         sig,
+		signed:      resp.signed,
+		etag:        resp.etag,
+		envelope:    resp.envelope,
+		keyCert:     resp.keyCert,
+		fetchedAt:   time.Now(),
+		cached:      notModified,
+		contentHash: contentHashJSON(data, params.all),
+	}
+	c.putCached(cacheKey, fr)
+	return fr, nil
+}
+
+// rotateKey retrieves the server info of the server at host, whose key is pinned
+// under serverName, and accepts its new key if it's signed by the pinned key.
+// It returns [ErrSignatureMismatch] if the key hasn't changed or the new key
+// can't be verified.
+func (c Client) rotateKey(scheme, host, serverName string, pubkey ed25519.PublicKey) (ed25519.PublicKey, error) {
+	serverData, infoSig, sigs, err := c.getServerInfo(scheme, host)
+	if err != nil {
+		return nil, err
+	}
+
+	var info serverInfoData
+	err = json.Unmarshal(serverData, &info)
+	if err != nil {
+		return nil, err
+	}
+	info.normalize()
+
+	if err := c.checkQuarantine(info.PreviousNames...); err != nil {
+		return nil, err
+	}
+
+	newPubkey, err := info.pubkey()
+	if err != nil {
+		return nil, err
+	}
+
+	// If the pubkey hasn't changed but we couldn't
+	// verify the signature, return an error immediately.
+	if bytes.Equal(pubkey, newPubkey) {
+		c.tracef("server key is unchanged, rejecting response")
+		c.observe(serverName, OutcomeMismatchInitial)
+		return nil, ErrSignatureMismatch
+	}
+
+	var oldSig []byte
+	for _, sig := range sigs {
+		if ed25519.Verify(pubkey, serverData, sig) {
+			oldSig = sig
+			break
+		}
+	}
+
+	rotation := KeyEvent{
+		ServerName:     serverName,
+		OldFingerprint: FingerprintHex(pubkey),
+		NewFingerprint: FingerprintHex(newPubkey),
+	}
+
+	if oldSig == nil {
+		c.tracef("new key %s is not signed by pinned key %s, rejecting rotation", FingerprintHex(newPubkey), FingerprintHex(pubkey))
+		rotation.Type = KeyEventRotationRejected
+		c.emit(rotation)
+		c.observe(serverName, OutcomeMismatchRotation)
+		return nil, ErrSignatureMismatch
+	}
+
+	if !verify(newPubkey, serverData, infoSig) {
+		rotation.Type = KeyEventRotationRejected
+		c.emit(rotation)
+		c.observe(serverName, OutcomeMismatchRotation)
+		return nil, ErrSignatureMismatch
+	}
+
+	change := newKeyChange(KeyChangeRotation, serverName, pubkey, newPubkey)
+	change.ServerInfo, change.OldKeySignature, change.NewKeySignature = serverData, oldSig, infoSig
+	if err := c.keyChanged(change); err != nil {
+		rotation.Type = KeyEventRotationRejected
+		c.emit(rotation)
+		return nil, err
+	}
+
+	c.tracef("accepting key rotation for %s from %s to %s", serverName, FingerprintHex(pubkey), FingerprintHex(newPubkey))
+	err = c.savePubkey(serverName, info.PreviousNames, newPubkey)
+	if err != nil {
+		return nil, err
+	}
+	rotation.Type = KeyEventRotationAccepted
+	c.emit(rotation)
+	c.observe(serverName, OutcomeRotationAccepted)
+
+	return newPubkey, nil
+}
+
+// verifyServerSignature verifies a signature made by the server at host over data,
+// such as a token or a message it sent. The server's key is trusted on first use,
+// and if the signature doesn't match its pinned key, the server is checked for
+// a key rotation. It returns [ErrSignatureMismatch] if the signature is invalid.
+func (c Client) verifyServerSignature(scheme, host string, data, sig []byte) error {
+	u := &url.URL{Scheme: scheme, Host: host}
+	pubkey, err := c.serverPubkey(u)
+	if err != nil {
 		return err
 	}
 
-	q := pfdURL.Query()
-	if all {
-		q.Set("all", "1")
-	} else if id != "" {
-		q.Set("id", id)
+	if verify(pubkey, data, sig) {
+		return nil
 	}
-	pfdURL.RawQuery = q.Encode()
 
-	res, err := http.Get(pfdURL.String())
+	serverName, err := c.serverName(host)
 	if err != nil {
 		return err
 	}
-	defer res.Body.Close()
 
-	if err := checkResp(res, "getProfileDescriptor"); err != nil {
+	c.tracef("signature from %s does not match key %s, checking for a key rotation", host, FingerprintHex(pubkey))
+	pubkey, err = c.rotateKey(scheme, host, serverName, pubkey)
+	if err != nil {
 		return err
 	}
 
+	if !verify(pubkey, data, sig) {
+		return ErrSignatureMismatch
+	}
+	return nil
+}
+
+// descriptorResponse contains a raw descriptor response.
+type descriptorResponse struct {
+	data []byte
+	sig  []byte
+	// signed is the data covered by sig, which is either data itself or
+	// the signature base of an HTTP message signature.
+	signed   []byte
+	etag     string
+	envelope string
+	keyCert  string
+	// date is the time in the Date header of the response, if any.
+	date time.Time
+}
+
+// fetchDescriptor retrieves the raw descriptor data at pfdURL, its signature,
+// and its ETag. If cached is non-nil and has an ETag, the request is made
+// conditional, and if the server responds with 304 Not Modified, the cached
+// response is returned along with errNotModified.
+func (c Client) fetchDescriptor(pfdURL *url.URL, cached *CacheEntry) (*descriptorResponse, error) {
+	var ifNoneMatch string
+	if cached != nil {
+		ifNoneMatch = cached.ETag
+	}
+
+	res, err := c.getDescriptor(pfdURL, ifNoneMatch)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if ifNoneMatch != "" && res.StatusCode == http.StatusNotModified {
+		// The server sends a new signed timestamp for the cached response
+		return &descriptorResponse{
+			data:     cached.Data,
+			sig:      cached.Signature,
+			signed:   cached.signedData(),
+			etag:     cached.ETag,
+			envelope: cmp.Or(res.Header.Get(envelopeHeader), cached.Envelope),
+			keyCert:  cmp.Or(res.Header.Get(keyCertHeader), cached.KeyCertificate),
+			date:     responseDate(res),
+		}, errNotModified
+	}
+
+	// Redirects are only followed if they're signed, which is
+	// checked by the caller once the server's key is known.
+	moved := isRedirect(res.StatusCode) && res.Header.Get("X-ProfileFed-Sig") != ""
+	if !moved {
+		if err := checkResp(res, "getProfileDescriptor"); err != nil {
+			return nil, err
+		}
+	}
+
 	data, err := io.ReadAll(io.LimitReader(res.Body, responseSizeLimit))
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if err := res.Body.Close(); err != nil {
-		return err
+		return nil, err
+	}
+
+	if err := c.checkDigest(res, pfdURL.Host, data); err != nil {
+		return nil, err
 	}
 
-	sig, err := getSignature(res)
+	var sig, signed []byte
+	if moved {
+		sig, err = getSignature(res)
+		signed = append([]byte(redirectPrefix), data...)
+	} else {
+		sig, signed, err = responseSignature(res, data)
+	}
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if !ed25519.Verify(pubkey, data, sig) {
-		// If the pubkey was just saved in the current request, we probably
-		// already have the newest one, so just return a mismatch error.
-		if pubkeySaved {
-			return ErrSignatureMismatch
-		}
+	resp := &descriptorResponse{
+		data:     data,
+		sig:      sig,
+		signed:   signed,
+		etag:     res.Header.Get("ETag"),
+		envelope: res.Header.Get(envelopeHeader),
+		keyCert:  res.Header.Get(keyCertHeader),
+		date:     responseDate(res),
+	}
+	if moved {
+		return resp, errMoved
+	}
+	return resp, nil
+}
 
-		serverData, infoSig, sigs, err := getServerInfo(pfdURL.Scheme, pfdURL.Host)
-		if err != nil {
-			return err
-		}
+// trustServer retrieves the server info for the server at pfdURL for the first
+// time and saves its public key, verifying any previous names it advertises.
+func (c Client) trustServer(pfdURL *url.URL) (ed25519.PublicKey, error) {
+	data, sig, prevSigs, err := c.getServerInfo(pfdURL.Scheme, pfdURL.Host)
+	if err != nil {
+		return nil, err
+	}
 
-		var info serverInfoData
-		err = json.Unmarshal(serverData, &info)
-		if err != nil {
-			return err
+	var info serverInfoData
+	err = json.Unmarshal(data, &info)
+	if err != nil {
+		return nil, err
+	}
+	info.normalize()
+
+	if c.SaveAlias != nil && info.ServerName != pfdURL.Host && slices.Contains(info.AlternateNames, pfdURL.Host) {
+		return c.trustAlias(pfdURL.Scheme, pfdURL.Host, info)
+	}
+
+	return c.trustInfo(pfdURL.Host, info, data, sig, prevSigs)
+}
+
+// trustInfo verifies the previous names advertised in the server info
+// of the given server and saves its public key.
+func (c Client) trustInfo(host string, info serverInfoData, data, sig []byte, prevSigs [][]byte) (ed25519.PublicKey, error) {
+	// A quarantined server must not be able to escape
+	// its quarantine by moving to a new name.
+	if err := c.checkQuarantine(info.PreviousNames...); err != nil {
+		return nil, err
+	}
+
+	pubkey, err := info.pubkey()
+	if err != nil {
+		return nil, err
+	}
+
+	// If this server is advertising previous names, make sure
+	// we verify that it's telling the truth by checking whether
+	// any of its signatures match using the pubkeys of the previous names.
+	var (
+		renamedFrom    []string
+		oldFingerprint string
+		changes        []KeyChange
+	)
+	for _, prevName := range info.PreviousNames {
+		prevPubkey, err := c.getPubkey(prevName)
+		if errors.Is(err, ErrPubkeyNotFound) {
+			continue
+		} else if err != nil {
+			return nil, err
 		}
 
-		newPubkey, err := base64.StdEncoding.DecodeString(info.PublicKey)
-		if err != nil {
-			return err
+		c.tracef("verifying previous name %s using its pinned key %s", prevName, FingerprintHex(prevPubkey))
+		sigs := append([][]byte{sig}, prevSigs...)
+		i := slices.IndexFunc(sigs, func(s []byte) bool {
+			return verify(prevPubkey, data, s)
+		})
+
+		// If none of the signatures match, this name
+		// could not be verified, so return an error.
+		if i == -1 {
+			c.observe(host, OutcomeMismatchPreviousName)
+			return nil, ErrSignatureMismatch
 		}
 
-		// If the pubkey hasn't changed but we couldn't
-		// verify the signature, return an error immediately.
-		if bytes.Equal(pubkey, newPubkey) {
-			return ErrSignatureMismatch
+		renamedFrom = append(renamedFrom, prevName)
+		oldFingerprint = FingerprintHex(prevPubkey)
+
+		if !prevPubkey.Equal(pubkey) {
+			change := newKeyChange(KeyChangeRename, host, prevPubkey, pubkey)
+			change.PreviousName, change.ServerInfo, change.OldKeySignature, change.NewKeySignature = prevName, data, sigs[i], sig
+			changes = append(changes, change)
 		}
+	}
 
-		verified := false
-		for _, sig := range sigs {
-			if ed25519.Verify(pubkey, serverData, sig) {
-				verified = true
-				break
-			}
+	for _, change := range changes {
+		if err := c.keyChanged(change); err != nil {
+			return nil, err
 		}
+	}
 
-		if !verified {
-			return ErrSignatureMismatch
+	if c.ConfirmNewKey != nil && len(renamedFrom) == 0 {
+		ok, err := c.ConfirmNewKey(host, Fingerprint(pubkey))
+		if err != nil {
+			return nil, err
 		}
 
-		if !ed25519.Verify(newPubkey, infoSig, serverData) {
-			return ErrSignatureMismatch
+		if !ok {
+			c.tracef("key %s for %s was not confirmed", FingerprintHex(pubkey), host)
+			c.observe(host, OutcomeKeyNotConfirmed)
+			return nil, ErrKeyNotConfirmed
 		}
+	}
+
+	c.tracef("trusting key %s for %s on first use", FingerprintHex(pubkey), host)
+	err = c.savePubkey(host, info.PreviousNames, pubkey)
+	if err != nil {
+		return nil, err
+	}
+
+	ev := KeyEvent{
+		Type:           KeyEventFirstTrust,
+		ServerName:     host,
+		NewFingerprint: FingerprintHex(pubkey),
+	}
+	if len(renamedFrom) > 0 {
+		ev.Type = KeyEventRenameObserved
+		ev.PreviousNames = renamedFrom
+		ev.OldFingerprint = oldFingerprint
+	}
+	c.emit(ev)
+	c.observe(host, OutcomeFirstTrust)
+
+	return pubkey, nil
+}
+
+// firstContactConcurrent performs the server info and descriptor requests for a
+// server that's being contacted for the first time concurrently, to save a round
+// trip. The descriptor isn't trusted until the server info has been verified.
+func (c Client) firstContactConcurrent(pfdURL *url.URL) (pubkey ed25519.PublicKey, resp *descriptorResponse, err error) {
+	var (
+		wg      sync.WaitGroup
+		descErr error
+	)
+
+	descURL := *pfdURL
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		resp, descErr = c.fetchDescriptor(&descURL, nil)
+	}()
 
-		err = c.SavePubkey(pfdURL.Host, info.PreviousNames, newPubkey)
+	pubkey, err = c.trustServer(pfdURL)
+	wg.Wait()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if errors.Is(descErr, errMoved) {
+		return pubkey, resp, descErr
+	} else if descErr != nil {
+		return nil, nil, descErr
+	}
+
+	return pubkey, resp, nil
+}
+
+// tokenHash returns the hex-encoded SHA-256 hash of the bearer token the
+// client's TokenFunc returns for host, or an empty string if there isn't one.
+func (c Client) tokenHash(host string) (string, error) {
+	if c.TokenFunc == nil {
+		return "", nil
+	}
+
+	token, err := c.TokenFunc(host)
+	if err != nil || token == "" {
+		return "", err
+	}
+
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// getDescriptor sends a request for the descriptor at pfdURL, attaching
+// a bearer token if the client has a TokenFunc. If ifNoneMatch isn't
+// empty, it's sent in the If-None-Match header.
+func (c Client) getDescriptor(pfdURL *url.URL, ifNoneMatch string) (*http.Response, error) {
+	if err := c.checkURL(pfdURL); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodGet, pfdURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.TokenFunc != nil {
+		token, err := c.TokenFunc(pfdURL.Host)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
-		if !ed25519.Verify(newPubkey, data, sig) {
-			return ErrSignatureMismatch
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
 		}
 	}
 
-	return json.Unmarshal(data, dest)
+	if ifNoneMatch != "" {
+		req.Header.Set("If-None-Match", ifNoneMatch)
+	}
+
+	// Unsigned redirects must not be followed, since the
+	// client can't tell whether they're legitimate.
+	hc := *c.httpClient()
+	hc.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	return hc.Do(req)
 }
 
 // getServerInfo retrieves server information.
-func getServerInfo(scheme, host string) (data, sig []byte, prevSigs [][]byte, err error) {
+func (c Client) getServerInfo(scheme, host string) (data, sig []byte, prevSigs [][]byte, err error) {
+	defer func() {
+		if err != nil {
+			c.observe(host, OutcomeKeyFetchFailed)
+		}
+	}()
+
 	serverInfoURL := url.URL{
 		Scheme: scheme,
 		Host:   host,
 		Path:   "/_profilefed/server",
 	}
 
-	res, err := http.Get(serverInfoURL.String())
+	if err := c.checkURL(&serverInfoURL); err != nil {
+		return nil, nil, nil, err
+	}
+
+	res, err := c.httpClient().Get(serverInfoURL.String())
 	if err != nil {
 		return nil, nil, nil, err
 	}
@@ -298,7 +1028,18 @@ func getServerInfo(scheme, host string) (data, sig []byte, prevSigs [][]byte, er
 	}
 
 	data, err = io.ReadAll(io.LimitReader(res.Body, responseSizeLimit))
-	return data, sig, getPrevSignatures(res), err
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if err := c.checkDigest(res, host, data); err != nil {
+		return nil, nil, nil, err
+	}
+
+	if err := c.checkQuorum(res, host, data); err != nil {
+		return nil, nil, nil, err
+	}
+	return data, sig, getPrevSignatures(res), nil
 }
 
 // getPrevSignatures extracts previous signatures from a response.
@@ -324,10 +1065,11 @@ func getSignature(res *http.Response) ([]byte, error) {
 	return base64.StdEncoding.DecodeString(sigStr)
 }
 
-// checkResp returns an error if the response is not 200 OK.
-func checkResp(res *http.Response, opName string) error {
-	if res.StatusCode != 200 {
-		return fmt.Errorf("%s: %s", opName, res.Status)
+// verify reports whether sig is a valid signature of data by pubkey.
+// Unlike [ed25519.Verify], it doesn't panic if pubkey has an invalid length.
+func verify(pubkey, data, sig []byte) bool {
+	if len(pubkey) != ed25519.PublicKeySize {
+		return false
 	}
-	return nil
+	return ed25519.Verify(pubkey, data, sig)
 }
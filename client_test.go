@@ -0,0 +1,662 @@
+package profilefed
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"queerdevs.org/profilefed/publicsuffix"
+	"queerdevs.org/profilefed/webfinger"
+)
+
+// newTestServer starts a ProfileFed server that serves the given descriptors
+// for acct:user@<server address>.
+func newTestServer(t *testing.T, descs map[string]*Descriptor) *httptest.Server {
+	t.Helper()
+
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey error: %s", err)
+	}
+
+	errorHandler := func(err error, res http.ResponseWriter) {
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+	}
+
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+
+	mux.Handle("/.well-known/webfinger", webfinger.Handler{
+		DescriptorFunc: func(resource string) (*webfinger.Descriptor, error) {
+			return &webfinger.Descriptor{
+				Subject: resource,
+				Links: []webfinger.Link{{
+					Rel:  "self",
+					Type: "application/x-pfd+json",
+					Href: srv.URL + "/pfd/user",
+				}},
+			}, nil
+		},
+	})
+
+	mux.Handle("/_profilefed/server", ServerInfoHandler{
+		ServerName:   srv.Listener.Addr().String(),
+		PublicKey:    pub,
+		PrivateKey:   priv,
+		ErrorHandler: errorHandler,
+	})
+
+	mux.Handle("/pfd/user", Handler{
+		PrivateKey: priv,
+		DescriptorFunc: func(req *Request) (*Descriptor, error) {
+			id := req.ID
+			if id == "" {
+				id = "main"
+			}
+			desc, ok := descs[id]
+			if !ok {
+				return nil, ErrDescriptorNotFound
+			}
+			return desc, nil
+		},
+		AllDescriptorsFunc: func(req *Request) (map[string]*Descriptor, error) {
+			return descs, nil
+		},
+		ErrorHandler: errorHandler,
+	})
+
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestClientLookup(t *testing.T) {
+	descs := map[string]*Descriptor{
+		"main": {ID: "main", Username: "user", DisplayName: "User", Role: RoleUser},
+		"alt":  {ID: "alt", Username: "user", DisplayName: "Alt User", Role: RoleUser},
+	}
+	srv := newTestServer(t, descs)
+	acct := "user@" + srv.Listener.Addr().String()
+
+	for _, optimistic := range []bool{false, true} {
+		c := DefaultClient()
+		c.OptimisticFetch = optimistic
+
+		desc, err := c.Lookup(acct)
+		if err != nil {
+			t.Fatalf("Lookup error: %s", err)
+		}
+
+		if !reflect.DeepEqual(desc, descs["main"]) {
+			t.Errorf("Descriptors are not equal:\n%#v\n\n%#v", desc, descs["main"])
+		}
+
+		desc, err = c.LookupID(acct, "alt")
+		if err != nil {
+			t.Fatalf("LookupID error: %s", err)
+		}
+
+		if !reflect.DeepEqual(desc, descs["alt"]) {
+			t.Errorf("Descriptors are not equal:\n%#v\n\n%#v", desc, descs["alt"])
+		}
+
+		all, err := c.LookupAll(acct)
+		if err != nil {
+			t.Fatalf("LookupAll error: %s", err)
+		}
+
+		if !reflect.DeepEqual(all, descs) {
+			t.Errorf("Descriptor maps are not equal:\n%#v\n\n%#v", all, descs)
+		}
+	}
+}
+
+func TestClientLookupFields(t *testing.T) {
+	descs := map[string]*Descriptor{
+		"main": {ID: "main", Username: "user", DisplayName: "User", Bio: "Hi", Role: RoleUser},
+	}
+	srv := newTestServer(t, descs)
+	acct := "user@" + srv.Listener.Addr().String()
+
+	desc, err := DefaultClient().LookupFields(acct, "display_name")
+	if err != nil {
+		t.Fatalf("LookupFields error: %s", err)
+	}
+
+	expected := &Descriptor{ID: "main", Username: "user", DisplayName: "User"}
+	if !reflect.DeepEqual(desc, expected) {
+		t.Errorf("Descriptors are not equal:\n%#v\n\n%#v", desc, expected)
+	}
+
+	_, err = DefaultClient().LookupFields(acct, "password")
+	if err == nil {
+		t.Fatalf("Expected error for unknown field, got nil")
+	}
+}
+
+func TestClientHTTPError(t *testing.T) {
+	srv := newTestServer(t, map[string]*Descriptor{})
+	acct := "user@" + srv.Listener.Addr().String()
+
+	_, err := DefaultClient().LookupID(acct, "missing")
+
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) {
+		t.Fatalf("Expected HTTPError, got %v", err)
+	}
+
+	if httpErr.StatusCode != http.StatusInternalServerError || httpErr.Body != ErrDescriptorNotFound.Error() {
+		t.Errorf("Unexpected HTTPError: %#v", httpErr)
+	}
+}
+
+func TestClientQuarantine(t *testing.T) {
+	descs := map[string]*Descriptor{
+		"main": {ID: "main", Username: "user", DisplayName: "User", Role: RoleUser},
+	}
+	srv := newTestServer(t, descs)
+	host := srv.Listener.Addr().String()
+	acct := "user@" + host
+
+	c := DefaultClient()
+	if _, err := c.Lookup(acct); err != nil {
+		t.Fatalf("Lookup error: %s", err)
+	}
+
+	if err := c.QuarantineHost(host); err != nil {
+		t.Fatalf("QuarantineHost error: %s", err)
+	}
+
+	if _, err := c.Lookup(acct); !errors.Is(err, ErrHostQuarantined) {
+		t.Fatalf("Expected ErrHostQuarantined, got %v", err)
+	}
+
+	if err := c.ClearQuarantine(host); err != nil {
+		t.Fatalf("ClearQuarantine error: %s", err)
+	}
+
+	if _, err := c.Lookup(acct); err != nil {
+		t.Fatalf("Lookup error after clearing quarantine: %s", err)
+	}
+}
+
+func TestClientConfirmNewKey(t *testing.T) {
+	desc := &Descriptor{ID: "main", Username: "user", DisplayName: "User"}
+
+	mt := &MemoryTransport{}
+	mt.Register("example.test", newTenant(t, "example.test", desc))
+
+	var confirm bool
+	c := mt.Client()
+	c.ConfirmNewKey = func(serverName, fingerprint string) (bool, error) {
+		if serverName != "example.test" || !strings.HasPrefix(fingerprint, "SHA256:") {
+			t.Errorf("Unexpected confirmation request: %q %q", serverName, fingerprint)
+		}
+		return confirm, nil
+	}
+
+	if _, err := c.Lookup("user@example.test"); !errors.Is(err, ErrKeyNotConfirmed) {
+		t.Fatalf("Expected ErrKeyNotConfirmed, got %v", err)
+	}
+
+	if _, err := c.GetPubkey("example.test"); !errors.Is(err, ErrPubkeyNotFound) {
+		t.Fatalf("Expected unconfirmed key not to be saved, got %v", err)
+	}
+
+	confirm = true
+	if _, err := c.Lookup("user@example.test"); err != nil {
+		t.Fatalf("Lookup error: %s", err)
+	}
+}
+
+func TestClientEvents(t *testing.T) {
+	descs := map[string]*Descriptor{
+		"main": {ID: "main", Username: "user", DisplayName: "User", Role: RoleUser},
+	}
+	srv := newTestServer(t, descs)
+	host := srv.Listener.Addr().String()
+
+	var events []KeyEventType
+	c := DefaultClient()
+	c.Events = KeyEventSinkFunc(func(ev KeyEvent) {
+		if ev.ServerName != host {
+			t.Errorf("Unexpected server name: %q", ev.ServerName)
+		}
+		events = append(events, ev.Type)
+	})
+
+	for range 2 {
+		if _, err := c.Lookup("user@" + host); err != nil {
+			t.Fatalf("Lookup error: %s", err)
+		}
+	}
+
+	if err := c.QuarantineHost(host); err != nil {
+		t.Fatalf("QuarantineHost error: %s", err)
+	}
+
+	expected := []KeyEventType{KeyEventFirstTrust, KeyEventQuarantined}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("Unexpected events: %q", events)
+	}
+}
+
+func TestClientAlias(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey error: %s", err)
+	}
+
+	desc := &Descriptor{ID: "main", Username: "user", DisplayName: "User", Role: RoleUser}
+
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	// The server is reachable both via its IP address and via localhost
+	primary := srv.Listener.Addr().String()
+	alias := strings.Replace(primary, "127.0.0.1", "localhost", 1)
+
+	mux.Handle("/.well-known/webfinger", webfinger.Handler{
+		DescriptorFunc: func(resource string) (*webfinger.Descriptor, error) {
+			_, host, _ := strings.Cut(resource, "@")
+			return &webfinger.Descriptor{
+				Subject: resource,
+				Links: []webfinger.Link{{
+					Rel:  "self",
+					Type: "application/x-pfd+json",
+					Href: "http://" + host + "/pfd/user",
+				}},
+			}, nil
+		},
+	})
+
+	mux.Handle("/_profilefed/server", ServerInfoHandler{
+		ServerName:     primary,
+		AlternateNames: []string{alias},
+		PublicKey:      pub,
+		PrivateKey:     priv,
+	})
+
+	mux.Handle("/pfd/user", Handler{
+		PrivateKey: priv,
+		DescriptorFunc: func(req *Request) (*Descriptor, error) {
+			return desc, nil
+		},
+	})
+
+	ks := &MemoryKeyStore{}
+	c := DefaultClient().WithKeyStore(ks)
+	for _, host := range []string{alias, primary, alias} {
+		if _, err := c.Lookup("user@" + host); err != nil {
+			t.Fatalf("Lookup error for %s: %s", host, err)
+		}
+	}
+
+	if hosts := ks.Hosts(); !reflect.DeepEqual(hosts, []string{primary}) {
+		t.Errorf("Unexpected pinned hosts: %q", hosts)
+	}
+
+	if name, _ := ks.GetAlias(alias); name != primary {
+		t.Errorf("Unexpected primary name for alias: %q", name)
+	}
+}
+
+func TestResourceServer(t *testing.T) {
+	tests := map[string]string{
+		"acct:user@example.com":          "example.com",
+		"acct:user@example.com:8080":     "example.com:8080",
+		"mailto:user@example.com":        "example.com",
+		"https://example.com/users/1":    "example.com",
+		"did:web:example.com:user:alice": "example.com",
+	}
+
+	for resource, expected := range tests {
+		server, err := resourceServer(resource)
+		if err != nil {
+			t.Errorf("resourceServer(%q) error: %s", resource, err)
+			continue
+		}
+
+		if server != expected {
+			t.Errorf("resourceServer(%q) = %q, expected %q", resource, server, expected)
+		}
+	}
+
+	for _, resource := range []string{"urn:isbn:123", "acct:user", "mailto:user@"} {
+		if _, err := resourceServer(resource); err == nil {
+			t.Errorf("resourceServer(%q): expected error, got nil", resource)
+		}
+	}
+}
+
+func TestClientSignedRedirect(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey error: %s", err)
+	}
+
+	desc := &Descriptor{ID: "main", Username: "user", DisplayName: "User", Role: RoleUser}
+
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	mux.Handle("/_profilefed/server", ServerInfoHandler{
+		ServerName: srv.Listener.Addr().String(),
+		PublicKey:  pub,
+		PrivateKey: priv,
+	})
+	mux.Handle("/pfd/old", Handler{PrivateKey: priv, MovedTo: srv.URL + "/pfd/user"})
+	mux.Handle("/pfd/unsigned", http.RedirectHandler(srv.URL+"/pfd/user", http.StatusMovedPermanently))
+	mux.Handle("/pfd/user", Handler{
+		PrivateKey: priv,
+		DescriptorFunc: func(req *Request) (*Descriptor, error) {
+			return desc, nil
+		},
+	})
+
+	endpoints := map[string]string{}
+	c := DefaultClient()
+	c.SaveEndpoint = func(oldURL, newURL string) error {
+		endpoints[oldURL] = newURL
+		return nil
+	}
+
+	wfdesc := func(path string) *webfinger.Descriptor {
+		return &webfinger.Descriptor{Links: []webfinger.Link{{
+			Rel:  "self",
+			Type: "application/x-pfd+json",
+			Href: srv.URL + path,
+		}}}
+	}
+
+	got, err := c.LookupWebFinger(wfdesc("/pfd/old"))
+	if err != nil {
+		t.Fatalf("LookupWebFinger error: %s", err)
+	}
+
+	if !reflect.DeepEqual(got, desc) {
+		t.Errorf("Descriptors are not equal:\n%#v\n\n%#v", got, desc)
+	}
+
+	expected := map[string]string{srv.URL + "/pfd/old": srv.URL + "/pfd/user"}
+	if !reflect.DeepEqual(endpoints, expected) {
+		t.Errorf("Unexpected saved endpoints: %#v", endpoints)
+	}
+
+	if _, err := c.LookupWebFinger(wfdesc("/pfd/unsigned")); err == nil {
+		t.Errorf("Expected error for unsigned redirect, got nil")
+	}
+}
+
+func TestClientRedirectRejected(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey error: %s", err)
+	}
+
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	now := time.Now()
+	mux.Handle("/_profilefed/server", ServerInfoHandler{
+		ServerName: srv.Listener.Addr().String(),
+		PublicKey:  pub,
+		PrivateKey: priv,
+	})
+
+	// A redirect-shaped body signed like any other response, such as
+	// by an extension endpoint using SignedJSON, isn't a valid redirect
+	mux.Handle("/pfd/bare", http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		data, err := json.Marshal(redirectData{
+			Path:      "/pfd/bare",
+			Location:  srv.URL + "/pfd/evil",
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(time.Hour).Unix(),
+		})
+		if err != nil {
+			t.Errorf("Marshal error: %s", err)
+			return
+		}
+		writeSignedStatus(res, priv, http.StatusPermanentRedirect, data)
+	}))
+
+	mux.Handle("/pfd/expired", http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		data, err := json.Marshal(redirectData{
+			Path:      "/pfd/expired",
+			Location:  srv.URL + "/pfd/evil",
+			IssuedAt:  now.Add(-2 * time.Hour).Unix(),
+			ExpiresAt: now.Add(-time.Hour).Unix(),
+		})
+		if err != nil {
+			t.Errorf("Marshal error: %s", err)
+			return
+		}
+		sig := ed25519.Sign(priv, append([]byte(redirectPrefix), data...))
+		res.Header().Set("X-ProfileFed-Sig", base64.StdEncoding.EncodeToString(sig))
+		res.WriteHeader(http.StatusPermanentRedirect)
+		res.Write(data)
+	}))
+
+	endpoints := map[string]string{}
+	c := DefaultClient()
+	c.SaveEndpoint = func(oldURL, newURL string) error {
+		endpoints[oldURL] = newURL
+		return nil
+	}
+
+	for path, expected := range map[string]error{"/pfd/bare": ErrSignatureMismatch, "/pfd/expired": ErrStaleDescriptor} {
+		_, err := c.LookupWebFinger(&webfinger.Descriptor{Links: []webfinger.Link{{
+			Rel:  "self",
+			Type: "application/x-pfd+json",
+			Href: srv.URL + path,
+		}}})
+		if !errors.Is(err, expected) {
+			t.Errorf("%s: expected %v, got %v", path, expected, err)
+		}
+	}
+
+	if len(endpoints) != 0 {
+		t.Errorf("Rejected redirects must not be saved: %#v", endpoints)
+	}
+
+	// Redirects must not downgrade from HTTPS to plain HTTP
+	data, err := json.Marshal(redirectData{
+		Path:      "/pfd/user",
+		Location:  "http://example.com/pfd/user",
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		t.Fatalf("Marshal error: %s", err)
+	}
+	pfdURL := &url.URL{Scheme: "https", Host: "example.com", Path: "/pfd/user"}
+	if err := c.followRedirect(pfdURL, data); !errors.Is(err, ErrInvalidRedirect) {
+		t.Errorf("Expected ErrInvalidRedirect for a downgrade, got %v", err)
+	}
+	if len(endpoints) != 0 {
+		t.Errorf("Downgrading redirects must not be saved: %#v", endpoints)
+	}
+}
+
+func TestClientTokenSharedCache(t *testing.T) {
+	h := newTenant(t, "example.test", nil, func(h *Handler) {
+		h.TokenValidator = TokenValidatorFunc(func(ctx context.Context, token string) (*TokenInfo, error) {
+			if token != "secret" {
+				return nil, ErrInvalidToken
+			}
+			return &TokenInfo{Subject: "friend"}, nil
+		})
+		h.DescriptorFunc = func(req *Request) (*Descriptor, error) {
+			desc := &Descriptor{ID: "main", Username: "user", DisplayName: "User"}
+			if _, ok := TokenFromContext(req.Context()); ok {
+				desc.Bio = "Only for friends"
+			}
+			return desc, nil
+		}
+	})
+
+	mt := &MemoryTransport{}
+	mt.Register("example.test", h)
+
+	// Both clients share a lookup group and a cache, like
+	// clients of a multi-user app sharing a disk cache.
+	group, cache := &LookupGroup{}, mapCache{}
+	authed, anon := mt.Client(), mt.Client()
+	for _, c := range []*Client{&authed, &anon} {
+		c.Group, c.Cache, c.CacheMaxAge = group, cache, time.Hour
+	}
+	authed.TokenFunc = func(host string) (string, error) {
+		return "secret", nil
+	}
+
+	desc, prov, err := authed.LookupProvenance("user@example.test")
+	if err != nil {
+		t.Fatalf("LookupProvenance error: %s", err)
+	}
+	if desc.Bio != "Only for friends" {
+		t.Errorf("Expected the authorized view, got %+v", desc)
+	}
+	if strings.Contains(prov.URL, "#") {
+		t.Errorf("Provenance URL contains the cache key fragment: %s", prov.URL)
+	}
+
+	desc, err = anon.Lookup("user@example.test")
+	if err != nil {
+		t.Fatalf("Lookup error: %s", err)
+	}
+	if desc.Bio != "" {
+		t.Errorf("Anonymous client got the authorized view: %+v", desc)
+	}
+
+	if len(cache) != 2 {
+		t.Errorf("Expected separate cache entries for both views, got %d", len(cache))
+	}
+	for key := range cache {
+		if strings.Contains(key, "secret") {
+			t.Errorf("Cache key contains the token: %s", key)
+		}
+	}
+}
+
+// mapCache is a simple in-memory [DescriptorCache] used in tests.
+type mapCache map[string]*CacheEntry
+
+func (mc mapCache) Get(key string) (*CacheEntry, error) {
+	entry, ok := mc[key]
+	if !ok {
+		return nil, ErrCacheMiss
+	}
+	return entry, nil
+}
+
+func (mc mapCache) Put(key string, entry *CacheEntry) error {
+	mc[key] = entry
+	return nil
+}
+
+// statusRecorder is an [http.RoundTripper] that records the status codes of responses.
+type statusRecorder []int
+
+func (sr *statusRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := http.DefaultTransport.RoundTrip(req)
+	if err == nil && strings.HasPrefix(req.URL.Path, "/pfd/") {
+		*sr = append(*sr, res.StatusCode)
+	}
+	return res, err
+}
+
+func TestClientRevalidate(t *testing.T) {
+	descs := map[string]*Descriptor{
+		"main": {ID: "main", Username: "user", DisplayName: "User", Role: RoleUser},
+	}
+	srv := newTestServer(t, descs)
+	acct := "user@" + srv.Listener.Addr().String()
+
+	var statuses statusRecorder
+	c := DefaultClient()
+	c.HTTPClient = &http.Client{Transport: &statuses}
+	c.Cache = mapCache{}
+
+	// CacheMaxAge is zero, so every lookup after the first one revalidates
+	for range 2 {
+		desc, prov, err := c.LookupProvenance(acct)
+		if err != nil {
+			t.Fatalf("LookupProvenance error: %s", err)
+		}
+
+		if !reflect.DeepEqual(desc, descs["main"]) {
+			t.Errorf("Descriptors are not equal:\n%#v\n\n%#v", desc, descs["main"])
+		}
+
+		if prov.FromCache != (len(statuses) > 1) {
+			t.Errorf("Unexpected FromCache value: %t", prov.FromCache)
+		}
+	}
+
+	descs["main"] = &Descriptor{ID: "main", Username: "user", DisplayName: "Renamed", Role: RoleUser}
+	desc, err := c.Lookup(acct)
+	if err != nil {
+		t.Fatalf("Lookup error: %s", err)
+	}
+
+	if !reflect.DeepEqual(desc, descs["main"]) {
+		t.Errorf("Descriptors are not equal:\n%#v\n\n%#v", desc, descs["main"])
+	}
+
+	expected := statusRecorder{http.StatusOK, http.StatusNotModified, http.StatusOK}
+	if !reflect.DeepEqual(statuses, expected) {
+		t.Errorf("Unexpected response statuses: %v", statuses)
+	}
+}
+
+func TestClientSameSiteEndpoints(t *testing.T) {
+	desc := &Descriptor{ID: "main", Username: "user"}
+
+	mt := &MemoryTransport{}
+	mt.Register("profile.users.example.co.uk", newTenant(t, "profile.users.example.co.uk", desc))
+	mt.Register("evil.co.uk", newTenant(t, "evil.co.uk", desc))
+
+	c := mt.Client()
+	c.Policy = &TransportPolicy{SameSiteEndpoints: true}
+
+	wfdesc := func(host string) *webfinger.Descriptor {
+		return &webfinger.Descriptor{
+			Subject: "acct:user@example.co.uk",
+			Links: []webfinger.Link{{
+				Rel:  "self",
+				Type: "application/x-pfd+json",
+				Href: "http://" + host + "/pfd/user",
+			}},
+		}
+	}
+
+	if _, err := c.LookupWebFinger(wfdesc("profile.users.example.co.uk")); err != nil {
+		t.Fatalf("LookupWebFinger error: %s", err)
+	}
+
+	_, err := c.LookupWebFinger(wfdesc("evil.co.uk"))
+	if !errors.Is(err, ErrCrossSiteEndpoint) {
+		t.Errorf("Expected ErrCrossSiteEndpoint, got %v", err)
+	}
+
+	// Treating users.example.co.uk as a private suffix puts every user on their own site
+	c.Policy = &TransportPolicy{
+		SameSiteEndpoints: true,
+		PublicSuffixes:    publicsuffix.Default().WithPrivate("users.example.co.uk"),
+	}
+	_, err = c.LookupWebFinger(wfdesc("profile.users.example.co.uk"))
+	if !errors.Is(err, ErrCrossSiteEndpoint) {
+		t.Errorf("Expected ErrCrossSiteEndpoint, got %v", err)
+	}
+}
@@ -0,0 +1,88 @@
+package profilefed
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ErrClockSkew signifies that a server's clock differs from the local clock by more
+// than the client tolerates. Errors returned for this reason are [ClockSkewError]s.
+var ErrClockSkew = errors.New("clock skew exceeds tolerance")
+
+// ClockSkewError is returned when a server's clock differs from the local clock by
+// more than [Client.MaxClockSkew]. It contains both times, to help operators tell
+// NTP problems apart from other verification failures.
+type ClockSkewError struct {
+	// Host is the server whose clock is skewed.
+	Host string
+	// Local is the local time at which the response was received.
+	Local time.Time
+	// Remote is the time reported by the server.
+	Remote time.Time
+}
+
+// Skew returns the difference between the remote and local times.
+// It's positive if the server's clock is ahead of the local clock.
+func (cse ClockSkewError) Skew() time.Duration {
+	return cse.Remote.Sub(cse.Local)
+}
+
+func (cse ClockSkewError) Error() string {
+	return fmt.Sprintf("%s: server %s clock is off by %s", ErrClockSkew, cse.Host, cse.Skew().Round(time.Second))
+}
+
+// Is allows ClockSkewError to be matched with [errors.Is] against [ErrClockSkew].
+func (cse ClockSkewError) Is(target error) bool {
+	return target == ErrClockSkew
+}
+
+// checkSignedTime checks the verified signed timestamp of a response from
+// host against the local time, tolerating differences of up to the client's
+// MaxClockSkew. The Date header of the response isn't signed, so date is only
+// used to diagnose clock skew if it agrees with the signed timestamp.
+func (c Client) checkSignedTime(host string, env envelope, date time.Time) error {
+	now := time.Now()
+	issuedAt, expiresAt := time.Unix(env.issuedAt, 0), time.Unix(env.expiresAt, 0)
+	skew := c.MaxClockSkew
+
+	// Responses can only be issued in the future if one of the clocks is off
+	if skew > 0 && issuedAt.Sub(now) > skew {
+		return ClockSkewError{Host: host, Local: now, Remote: issuedAt}
+	}
+
+	// If the server's clock matches its signed timestamp but not the
+	// local clock, the response was issued just now and isn't a replay.
+	if skew > 0 && !date.IsZero() && absDuration(date.Sub(issuedAt)) <= skew && absDuration(date.Sub(now)) > skew {
+		return ClockSkewError{Host: host, Local: now, Remote: date}
+	}
+
+	if now.Sub(expiresAt) > skew {
+		return ErrStaleDescriptor
+	}
+
+	if c.MaxDescriptorAge > 0 && now.Sub(issuedAt) > c.MaxDescriptorAge+skew {
+		return ErrStaleDescriptor
+	}
+
+	return nil
+}
+
+// absDuration returns the absolute value of d.
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+// responseDate returns the time in the Date header of res,
+// or the zero time if it doesn't have a valid one.
+func responseDate(res *http.Response) time.Time {
+	date, err := http.ParseTime(res.Header.Get("Date"))
+	if err != nil {
+		return time.Time{}
+	}
+	return date
+}
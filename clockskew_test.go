@@ -0,0 +1,105 @@
+package profilefed
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestCheckSignedTime(t *testing.T) {
+	c := Client{MaxClockSkew: time.Minute}
+	now := time.Now()
+
+	newEnv := func(issuedAt time.Time, ttl time.Duration) envelope {
+		return envelope{issuedAt: issuedAt.Unix(), expiresAt: issuedAt.Add(ttl).Unix()}
+	}
+
+	if err := c.checkSignedTime("example.com", newEnv(now, time.Hour), now); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+
+	// Small differences in either direction are tolerated
+	if err := c.checkSignedTime("example.com", newEnv(now.Add(30*time.Second), time.Hour), time.Time{}); err != nil {
+		t.Errorf("Unexpected error for a timestamp slightly in the future: %s", err)
+	}
+	if err := c.checkSignedTime("example.com", newEnv(now.Add(-time.Hour-30*time.Second), time.Hour), time.Time{}); err != nil {
+		t.Errorf("Unexpected error for a timestamp that expired just now: %s", err)
+	}
+
+	// Timestamps in the future mean one of the clocks is off
+	err := c.checkSignedTime("example.com", newEnv(now.Add(time.Hour), time.Hour), time.Time{})
+	var cse ClockSkewError
+	if !errors.As(err, &cse) || cse.Host != "example.com" || cse.Skew() < 59*time.Minute {
+		t.Errorf("Expected a ClockSkewError for a future timestamp, got %v", err)
+	}
+
+	// A response that expired according to a server whose clock is behind
+	issuedAt := now.Add(-2 * time.Hour)
+	err = c.checkSignedTime("example.com", newEnv(issuedAt, time.Hour), issuedAt)
+	if !errors.As(err, &cse) || cse.Skew() > -119*time.Minute {
+		t.Errorf("Expected a ClockSkewError for a server that's behind, got %v", err)
+	}
+
+	// A Date header that doesn't agree with the signed timestamp is ignored
+	err = c.checkSignedTime("example.com", newEnv(issuedAt, time.Hour), now)
+	if !errors.Is(err, ErrStaleDescriptor) || errors.Is(err, ErrClockSkew) {
+		t.Errorf("Expected ErrStaleDescriptor for a replayed response, got %v", err)
+	}
+	if err := c.checkSignedTime("example.com", newEnv(now, time.Hour), now.Add(-time.Hour)); err != nil {
+		t.Errorf("Unexpected error for a wrong Date header: %s", err)
+	}
+
+	c.MaxDescriptorAge = time.Hour
+	if err := c.checkSignedTime("example.com", newEnv(now.Add(-time.Hour-30*time.Second), 24*time.Hour), time.Time{}); err != nil {
+		t.Errorf("Unexpected error for a descriptor that's slightly too old: %s", err)
+	}
+	if err := c.checkSignedTime("example.com", newEnv(now.Add(-2*time.Hour), 24*time.Hour), time.Time{}); !errors.Is(err, ErrStaleDescriptor) {
+		t.Errorf("Expected ErrStaleDescriptor for an old descriptor, got %v", err)
+	}
+}
+
+func TestClientClockSkewDateHeader(t *testing.T) {
+	desc := &Descriptor{ID: "main", Username: "user", DisplayName: "User"}
+
+	_, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey error: %s", err)
+	}
+
+	// An intermediary that rewrites the unsigned Date header
+	// must not be able to make lookups fail.
+	h := tenantMux("example.test", ServerInfoHandler{ServerName: "example.test", PrivateKey: priv}, Handler{
+		PrivateKey: priv,
+		DescriptorFunc: func(req *Request) (*Descriptor, error) {
+			return desc, nil
+		},
+	})
+	mt := &MemoryTransport{}
+	mt.Register("example.test", http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		h.ServeHTTP(dateRewriter{res}, req)
+	}))
+
+	c := mt.Client()
+	c.MaxClockSkew = time.Minute
+	if _, err := c.Lookup("user@example.test"); err != nil {
+		t.Errorf("Lookup error: %s", err)
+	}
+}
+
+// dateRewriter is an [http.ResponseWriter] that replaces the Date header
+// of the response with a time far in the past.
+type dateRewriter struct {
+	http.ResponseWriter
+}
+
+func (dr dateRewriter) WriteHeader(status int) {
+	dr.Header().Set("Date", time.Now().Add(-24*time.Hour).UTC().Format(http.TimeFormat))
+	dr.ResponseWriter.WriteHeader(status)
+}
+
+func (dr dateRewriter) Write(b []byte) (int, error) {
+	dr.Header().Set("Date", time.Now().Add(-24*time.Hour).UTC().Format(http.TimeFormat))
+	return dr.ResponseWriter.Write(b)
+}
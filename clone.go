@@ -0,0 +1,17 @@
+package profilefed
+
+import "reflect"
+
+// cloneExported returns a copy of the exported fields of the struct v points
+// to. Unexported fields, such as mutexes and caches, are left at their zero
+// values, so that the copy doesn't share state with v.
+func cloneExported[T any](v *T) *T {
+	out := new(T)
+	src, dst := reflect.ValueOf(v).Elem(), reflect.ValueOf(out).Elem()
+	for i := range src.NumField() {
+		if src.Type().Field(i).IsExported() {
+			dst.Field(i).Set(src.Field(i))
+		}
+	}
+	return out
+}
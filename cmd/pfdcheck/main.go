@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"queerdevs.org/profilefed"
+	"queerdevs.org/profilefed/internal/cli"
+)
+
+func main() {
+	resource := flag.String("resource", "", "A resource served by the server, used to check the WebFinger and descriptor endpoints (e.g. acct:user@example.com)")
+	keyFile := flag.String("key-file", "", "Path to the server's private key file, to check its permissions")
+	format := flag.String("format", "text", "Output format (text, or ndjson to write one finding per line)")
+	quiet := flag.Bool("quiet", false, "Don't print any messages to stderr, only results and the exit code")
+	flag.Parse()
+
+	ui := cli.Output{Quiet: *quiet}
+
+	if *format != "text" && *format != "ndjson" {
+		ui.Exit(cli.ExitUsage, "--format must be text or ndjson")
+	}
+
+	if flag.NArg() < 1 {
+		ui.Exit(cli.ExitUsage, "pfdcheck requires a domain argument")
+	}
+
+	findings := profilefed.Preflight(flag.Arg(0), profilefed.PreflightOptions{
+		Resource: *resource,
+		KeyFile:  *keyFile,
+	})
+
+	failed := false
+	enc := json.NewEncoder(os.Stdout)
+	for _, f := range findings {
+		if *format == "ndjson" {
+			if err := enc.Encode(f); err != nil {
+				ui.Fatal("JSON encode error:", err)
+			}
+		} else if !ui.Quiet {
+			fmt.Printf("[%s] %s: %s\n", f.Severity, f.Check, f.Message)
+			if f.Hint != "" {
+				fmt.Printf("       %s\n", f.Hint)
+			}
+		}
+		if f.Severity == profilefed.SeverityFail {
+			failed = true
+		}
+	}
+
+	if failed {
+		os.Exit(cli.ExitCheckFailed)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"queerdevs.org/profilefed"
+	"queerdevs.org/profilefed/internal/cli"
+)
+
+func main() {
+	scheme := flag.String("scheme", "https", "The URL scheme used to contact the server")
+	output := flag.String("output", "", "Path to write the verified profiles to, as JSON (defaults to stdout)")
+	keystore := flag.String("keystore", "", "Path to a JSON keystore used to pin server keys between runs")
+	format := flag.String("format", "json", "Output format (json, or ndjson to write one profile per line)")
+	quiet := flag.Bool("quiet", false, "Don't print any messages to stderr, only results and the exit code")
+	flag.Parse()
+
+	ui := cli.Output{Quiet: *quiet}
+
+	if *format != "json" && *format != "ndjson" {
+		ui.Exit(cli.ExitUsage, "--format must be json or ndjson")
+	}
+
+	if flag.NArg() < 1 {
+		ui.Exit(cli.ExitUsage, "pfdexport requires a server argument (e.g. example.com)")
+	}
+
+	client := profilefed.DefaultClient()
+	ks := &profilefed.MemoryKeyStore{}
+	if *keystore != "" {
+		var err error
+		ks, err = profilefed.LoadKeyStoreFile(*keystore)
+		if err != nil {
+			ui.Fatal("Error loading keystore:", err)
+		}
+	}
+	client = client.WithKeyStore(ks)
+
+	export, err := client.DownloadExport(*scheme, flag.Arg(0))
+	if err != nil {
+		ui.Fatal("Export error:", err)
+	}
+
+	if *keystore != "" {
+		if err := ks.SaveFile(*keystore); err != nil {
+			ui.Fatal("Error saving keystore:", err)
+		}
+	}
+
+	out := os.Stdout
+	if *output != "" {
+		out, err = os.Create(*output)
+		if err != nil {
+			ui.Fatal("Error creating output file:", err)
+		}
+		defer out.Close()
+	}
+
+	enc := json.NewEncoder(out)
+	if *format == "ndjson" {
+		for _, profile := range export.Profiles {
+			if err := enc.Encode(profile); err != nil {
+				ui.Fatal("JSON encode error:", err)
+			}
+		}
+	} else {
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(export); err != nil {
+			ui.Fatal("JSON encode error:", err)
+		}
+	}
+
+	ui.Println(fmt.Sprintf("Verified %d profiles from %s", len(export.Profiles), export.Manifest.ServerName))
+}
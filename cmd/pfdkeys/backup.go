@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"flag"
+	"os"
+	"strings"
+
+	"queerdevs.org/profilefed"
+	"queerdevs.org/profilefed/internal/cli"
+)
+
+// backup writes the state of a server, including its keys, profiles,
+// and the keys it has pinned for other servers, to a backup archive.
+func backup(args []string) {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	name := fs.String("name", "", "Name of the server")
+	key := fs.String("key", "", "Path to the server's private key, which isn't backed up if empty")
+	var previousNames, previousKeys []string
+	fs.Func("previous-name", "Name the server used before, can be repeated", appendTo(&previousNames))
+	fs.Func("previous-key", "Path to a private key the server used before, can be repeated", appendTo(&previousKeys))
+	profiles := fs.String("profiles", "", "Path to a JSON file mapping resources to descriptors, keyed by descriptor ID")
+	keystore := fs.String("keystore", "", "Path to a JSON keystore file or pfdstore directory containing the keys pinned by the server")
+	passphraseFile := fs.String("passphrase-file", "", "Path to a file containing the passphrase the archive is encrypted with")
+	quiet := fs.Bool("quiet", false, "Don't print any messages to stderr, only results and the exit code")
+	fs.Parse(args)
+
+	ui := cli.Output{Quiet: *quiet}
+
+	if *name == "" {
+		ui.Exit(cli.ExitUsage, "pfdkeys backup requires --name")
+	}
+	if fs.NArg() < 1 {
+		ui.Exit(cli.ExitUsage, "pfdkeys backup requires an archive argument")
+	}
+
+	state := &profilefed.ServerState{ServerName: *name, PreviousNames: previousNames}
+
+	if *key != "" {
+		priv, err := profilefed.LoadPrivateKey(*key)
+		if err != nil {
+			ui.Fatal("Error loading key:", err)
+		}
+		state.PrivateKey = priv
+	}
+
+	for _, path := range previousKeys {
+		priv, err := profilefed.LoadPrivateKey(path)
+		if err != nil {
+			ui.Fatal("Error loading previous key:", err)
+		}
+		state.PreviousKeys = append(state.PreviousKeys, priv)
+	}
+
+	if *profiles != "" {
+		data, err := os.ReadFile(*profiles)
+		if err != nil {
+			ui.Fatal("Error reading profiles:", err)
+		}
+		if err := json.Unmarshal(data, &state.Profiles); err != nil {
+			ui.Fatal("Error decoding profiles:", err)
+		}
+	}
+
+	if *keystore != "" {
+		ks, _, err := openKeyStore(*keystore)
+		if err != nil {
+			ui.Fatal("Error loading keystore:", err)
+		}
+
+		hosts, err := ks.ListHosts()
+		if err != nil {
+			ui.Fatal("Error listing servers:", err)
+		}
+
+		state.KnownKeys = make(map[string]ed25519.PublicKey, len(hosts))
+		for _, host := range hosts {
+			pubkey, err := ks.GetPubkey(host)
+			if err != nil {
+				ui.Fatal("Error reading key:", err)
+			}
+			state.KnownKeys[host] = pubkey
+		}
+	}
+
+	passphrase := readPassphrase(ui, *passphraseFile)
+	if passphrase == nil {
+		ui.Println("Warning: the archive isn't encrypted, use --passphrase-file to encrypt it")
+	}
+
+	buf := &bytes.Buffer{}
+	if err := profilefed.WriteBackup(buf, state, passphrase); err != nil {
+		ui.Fatal("Error writing backup:", err)
+	}
+	if err := os.WriteFile(fs.Arg(0), buf.Bytes(), 0o600); err != nil {
+		ui.Fatal("Error writing backup:", err)
+	}
+
+	ui.Println("Backed up", *name, "to", fs.Arg(0))
+}
+
+// restore adjusts a backup archive for a server that's been moved to a new
+// name or key, so that the old name and key are kept as previous ones, and
+// optionally imports the keys pinned by the server into a keystore.
+func restore(args []string) {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	name := fs.String("name", "", "New name of the server, if it changed")
+	key := fs.String("key", "", "Path to the server's new private key, if it changed")
+	out := fs.String("out", "", "Path to write the restored archive to, which is encrypted with the same passphrase")
+	keystore := fs.String("keystore", "", "Path to a JSON keystore file or pfdstore directory to import the pinned keys into")
+	passphraseFile := fs.String("passphrase-file", "", "Path to a file containing the passphrase the archive is encrypted with")
+	quiet := fs.Bool("quiet", false, "Don't print any messages to stderr, only results and the exit code")
+	fs.Parse(args)
+
+	ui := cli.Output{Quiet: *quiet}
+
+	if fs.NArg() < 1 {
+		ui.Exit(cli.ExitUsage, "pfdkeys restore requires an archive argument")
+	}
+	if *out == "" && *keystore == "" {
+		ui.Exit(cli.ExitUsage, "pfdkeys restore requires --out or --keystore")
+	}
+
+	passphrase := readPassphrase(ui, *passphraseFile)
+
+	fl, err := os.Open(fs.Arg(0))
+	if err != nil {
+		ui.Fatal("Error opening backup:", err)
+	}
+	state, err := profilefed.ReadBackup(fl, passphrase)
+	fl.Close()
+	if err != nil {
+		ui.Fatal("Error reading backup:", err)
+	}
+
+	var newKey ed25519.PrivateKey
+	if *key != "" {
+		newKey, err = profilefed.LoadPrivateKey(*key)
+		if err != nil {
+			ui.Fatal("Error loading key:", err)
+		}
+	}
+	state = state.RestoreTo(*name, newKey)
+
+	if *out != "" {
+		buf := &bytes.Buffer{}
+		if err := profilefed.WriteBackup(buf, state, passphrase); err != nil {
+			ui.Fatal("Error writing backup:", err)
+		}
+		if err := os.WriteFile(*out, buf.Bytes(), 0o600); err != nil {
+			ui.Fatal("Error writing backup:", err)
+		}
+	}
+
+	if *keystore != "" {
+		ks, save, err := openKeyStore(*keystore)
+		if err != nil {
+			ui.Fatal("Error loading keystore:", err)
+		}
+
+		for host, pubkey := range state.KnownKeys {
+			if err := ks.SavePubkey(host, nil, pubkey); err != nil {
+				ui.Fatal("Error saving key:", err)
+			}
+		}
+
+		if err := save(); err != nil {
+			ui.Fatal("Error saving keystore:", err)
+		}
+	}
+
+	ui.Println("Restored", state.ServerName)
+	if len(state.PreviousNames) > 0 {
+		ui.Println("Previous names:", strings.Join(state.PreviousNames, ", "))
+	}
+}
+
+// readPassphrase reads the passphrase from path, without any trailing
+// newline. If path is empty, it returns nil.
+func readPassphrase(ui cli.Output, path string) []byte {
+	if path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		ui.Fatal("Error reading passphrase:", err)
+	}
+
+	passphrase := bytes.TrimRight(data, "\r\n")
+	if len(passphrase) == 0 {
+		ui.Exit(cli.ExitUsage, "Passphrase file is empty")
+	}
+	return passphrase
+}
+
+// appendTo returns a flag function that appends the flag's values to s.
+func appendTo(s *[]string) func(string) error {
+	return func(v string) error {
+		*s = append(*s, v)
+		return nil
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"queerdevs.org/profilefed"
+	"queerdevs.org/profilefed/internal/cli"
+)
+
+func main() {
+	flag.Usage = func() {
+		out := flag.CommandLine.Output()
+		fmt.Fprintln(out, "Usage:")
+		fmt.Fprintln(out, "  pfdkeys fingerprint [flags] <key file>")
+		fmt.Fprintln(out, "  pfdkeys list --keystore <path>")
+		fmt.Fprintln(out, "  pfdkeys show --keystore <path> <server>")
+		fmt.Fprintln(out, "  pfdkeys delete --keystore <path> <server>")
+		fmt.Fprintln(out, "  pfdkeys backup --name <server> [flags] <archive>")
+		fmt.Fprintln(out, "  pfdkeys restore [flags] <archive>")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(cli.ExitUsage)
+	}
+
+	switch flag.Arg(0) {
+	case "fingerprint":
+		fingerprint(flag.Args()[1:])
+	case "list", "show", "delete":
+		manage(flag.Arg(0), flag.Args()[1:])
+	case "backup":
+		backup(flag.Args()[1:])
+	case "restore":
+		restore(flag.Args()[1:])
+	default:
+		fmt.Fprintln(os.Stderr, "Unknown command:", flag.Arg(0))
+		flag.Usage()
+		os.Exit(cli.ExitUsage)
+	}
+}
+
+// fingerprint prints the fingerprint of a key file, optionally
+// comparing it to a fingerprint given by the operator.
+func fingerprint(args []string) {
+	fs := flag.NewFlagSet("fingerprint", flag.ExitOnError)
+	compare := fs.String("compare", "", "Fingerprint to compare the key's fingerprint to, in any of the printed formats")
+	quiet := fs.Bool("quiet", false, "Don't print any messages to stderr, only results and the exit code")
+	fs.Parse(args)
+
+	ui := cli.Output{Quiet: *quiet}
+
+	if fs.NArg() < 1 {
+		ui.Exit(cli.ExitUsage, "pfdkeys fingerprint requires a key file argument")
+	}
+
+	pubkey, err := loadPublicKey(fs.Arg(0))
+	if err != nil {
+		ui.Fatal("Error loading key:", err)
+	}
+
+	if *compare != "" {
+		if !cli.MatchFingerprint(pubkey, *compare) {
+			ui.Exit(cli.ExitVerificationFailed, "Fingerprint does not match")
+		}
+		ui.Println("Fingerprint matches")
+		return
+	}
+
+	cli.PrintFingerprint(os.Stdout, pubkey)
+}
+
+// loadPublicKey loads the public key from path, which can be either a public
+// key or a private key. If the private key is encrypted, the public key is
+// loaded from the .pub file next to it instead, so no passphrase is needed.
+func loadPublicKey(path string) (ed25519.PublicKey, error) {
+	if pubkey, err := profilefed.LoadPublicKey(path); err == nil {
+		return pubkey, nil
+	}
+
+	priv, err := profilefed.LoadPrivateKey(path)
+	if errors.Is(err, profilefed.ErrEncryptedKey) {
+		return profilefed.LoadPublicKey(path + ".pub")
+	} else if err != nil {
+		return nil, err
+	}
+
+	return priv.Public().(ed25519.PublicKey), nil
+}
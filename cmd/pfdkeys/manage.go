@@ -0,0 +1,98 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"queerdevs.org/profilefed"
+	"queerdevs.org/profilefed/internal/cli"
+	"queerdevs.org/profilefed/pfdstore"
+)
+
+// manage runs the list, show, and delete commands,
+// which manage the server keys pinned in a keystore.
+func manage(cmd string, args []string) {
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	keystore := fs.String("keystore", "", "Path to a JSON keystore file, as used by pfdlookup, or a pfdstore directory")
+	quiet := fs.Bool("quiet", false, "Don't print any messages to stderr, only results and the exit code")
+	fs.Parse(args)
+
+	ui := cli.Output{Quiet: *quiet}
+
+	if *keystore == "" {
+		ui.Exit(cli.ExitUsage, "pfdkeys", cmd, "requires --keystore")
+	}
+	if cmd != "list" && fs.NArg() < 1 {
+		ui.Exit(cli.ExitUsage, "pfdkeys", cmd, "requires a server argument")
+	}
+
+	ks, save, err := openKeyStore(*keystore)
+	if err != nil {
+		ui.Fatal("Error loading keystore:", err)
+	}
+	client := profilefed.Client{}.WithKeyStore(ks)
+
+	switch cmd {
+	case "list":
+		hosts, err := client.ListHosts()
+		if err != nil {
+			ui.Fatal("Error listing servers:", err)
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "SERVER\tFINGERPRINT\tFIRST SEEN\tLAST VERIFIED")
+		for _, host := range hosts {
+			info, err := client.GetKeyInfo(host)
+			if err != nil {
+				ui.Fatal("Error reading key:", err)
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", host, profilefed.Fingerprint(info.PublicKey), formatTime(info.FirstSeen), formatTime(info.LastVerified))
+		}
+		tw.Flush()
+	case "show":
+		info, err := client.GetKeyInfo(fs.Arg(0))
+		if err != nil {
+			ui.Fatal("Error reading key:", err)
+		}
+
+		fmt.Println("server:       ", info.ServerName)
+		fmt.Println("first seen:   ", formatTime(info.FirstSeen))
+		fmt.Println("last verified:", formatTime(info.LastVerified))
+		cli.PrintFingerprint(os.Stdout, info.PublicKey)
+	case "delete":
+		if err := client.DeleteHost(fs.Arg(0)); err != nil {
+			ui.Fatal("Error deleting key:", err)
+		}
+		if err := save(); err != nil {
+			ui.Fatal("Error saving keystore:", err)
+		}
+		ui.Println("Deleted key for", fs.Arg(0))
+	}
+}
+
+// openKeyStore opens the keystore at path, which is either a pfdstore
+// directory or a JSON keystore file. The returned function saves changes
+// to JSON keystore files, and does nothing for directories.
+func openKeyStore(path string) (profilefed.KeyStore, func() error, error) {
+	if fi, err := os.Stat(path); err == nil && fi.IsDir() {
+		fs, err := pfdstore.NewFileStore(path)
+		return fs, func() error { return nil }, err
+	}
+
+	mks, err := profilefed.LoadKeyStoreFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return mks, func() error { return mks.SaveFile(path) }, nil
+}
+
+// formatTime formats t for display, or returns "unknown" if it's zero.
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "unknown"
+	}
+	return t.Local().Format(time.DateTime)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// batchResult is a single line of output in batch mode.
+type batchResult struct {
+	Resource string `json:"resource"`
+	Result   any    `json:"result,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// runBatch looks up every resource read from r, one per line, and writes the
+// results to w as NDJSON in the order they complete. At most concurrency
+// lookups run at once, and at most rate lookups are started per second, unless
+// rate is zero. Empty lines and lines starting with # are skipped.
+func runBatch(r io.Reader, w io.Writer, concurrency int, rate float64, lookup func(res string) (any, error)) error {
+	var tick <-chan time.Time
+	if rate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / rate))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	var (
+		wg  sync.WaitGroup
+		mtx sync.Mutex
+		enc = json.NewEncoder(w)
+	)
+	resources := make(chan string)
+	for range max(concurrency, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for res := range resources {
+				result := batchResult{Resource: res}
+				out, err := lookup(res)
+				if err != nil {
+					result.Error = err.Error()
+				} else {
+					result.Result = out
+				}
+
+				mtx.Lock()
+				enc.Encode(result)
+				mtx.Unlock()
+			}
+		}()
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		res := strings.TrimSpace(scanner.Text())
+		if res == "" || strings.HasPrefix(res, "#") {
+			continue
+		}
+
+		if tick != nil {
+			<-tick
+		}
+		resources <- res
+	}
+	close(resources)
+	wg.Wait()
+
+	return scanner.Err()
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"queerdevs.org/profilefed"
+	"queerdevs.org/profilefed/diskcache"
+	"queerdevs.org/profilefed/internal/cli"
+)
+
+func main() {
+	id := flag.String("id", "", "The ID of the descriptor to look up")
+	all := flag.Bool("all", false, "Look up all of the user's descriptors")
+	fields := flag.String("fields", "", "Comma-separated list of fields to request (e.g. display_name,bio)")
+	keystore := flag.String("keystore", "", "Path to a JSON keystore used to pin server keys between runs")
+	cacheDir := flag.String("cache-dir", "", "Directory used to cache verified responses between runs")
+	cacheMaxAge := flag.Duration("cache-max-age", time.Hour, "Maximum age of cached responses before they're revalidated")
+	trace := flag.Bool("trace", false, "Print a transcript of every request and verification step to stderr, with credentials redacted")
+	batch := flag.Bool("batch", false, "Read accounts from stdin, one per line, and print the results as NDJSON")
+	concurrency := flag.Int("concurrency", 8, "Maximum number of concurrent lookups in batch mode")
+	rate := flag.Float64("rate", 10, "Maximum number of lookups started per second in batch mode (0 for no limit)")
+	format := flag.String("format", "json", "Output format (json or ndjson). Batch mode always uses ndjson")
+	quiet := flag.Bool("quiet", false, "Don't print any messages to stderr, only results and the exit code")
+	showKey := flag.Bool("show-key", false, "Print the fingerprint of the server's key to stderr, so it can be verified out of band")
+	allowlist := flag.String("allowlist", "", "Path to a file listing the only hosts that may be contacted, one per line")
+	flag.Parse()
+
+	ui := cli.Output{Quiet: *quiet}
+
+	if *format != "json" && *format != "ndjson" {
+		ui.Exit(cli.ExitUsage, "--format must be json or ndjson")
+	}
+
+	if flag.NArg() < 1 && !*batch {
+		ui.Exit(cli.ExitUsage, "pfdlookup requires an account argument (e.g. user@example.com)")
+	}
+
+	if *all && (*id != "" || *fields != "") {
+		ui.Exit(cli.ExitUsage, "--all can't be combined with --id or --fields")
+	} else if *id != "" && *fields != "" {
+		ui.Exit(cli.ExitUsage, "--fields can't be combined with --id")
+	}
+
+	if *showKey && *batch {
+		ui.Exit(cli.ExitUsage, "--show-key can't be combined with --batch")
+	}
+
+	client := profilefed.DefaultClient()
+	ks := &profilefed.MemoryKeyStore{}
+	if *keystore != "" {
+		var err error
+		ks, err = profilefed.LoadKeyStoreFile(*keystore)
+		if err != nil {
+			ui.Fatal("Error loading keystore:", err)
+		}
+	}
+	client = client.WithKeyStore(ks)
+
+	if *allowlist != "" {
+		al, err := profilefed.LoadHostAllowlist(*allowlist)
+		if err != nil {
+			ui.Fatal("Error loading allowlist:", err)
+		}
+		client.AllowHost = al.Allowed
+	}
+
+	if *cacheDir != "" {
+		cache, err := diskcache.New(*cacheDir)
+		if err != nil {
+			ui.Fatal("Error opening cache:", err)
+		}
+		client.Cache = cache
+		client.CacheMaxAge = *cacheMaxAge
+	}
+
+	// Remember the keys used to verify the lookup, so they can be shown
+	keys := map[string]ed25519.PublicKey{}
+	if *showKey {
+		getPubkey, savePubkey := client.GetPubkey, client.SavePubkey
+		client.GetPubkey = func(serverName string) (ed25519.PublicKey, error) {
+			pubkey, err := getPubkey(serverName)
+			if err == nil {
+				keys[serverName] = pubkey
+			}
+			return pubkey, err
+		}
+		client.SavePubkey = func(serverName string, previousNames []string, pubkey ed25519.PublicKey) error {
+			keys[serverName] = pubkey
+			return savePubkey(serverName, previousNames, pubkey)
+		}
+	}
+
+	if *trace {
+		client = client.WithTrace(func(msg string) { fmt.Fprintln(os.Stderr, msg) })
+	}
+
+	lookup := func(res string) (any, error) {
+		switch {
+		case *all:
+			return client.LookupAll(res)
+		case *fields != "":
+			return client.LookupFields(res, strings.Split(*fields, ",")...)
+		case *id != "":
+			return client.LookupID(res, *id)
+		default:
+			return client.Lookup(res)
+		}
+	}
+
+	if *batch {
+		err := runBatch(os.Stdin, os.Stdout, *concurrency, *rate, lookup)
+		saveKeyStore(ui, ks, *keystore)
+		if err != nil {
+			ui.Fatal("Error reading accounts:", err)
+		}
+		return
+	}
+
+	out, err := lookup(flag.Arg(0))
+	if err != nil {
+		ui.Fatal("Lookup error:", err)
+	}
+	saveKeyStore(ui, ks, *keystore)
+
+	if *showKey && !*quiet {
+		showKeys(keys)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	if *format == "json" {
+		enc.SetIndent("", "  ")
+	}
+
+	// In NDJSON mode, every descriptor gets its own line
+	if descs, ok := out.(map[string]*profilefed.Descriptor); ok && *format == "ndjson" {
+		ids := make([]string, 0, len(descs))
+		for id := range descs {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+
+		for _, id := range ids {
+			if err := enc.Encode(descs[id]); err != nil {
+				ui.Fatal("JSON encode error:", err)
+			}
+		}
+		return
+	}
+
+	err = enc.Encode(out)
+	if err != nil {
+		ui.Fatal("JSON encode error:", err)
+	}
+}
+
+// saveKeyStore saves ks to path, if it's set.
+func saveKeyStore(ui cli.Output, ks *profilefed.MemoryKeyStore, path string) {
+	if path == "" {
+		return
+	}
+
+	if err := ks.SaveFile(path); err != nil {
+		ui.Fatal("Error saving keystore:", err)
+	}
+}
+
+// showKeys prints the fingerprints of keys to stderr, sorted by server name.
+func showKeys(keys map[string]ed25519.PublicKey) {
+	names := make([]string, 0, len(keys))
+	for name := range keys {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "Key for %s:\n", name)
+		cli.PrintFingerprint(os.Stderr, keys[name])
+	}
+}
@@ -0,0 +1,76 @@
+package profilefed
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrLookupPanicked signifies that a coalesced lookup panicked. The panic is
+// recovered and returned as an error to every caller sharing the lookup.
+var ErrLookupPanicked = errors.New("lookup panicked")
+
+// LookupGroup coalesces concurrent identical lookups, so that when many
+// callers look up the same profile at the same time, only one network
+// round trip and verification is performed and all of them share the result.
+//
+// The zero value is ready to use.
+type LookupGroup struct {
+	mtx   sync.Mutex
+	calls map[lookupKey]*lookupCall
+}
+
+// lookupKey identifies a lookup for coalescing purposes.
+type lookupKey struct {
+	host     string
+	resource string // the descriptor URL
+	params   lookupParams
+}
+
+type lookupCall struct {
+	wg  sync.WaitGroup
+	res *fetchResult
+	err error
+}
+
+// do executes fn, making sure only one execution is in flight for the given key
+// at a time. If a duplicate call comes in, it waits for the original to complete
+// and receives the same results.
+func (g *LookupGroup) do(key lookupKey, fn func() (*fetchResult, error)) (*fetchResult, error) {
+	g.mtx.Lock()
+	if g.calls == nil {
+		g.calls = map[lookupKey]*lookupCall{}
+	}
+
+	if c, ok := g.calls[key]; ok {
+		g.mtx.Unlock()
+		c.wg.Wait()
+		return c.res, c.err
+	}
+
+	c := &lookupCall{}
+	c.wg.Add(1)
+	g.calls[key] = c
+	g.mtx.Unlock()
+
+	defer func() {
+		g.mtx.Lock()
+		delete(g.calls, key)
+		g.mtx.Unlock()
+		c.wg.Done()
+	}()
+
+	c.res, c.err = callLookup(fn)
+	return c.res, c.err
+}
+
+// callLookup calls fn, converting a panic into an error, so that
+// callers waiting for the lookup don't receive a nil result.
+func callLookup(fn func() (*fetchResult, error)) (res *fetchResult, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			res, err = nil, fmt.Errorf("%w: %v", ErrLookupPanicked, r)
+		}
+	}()
+	return fn()
+}
@@ -0,0 +1,95 @@
+package profilefed
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLookupGroupDedup(t *testing.T) {
+	var g LookupGroup
+	key := lookupKey{host: "example.test", resource: "http://example.test/pfd/user"}
+
+	var calls atomic.Int32
+	release := make(chan struct{})
+	fn := func() (*fetchResult, error) {
+		calls.Add(1)
+		<-release
+		return &fetchResult{contentHash: "hash"}, nil
+	}
+
+	const n = 10
+	results := make([]*fetchResult, n)
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := g.do(key, fn)
+			if err != nil {
+				t.Errorf("do error: %s", err)
+			}
+			results[i] = res
+		}()
+	}
+
+	// Give the duplicate calls time to start waiting
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls.Load() != 1 {
+		t.Errorf("Expected 1 call, got %d", calls.Load())
+	}
+	for i, res := range results {
+		if res != results[0] {
+			t.Errorf("Result %d isn't shared", i)
+		}
+	}
+
+	// Once the call is done, the next one runs again
+	if _, err := g.do(key, fn); err != nil || calls.Load() != 2 {
+		t.Errorf("Expected a new call, got %d calls, %v", calls.Load(), err)
+	}
+}
+
+func TestLookupGroupPanic(t *testing.T) {
+	var g LookupGroup
+	key := lookupKey{host: "example.test", resource: "http://example.test/pfd/user"}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	errs := make(chan error, 1)
+	go func() {
+		_, err := g.do(key, func() (*fetchResult, error) {
+			close(started)
+			<-release
+			panic("boom")
+		})
+		errs <- err
+	}()
+
+	<-started
+	waiter := make(chan error, 1)
+	go func() {
+		res, err := g.do(key, func() (*fetchResult, error) {
+			return &fetchResult{}, nil
+		})
+		if res != nil {
+			t.Errorf("Expected no result, got %#v", res)
+		}
+		waiter <- err
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	if err := <-errs; !errors.Is(err, ErrLookupPanicked) {
+		t.Errorf("Expected ErrLookupPanicked, got %v", err)
+	}
+	if err := <-waiter; !errors.Is(err, ErrLookupPanicked) {
+		t.Errorf("Expected ErrLookupPanicked for waiter, got %v", err)
+	}
+}
@@ -0,0 +1,191 @@
+package profilefed
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	// cosigHeader is the header containing a co-signature of the server info.
+	cosigHeader = "X-ProfileFed-Cosig"
+	// cosignPrefix is prepended to the server info before it's co-signed,
+	// so that co-signatures can't be mistaken for signatures of responses.
+	cosignPrefix = "profilefed-cosign:"
+)
+
+// ErrQuorumNotMet signifies that a server info declares a co-signing policy,
+// but isn't signed by enough of its co-signers, or that it doesn't declare a
+// policy required by the client. Errors returned for this reason are [QuorumError]s.
+var ErrQuorumNotMet = errors.New("server info co-signature quorum not met")
+
+// CosignerPolicy declares that a server's info has to be co-signed by at least
+// Threshold of the given keys, so that no single administrator can change the
+// server's key. It's part of the server info, so changing it requires a quorum
+// of the current co-signers as well.
+type CosignerPolicy struct {
+	// Threshold is the number of co-signatures required.
+	Threshold int `json:"threshold"`
+	// Keys contains the Ed25519 public keys of the co-signers.
+	Keys []ed25519.PublicKey `json:"keys"`
+}
+
+// Cosignature is a signature of a server info made by one of its co-signers.
+type Cosignature struct {
+	// Key is the public key of the co-signer.
+	Key ed25519.PublicKey
+	// Signature is the co-signer's signature of the server info.
+	Signature []byte
+}
+
+// QuorumError is returned when a server info doesn't meet its co-signing
+// policy or the one required by [Client.MinCosigners].
+type QuorumError struct {
+	// Host is the server whose info was rejected.
+	Host string
+	// Threshold is the number of valid co-signatures required.
+	Threshold int
+	// Valid is the number of valid co-signatures the server info had.
+	Valid int
+}
+
+func (qe QuorumError) Error() string {
+	return fmt.Sprintf("%s: server info for %s has %d of %d required co-signatures", ErrQuorumNotMet, qe.Host, qe.Valid, qe.Threshold)
+}
+
+// Is allows QuorumError to be matched with [errors.Is] against [ErrQuorumNotMet].
+func (qe QuorumError) Is(target error) bool {
+	return target == ErrQuorumNotMet
+}
+
+// Cosign co-signs a server info document returned by [ServerInfoHandler.Document]
+// using signer, which has to hold one of the keys in the server's [CosignerPolicy].
+func Cosign(signer crypto.Signer, document []byte) (Cosignature, error) {
+	pubkey, err := signerPublicKey(signer)
+	if err != nil {
+		return Cosignature{}, err
+	}
+
+	sig, err := sign(signer, append([]byte(cosignPrefix), document...))
+	if err != nil {
+		return Cosignature{}, err
+	}
+	return Cosignature{Key: pubkey, Signature: sig}, nil
+}
+
+// Document returns the server info document served by the handler, which
+// has to be co-signed using [Cosign] if the handler has a co-signing policy.
+// The document changes whenever the server's names, key, or policy change.
+func (sih ServerInfoHandler) Document() ([]byte, error) {
+	pubkey, _, _, err := sih.keys()
+	if err != nil {
+		return nil, err
+	}
+	return sih.document(pubkey)
+}
+
+// document returns the server info document for the given current key.
+func (sih ServerInfoHandler) document(pubkey ed25519.PublicKey) ([]byte, error) {
+	return json.Marshal(serverInfoData{
+		ServerName:     normalizeHost(sih.ServerName),
+		PreviousNames:  normalizeHosts(sih.PreviousNames),
+		AlternateNames: normalizeHosts(sih.AlternateNames),
+		PublicKey:      base64.StdEncoding.EncodeToString(pubkey),
+		Fingerprint:    Fingerprint(pubkey),
+		Cosigners:      sih.Cosigners,
+	})
+}
+
+// setCosignatures adds the co-signature headers to h.
+func setCosignatures(h http.Header, cosigs []Cosignature) {
+	for _, cosig := range cosigs {
+		h.Add(cosigHeader, fmt.Sprintf("key=%s, sig=%s",
+			base64.StdEncoding.EncodeToString(cosig.Key),
+			base64.StdEncoding.EncodeToString(cosig.Signature),
+		))
+	}
+}
+
+// getCosignatures extracts co-signatures from a response. Malformed ones are skipped.
+func getCosignatures(res *http.Response) []Cosignature {
+	var out []Cosignature
+	for _, val := range res.Header.Values(cosigHeader) {
+		var cosig Cosignature
+		for _, param := range strings.Split(val, ",") {
+			key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			decoded, err := base64.StdEncoding.DecodeString(value)
+			if err != nil {
+				continue
+			}
+
+			switch key {
+			case "key":
+				cosig.Key = decoded
+			case "sig":
+				cosig.Signature = decoded
+			}
+		}
+
+		if cosig.Key != nil && cosig.Signature != nil {
+			out = append(out, cosig)
+		}
+	}
+	return out
+}
+
+// checkQuorum verifies that the server info in data, retrieved from host in
+// res, is co-signed by enough of the co-signers declared in it, and that it
+// meets the client's MinCosigners. Server infos without a policy are accepted
+// unless MinCosigners is set.
+func (c Client) checkQuorum(res *http.Response, host string, data []byte) error {
+	var info serverInfoData
+	if err := json.Unmarshal(data, &info); err != nil {
+		return err
+	}
+
+	policy := info.Cosigners
+	if policy == nil {
+		if c.MinCosigners > 0 {
+			c.tracef("server info from %s has no co-signing policy, but %d co-signers are required", host, c.MinCosigners)
+			c.observe(host, OutcomeQuorumNotMet)
+			return QuorumError{Host: host, Threshold: c.MinCosigners}
+		}
+		return nil
+	}
+
+	// A policy that can be met without anyone's help is no policy at all
+	threshold := max(policy.Threshold, c.MinCosigners, 1)
+
+	signed := append([]byte(cosignPrefix), data...)
+	var valid int
+	seen := map[string]bool{}
+	for _, cosig := range getCosignatures(res) {
+		listed := false
+		for _, key := range policy.Keys {
+			if key.Equal(cosig.Key) {
+				listed = true
+				break
+			}
+		}
+
+		if !listed || seen[string(cosig.Key)] || !verify(cosig.Key, signed, cosig.Signature) {
+			continue
+		}
+		seen[string(cosig.Key)] = true
+		valid++
+	}
+
+	if valid < threshold {
+		c.tracef("server info from %s has %d of %d required co-signatures", host, valid, threshold)
+		c.observe(host, OutcomeQuorumNotMet)
+		return QuorumError{Host: host, Threshold: threshold, Valid: valid}
+	}
+
+	c.tracef("server info from %s has %d of %d required co-signatures", host, valid, threshold)
+	return nil
+}
@@ -0,0 +1,83 @@
+package profilefed
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"testing"
+)
+
+func TestCosigners(t *testing.T) {
+	desc := &Descriptor{ID: "main", Username: "user", DisplayName: "User"}
+
+	var (
+		cosigners []ed25519.PrivateKey
+		policy    = &CosignerPolicy{Threshold: 2}
+	)
+	for range 3 {
+		pub, priv, err := GenerateKeys()
+		if err != nil {
+			t.Fatalf("GenerateKeys error: %s", err)
+		}
+		cosigners = append(cosigners, priv)
+		policy.Keys = append(policy.Keys, pub)
+	}
+
+	tenant := func(host string, signers ...ed25519.PrivateKey) *ServerInfoHandler {
+		_, priv, err := GenerateKeys()
+		if err != nil {
+			t.Fatalf("GenerateKeys error: %s", err)
+		}
+
+		sih := &ServerInfoHandler{ServerName: host, PrivateKey: priv, Cosigners: policy}
+		doc, err := sih.Document()
+		if err != nil {
+			t.Fatalf("Document error: %s", err)
+		}
+
+		for _, signer := range signers {
+			cosig, err := Cosign(signer, doc)
+			if err != nil {
+				t.Fatalf("Cosign error: %s", err)
+			}
+			sih.Cosignatures = append(sih.Cosignatures, cosig)
+		}
+		return sih
+	}
+
+	quorum := tenant("quorum.test", cosigners[0], cosigners[2])
+	// Signing twice with the same key doesn't count twice
+	noQuorum := tenant("noquorum.test", cosigners[1], cosigners[1])
+	noPolicy := tenant("nopolicy.test")
+	noPolicy.Cosigners = nil
+
+	mt := &MemoryTransport{}
+	for _, sih := range []*ServerInfoHandler{quorum, noQuorum, noPolicy} {
+		mt.Register(sih.ServerName, tenantMux(sih.ServerName, *sih, Handler{
+			PrivateKey: sih.PrivateKey,
+			DescriptorFunc: func(req *Request) (*Descriptor, error) {
+				return desc, nil
+			},
+		}))
+	}
+
+	c := mt.Client()
+	if _, err := c.Lookup("user@quorum.test"); err != nil {
+		t.Fatalf("Lookup error: %s", err)
+	}
+
+	_, err := c.Lookup("user@noquorum.test")
+	var qe QuorumError
+	if !errors.As(err, &qe) || qe.Valid != 1 || qe.Threshold != 2 {
+		t.Errorf("Expected QuorumError with 1 of 2 co-signatures, got %v", err)
+	}
+
+	if _, err := c.Lookup("user@nopolicy.test"); err != nil {
+		t.Fatalf("Lookup error: %s", err)
+	}
+
+	c = mt.Client()
+	c.MinCosigners = 1
+	if _, err := c.Lookup("user@nopolicy.test"); !errors.Is(err, ErrQuorumNotMet) {
+		t.Errorf("Expected ErrQuorumNotMet, got %v", err)
+	}
+}
@@ -0,0 +1,196 @@
+package profilefed
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	// DefaultDeliveryAttempts is the number of attempts made by
+	// a [Deliverer] if its MaxAttempts is zero.
+	DefaultDeliveryAttempts = 5
+	// DefaultDeliveryBackoff is the delay before the first retry made
+	// by a [Deliverer] if its Backoff is zero.
+	DefaultDeliveryBackoff = time.Second
+	// maxDeliveryBackoff is the maximum delay between two delivery attempts.
+	maxDeliveryBackoff = 5 * time.Minute
+)
+
+// Deliverer delivers signed messages to the inboxes of other servers,
+// retrying with exponential backoff if delivery fails temporarily.
+// Messages can either be delivered directly, or queued and delivered
+// in the background.
+type Deliverer struct {
+	// PrivateKey contains the server's Ed25519 private key for signing messages.
+	PrivateKey ed25519.PrivateKey
+	// Signer, if set, signs messages instead of PrivateKey. See [Handler.Signer].
+	Signer crypto.Signer
+	// Rotator, if set, provides the key used to sign messages instead of PrivateKey.
+	Rotator *KeyRotator
+
+	// Client is used to send messages. Its HTTP client and policy apply.
+	Client Client
+	// Scheme is the URL scheme used to contact inboxes. If empty, https is used.
+	Scheme string
+
+	// Queue, if set, stores messages added using [Deliverer.Enqueue] until
+	// they're delivered by [Deliverer.Run].
+	Queue DeliveryQueue
+	// PollInterval is how often Run checks the queue for due deliveries.
+	// If it's zero, [DefaultPollInterval] is used.
+	PollInterval time.Duration
+
+	// MaxAttempts is the maximum number of delivery attempts for a message.
+	// If it's zero, [DefaultDeliveryAttempts] is used.
+	MaxAttempts int
+	// Backoff is the delay before the first retry, which doubles after every
+	// attempt. If a server sends a Retry-After header, the delay it asks for
+	// is used instead. If it's zero, [DefaultDeliveryBackoff] is used.
+	Backoff time.Duration
+}
+
+// Deliver signs msg and delivers it to the inbox of its recipient. Network
+// errors, rate limiting, and server errors are retried until the message is
+// accepted, MaxAttempts is reached, or ctx is canceled. Other errors, such as
+// the recipient rejecting the message, are returned immediately.
+//
+// Deliver blocks while it waits between attempts. To deliver messages in
+// the background and keep them across restarts, use [Deliverer.Enqueue].
+func (d Deliverer) Deliver(ctx context.Context, msg *Message) error {
+	for attempt := 1; ; attempt++ {
+		err := d.attempt(ctx, msg)
+		if err == nil || attempt == d.maxAttempts() || !retryable(err) {
+			return err
+		}
+
+		delay := d.retryDelay(attempt, err)
+		d.Client.tracef("delivery of message %s to %s failed, retrying in %s: %s", msg.ID, msg.To, delay, err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// attempt signs msg and makes a single attempt to deliver it. The creation
+// time of the message is updated, so that recipients don't reject retries
+// as expired.
+func (d Deliverer) attempt(ctx context.Context, msg *Message) error {
+	signer := keySigner(d.Signer, d.PrivateKey)
+	if d.Signer == nil && d.Rotator != nil {
+		signer = d.Rotator.PrivateKey()
+	}
+
+	signedMsg := *msg
+	signedMsg.Created = time.Now().UTC()
+	data, sig, err := signMessage(signer, &signedMsg)
+	if err != nil {
+		return err
+	}
+
+	scheme := d.Scheme
+	if scheme == "" {
+		scheme = "https"
+	}
+	return d.send(ctx, &url.URL{Scheme: scheme, Host: msg.To, Path: InboxPath}, data, sig)
+}
+
+// maxAttempts returns the maximum number of delivery attempts for a message.
+func (d Deliverer) maxAttempts() int {
+	if d.MaxAttempts == 0 {
+		return DefaultDeliveryAttempts
+	}
+	return d.MaxAttempts
+}
+
+// retryDelay returns the delay before the next attempt after the given number
+// of failed attempts, the last of which failed with err. The delay doubles
+// after every attempt, unless the server asked for a specific delay.
+func (d Deliverer) retryDelay(attempts int, err error) time.Duration {
+	if retryAfter, ok := RetryAfter(err); ok {
+		return retryAfter
+	}
+
+	delay := d.Backoff
+	if delay == 0 {
+		delay = DefaultDeliveryBackoff
+	}
+
+	for range attempts - 1 {
+		delay *= 2
+		if delay >= maxDeliveryBackoff {
+			return maxDeliveryBackoff
+		}
+	}
+	return delay
+}
+
+// send makes a single delivery attempt.
+func (d Deliverer) send(ctx context.Context, inboxURL *url.URL, data, sig []byte) error {
+	if err := d.Client.checkURL(inboxURL); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, inboxURL.String(), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-ProfileFed-Sig", base64.StdEncoding.EncodeToString(sig))
+	setContentDigest(req.Header, data)
+
+	res, err := d.Client.httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusOK || res.StatusCode == http.StatusAccepted || res.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return checkResp(res, "deliverMessage")
+}
+
+// retryable reports whether a failed delivery attempt should be retried.
+func retryable(err error) bool {
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return retryableStatus(httpErr.StatusCode)
+	}
+
+	if errors.Is(err, ErrInsecureURL) {
+		return false
+	}
+	return retryableNetError(err)
+}
+
+// retryableStatus reports whether a response with the given status code
+// indicates a temporary failure, such as rate limiting or a server error.
+func retryableStatus(code int) bool {
+	// 501 means the server doesn't support the request
+	return code == http.StatusTooManyRequests ||
+		(code >= 500 && code != http.StatusNotImplemented)
+}
+
+// retryableNetError reports whether err is a network error,
+// such as a connection failure, that may be temporary.
+func retryableNetError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	// Errors returned by the HTTP client, such as connection
+	// failures, implement net.Error.
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
@@ -0,0 +1,283 @@
+package profilefed
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+var (
+	// ErrInvalidDID signifies that a DID string is malformed or uses an unsupported method.
+	ErrInvalidDID = errors.New("invalid or unsupported did")
+	// ErrDIDMismatch signifies that a DID document's id doesn't match the requested DID.
+	ErrDIDMismatch = errors.New("did document id does not match requested did")
+	// ErrDIDKeyNotAuthorized signifies that a key isn't authorized by a DID document.
+	ErrDIDKeyNotAuthorized = errors.New("key is not authorized by did document")
+)
+
+// DIDDocument represents a DID document as defined by the W3C DID Core specification.
+// Only the members relevant to ProfileFed are decoded.
+type DIDDocument struct {
+	ID                 string               `json:"id"`
+	AlsoKnownAs        []string             `json:"alsoKnownAs,omitempty"`
+	VerificationMethod []VerificationMethod `json:"verificationMethod,omitempty"`
+	// Authentication and AssertionMethod contain either verification
+	// method IDs or embedded verification method objects.
+	Authentication  []json.RawMessage `json:"authentication,omitempty"`
+	AssertionMethod []json.RawMessage `json:"assertionMethod,omitempty"`
+}
+
+// VerificationMethod represents a verification method in a DID document
+type VerificationMethod struct {
+	ID                 string          `json:"id"`
+	Type               string          `json:"type"`
+	Controller         string          `json:"controller"`
+	PublicKeyBase58    string          `json:"publicKeyBase58,omitempty"`
+	PublicKeyMultibase string          `json:"publicKeyMultibase,omitempty"`
+	PublicKeyJWK       json.RawMessage `json:"publicKeyJwk,omitempty"`
+}
+
+// DIDWebURL returns the URL of the DID document for the given did:web DID.
+// For example, did:web:example.com resolves to https://example.com/.well-known/did.json
+// and did:web:example.com:user:alice resolves to https://example.com/user/alice/did.json.
+func DIDWebURL(did string) (string, error) {
+	id, ok := strings.CutPrefix(did, "did:web:")
+	if !ok || id == "" {
+		return "", ErrInvalidDID
+	}
+
+	parts := strings.Split(id, ":")
+	host, err := url.PathUnescape(parts[0])
+	if err != nil || host == "" || strings.ContainsAny(host, "/?#@") {
+		return "", ErrInvalidDID
+	}
+
+	u := url.URL{Scheme: "https", Host: host}
+	if len(parts) == 1 {
+		u.Path = "/.well-known/did.json"
+	} else {
+		segments := make([]string, len(parts)-1)
+		for i, part := range parts[1:] {
+			segments[i], err = url.PathUnescape(part)
+			if err != nil || segments[i] == "" {
+				return "", ErrInvalidDID
+			}
+		}
+		u.Path = "/" + strings.Join(segments, "/") + "/did.json"
+	}
+
+	return u.String(), nil
+}
+
+// ResolveDIDWeb fetches and decodes the DID document for the given did:web DID.
+func ResolveDIDWeb(did string) (*DIDDocument, error) {
+	return Client{}.resolveDIDWeb(did)
+}
+
+// resolveDIDWeb fetches and decodes the DID document for the given did:web DID,
+// using the client's HTTP client and transport policy.
+func (c Client) resolveDIDWeb(did string) (*DIDDocument, error) {
+	docURL, err := DIDWebURL(did)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodGet, docURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.checkURL(req.URL); err != nil {
+		return nil, err
+	}
+
+	res, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if err := checkResp(res, "resolveDIDWeb"); err != nil {
+		return nil, err
+	}
+
+	doc := &DIDDocument{}
+	err = json.NewDecoder(io.LimitReader(res.Body, responseSizeLimit)).Decode(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	if doc.ID != did {
+		return nil, ErrDIDMismatch
+	}
+
+	return doc, nil
+}
+
+// AssertionKeys returns all the Ed25519 keys the DID document authorizes
+// to make assertions on behalf of the DID subject. Keys referenced by either
+// the assertionMethod or authentication relationships are included.
+func (d *DIDDocument) AssertionKeys() []ed25519.PublicKey {
+	var out []ed25519.PublicKey
+	for _, rel := range slices.Concat(d.AssertionMethod, d.Authentication) {
+		vm, ok := d.resolveMethod(rel)
+		if !ok {
+			continue
+		}
+
+		key, err := vm.Ed25519Key()
+		if err != nil {
+			continue
+		}
+		out = append(out, key)
+	}
+	return out
+}
+
+// Authorizes reports whether the DID document authorizes the given key.
+func (d *DIDDocument) Authorizes(key ed25519.PublicKey) bool {
+	return slices.ContainsFunc(d.AssertionKeys(), func(k ed25519.PublicKey) bool {
+		return k.Equal(key)
+	})
+}
+
+// resolveMethod resolves a verification relationship entry, which
+// may either be a reference to a verification method or an embedded one.
+func (d *DIDDocument) resolveMethod(rel json.RawMessage) (VerificationMethod, bool) {
+	var ref string
+	if err := json.Unmarshal(rel, &ref); err == nil {
+		for _, vm := range d.VerificationMethod {
+			// References may be relative to the document ID
+			if vm.ID == ref || d.ID+vm.ID == ref || vm.ID == d.ID+ref {
+				return vm, true
+			}
+		}
+		return VerificationMethod{}, false
+	}
+
+	var vm VerificationMethod
+	if err := json.Unmarshal(rel, &vm); err != nil {
+		return VerificationMethod{}, false
+	}
+	return vm, true
+}
+
+// Ed25519Key decodes the Ed25519 public key contained in the verification method.
+func (vm VerificationMethod) Ed25519Key() (ed25519.PublicKey, error) {
+	var key []byte
+	switch {
+	case vm.PublicKeyBase58 != "":
+		var err error
+		key, err = decodeBase58(vm.PublicKeyBase58)
+		if err != nil {
+			return nil, err
+		}
+	case vm.PublicKeyMultibase != "":
+		// Only base58btc multibase values are supported
+		mb, ok := strings.CutPrefix(vm.PublicKeyMultibase, "z")
+		if !ok {
+			return nil, errors.New("unsupported multibase encoding")
+		}
+
+		data, err := decodeBase58(mb)
+		if err != nil {
+			return nil, err
+		}
+
+		// Multikey values are prefixed with the ed25519-pub multicodec
+		// (0xed01), while Ed25519VerificationKey2020 values may not be.
+		key = data
+		if len(data) == ed25519.PublicKeySize+2 && data[0] == 0xed && data[1] == 0x01 {
+			key = data[2:]
+		}
+	case len(vm.PublicKeyJWK) > 0:
+		var jwk struct {
+			Kty string `json:"kty"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+		}
+		if err := json.Unmarshal(vm.PublicKeyJWK, &jwk); err != nil {
+			return nil, err
+		}
+
+		if jwk.Kty != "OKP" || jwk.Crv != "Ed25519" {
+			return nil, errors.New("jwk is not an ed25519 key")
+		}
+
+		var err error
+		key, err = base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("verification method contains no public key")
+	}
+
+	if len(key) != ed25519.PublicKeySize {
+		return nil, errors.New("invalid ed25519 key length")
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// VerifyDID resolves the DID declared by the given descriptor, and checks
+// that the DID document authorizes either the key pinned for the server
+// at host, or one of the provided user keys. If the descriptor doesn't
+// declare a DID, VerifyDID returns [ErrInvalidDID].
+func (c Client) VerifyDID(host string, desc *Descriptor, userKeys ...ed25519.PublicKey) error {
+	if desc.DID == "" {
+		return ErrInvalidDID
+	}
+
+	doc, err := c.resolveDIDWeb(desc.DID)
+	if err != nil {
+		return err
+	}
+
+	pubkey, err := c.getPubkey(host)
+	if err != nil && !errors.Is(err, ErrPubkeyNotFound) {
+		return err
+	}
+
+	if pubkey != nil && doc.Authorizes(pubkey) {
+		return nil
+	}
+
+	for _, key := range userKeys {
+		if doc.Authorizes(key) {
+			return nil
+		}
+	}
+
+	return ErrDIDKeyNotAuthorized
+}
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// decodeBase58 decodes a string encoded using the Bitcoin base58 alphabet.
+func decodeBase58(s string) ([]byte, error) {
+	n := new(big.Int)
+	radix := big.NewInt(58)
+	for _, r := range s {
+		i := strings.IndexRune(base58Alphabet, r)
+		if i < 0 {
+			return nil, errors.New("invalid base58 character")
+		}
+		n.Mul(n, radix)
+		n.Add(n, big.NewInt(int64(i)))
+	}
+
+	// Leading ones represent leading zero bytes
+	zeros := 0
+	for zeros < len(s) && s[zeros] == '1' {
+		zeros++
+	}
+
+	return append(make([]byte, zeros), n.Bytes()...), nil
+}
@@ -0,0 +1,108 @@
+package profilefed
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestDIDWebURL(t *testing.T) {
+	tests := map[string]string{
+		"did:web:example.com":                "https://example.com/.well-known/did.json",
+		"did:web:example.com%3A8080":         "https://example.com:8080/.well-known/did.json",
+		"did:web:example.com:user:alice":     "https://example.com/user/alice/did.json",
+		"did:web:w3c-ccg.github.io:user:bob": "https://w3c-ccg.github.io/user/bob/did.json",
+	}
+
+	for did, expected := range tests {
+		u, err := DIDWebURL(did)
+		if err != nil {
+			t.Errorf("DIDWebURL(%q) error: %s", did, err)
+			continue
+		}
+
+		if u != expected {
+			t.Errorf("DIDWebURL(%q) = %q, expected %q", did, u, expected)
+		}
+	}
+
+	for _, did := range []string{"did:key:abc", "did:web:", "did:web:example.com::x"} {
+		if _, err := DIDWebURL(did); err == nil {
+			t.Errorf("DIDWebURL(%q): expected error, got nil", did)
+		}
+	}
+}
+
+func TestVerificationMethodKey(t *testing.T) {
+	// Test vector from the did:key specification
+	vm := VerificationMethod{
+		Type:               "Multikey",
+		PublicKeyMultibase: "z6MkhaXgBZDvotDkL5257faiztiGiC2QtKLGpbnnEGta2doK",
+	}
+
+	key, err := vm.Ed25519Key()
+	if err != nil {
+		t.Fatalf("Ed25519Key error: %s", err)
+	}
+
+	if len(key) != 32 {
+		t.Errorf("Unexpected key length: %d", len(key))
+	}
+}
+
+func TestClientVerifyDID(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey error: %s", err)
+	}
+
+	var did string
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/.well-known/did.json" {
+			http.NotFound(res, req)
+			return
+		}
+
+		jwk, _ := json.Marshal(map[string]string{"kty": "OKP", "crv": "Ed25519", "x": base64.RawURLEncoding.EncodeToString(pub)})
+		method, _ := json.Marshal(VerificationMethod{ID: did + "#key", Type: "JsonWebKey2020", Controller: did, PublicKeyJWK: jwk})
+		json.NewEncoder(res).Encode(DIDDocument{ID: did, AssertionMethod: []json.RawMessage{method}})
+	}))
+	defer srv.Close()
+
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatalf("Parse error: %s", err)
+	}
+	did = "did:web:" + strings.ReplaceAll(u.Host, ":", "%3A")
+	desc := &Descriptor{ID: "main", DID: did}
+
+	// The DID document must be fetched using the client's HTTP client,
+	// which is the only one that trusts the test server's certificate.
+	c := DefaultClient()
+	c.HTTPClient = srv.Client()
+	if err := c.VerifyDID(u.Host, desc, pub); err != nil {
+		t.Fatalf("VerifyDID error: %s", err)
+	}
+
+	other, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey error: %s", err)
+	}
+	if err := c.VerifyDID(u.Host, desc, other); !errors.Is(err, ErrDIDKeyNotAuthorized) {
+		t.Errorf("Expected ErrDIDKeyNotAuthorized, got %v", err)
+	}
+
+	// The client's allowlist applies to DID documents as well
+	c.AllowHost = func(host string) bool { return false }
+	var hna HostNotAllowedError
+	if err := c.VerifyDID(u.Host, desc, pub); !errors.As(err, &hna) {
+		t.Errorf("Expected HostNotAllowedError, got %v", err)
+	}
+
+}
@@ -0,0 +1,104 @@
+package profilefed
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"hash"
+	"net/http"
+	"strings"
+)
+
+// ErrDigestMismatch signifies that a response body doesn't match its Content-Digest
+// header, which means it was corrupted or truncated in transit. It's returned before
+// the signature is checked, so it doesn't indicate a problem with the server's key.
+var ErrDigestMismatch = errors.New("response body does not match content digest")
+
+// digestAlgorithms contains the hash functions supported in Content-Digest
+// and legacy Digest headers, keyed by their lower case algorithm names.
+var digestAlgorithms = map[string]func() hash.Hash{
+	"sha-256": sha256.New,
+	"sha-512": sha512.New,
+}
+
+// setContentDigest sets the RFC 9530 Content-Digest header of h to the SHA-256 digest of data.
+func setContentDigest(h http.Header, data []byte) {
+	sum := sha256.Sum256(data)
+	h.Set("Content-Digest", "sha-256=:"+base64.StdEncoding.EncodeToString(sum[:])+":")
+}
+
+// checkDigest verifies the body of res against its Content-Digest header, or its
+// RFC 3230 Digest header if it doesn't have one. Responses without a digest in a
+// supported algorithm are accepted, since the header is optional.
+func (c Client) checkDigest(res *http.Response, host string, data []byte) error {
+	// The digest covers the encoded body, which isn't available
+	// if the transport has transparently decompressed it.
+	if res.Uncompressed {
+		return nil
+	}
+
+	digests := parseDigests(res.Header.Get("Content-Digest"), true)
+	if len(digests) == 0 {
+		digests = parseDigests(res.Header.Get("Digest"), false)
+	}
+
+	if ok, _ := matchDigests(digests, data); !ok {
+		c.tracef("response body from %s does not match its content digest", host)
+		c.observe(host, OutcomeDigestMismatch)
+		return ErrDigestMismatch
+	}
+
+	return nil
+}
+
+// matchDigests reports whether data matches all the digests that use a supported
+// algorithm, and whether there were any such digests.
+func matchDigests(digests map[string][]byte, data []byte) (ok, checked bool) {
+	for alg, expected := range digests {
+		newHash, supported := digestAlgorithms[alg]
+		if !supported {
+			continue
+		}
+
+		h := newHash()
+		h.Write(data)
+		if subtle.ConstantTimeCompare(h.Sum(nil), expected) != 1 {
+			return false, true
+		}
+		checked = true
+	}
+	return true, checked
+}
+
+// parseDigests parses a Content-Digest header, whose values are structured field
+// byte sequences wrapped in colons, or a legacy Digest header, whose values are
+// plain base64. Malformed members are skipped.
+func parseDigests(val string, structured bool) map[string][]byte {
+	if val == "" {
+		return nil
+	}
+
+	out := map[string][]byte{}
+	for _, member := range strings.Split(val, ",") {
+		alg, digest, ok := strings.Cut(strings.TrimSpace(member), "=")
+		if !ok {
+			continue
+		}
+
+		if structured {
+			if len(digest) < 2 || digest[0] != ':' || digest[len(digest)-1] != ':' {
+				continue
+			}
+			digest = digest[1 : len(digest)-1]
+		}
+
+		decoded, err := base64.StdEncoding.DecodeString(digest)
+		if err != nil {
+			continue
+		}
+		out[strings.ToLower(alg)] = decoded
+	}
+	return out
+}
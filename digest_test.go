@@ -0,0 +1,61 @@
+package profilefed
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// bodyCorrupter is an [http.RoundTripper] that flips a byte in the
+// body of every response to a request for the given path.
+type bodyCorrupter struct {
+	http.RoundTripper
+	path string
+}
+
+func (bc bodyCorrupter) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := bc.RoundTripper.RoundTrip(req)
+	if err != nil || req.URL.Path != bc.path {
+		return res, err
+	}
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	data[len(data)/2] ^= 1
+	res.Body = io.NopCloser(bytes.NewReader(data))
+	return res, nil
+}
+
+func TestClientContentDigest(t *testing.T) {
+	desc := &Descriptor{ID: "main", Username: "user", DisplayName: "User"}
+
+	mt := &MemoryTransport{}
+	mt.Register("example.test", newTenant(t, "example.test", desc))
+
+	c := mt.Client()
+	res, err := c.HTTPClient.Get("http://example.test/pfd/user")
+	if err != nil {
+		t.Fatalf("Get error: %s", err)
+	}
+	res.Body.Close()
+
+	if digest := res.Header.Get("Content-Digest"); !strings.HasPrefix(digest, "sha-256=:") {
+		t.Errorf("Unexpected Content-Digest header: %q", digest)
+	}
+
+	// Trust the server before corrupting descriptor responses
+	if _, err := c.Lookup("user@example.test"); err != nil {
+		t.Fatalf("Lookup error: %s", err)
+	}
+
+	c.HTTPClient = &http.Client{Transport: bodyCorrupter{mt, "/pfd/user"}}
+	_, err = c.Lookup("user@example.test")
+	if !errors.Is(err, ErrDigestMismatch) {
+		t.Errorf("Expected ErrDigestMismatch, got %v", err)
+	}
+}
@@ -0,0 +1,300 @@
+// Package diskcache implements a persistent, disk-backed [profilefed.DescriptorCache]
+// that can be safely shared between multiple processes.
+//
+// Response bodies are stored as content-addressed files, named after the SHA-256
+// hash of their contents, and an index file maps cache keys to those files. Writes
+// to the index are serialized between processes using a lock file.
+package diskcache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"queerdevs.org/profilefed"
+)
+
+const (
+	indexName   = "index.json"
+	lockName    = "lock"
+	objectsName = "objects"
+
+	// staleLockAge is the age after which a lock file is considered
+	// abandoned by a crashed process and is removed.
+	staleLockAge = 30 * time.Second
+	// lockTimeout is the maximum amount of time to wait for the lock.
+	lockTimeout = 10 * time.Second
+)
+
+// ErrLockTimeout is returned when the cache lock couldn't be acquired in time.
+var ErrLockTimeout = errors.New("diskcache: timed out waiting for lock")
+
+// Cache is a disk-backed descriptor cache.
+type Cache struct {
+	dir string
+}
+
+// indexEntry is the metadata stored in the index for each cache key.
+type indexEntry struct {
+	Hash       string    `json:"hash"`
+	Signature  []byte    `json:"sig"`
+	SignedData []byte    `json:"signed_data,omitempty"`
+	ETag       string    `json:"etag,omitempty"`
+	Envelope   string    `json:"envelope,omitempty"`
+	KeyCert    string    `json:"key_cert,omitempty"`
+	FetchedAt  time.Time `json:"fetched_at"`
+
+	ContentHash string `json:"content_hash,omitempty"`
+}
+
+// New creates a new cache in the given directory, creating it if it doesn't exist.
+func New(dir string) (*Cache, error) {
+	err := os.MkdirAll(filepath.Join(dir, objectsName), 0o700)
+	if err != nil {
+		return nil, err
+	}
+	return &Cache{dir: dir}, nil
+}
+
+// Get implements [profilefed.DescriptorCache]
+func (c *Cache) Get(key string) (*profilefed.CacheEntry, error) {
+	index, err := c.readIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	ie, ok := index[key]
+	if !ok {
+		return nil, profilefed.ErrCacheMiss
+	}
+
+	data, err := os.ReadFile(c.objectPath(ie.Hash))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, profilefed.ErrCacheMiss
+	} else if err != nil {
+		return nil, err
+	}
+
+	// Make sure the object hasn't been corrupted
+	if hashData(data) != ie.Hash {
+		return nil, profilefed.ErrCacheMiss
+	}
+
+	return &profilefed.CacheEntry{
+		Data:           data,
+		Signature:      ie.Signature,
+		SignedData:     ie.SignedData,
+		ETag:           ie.ETag,
+		Envelope:       ie.Envelope,
+		KeyCertificate: ie.KeyCert,
+		FetchedAt:      ie.FetchedAt,
+		ContentHash:    ie.ContentHash,
+	}, nil
+}
+
+// Put implements [profilefed.DescriptorCache]
+func (c *Cache) Put(key string, entry *profilefed.CacheEntry) error {
+	// The object is written while holding the lock, so that
+	// Prune can't remove it before it's added to the index.
+	unlock, err := c.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	hash := hashData(entry.Data)
+	if _, err := os.Stat(c.objectPath(hash)); err != nil {
+		err = writeAtomic(c.objectPath(hash), entry.Data)
+		if err != nil {
+			return err
+		}
+	}
+
+	index, err := c.readIndex()
+	if err != nil {
+		return err
+	}
+
+	index[key] = indexEntry{
+		Hash:        hash,
+		Signature:   entry.Signature,
+		SignedData:  entry.SignedData,
+		ETag:        entry.ETag,
+		Envelope:    entry.Envelope,
+		KeyCert:     entry.KeyCertificate,
+		FetchedAt:   entry.FetchedAt,
+		ContentHash: entry.ContentHash,
+	}
+
+	return c.writeIndex(index)
+}
+
+// Delete removes the entry stored under key, if it exists.
+func (c *Cache) Delete(key string) error {
+	unlock, err := c.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	index, err := c.readIndex()
+	if err != nil {
+		return err
+	}
+
+	delete(index, key)
+	return c.writeIndex(index)
+}
+
+// Prune removes any objects that are no longer referenced by the index.
+func (c *Cache) Prune() error {
+	unlock, err := c.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	index, err := c.readIndex()
+	if err != nil {
+		return err
+	}
+
+	used := make(map[string]struct{}, len(index))
+	for _, ie := range index {
+		used[ie.Hash] = struct{}{}
+	}
+
+	entries, err := os.ReadDir(filepath.Join(c.dir, objectsName))
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if _, ok := used[entry.Name()]; ok {
+			continue
+		}
+		err = os.Remove(filepath.Join(c.dir, objectsName, entry.Name()))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *Cache) readIndex() (map[string]indexEntry, error) {
+	index := map[string]indexEntry{}
+
+	data, err := os.ReadFile(filepath.Join(c.dir, indexName))
+	if errors.Is(err, os.ErrNotExist) {
+		return index, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, &index)
+	if err != nil {
+		// A corrupted index is treated as an empty cache
+		return map[string]indexEntry{}, nil
+	}
+	return index, nil
+}
+
+func (c *Cache) writeIndex(index map[string]indexEntry) error {
+	data, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	return writeAtomic(filepath.Join(c.dir, indexName), data)
+}
+
+// lock acquires the inter-process cache lock. It returns a function
+// that releases the lock.
+func (c *Cache) lock() (func(), error) {
+	path := filepath.Join(c.dir, lockName)
+	deadline := time.Now().Add(lockTimeout)
+	delay := time.Millisecond
+
+	for {
+		fl, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if err == nil {
+			fi, err := fl.Stat()
+			fl.Close()
+			if err != nil {
+				os.Remove(path)
+				return nil, err
+			}
+			return func() { removeLock(path, fi) }, nil
+		} else if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+
+		// If the lock is older than staleLockAge, the process that
+		// created it most likely crashed, so remove it and try again.
+		if fi, err := os.Stat(path); err == nil && time.Since(fi.ModTime()) > staleLockAge {
+			removeLock(path, fi)
+			continue
+		}
+
+		if time.Now().After(deadline) {
+			return nil, ErrLockTimeout
+		}
+
+		time.Sleep(delay)
+		delay = min(delay*2, 100*time.Millisecond)
+	}
+}
+
+// removeLock removes the lock file at path if it's still the file described by
+// fi, with the same modification time. The lock is renamed to a unique name before it's compared, so that a lock
+// acquired by another process in the meantime is never removed. If it was, it's
+// moved back.
+func removeLock(path string, fi os.FileInfo) {
+	tmp := fmt.Sprintf("%s.%d-%d", path, os.Getpid(), time.Now().UnixNano())
+	if err := os.Rename(path, tmp); err != nil {
+		return
+	}
+
+	// Inodes can be reused, so the modification times are compared too
+	if cur, err := os.Stat(tmp); err == nil && (!os.SameFile(cur, fi) || !cur.ModTime().Equal(fi.ModTime())) {
+		// Unlike Rename, Link doesn't replace a lock created since
+		os.Link(tmp, path)
+	}
+	os.Remove(tmp)
+}
+
+func (c *Cache) objectPath(hash string) string {
+	return filepath.Join(c.dir, objectsName, hash)
+}
+
+// writeAtomic writes data to a temporary file and then renames it to path,
+// so that other processes never observe a partially-written file.
+func writeAtomic(path string, data []byte) error {
+	fl, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(fl.Name())
+
+	_, err = fl.Write(data)
+	if err != nil {
+		fl.Close()
+		return err
+	}
+
+	if err := fl.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(fl.Name(), path)
+}
+
+func hashData(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
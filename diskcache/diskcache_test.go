@@ -0,0 +1,131 @@
+package diskcache
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"queerdevs.org/profilefed"
+)
+
+func TestCache(t *testing.T) {
+	dir := t.TempDir()
+
+	c, err := New(dir)
+	if err != nil {
+		t.Fatalf("New error: %s", err)
+	}
+
+	_, err = c.Get("missing")
+	if !errors.Is(err, profilefed.ErrCacheMiss) {
+		t.Fatalf("Expected ErrCacheMiss, got %v", err)
+	}
+
+	// Write from several "processes" concurrently
+	var wg sync.WaitGroup
+	for i := range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c, err := New(dir)
+			if err != nil {
+				t.Errorf("New error: %s", err)
+				return
+			}
+			err = c.Put(fmt.Sprint("key", i), &profilefed.CacheEntry{
+				Data:      []byte(fmt.Sprint("data", i)),
+				Signature: []byte("sig"),
+				FetchedAt: time.Now(),
+			})
+			if err != nil {
+				t.Errorf("Put error: %s", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	for i := range 10 {
+		entry, err := c.Get(fmt.Sprint("key", i))
+		if err != nil {
+			t.Fatalf("Get error: %s", err)
+		}
+
+		if !bytes.Equal(entry.Data, []byte(fmt.Sprint("data", i))) {
+			t.Errorf("Unexpected data for key%d: %q", i, entry.Data)
+		}
+	}
+
+	err = c.Delete("key0")
+	if err != nil {
+		t.Fatalf("Delete error: %s", err)
+	}
+
+	err = c.Prune()
+	if err != nil {
+		t.Fatalf("Prune error: %s", err)
+	}
+
+	_, err = c.Get("key0")
+	if !errors.Is(err, profilefed.ErrCacheMiss) {
+		t.Fatalf("Expected ErrCacheMiss, got %v", err)
+	}
+}
+
+func TestCacheStaleLock(t *testing.T) {
+	dir := t.TempDir()
+
+	c, err := New(dir)
+	if err != nil {
+		t.Fatalf("New error: %s", err)
+	}
+
+	path := filepath.Join(dir, lockName)
+	if err := os.WriteFile(path, nil, 0o600); err != nil {
+		t.Fatalf("WriteFile error: %s", err)
+	}
+	old := time.Now().Add(-2 * staleLockAge)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatalf("Chtimes error: %s", err)
+	}
+	stale, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat error: %s", err)
+	}
+
+	// Another process replaces the stale lock before it's removed
+	if err := os.Remove(path); err != nil {
+		t.Fatalf("Remove error: %s", err)
+	}
+	if err := os.WriteFile(path, nil, 0o600); err != nil {
+		t.Fatalf("WriteFile error: %s", err)
+	}
+
+	removeLock(path, stale)
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("Lock acquired by another process was removed: %s", err)
+	}
+
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatalf("Chtimes error: %s", err)
+	}
+
+	if err := c.Put("key", &profilefed.CacheEntry{Data: []byte("{}")}); err != nil {
+		t.Fatalf("Put error with stale lock: %s", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir error: %s", err)
+	}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), lockName) {
+			t.Errorf("Lock file %s left behind", entry.Name())
+		}
+	}
+}
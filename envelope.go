@@ -0,0 +1,127 @@
+package profilefed
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultEnvelopeTTL is how long the signed timestamps sent by a [Handler]
+// are valid for if its EnvelopeTTL is zero.
+const DefaultEnvelopeTTL = 24 * time.Hour
+
+// DefaultMaxDescriptorAge is the MaxDescriptorAge of clients returned by
+// [DefaultClient], so that they reject replayed descriptors whose signed
+// timestamp has been stripped.
+const DefaultMaxDescriptorAge = DefaultEnvelopeTTL
+
+// envelopeHeader is the header containing the signed timestamp of a response.
+const envelopeHeader = "X-ProfileFed-Envelope"
+
+var (
+	// ErrNoEnvelope signifies that a descriptor response has no signed timestamp,
+	// but the client requires one because its MaxDescriptorAge is set.
+	ErrNoEnvelope = errors.New("response contains no signed timestamp")
+	// ErrInvalidEnvelope signifies that a descriptor's signed timestamp is malformed.
+	ErrInvalidEnvelope = errors.New("invalid signed timestamp")
+	// ErrStaleDescriptor signifies that a descriptor has expired or is
+	// older than the client's MaxDescriptorAge, so it may have been replayed.
+	ErrStaleDescriptor = errors.New("descriptor is expired or too old")
+)
+
+// envelope is the signed timestamp of a descriptor response.
+type envelope struct {
+	issuedAt  int64
+	expiresAt int64
+	sig       []byte
+}
+
+// envelopeData returns the data signed by an envelope. The prefix makes
+// sure it can never be mistaken for a signed response body.
+func envelopeData(issuedAt, expiresAt int64, data []byte) []byte {
+	prefix := fmt.Sprintf("profilefed-envelope:%d:%d:", issuedAt, expiresAt)
+	return append([]byte(prefix), data...)
+}
+
+// setEnvelope uses signer to sign data along with the current time and an expiry
+// time ttl from now, and sets the envelope header in h.
+func setEnvelope(h http.Header, signer crypto.Signer, data []byte, ttl time.Duration) error {
+	if ttl == 0 {
+		ttl = DefaultEnvelopeTTL
+	}
+
+	now := time.Now()
+	issuedAt, expiresAt := now.Unix(), now.Add(ttl).Unix()
+	sig, err := sign(signer, envelopeData(issuedAt, expiresAt, data))
+	if err != nil {
+		return err
+	}
+
+	val := fmt.Sprintf("issued=%d, expires=%d, sig=%s", issuedAt, expiresAt, base64.StdEncoding.EncodeToString(sig))
+	h.Set(envelopeHeader, val)
+	return nil
+}
+
+// parseEnvelope parses the value of the envelope header.
+func parseEnvelope(val string) (envelope, error) {
+	var (
+		env envelope
+		err error
+	)
+
+	for _, param := range strings.Split(val, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+		if !ok {
+			return envelope{}, ErrInvalidEnvelope
+		}
+
+		switch key {
+		case "issued":
+			env.issuedAt, err = strconv.ParseInt(value, 10, 64)
+		case "expires":
+			env.expiresAt, err = strconv.ParseInt(value, 10, 64)
+		case "sig":
+			env.sig, err = base64.StdEncoding.DecodeString(value)
+		}
+		if err != nil {
+			return envelope{}, ErrInvalidEnvelope
+		}
+	}
+
+	if env.issuedAt == 0 || env.expiresAt == 0 || env.sig == nil {
+		return envelope{}, ErrInvalidEnvelope
+	}
+	return env, nil
+}
+
+// checkEnvelope verifies the signed timestamp of a descriptor response from host.
+// Expired descriptors are always rejected. If the client's MaxDescriptorAge
+// is set, descriptors without a signed timestamp or with one that's too old
+// are rejected as well. The bounds of the timestamp are extended by the
+// client's MaxClockSkew. The date parameter is the time in the response's
+// Date header, or the zero time if it doesn't have one.
+func (c Client) checkEnvelope(host string, pubkey ed25519.PublicKey, data []byte, val string, date time.Time) error {
+	if val == "" {
+		if c.MaxDescriptorAge > 0 {
+			return ErrNoEnvelope
+		}
+		return nil
+	}
+
+	env, err := parseEnvelope(val)
+	if err != nil {
+		return err
+	}
+
+	if !verify(pubkey, envelopeData(env.issuedAt, env.expiresAt, data), env.sig) {
+		return ErrSignatureMismatch
+	}
+
+	return c.checkSignedTime(host, env, date)
+}
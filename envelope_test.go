@@ -0,0 +1,69 @@
+package profilefed
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// headerStripper is an [http.RoundTripper] that removes a header from every response.
+type headerStripper struct {
+	http.RoundTripper
+	header string
+}
+
+func (hs headerStripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := hs.RoundTripper.RoundTrip(req)
+	if err == nil {
+		res.Header.Del(hs.header)
+	}
+	return res, err
+}
+
+func TestEnvelope(t *testing.T) {
+	desc := &Descriptor{ID: "main", Username: "user", DisplayName: "User"}
+
+	mt := &MemoryTransport{}
+	mt.Register("fresh.test", newTenant(t, "fresh.test", desc))
+	mt.Register("expired.test", newTenant(t, "expired.test", desc, func(h *Handler) {
+		h.EnvelopeTTL = -time.Minute
+	}))
+
+	c := mt.Client()
+	c.MaxDescriptorAge = time.Hour
+
+	got, err := c.Lookup("user@fresh.test")
+	if err != nil {
+		t.Fatalf("Lookup error: %s", err)
+	}
+
+	if !reflect.DeepEqual(got, desc) {
+		t.Errorf("Descriptors are not equal:\n%#v\n\n%#v", got, desc)
+	}
+
+	_, err = c.Lookup("user@expired.test")
+	if !errors.Is(err, ErrStaleDescriptor) {
+		t.Errorf("Expected ErrStaleDescriptor, got %v", err)
+	}
+
+	// Responses without a signed timestamp are only rejected if MaxDescriptorAge is set
+	c.HTTPClient = &http.Client{Transport: headerStripper{mt, envelopeHeader}}
+	_, err = c.Lookup("user@fresh.test")
+	if !errors.Is(err, ErrNoEnvelope) {
+		t.Errorf("Expected ErrNoEnvelope, got %v", err)
+	}
+
+	// DefaultClient sets it, so stripping the header can't bypass the check
+	dc := DefaultClient()
+	dc.HTTPClient = &http.Client{Transport: headerStripper{mt, envelopeHeader}}
+	if _, err = dc.Lookup("user@fresh.test"); !errors.Is(err, ErrNoEnvelope) {
+		t.Errorf("Expected ErrNoEnvelope from the default client, got %v", err)
+	}
+
+	c.MaxDescriptorAge = 0
+	if _, err = c.Lookup("user@fresh.test"); err != nil {
+		t.Errorf("Lookup error: %s", err)
+	}
+}
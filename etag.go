@@ -0,0 +1,30 @@
+package profilefed
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// etag returns the entity tag for a response body signed using the key pubkey.
+// The public key is included in the hash, so that clients holding a
+// signature made with a rotated key don't get a 304 Not Modified response.
+func etag(pubkey ed25519.PublicKey, data []byte) string {
+	h := sha256.New()
+	h.Write(pubkey)
+	h.Write(data)
+	return `"` + hex.EncodeToString(h.Sum(nil)) + `"`
+}
+
+// etagMatches reports whether the value of an If-None-Match
+// header matches tag, using the weak comparison function.
+func etagMatches(header, tag string) bool {
+	for _, val := range strings.Split(header, ",") {
+		val = strings.TrimSpace(val)
+		if val == "*" || strings.TrimPrefix(val, "W/") == tag {
+			return true
+		}
+	}
+	return false
+}
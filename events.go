@@ -0,0 +1,87 @@
+package profilefed
+
+import "time"
+
+// KeyEventType identifies a key lifecycle event.
+type KeyEventType string
+
+// Key lifecycle events
+const (
+	// KeyEventFirstTrust is emitted when a server's key is trusted on first use.
+	KeyEventFirstTrust KeyEventType = "first_trust"
+	// KeyEventRotationAccepted is emitted when a server's new key is accepted
+	// because it was signed by the previously pinned key.
+	KeyEventRotationAccepted KeyEventType = "rotation_accepted"
+	// KeyEventRotationRejected is emitted when a server presents a new key
+	// that isn't signed by the previously pinned key.
+	KeyEventRotationRejected KeyEventType = "rotation_rejected"
+	// KeyEventRenameObserved is emitted when a server that was previously
+	// known under another name is verified under its new name.
+	KeyEventRenameObserved KeyEventType = "rename_observed"
+	// KeyEventQuarantined is emitted when a server is quarantined.
+	KeyEventQuarantined KeyEventType = "quarantined"
+	// KeyEventQuarantineCleared is emitted when a server's quarantine is lifted.
+	KeyEventQuarantineCleared KeyEventType = "quarantine_cleared"
+	// KeyEventHostDeleted is emitted when a server's pinned key is deleted
+	// using [Client.DeleteHost].
+	KeyEventHostDeleted KeyEventType = "host_deleted"
+	// KeyEventPinUpdated is emitted when pinned descriptor fields change,
+	// and the change is signed by the pinned owner key. See [DescriptorPins].
+	KeyEventPinUpdated KeyEventType = "pin_updated"
+	// KeyEventPinViolation is emitted when pinned descriptor fields change
+	// without a valid owner signature. See [DescriptorPins].
+	KeyEventPinViolation KeyEventType = "pin_violation"
+	// KeyEventDeprecatedNamespace is emitted when a descriptor uses an extras
+	// namespace that's been deprecated using [DeprecateNamespace].
+	KeyEventDeprecatedNamespace KeyEventType = "deprecated_namespace"
+)
+
+// KeyEvent describes a change in the trust a client places in a server.
+// It's suitable for audit logs and for alerting users.
+type KeyEvent struct {
+	// Type is the type of the event.
+	Type KeyEventType `json:"type"`
+	// Time is the time at which the event occurred.
+	Time time.Time `json:"time"`
+	// ServerName is the name of the server the event concerns.
+	ServerName string `json:"server_name"`
+	// PreviousNames contains the previous names of the server that were
+	// verified, for [KeyEventRenameObserved] events.
+	PreviousNames []string `json:"previous_names,omitempty"`
+	// OldFingerprint is the fingerprint of the previously pinned key, if any.
+	OldFingerprint string `json:"old_fingerprint,omitempty"`
+	// NewFingerprint is the fingerprint of the newly presented key, if any.
+	NewFingerprint string `json:"new_fingerprint,omitempty"`
+	// Resource and DescriptorID identify the descriptor that changed, for
+	// [KeyEventPinUpdated] and [KeyEventPinViolation] events, or the one
+	// that uses a deprecated namespace, for [KeyEventDeprecatedNamespace].
+	Resource     string `json:"resource,omitempty"`
+	DescriptorID string `json:"descriptor_id,omitempty"`
+	// Namespace is the deprecated namespace, for [KeyEventDeprecatedNamespace] events.
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// KeyEventSink receives key lifecycle events from [Client]. KeyEvent is called
+// synchronously during lookups, so implementations that do slow I/O should
+// buffer events.
+type KeyEventSink interface {
+	KeyEvent(ev KeyEvent)
+}
+
+// KeyEventSinkFunc is an adapter that allows the use of an ordinary
+// function as a [KeyEventSink].
+type KeyEventSinkFunc func(ev KeyEvent)
+
+// KeyEvent implements the [KeyEventSink] interface
+func (f KeyEventSinkFunc) KeyEvent(ev KeyEvent) {
+	f(ev)
+}
+
+// emit sends ev to the client's event sink, if it has one.
+func (c Client) emit(ev KeyEvent) {
+	if c.Events == nil {
+		return
+	}
+	ev.Time = time.Now()
+	c.Events.KeyEvent(ev)
+}
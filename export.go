@@ -0,0 +1,368 @@
+package profilefed
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	exportManifestName = "manifest.json"
+	exportManifestSig  = "manifest.sig"
+
+	// exportPrefix is prepended to exported descriptors and the manifest
+	// before they're signed, so that their signatures can't be replayed
+	// as the signatures of live descriptor responses.
+	exportPrefix = "profilefed-export:"
+)
+
+// ErrExportInvalid signifies that an export archive is malformed or fails verification.
+var ErrExportInvalid = errors.New("invalid export archive")
+
+// ExportHandler serves a bulk export of all the profiles on a server at
+// /_profilefed/export. The export is a gzip-compressed tarball containing
+// one signed envelope per profile and a signed manifest listing the SHA-256
+// hash of every envelope.
+type ExportHandler struct {
+	// Enabled must be set to true for the export to be served.
+	// If it's false, the handler responds with 404 Not Found.
+	Enabled bool
+
+	// ServerName is the name of the server, which is recorded in the
+	// manifest of the export. It should be the same as the name served
+	// by [ServerInfoHandler].
+	ServerName string
+
+	// PrivateKey contains the server's Ed25519 private key for signing the export.
+	PrivateKey ed25519.PrivateKey
+	// Signer, if set, signs the export instead of PrivateKey. It has to hold
+	// an Ed25519 key. See [Handler] for details.
+	Signer crypto.Signer
+	// Rotator, if set, provides the key used to sign the export instead of PrivateKey.
+	Rotator *KeyRotator
+
+	// MinimalFields contains the fields exported for profiles that use
+	// [PrivacyMinimal], since the export is served to anonymous clients.
+	// If empty, only the ID, username, and display name are exported.
+	MinimalFields []string
+
+	// EachProfile should call fn for every profile that should be exported.
+	// If fn returns an error, EachProfile should stop and return it.
+	// If it's nil, the handler responds with an error.
+	EachProfile func(ctx context.Context, fn func(resource string, desc *Descriptor) error) error
+
+	// RateLimiter, if set, limits how often clients can request the export.
+	// Since exports are expensive, this should be much stricter than the
+	// limit used for regular descriptor requests.
+	RateLimiter *RateLimiter
+
+	// ErrorHandler is called whenever an error is encountered before
+	// the response has started. Errors that happen while streaming
+	// the archive abort the response instead. If it's nil,
+	// [DefaultErrorHandler] is used.
+	ErrorHandler func(err error, res http.ResponseWriter)
+}
+
+// ExportEnvelope contains a single signed profile in an export archive.
+type ExportEnvelope struct {
+	// Resource is the resource the profile belongs to.
+	Resource string `json:"resource"`
+	// Descriptor contains the raw signed descriptor data.
+	Descriptor json.RawMessage `json:"descriptor"`
+	// Signature is the server signature of Descriptor, prefixed with
+	// "profilefed-export:" so that it can't be used outside the export.
+	Signature []byte `json:"sig"`
+}
+
+// ExportManifest lists the contents of an export archive.
+type ExportManifest struct {
+	// ServerName is the name of the server that produced the export.
+	ServerName string `json:"server_name"`
+	// CreatedAt is the time at which the export was produced.
+	CreatedAt time.Time `json:"created_at"`
+	// Files maps the name of every envelope file in the
+	// archive to the hex-encoded SHA-256 hash of its contents.
+	Files map[string]string `json:"files"`
+}
+
+// ServeHTTP implements the [http.Handler] interface
+func (eh ExportHandler) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	if eh.ErrorHandler == nil {
+		eh.ErrorHandler = DefaultErrorHandler
+	}
+
+	if !eh.Enabled {
+		http.NotFound(res, req)
+		return
+	}
+
+	if eh.EachProfile == nil {
+		eh.ErrorHandler(errors.New("export handler has no EachProfile function"), res)
+		return
+	}
+
+	signer := eh.signer()
+	if _, err := signerPublicKey(signer); err != nil {
+		eh.ErrorHandler(err, res)
+		return
+	}
+
+	if eh.RateLimiter != nil && !eh.RateLimiter.Allow(req) {
+		http.Error(res, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+		return
+	}
+
+	res.Header().Set("Content-Type", "application/gzip")
+	res.Header().Set("Content-Disposition", `attachment; filename="profilefed-export.tar.gz"`)
+
+	gw := gzip.NewWriter(res)
+	tw := tar.NewWriter(gw)
+	now := time.Now().UTC()
+
+	manifest := ExportManifest{
+		ServerName: eh.ServerName,
+		CreatedAt:  now,
+		Files:      map[string]string{},
+	}
+
+	n := 0
+	err := eh.EachProfile(req.Context(), func(resource string, desc *Descriptor) error {
+		if desc != nil && desc.Privacy == PrivacyMinimal {
+			desc = Handler{MinimalFields: eh.MinimalFields}.minimal(desc)
+		}
+
+		data, err := json.Marshal(desc)
+		if err != nil {
+			return err
+		}
+
+		sig, err := sign(signer, exportData(data))
+		if err != nil {
+			return err
+		}
+
+		env, err := json.Marshal(ExportEnvelope{
+			Resource:   resource,
+			Descriptor: data,
+			Signature:  sig,
+		})
+		if err != nil {
+			return err
+		}
+
+		name := fmt.Sprintf("profiles/%08d.json", n)
+		n++
+
+		sum := sha256.Sum256(env)
+		manifest.Files[name] = hex.EncodeToString(sum[:])
+		return writeTarFile(tw, name, env, now)
+	})
+	if err != nil {
+		// The response has most likely already started, so the best
+		// we can do is abort it, so the client sees a truncated archive.
+		if n == 0 {
+			eh.ErrorHandler(err, res)
+			return
+		}
+		panic(http.ErrAbortHandler)
+	}
+
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		panic(http.ErrAbortHandler)
+	}
+
+	if err := writeTarFile(tw, exportManifestName, data, now); err != nil {
+		return
+	}
+
+	sig, err := sign(signer, exportData(data))
+	if err != nil {
+		panic(http.ErrAbortHandler)
+	}
+
+	if err := writeTarFile(tw, exportManifestSig, sig, now); err != nil {
+		return
+	}
+
+	if err := tw.Close(); err != nil {
+		return
+	}
+	gw.Close()
+}
+
+// signer returns the signer used to sign the export.
+func (eh ExportHandler) signer() crypto.Signer {
+	if eh.Signer == nil && eh.Rotator != nil {
+		return eh.Rotator.PrivateKey()
+	}
+	return keySigner(eh.Signer, eh.PrivateKey)
+}
+
+// exportData returns the data signed for an exported descriptor or manifest.
+func exportData(data []byte) []byte {
+	return append([]byte(exportPrefix), data...)
+}
+
+// writeTarFile writes a single regular file to tw.
+func writeTarFile(tw *tar.Writer, name string, data []byte, modTime time.Time) error {
+	err := tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     int64(len(data)),
+		Mode:     0o644,
+		ModTime:  modTime,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = tw.Write(data)
+	return err
+}
+
+// Export contains the verified contents of an export archive.
+type Export struct {
+	// Manifest is the verified manifest of the archive.
+	Manifest ExportManifest
+	// Profiles contains every profile in the archive, each of which
+	// has been verified against the server's public key.
+	Profiles []ExportEnvelope
+}
+
+// ReadExport reads and verifies an export archive produced by [ExportHandler].
+// The manifest signature, the hash of every envelope, and the signature of every
+// descriptor are verified against pubkey.
+func ReadExport(r io.Reader, pubkey ed25519.PublicKey) (*Export, error) {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	tr := tar.NewReader(gr)
+
+	files := map[string][]byte{}
+	var manifestData, manifestSig []byte
+	total := int64(0)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		total += hdr.Size
+		if total > responseSizeLimit {
+			return nil, ErrExportInvalid
+		}
+
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+
+		switch hdr.Name {
+		case exportManifestName:
+			manifestData = data
+		case exportManifestSig:
+			manifestSig = data
+		default:
+			files[hdr.Name] = data
+		}
+	}
+
+	if manifestData == nil || !verify(pubkey, exportData(manifestData), manifestSig) {
+		return nil, ErrExportInvalid
+	}
+
+	out := &Export{}
+	if err := json.Unmarshal(manifestData, &out.Manifest); err != nil {
+		return nil, err
+	}
+
+	if len(files) != len(out.Manifest.Files) {
+		return nil, ErrExportInvalid
+	}
+
+	for name, hash := range out.Manifest.Files {
+		data, ok := files[name]
+		if !ok {
+			return nil, ErrExportInvalid
+		}
+
+		sum := sha256.Sum256(data)
+		if hex.EncodeToString(sum[:]) != hash {
+			return nil, ErrExportInvalid
+		}
+
+		var env ExportEnvelope
+		if err := json.Unmarshal(data, &env); err != nil {
+			return nil, err
+		}
+
+		if !verify(pubkey, exportData(env.Descriptor), env.Signature) {
+			return nil, ErrSignatureMismatch
+		}
+
+		out.Profiles = append(out.Profiles, env)
+	}
+
+	return out, nil
+}
+
+// DownloadExport downloads the export archive of the server at host and verifies
+// it using the server's pinned public key. If the server hasn't been contacted
+// before, its key is trusted on first use, like with any other lookup.
+func (c Client) DownloadExport(scheme, host string) (*Export, error) {
+	u := &url.URL{Scheme: scheme, Host: host, Path: "/_profilefed/export"}
+	if err := c.checkURL(u); err != nil {
+		return nil, err
+	}
+
+	pubkey, err := c.serverPubkey(u)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.httpClient().Get(u.String())
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if err := checkResp(res, "downloadExport"); err != nil {
+		return nil, err
+	}
+
+	return ReadExport(io.LimitReader(res.Body, responseSizeLimit), pubkey)
+}
+
+// serverPubkey returns the pinned public key of the server at u,
+// trusting the server on first use if it hasn't been contacted before.
+func (c Client) serverPubkey(u *url.URL) (ed25519.PublicKey, error) {
+	serverName, err := c.serverName(u.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.checkQuarantine(u.Host, serverName); err != nil {
+		return nil, err
+	}
+
+	pubkey, err := c.getPubkey(serverName)
+	if errors.Is(err, ErrPubkeyNotFound) {
+		return c.trustServer(u)
+	}
+	return pubkey, err
+}
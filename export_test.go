@@ -0,0 +1,244 @@
+package profilefed
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newExport serves an export of the given profiles using eh
+// and returns the archive.
+func newExport(t *testing.T, eh ExportHandler, profiles map[string]*Descriptor) []byte {
+	t.Helper()
+
+	eh.Enabled = true
+	eh.EachProfile = func(ctx context.Context, fn func(resource string, desc *Descriptor) error) error {
+		for resource, desc := range profiles {
+			if err := fn(resource, desc); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/_profilefed/export", nil)
+	req.Host = "attacker.example"
+	eh.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	return rec.Body.Bytes()
+}
+
+// rewriteExport returns a copy of the export archive in which the
+// contents of every file have been replaced with the result of fn.
+func rewriteExport(t *testing.T, archive []byte, fn func(name string, data []byte) []byte) []byte {
+	t.Helper()
+
+	gr, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		t.Fatalf("gzip.NewReader error: %s", err)
+	}
+	tr := tar.NewReader(gr)
+
+	buf := &bytes.Buffer{}
+	gw := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gw)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			t.Fatalf("Next error: %s", err)
+		}
+
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatalf("ReadAll error: %s", err)
+		}
+
+		if err := writeTarFile(tw, hdr.Name, fn(hdr.Name, data), hdr.ModTime); err != nil {
+			t.Fatalf("writeTarFile error: %s", err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		t.Fatalf("Close error: %s", err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatalf("Close error: %s", err)
+	}
+	return buf.Bytes()
+}
+
+func TestExportRoundTrip(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey error: %s", err)
+	}
+
+	archive := newExport(t, ExportHandler{ServerName: "example.com", PrivateKey: priv}, map[string]*Descriptor{
+		"acct:alice@example.com": {ID: "main", Username: "alice", DisplayName: "Alice"},
+		"acct:bob@example.com":   {ID: "main", Username: "bob", DisplayName: "Bob"},
+	})
+
+	export, err := ReadExport(bytes.NewReader(archive), pub)
+	if err != nil {
+		t.Fatalf("ReadExport error: %s", err)
+	}
+
+	// The manifest must name the configured server, not the Host header
+	if export.Manifest.ServerName != "example.com" {
+		t.Errorf("Expected server name example.com, got %q", export.Manifest.ServerName)
+	}
+	if len(export.Manifest.Files) != 2 || len(export.Profiles) != 2 {
+		t.Fatalf("Expected 2 profiles, got %d files and %d profiles", len(export.Manifest.Files), len(export.Profiles))
+	}
+
+	resources := map[string]bool{}
+	for _, env := range export.Profiles {
+		resources[env.Resource] = true
+
+		// Exported signatures must not be valid descriptor response signatures
+		if verify(pub, env.Descriptor, env.Signature) {
+			t.Errorf("Export signature for %s verifies as a descriptor signature", env.Resource)
+		}
+	}
+	if !resources["acct:alice@example.com"] || !resources["acct:bob@example.com"] {
+		t.Errorf("Unexpected resources: %v", resources)
+	}
+
+	otherPub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey error: %s", err)
+	}
+	if _, err := ReadExport(bytes.NewReader(archive), otherPub); !errors.Is(err, ErrExportInvalid) {
+		t.Errorf("Expected ErrExportInvalid with the wrong key, got %v", err)
+	}
+}
+
+func TestExportMinimalPrivacy(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey error: %s", err)
+	}
+
+	archive := newExport(t, ExportHandler{ServerName: "example.com", PrivateKey: priv}, map[string]*Descriptor{
+		"acct:user@example.com": {ID: "main", Username: "user", DisplayName: "User", Bio: "Private bio", Pronouns: "they/them", Privacy: PrivacyMinimal},
+	})
+
+	export, err := ReadExport(bytes.NewReader(archive), pub)
+	if err != nil {
+		t.Fatalf("ReadExport error: %s", err)
+	}
+	if len(export.Profiles) != 1 {
+		t.Fatalf("Expected 1 profile, got %d", len(export.Profiles))
+	}
+
+	var desc Descriptor
+	if err := json.Unmarshal(export.Profiles[0].Descriptor, &desc); err != nil {
+		t.Fatalf("Unmarshal error: %s", err)
+	}
+	if desc.Username != "user" || desc.DisplayName != "User" || desc.Bio != "" || desc.Pronouns != "" {
+		t.Errorf("Expected only the minimal profile to be exported, got %+v", desc)
+	}
+}
+
+func TestExportTamperedManifest(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey error: %s", err)
+	}
+
+	archive := newExport(t, ExportHandler{ServerName: "example.com", PrivateKey: priv}, map[string]*Descriptor{
+		"acct:user@example.com": {ID: "main", Username: "user", DisplayName: "User"},
+	})
+
+	tampered := rewriteExport(t, archive, func(name string, data []byte) []byte {
+		if name == exportManifestName {
+			return bytes.Replace(data, []byte("example.com"), []byte("example.net"), 1)
+		}
+		return data
+	})
+
+	if _, err := ReadExport(bytes.NewReader(tampered), pub); !errors.Is(err, ErrExportInvalid) {
+		t.Errorf("Expected ErrExportInvalid for a tampered manifest, got %v", err)
+	}
+}
+
+func TestExportTamperedEnvelope(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey error: %s", err)
+	}
+
+	archive := newExport(t, ExportHandler{ServerName: "example.com", PrivateKey: priv}, map[string]*Descriptor{
+		"acct:user@example.com": {ID: "main", Username: "user", DisplayName: "User"},
+	})
+
+	tampered := rewriteExport(t, archive, func(name string, data []byte) []byte {
+		if name == exportManifestName || name == exportManifestSig {
+			return data
+		}
+		return bytes.Replace(data, []byte("acct:user@"), []byte("acct:evil@"), 1)
+	})
+
+	if _, err := ReadExport(bytes.NewReader(tampered), pub); !errors.Is(err, ErrExportInvalid) {
+		t.Errorf("Expected ErrExportInvalid for a tampered envelope, got %v", err)
+	}
+}
+
+func TestExportHandlerNoProfiles(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey error: %s", err)
+	}
+
+	rec := httptest.NewRecorder()
+	ExportHandler{Enabled: true, PrivateKey: priv}.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/_profilefed/export", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("Expected 500 without EachProfile, got %d", rec.Code)
+	}
+}
+
+func TestExportHandlerSigner(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey error: %s", err)
+	}
+
+	eh := ExportHandler{
+		Enabled: true,
+		EachProfile: func(ctx context.Context, fn func(resource string, desc *Descriptor) error) error {
+			return fn("acct:user@example.com", &Descriptor{ID: "main", Username: "user", DisplayName: "User"})
+		},
+	}
+
+	// Without a key, the export fails instead of panicking
+	rec := httptest.NewRecorder()
+	eh.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/_profilefed/export", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("Expected 500 without a key, got %d", rec.Code)
+	}
+
+	eh.Signer = opaqueSigner{priv}
+	rec = httptest.NewRecorder()
+	eh.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/_profilefed/export", nil))
+
+	export, err := ReadExport(bytes.NewReader(rec.Body.Bytes()), pub)
+	if err != nil {
+		t.Fatalf("ReadExport error: %s", err)
+	}
+	if len(export.Profiles) != 1 {
+		t.Errorf("Expected 1 profile, got %d", len(export.Profiles))
+	}
+}
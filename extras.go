@@ -0,0 +1,84 @@
+package profilefed
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// extraKey identifies a registered extra type.
+type extraKey struct {
+	namespace string
+	etype     string
+}
+
+var (
+	extraTypesMtx sync.RWMutex
+	// extraTypes contains the factories of the registered extra types,
+	// starting with the ones defined by this package.
+	extraTypes = map[extraKey]func() any{
+		{StatsNamespace, StatsExtraType}:           func() any { return &Stats{} },
+		{LocationNamespace, LocationExtraType}:     func() any { return &Location{} },
+		{MembershipNamespace, MembershipExtraType}: func() any { return &Membership{} },
+		{MembershipNamespace, MemberExtraType}:     func() any { return &Member{} },
+		{ActivityPubNamespace, ActorExtraType}:     func() any { return new(string) },
+	}
+)
+
+// RegisterExtraType registers the Go type used to decode extras with the given
+// namespace and type in [Descriptor.DecodeExtras]. The factory should return a
+// pointer to a new value of the type, which the extra's data is unmarshaled into.
+// Registering a type again replaces the previous factory.
+//
+// The types of the extras defined by this package, such as [Stats]
+// and [Location], are registered by default.
+func RegisterExtraType(namespace, etype string, factory func() any) {
+	extraTypesMtx.Lock()
+	defer extraTypesMtx.Unlock()
+	extraTypes[extraKey{namespace, etype}] = factory
+}
+
+// DecodedExtra is an extra decoded by [Descriptor.DecodeExtras].
+type DecodedExtra struct {
+	Extra
+	// Value is the decoded data, as returned by the factory registered
+	// for the extra's type. It's nil if the type isn't registered or
+	// the data couldn't be decoded.
+	Value any
+	// Deprecated is true if the extra's namespace has been
+	// deprecated using [DeprecateNamespace].
+	Deprecated bool
+}
+
+// DecodeExtras decodes the descriptor's extras into the Go types registered
+// using [RegisterExtraType], which is the decoding counterpart of
+// [Descriptor.AddExtra]. The result contains every extra in order, including
+// ones whose type isn't registered. Extras whose data can't be decoded are
+// included without a value, and their errors are joined and returned along
+// with the result.
+func (d *Descriptor) DecodeExtras() ([]DecodedExtra, error) {
+	extraTypesMtx.RLock()
+	defer extraTypesMtx.RUnlock()
+
+	out := make([]DecodedExtra, len(d.Extra))
+	var errs []error
+	for i, extra := range d.Extra {
+		out[i].Extra = extra
+		_, out[i].Deprecated = NamespaceDeprecation(extra.Namespace)
+
+		factory, ok := extraTypes[extraKey{extra.Namespace, extra.Type}]
+		if !ok {
+			continue
+		}
+
+		val := factory()
+		if err := json.Unmarshal(extra.Data, val); err != nil {
+			errs = append(errs, fmt.Errorf("extra %s %s: %w", extra.Namespace, extra.Type, err))
+			continue
+		}
+		out[i].Value = val
+	}
+
+	return out, errors.Join(errs...)
+}
@@ -0,0 +1,43 @@
+package profilefed
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+type testCategory struct {
+	Name string `json:"name"`
+}
+
+func TestDecodeExtras(t *testing.T) {
+	const ns = "https://example.com/ns/test"
+	RegisterExtraType(ns, "category", func() any { return &testCategory{} })
+
+	desc := &Descriptor{ID: "main"}
+	if err := desc.AddExtra(ns, "category", testCategory{Name: "art"}); err != nil {
+		t.Fatalf("AddExtra error: %s", err)
+	}
+	if err := desc.AddStats(Stats{Posts: &StatCount{Count: 42}}); err != nil {
+		t.Fatalf("AddStats error: %s", err)
+	}
+	if err := desc.AddExtra(ns, "unknown", 1); err != nil {
+		t.Fatalf("AddExtra error: %s", err)
+	}
+	desc.Extra = append(desc.Extra, Extra{Namespace: ns, Type: "category", Data: json.RawMessage(`"invalid"`)})
+
+	extras, err := desc.DecodeExtras()
+	if err == nil {
+		t.Errorf("Expected error for invalid extra, got nil")
+	}
+
+	var values []any
+	for _, extra := range extras {
+		values = append(values, extra.Value)
+	}
+
+	expected := []any{&testCategory{Name: "art"}, &Stats{Posts: &StatCount{Count: 42}}, nil, nil}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("Values are not equal:\n%#v\n\n%#v", values, expected)
+	}
+}
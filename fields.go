@@ -0,0 +1,102 @@
+package profilefed
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// descriptorFields contains the JSON names of all the descriptor fields.
+var descriptorFields = []string{"id", "namespaces", "display_name", "username", "bio", "role", "extra", "did", "avatar_url", "banner_url", "avatar_alt", "banner_alt", "pronouns", "content_warning", "sensitive", "avatar_sensitive", "banner_sensitive", "audience"}
+
+// UnknownFieldError is returned when a client requests a descriptor field that doesn't exist.
+type UnknownFieldError struct {
+	Field string
+}
+
+func (ufe UnknownFieldError) Error() string {
+	return fmt.Sprintf("unknown descriptor field: %q", ufe.Field)
+}
+
+// SelectFields returns a copy of the descriptor that only contains the given fields,
+// identified by their JSON names. The id, username, and namespaces fields are always
+// kept, since without them, a descriptor can't be identified or its extras interpreted.
+// The content warning, sensitive flags, and audience are kept as well, so that selected
+// fields are never shown without them, and so is the alt text of selected images.
+// All other fields are set to their zero values.
+// If fields is empty, an unmodified copy is returned.
+func (d *Descriptor) SelectFields(fields ...string) (*Descriptor, error) {
+	out := *d
+	if len(fields) == 0 {
+		return &out, nil
+	}
+
+	if err := validateFields(fields); err != nil {
+		return nil, err
+	}
+
+	out = Descriptor{
+		ID:              d.ID,
+		Username:        d.Username,
+		Namespaces:      d.Namespaces,
+		ContentWarning:  d.ContentWarning,
+		Sensitive:       d.Sensitive,
+		AvatarSensitive: d.AvatarSensitive,
+		BannerSensitive: d.BannerSensitive,
+		Audience:        d.Audience,
+	}
+	for _, field := range fields {
+		switch field {
+		case "display_name":
+			out.DisplayName = d.DisplayName
+		case "bio":
+			out.Bio = d.Bio
+		case "role":
+			out.Role = d.Role
+		case "extra":
+			out.Extra = d.Extra
+		case "did":
+			out.DID = d.DID
+		case "avatar_url":
+			out.AvatarURL = d.AvatarURL
+			out.AvatarAlt = d.AvatarAlt
+		case "banner_url":
+			out.BannerURL = d.BannerURL
+			out.BannerAlt = d.BannerAlt
+		case "avatar_alt":
+			out.AvatarAlt = d.AvatarAlt
+		case "banner_alt":
+			out.BannerAlt = d.BannerAlt
+		case "pronouns":
+			out.Pronouns = d.Pronouns
+		}
+	}
+
+	return &out, nil
+}
+
+// validateFields returns an [UnknownFieldError] if any of the
+// given fields isn't a descriptor field.
+func validateFields(fields []string) error {
+	for _, field := range fields {
+		if !slices.Contains(descriptorFields, field) {
+			return UnknownFieldError{Field: field}
+		}
+	}
+	return nil
+}
+
+// LookupFields is the same as [Client.Lookup], but it asks the server to only
+// return the given fields, identified by their JSON names, such as display_name.
+// The id, username, and namespaces fields are always returned. The response is signed, so a server
+// that doesn't support field selection may return the full descriptor instead.
+func (c Client) LookupFields(resource string, fields ...string) (*Descriptor, error) {
+	wfdesc, err := c.webfinger().LookupAcct(resource)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &Descriptor{}
+	_, err = c.lookup(wfdesc, lookupParams{fields: strings.Join(fields, ",")}, out)
+	return out, err
+}
@@ -0,0 +1,90 @@
+package profilefed
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+)
+
+// ErrFingerprintMismatch signifies that the fingerprint in a
+// server info doesn't match the public key it contains.
+var ErrFingerprintMismatch = errors.New("server info fingerprint does not match pubkey")
+
+// Fingerprint returns the SHA-256 fingerprint of pubkey in the form used by
+// OpenSSH, such as "SHA256:" followed by the unpadded base64-encoded hash.
+// It's meant to be shown to users so they can compare keys out of band.
+func Fingerprint(pubkey ed25519.PublicKey) string {
+	sum := sha256.Sum256(pubkey)
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
+
+// FingerprintHex returns the hex-encoded SHA-256 fingerprint of pubkey,
+// as used in key events, traces, and by [Client.KeyFingerprint].
+func FingerprintHex(pubkey ed25519.PublicKey) string {
+	sum := sha256.Sum256(pubkey)
+	return hex.EncodeToString(sum[:])
+}
+
+// FingerprintSymbol is a symbol used to represent part of a key's fingerprint.
+type FingerprintSymbol struct {
+	// Emoji is the emoji representing the symbol.
+	Emoji string
+	// Name is the English name of the symbol, which can be read aloud.
+	Name string
+}
+
+// fingerprintSymbols contains the 64 symbols used by [FingerprintSymbols].
+var fingerprintSymbols = [64]FingerprintSymbol{
+	{"🐶", "Dog"}, {"🐱", "Cat"}, {"🦁", "Lion"}, {"🐎", "Horse"},
+	{"🦄", "Unicorn"}, {"🐷", "Pig"}, {"🐘", "Elephant"}, {"🐰", "Rabbit"},
+	{"🐼", "Panda"}, {"🐓", "Rooster"}, {"🐧", "Penguin"}, {"🐢", "Turtle"},
+	{"🐟", "Fish"}, {"🐙", "Octopus"}, {"🦋", "Butterfly"}, {"🌷", "Flower"},
+	{"🌳", "Tree"}, {"🌵", "Cactus"}, {"🍄", "Mushroom"}, {"🌏", "Globe"},
+	{"🌙", "Moon"}, {"☁️", "Cloud"}, {"🔥", "Fire"}, {"🍌", "Banana"},
+	{"🍎", "Apple"}, {"🍓", "Strawberry"}, {"🌽", "Corn"}, {"🍕", "Pizza"},
+	{"🎂", "Cake"}, {"❤️", "Heart"}, {"😀", "Smiley"}, {"🤖", "Robot"},
+	{"🎩", "Hat"}, {"👓", "Glasses"}, {"🔧", "Spanner"}, {"🎅", "Santa"},
+	{"👍", "Thumbs Up"}, {"☂️", "Umbrella"}, {"⌛", "Hourglass"}, {"⏰", "Clock"},
+	{"🎁", "Gift"}, {"💡", "Light Bulb"}, {"📕", "Book"}, {"✏️", "Pencil"},
+	{"📎", "Paperclip"}, {"✂️", "Scissors"}, {"🔒", "Lock"}, {"🔑", "Key"},
+	{"🔨", "Hammer"}, {"☎️", "Telephone"}, {"🏁", "Flag"}, {"🚂", "Train"},
+	{"🚲", "Bicycle"}, {"✈️", "Aeroplane"}, {"🚀", "Rocket"}, {"🏆", "Trophy"},
+	{"⚽", "Ball"}, {"🎸", "Guitar"}, {"🎺", "Trumpet"}, {"🔔", "Bell"},
+	{"⚓", "Anchor"}, {"🎧", "Headphones"}, {"📁", "Folder"}, {"📌", "Pin"},
+}
+
+// fingerprintSymbolCount is the number of symbols returned by [FingerprintSymbols].
+const fingerprintSymbolCount = 10
+
+// FingerprintSymbols returns the first 60 bits of the SHA-256 fingerprint of
+// pubkey as 10 symbols, each of which has an emoji and a name. They're meant
+// to be compared over a phone call or in person, where reading out a base64
+// or hex fingerprint is error-prone.
+func FingerprintSymbols(pubkey ed25519.PublicKey) []FingerprintSymbol {
+	sum := sha256.Sum256(pubkey)
+
+	out := make([]FingerprintSymbol, fingerprintSymbolCount)
+	for i := range out {
+		// Every symbol encodes 6 bits of the hash
+		bit := i * 6
+		val := uint16(sum[bit/8])<<8 | uint16(sum[bit/8+1])
+		out[i] = fingerprintSymbols[(val>>(10-bit%8))&0x3f]
+	}
+	return out
+}
+
+// pubkey decodes the public key in the server info and checks
+// that it matches the fingerprint, if there is one.
+func (info serverInfoData) pubkey() (ed25519.PublicKey, error) {
+	pubkey, err := base64.StdEncoding.DecodeString(info.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.Fingerprint != "" && info.Fingerprint != Fingerprint(pubkey) {
+		return nil, ErrFingerprintMismatch
+	}
+	return pubkey, nil
+}
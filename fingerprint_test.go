@@ -0,0 +1,70 @@
+package profilefed
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestFingerprint(t *testing.T) {
+	pub, err := JWK{KeyType: "OKP", Curve: "Ed25519", X: "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"}.PublicKey()
+	if err != nil {
+		t.Fatalf("PublicKey error: %s", err)
+	}
+
+	if fp := Fingerprint(pub); fp != "SHA256:If4x36FUomFia/hUBG/SJxt77UtqvkWqWId+9H+XIbk" {
+		t.Errorf("Unexpected fingerprint: %s", fp)
+	}
+
+	if fp := FingerprintHex(pub); fp != "21fe31dfa154a261626bf854046fd2271b7bed4b6abe45aa58877ef47f9721b9" {
+		t.Errorf("Unexpected hex fingerprint: %s", fp)
+	}
+
+	var names []string
+	for _, sym := range FingerprintSymbols(pub) {
+		names = append(names, sym.Name)
+	}
+	if got := strings.Join(names, " "); got != "Panda Robot Ball Telephone Trophy Trumpet Pig Moon Gift Hourglass" {
+		t.Errorf("Unexpected fingerprint symbols: %s", got)
+	}
+}
+
+func TestFingerprintMismatch(t *testing.T) {
+	desc := &Descriptor{ID: "main", Username: "user", DisplayName: "User"}
+
+	pub, priv, err := GenerateKeys()
+	if err != nil {
+		t.Fatalf("GenerateKeys error: %s", err)
+	}
+	other, _, err := GenerateKeys()
+	if err != nil {
+		t.Fatalf("GenerateKeys error: %s", err)
+	}
+
+	mux := tenantMux("mismatch.test", ServerInfoHandler{}, Handler{
+		PrivateKey: priv,
+		DescriptorFunc: func(req *Request) (*Descriptor, error) {
+			return desc, nil
+		},
+	})
+
+	mt := &MemoryTransport{}
+	mt.Register("mismatch.test", http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/_profilefed/server" {
+			mux.ServeHTTP(res, req)
+			return
+		}
+
+		SignedJSON(res, priv, serverInfoData{
+			ServerName:  "mismatch.test",
+			PublicKey:   base64.StdEncoding.EncodeToString(pub),
+			Fingerprint: Fingerprint(other),
+		})
+	}))
+
+	if _, err := mt.Client().Lookup("user@mismatch.test"); !errors.Is(err, ErrFingerprintMismatch) {
+		t.Errorf("Expected ErrFingerprintMismatch, got %v", err)
+	}
+}
@@ -1,17 +1,39 @@
 package profilefed
 
 import (
+	"crypto"
 	"crypto/ed25519"
-	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"net/http"
 	"slices"
 	"strings"
+	"time"
 )
 
-// ErrDescriptorNotFound should be returned
-var ErrDescriptorNotFound = errors.New("descriptor not found")
+var (
+	// ErrDescriptorNotFound should be returned
+	ErrDescriptorNotFound = errors.New("descriptor not found")
+	// ErrInvalidRequest signifies that a request's query parameters are malformed.
+	// Descriptor funcs can return it when they handle custom parameters.
+	ErrInvalidRequest = errors.New("invalid descriptor request")
+)
+
+// DefaultErrorHandler is the error handler used by the handlers in this package
+// if no ErrorHandler is set. It responds with 404 Not Found for [ErrDescriptorNotFound],
+// 400 Bad Request for [ErrInvalidRequest] and unknown fields, and 500 Internal
+// Server Error for any other error, without revealing the error message.
+func DefaultErrorHandler(err error, res http.ResponseWriter) {
+	var ufe UnknownFieldError
+	switch {
+	case errors.Is(err, ErrDescriptorNotFound):
+		http.Error(res, err.Error(), http.StatusNotFound)
+	case errors.Is(err, ErrInvalidRequest), errors.As(err, &ufe):
+		http.Error(res, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(res, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
 
 // AddExtra is a convenience function that adds an extra data object to the descriptor.
 // It defines any undefined namespaces and marshals the data parameter into JSON.
@@ -40,57 +62,293 @@ func (d *Descriptor) AddExtra(namespace, etype string, data any) error {
 type Handler struct {
 	// PrivateKey contains the server's Ed25519 private key for signing responses
 	PrivateKey ed25519.PrivateKey
+	// Signer, if set, signs responses instead of PrivateKey, so that keys held
+	// in an HSM or a KMS can be used without exposing them. It has to hold
+	// an Ed25519 key.
+	Signer crypto.Signer
+
+	// KeyCertificate, if set, certifies the handler's key using the server's
+	// identity key, and is sent with every response. It lets the identity key
+	// in the server info be kept offline, while PrivateKey or Signer hold
+	// an online key that's only used to sign descriptors.
+	KeyCertificate *KeyCertificate
+
+	// Rotator, if set, provides the key used to sign responses instead of
+	// PrivateKey, so that rotated keys take effect immediately. Share links
+	// signed with a previous key stop working once the key is rotated.
+	Rotator *KeyRotator
 
 	// AllDescriptorsFunc should return all the profile descriptors known to the server.
 	// If no matching descriptors can be found, AllDescriptorsFunc should reutnr
-	// [ErrDescriptorNotFound].
-	AllDescriptorsFunc func(req *http.Request) (map[string]*Descriptor, error)
+	// [ErrDescriptorNotFound]. Nil descriptors in the map are left out of the response.
+	AllDescriptorsFunc func(req *Request) (map[string]*Descriptor, error)
 
-	// DescriptorFunc should return a single descriptor. Make sure to check the `id`
-	// query parameter if your user has several descriptors available. If a matching
+	// DescriptorFunc should return a single descriptor. Make sure to check the
+	// requested ID if your user has several descriptors available. If a matching
 	// descriptor cannot be found, DescriptorFunc should return [ErrDescriptorNotFound].
-	DescriptorFunc func(req *http.Request) (*Descriptor, error)
+	// A nil descriptor is treated the same way.
+	DescriptorFunc func(req *Request) (*Descriptor, error)
 
 	// ErrorHandler is called whenever an error is encountered.
+	// If it's nil, [DefaultErrorHandler] is used.
 	ErrorHandler func(err error, res http.ResponseWriter)
+
+	// RateLimiter, if set, limits the rate at which clients can make requests.
+	// Clients that exceed the limit get a 429 Too Many Requests response.
+	RateLimiter *RateLimiter
+
+	// Tarpit, if set along with RateLimiter, puts clients that repeatedly
+	// trip the rate limiter into a tarpit. See [Tarpit] for details.
+	Tarpit *Tarpit
+
+	// TokenValidator, if set, validates bearer tokens sent by clients. The info of
+	// a validated token is available to DescriptorFunc and AllDescriptorsFunc via
+	// [TokenFromContext], so they can return more detailed descriptors to authorized apps.
+	TokenValidator TokenValidator
+
+	// RequireToken, if set, reports whether a request requires a valid bearer
+	// token. Requests that require one but don't provide it get a 401 response,
+	// and so do all requests that require one if TokenValidator is nil.
+	RequireToken func(req *http.Request) bool
+
+	// AccessLog, if set, receives a record of which fields of each descriptor
+	// were disclosed, at which visibility tier, and to which client.
+	AccessLog AccessLogSink
+
+	// Template, if set, fills defaults into every descriptor before it's signed.
+	Template *DescriptorTemplate
+
+	// EnvelopeTTL is how long the signed timestamp sent with every descriptor
+	// is valid for. Clients reject descriptors whose timestamp has expired,
+	// so that old descriptors can't be replayed. If it's zero,
+	// [DefaultEnvelopeTTL] is used.
+	EnvelopeTTL time.Duration
+
+	// SignatureMode selects how responses are signed. By default, they're
+	// signed using the X-ProfileFed-Sig header.
+	SignatureMode SignatureMode
+
+	// MovedTo, if set, is the URL that the descriptor endpoint has permanently
+	// moved to. Every request is answered with a redirect to it, which is
+	// signed, so that clients can verify it before following it.
+	MovedTo string
+
+	// MinimalFields contains the fields served to anonymous clients for profiles
+	// that use [PrivacyMinimal]. If empty, only the ID, username, and display
+	// name are served.
+	MinimalFields []string
 }
 
 // ServeHTTP implements the [http.Handler] interface
 func (h Handler) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	if h.ErrorHandler == nil {
+		h.ErrorHandler = DefaultErrorHandler
+	}
+
+	if h.RateLimiter != nil {
+		key := h.RateLimiter.Key(req)
+		if h.Tarpit != nil && h.Tarpit.Trapped(key) {
+			h.serveTarpit(res, req)
+			return
+		}
+
+		if !h.RateLimiter.AllowKey(key) {
+			if h.Tarpit != nil && h.Tarpit.trip(key, req) {
+				h.serveTarpit(res, req)
+				return
+			}
+			http.Error(res, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+			return
+		}
+	}
+
+	if h.MovedTo != "" {
+		h.serveMoved(res, req, h.signer())
+		return
+	}
+
+	req, err := h.checkShare(req)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusUnauthorized)
+		return
+	} else if _, ok := ShareGrantFromContext(req.Context()); ok {
+		// Share links must not be stored by shared caches
+		res.Header().Set("Cache-Control", "private")
+	}
+
+	if h.TokenValidator != nil || h.RequireToken != nil {
+		req, err = h.authenticate(req)
+		if errors.Is(err, ErrTokenRequired) || errors.Is(err, ErrInvalidToken) {
+			res.Header().Set("WWW-Authenticate", `Bearer realm="profilefed"`)
+			http.Error(res, err.Error(), http.StatusUnauthorized)
+			return
+		} else if err != nil {
+			h.ErrorHandler(err, res)
+			return
+		}
+		res.Header().Add("Vary", "Authorization")
+	}
+
+	pfdReq := parseRequest(req)
+	if err := validateFields(pfdReq.Fields); err != nil {
+		h.ErrorHandler(err, res)
+		return
+	}
+
 	var data []byte
-	if req.URL.Query().Get("all") == "1" {
-		descriptors, err := h.AllDescriptorsFunc(req)
+	if pfdReq.All {
+		descriptors, err := h.AllDescriptorsFunc(pfdReq)
 		if err != nil {
 			h.ErrorHandler(err, res)
 			return
 		}
 
+		prepared := make(map[string]*Descriptor, len(descriptors))
+		for id, desc := range descriptors {
+			if desc == nil {
+				continue
+			}
+			if err := ValidateAudience(desc.Audience); err != nil {
+				h.ErrorHandler(InvalidFieldError{Field: "audience", Reason: err.Error()}, res)
+				return
+			}
+			prepared[id] = h.prepare(pfdReq, desc)
+		}
+		descriptors = prepared
+
 		data, err = json.Marshal(descriptors)
 		if err != nil {
 			h.ErrorHandler(err, res)
 			return
 		}
+
+		for _, desc := range descriptors {
+			h.logAccess(req, desc)
+		}
 	} else {
-		descriptor, err := h.DescriptorFunc(req)
+		descriptor, err := h.DescriptorFunc(pfdReq)
 		if err != nil {
 			h.ErrorHandler(err, res)
 			return
 		}
+		if descriptor == nil {
+			h.ErrorHandler(ErrDescriptorNotFound, res)
+			return
+		}
+
+		if err := ValidateAudience(descriptor.Audience); err != nil {
+			h.ErrorHandler(InvalidFieldError{Field: "audience", Reason: err.Error()}, res)
+			return
+		}
+		descriptor = h.prepare(pfdReq, descriptor)
 
 		data, err = json.Marshal(descriptor)
 		if err != nil {
 			h.ErrorHandler(err, res)
 			return
 		}
+
+		h.logAccess(req, descriptor)
+	}
+
+	signer := h.signer()
+	pubkey, err := signerPublicKey(signer)
+	if err != nil {
+		h.ErrorHandler(err, res)
+		return
+	}
+
+	if err := setEnvelope(res.Header(), signer, data, h.EnvelopeTTL); err != nil {
+		h.ErrorHandler(err, res)
+		return
+	}
+
+	tag := etag(pubkey, data)
+	res.Header().Set("ETag", tag)
+	if etagMatches(req.Header.Get("If-None-Match"), tag) {
+		res.WriteHeader(http.StatusNotModified)
+		return
 	}
 
-	sig := ed25519.Sign(h.PrivateKey, data)
-	res.Header().Set("X-ProfileFed-Sig", base64.StdEncoding.EncodeToString(sig))
 	res.Header().Set("Content-Type", "application/x-pfd+json")
+	if err := h.writeSigned(res, req, signer, http.StatusOK, data); err != nil {
+		h.ErrorHandler(err, res)
+		return
+	}
+}
+
+// signer returns the signer used to sign responses.
+func (h Handler) signer() crypto.Signer {
+	if h.Signer == nil && h.Rotator != nil {
+		return h.Rotator.PrivateKey()
+	}
+	return keySigner(h.Signer, h.PrivateKey)
+}
+
+// prepare applies the handler's template and the requested
+// field selection to a descriptor returned by a descriptor func.
+func (h Handler) prepare(req *Request, desc *Descriptor) *Descriptor {
+	if h.Template != nil {
+		desc = h.Template.Apply(req, desc)
+	}
+
+	if desc.Privacy == PrivacyMinimal && req.Visibility() == VisibilityPublic {
+		desc = h.minimal(desc)
+	}
 
-	_, err := res.Write(data)
+	// The fields have already been validated, so this can't fail
+	desc, _ = desc.SelectFields(req.Fields...)
+	return desc
+}
+
+// minimal returns the minimal view of desc served to anonymous clients.
+func (h Handler) minimal(desc *Descriptor) *Descriptor {
+	fields := h.MinimalFields
+	if len(fields) == 0 {
+		fields = []string{"id", "username", "display_name"}
+	}
+
+	out, err := desc.SelectFields(fields...)
+	if err != nil {
+		// Fall back to the least revealing view if
+		// MinimalFields contains invalid fields
+		out, _ = desc.SelectFields("id")
+	}
+
+	// Without extras, the namespaces would only reveal
+	// which kinds of extra data the profile contains.
+	if !slices.Contains(fields, "extra") {
+		out.Namespaces = nil
+	}
+	return out
+}
+
+// serveTarpit serves a response to a client that's in the tarpit.
+func (h Handler) serveTarpit(res http.ResponseWriter, req *http.Request) {
+	if h.Tarpit.DecoyFunc != nil {
+		data, err := json.Marshal(h.Tarpit.DecoyFunc(req))
+		if err != nil {
+			h.ErrorHandler(err, res)
+			return
+		}
+
+		res.Header().Set("Content-Type", "application/x-pfd+json")
+		if err := setEnvelope(res.Header(), h.signer(), data, h.EnvelopeTTL); err != nil {
+			h.ErrorHandler(err, res)
+			return
+		}
+		if err := h.writeSigned(res, req, h.signer(), http.StatusOK, data); err != nil {
+			h.ErrorHandler(err, res)
+		}
+		return
+	}
+
+	data, err := json.Marshal(&Descriptor{})
 	if err != nil {
 		h.ErrorHandler(err, res)
 		return
 	}
+
+	res.Header().Set("Content-Type", "application/x-pfd+json")
+	h.Tarpit.drip(res, req, data)
 }
@@ -0,0 +1,230 @@
+package profilefed
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestHandlerMinimalPrivacy(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Error generating key: %s", err)
+	}
+
+	desc := &Descriptor{
+		ID:          "main",
+		Username:    "user",
+		DisplayName: "User",
+		Bio:         "Private bio",
+		Namespaces:  []string{"https://example.com/ns"},
+		Privacy:     PrivacyMinimal,
+	}
+
+	h := Handler{
+		PrivateKey: priv,
+		DescriptorFunc: func(req *Request) (*Descriptor, error) {
+			return desc, nil
+		},
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/pfd/user", nil))
+
+	var out Descriptor
+	if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+		t.Fatalf("Error decoding response: %s", err)
+	}
+
+	expected := Descriptor{ID: "main", Username: "user", DisplayName: "User"}
+	if !reflect.DeepEqual(out, expected) {
+		t.Errorf("Descriptors are not equal:\n%#v\n\n%#v", out, expected)
+	}
+
+	// A share link grants access to the full profile
+	link, err := NewShareLink(priv, "http://example.com/pfd/user", "", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("NewShareLink error: %s", err)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", link, nil))
+
+	out = Descriptor{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+		t.Fatalf("Error decoding response: %s", err)
+	}
+
+	if out.Bio != desc.Bio {
+		t.Errorf("Share link did not grant access to the full profile: %#v", out)
+	}
+
+	expired, err := NewShareLink(priv, "http://example.com/pfd/user", "", time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("NewShareLink error: %s", err)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", expired, nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Unexpected status code for expired share link: %d", rec.Code)
+	}
+
+	// A signed response with the same members must not be usable as a token
+	payload := []byte(`{"path":"/pfd/user","exp":"` + time.Now().Add(time.Hour).UTC().Format(time.RFC3339) + `"}`)
+	forged := base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(ed25519.Sign(priv, payload))
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/pfd/user?"+ShareParam+"="+forged, nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Unexpected status code for share token without prefix: %d", rec.Code)
+	}
+}
+
+func TestHandlerDefaultErrors(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Error generating key: %s", err)
+	}
+
+	h := Handler{
+		PrivateKey: priv,
+		DescriptorFunc: func(req *Request) (*Descriptor, error) {
+			switch req.ID {
+			case "broken":
+				return nil, errors.New("database is on fire")
+			case "main":
+				return &Descriptor{ID: "main"}, nil
+			default:
+				return nil, ErrDescriptorNotFound
+			}
+		},
+	}
+
+	tests := map[string]int{
+		"/pfd/user?id=main":          http.StatusOK,
+		"/pfd/user?id=missing":       http.StatusNotFound,
+		"/pfd/user?id=main&fields=x": http.StatusBadRequest,
+		"/pfd/user?id=broken":        http.StatusInternalServerError,
+	}
+
+	for target, status := range tests {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", target, nil))
+		if rec.Code != status {
+			t.Errorf("Unexpected status for %s: %d", target, rec.Code)
+		}
+	}
+}
+
+func TestHandlerETag(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Error generating key: %s", err)
+	}
+
+	h := Handler{
+		PrivateKey: priv,
+		DescriptorFunc: func(req *Request) (*Descriptor, error) {
+			return &Descriptor{ID: "main", DisplayName: "Test"}, nil
+		},
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/pfd/user", nil))
+	tag := rec.Header().Get("ETag")
+	if rec.Code != http.StatusOK || tag == "" {
+		t.Fatalf("Unexpected response: %d, ETag %q", rec.Code, tag)
+	}
+
+	req := httptest.NewRequest("GET", "/pfd/user", nil)
+	req.Header.Set("If-None-Match", `"other", W/`+tag)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Fatalf("Expected empty 304 response, got %d with %d bytes", rec.Code, rec.Body.Len())
+	}
+
+	// A different key must produce a different tag
+	_, h.PrivateKey, _ = ed25519.GenerateKey(rand.Reader)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 after key change, got %d", rec.Code)
+	}
+}
+
+func TestHandlerRequireTokenWithoutValidator(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Error generating key: %s", err)
+	}
+
+	h := Handler{
+		PrivateKey: priv,
+		DescriptorFunc: func(req *Request) (*Descriptor, error) {
+			return &Descriptor{ID: "main", Username: "user", DisplayName: "User"}, nil
+		},
+		RequireToken: func(req *http.Request) bool { return true },
+	}
+
+	for _, auth := range []string{"", "Bearer anything"} {
+		req := httptest.NewRequest("GET", "/pfd/user", nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("Expected 401 for %q, got %d", auth, rec.Code)
+		}
+	}
+}
+
+func TestHandlerNilDescriptor(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Error generating key: %s", err)
+	}
+
+	h := Handler{
+		PrivateKey: priv,
+		DescriptorFunc: func(req *Request) (*Descriptor, error) {
+			return nil, nil
+		},
+		AllDescriptorsFunc: func(req *Request) (map[string]*Descriptor, error) {
+			return map[string]*Descriptor{
+				"main":    {ID: "main", Username: "user", DisplayName: "User"},
+				"missing": nil,
+			}, nil
+		},
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/pfd/user", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a nil descriptor, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/pfd/user?all=1", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 with a nil descriptor in the map, got %d", rec.Code)
+	}
+
+	var descs map[string]*Descriptor
+	if err := json.Unmarshal(rec.Body.Bytes(), &descs); err != nil {
+		t.Fatalf("Unmarshal error: %s", err)
+	}
+	if _, ok := descs["missing"]; ok || descs["main"] == nil {
+		t.Errorf("Expected only the non-nil descriptor, got %v", descs)
+	}
+}
@@ -0,0 +1,82 @@
+package profilefed
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"queerdevs.org/profilefed/webfinger"
+)
+
+// maxErrorBodySize is the maximum size of the response body snippet kept in an [HTTPError].
+const maxErrorBodySize = 512
+
+// HTTPError is returned by [Client] when a server responds with an unexpected
+// status code. Callers can use [errors.As] to inspect it, for example to tell
+// a missing profile (404) apart from rate limiting (429) or a server error.
+type HTTPError struct {
+	// Operation is the name of the operation that failed, such as getServerInfo.
+	Operation string
+	// URL is the URL of the request, with credentials redacted.
+	URL string
+	// StatusCode is the status code of the response.
+	StatusCode int
+	// Status is the status line of the response, such as "404 Not Found".
+	Status string
+	// Body contains the beginning of the response body, which often
+	// includes a human-readable description of the error.
+	Body string
+	// RetryAfter is how long the server asked the client to wait before
+	// trying again, from the Retry-After header of 429 and 503 responses.
+	// It's zero if the server didn't say.
+	RetryAfter time.Duration
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Operation, e.Status)
+}
+
+// RetryAfter returns how long the server that caused err asked the client to
+// wait before trying again, if err is a rate limiting or unavailability error
+// returned by a WebFinger or ProfileFed request that included a Retry-After header.
+func RetryAfter(err error) (time.Duration, bool) {
+	var rle *webfinger.RateLimitedError
+	if errors.As(err, &rle) && rle.RetryAfter > 0 {
+		return rle.RetryAfter, true
+	}
+
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) && httpErr.RetryAfter > 0 {
+		return httpErr.RetryAfter, true
+	}
+
+	return 0, false
+}
+
+// checkResp returns an [*HTTPError] if the response is not 200 OK.
+func checkResp(res *http.Response, opName string) error {
+	if res.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	err := &HTTPError{
+		Operation:  opName,
+		StatusCode: res.StatusCode,
+		Status:     res.Status,
+	}
+
+	if res.StatusCode == http.StatusTooManyRequests || res.StatusCode == http.StatusServiceUnavailable {
+		err.RetryAfter, _ = webfinger.ParseRetryAfter(res.Header.Get("Retry-After"), time.Now())
+	}
+
+	if res.Request != nil && res.Request.URL != nil {
+		err.URL = redactURL(res.Request.URL)
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(res.Body, maxErrorBodySize))
+	err.Body = strings.TrimSpace(string(body))
+	return err
+}
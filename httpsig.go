@@ -0,0 +1,307 @@
+package profilefed
+
+import (
+	"crypto"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SignatureMode selects how a [Handler] signs its responses.
+type SignatureMode int
+
+const (
+	// SignatureProfileFed signs responses using the X-ProfileFed-Sig header.
+	SignatureProfileFed SignatureMode = iota
+	// SignatureHTTP signs responses using [RFC 9421] HTTP Message Signatures,
+	// so that they can be verified by generic HTTP signature tooling. Clients
+	// in this package detect and verify them automatically.
+	//
+	// [RFC 9421]: https://www.rfc-editor.org/rfc/rfc9421
+	SignatureHTTP
+	// SignatureBoth signs responses using both the X-ProfileFed-Sig header
+	// and HTTP Message Signatures, for clients that don't support the latter.
+	SignatureBoth
+)
+
+// httpSigLabel is the label of the HTTP message signatures made by handlers.
+const httpSigLabel = "pfd"
+
+// httpSigComponents contains the components covered by HTTP message signatures.
+// They bind the signature to the response body, via its digest, and to the
+// request, so that a response can't be replayed for another request.
+var httpSigComponents = []string{`"@status"`, `"@method";req`, `"@request-target";req`, `"content-digest"`, `"date"`}
+
+// ErrInvalidHTTPSignature signifies that a response's HTTP message signature
+// is malformed or doesn't cover the components required by ProfileFed.
+var ErrInvalidHTTPSignature = errors.New("invalid http message signature")
+
+// writeSigned signs data using signer and the handler's signature mode, and
+// writes it to res with the given status code in response to req.
+func (h Handler) writeSigned(res http.ResponseWriter, req *http.Request, signer crypto.Signer, status int, data []byte) error {
+	if h.KeyCertificate != nil {
+		res.Header().Set(keyCertHeader, h.KeyCertificate.String())
+	}
+
+	if h.SignatureMode == SignatureProfileFed {
+		return writeSignedStatus(res, signer, status, data)
+	}
+
+	if h.SignatureMode == SignatureBoth {
+		if err := setSignature(res.Header(), signer, data); err != nil {
+			return err
+		}
+	} else {
+		setContentDigest(res.Header(), data)
+		res.Header().Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	}
+
+	if err := signHTTPMessage(res.Header(), req, signer, status); err != nil {
+		return err
+	}
+
+	res.WriteHeader(status)
+	_, err := res.Write(data)
+	return err
+}
+
+// signHTTPMessage adds an HTTP message signature of a response to req with the
+// given status code and headers to h. The Content-Digest and Date headers have
+// to be set already.
+func signHTTPMessage(h http.Header, req *http.Request, signer crypto.Signer, status int) error {
+	target := req.RequestURI
+	if target == "" {
+		target = req.URL.RequestURI()
+	}
+
+	values := map[string]string{
+		`"@status"`:             strconv.Itoa(status),
+		`"@method";req`:         req.Method,
+		`"@request-target";req`: target,
+		`"content-digest"`:      h.Get("Content-Digest"),
+		`"date"`:                h.Get("Date"),
+	}
+
+	pubkey, err := signerPublicKey(signer)
+	if err != nil {
+		return err
+	}
+
+	params := fmt.Sprintf("(%s);created=%d;keyid=%q;alg=\"ed25519\"",
+		strings.Join(httpSigComponents, " "), time.Now().Unix(), FingerprintHex(pubkey))
+
+	var base strings.Builder
+	for _, component := range httpSigComponents {
+		base.WriteString(component + ": " + values[component] + "\n")
+	}
+	base.WriteString(`"@signature-params": ` + params)
+
+	sig, err := sign(signer, []byte(base.String()))
+	if err != nil {
+		return err
+	}
+
+	h.Set("Signature-Input", httpSigLabel+"="+params)
+	h.Set("Signature", httpSigLabel+"=:"+base64.StdEncoding.EncodeToString(sig)+":")
+	return nil
+}
+
+// responseSignature returns the signature of res, whose body is data, and the
+// data covered by the signature. Responses signed using the X-ProfileFed-Sig
+// header are preferred, and HTTP message signatures are used otherwise.
+func responseSignature(res *http.Response, data []byte) (sig, signed []byte, err error) {
+	sig, err = getSignature(res)
+	if err == nil {
+		return sig, data, nil
+	} else if !errors.Is(err, ErrNoSignature) || res.Header.Get("Signature-Input") == "" {
+		return nil, nil, err
+	}
+	return httpMessageSignature(res, data)
+}
+
+// httpMessageSignature returns the HTTP message signature of res, whose body
+// is data, and its signature base. The signature must cover all the components
+// in httpSigComponents, and the Content-Digest header must match data.
+func httpMessageSignature(res *http.Response, data []byte) (sig, base []byte, err error) {
+	inputs := splitSFDict(res.Header.Get("Signature-Input"))
+	sigs := splitSFDict(res.Header.Get("Signature"))
+
+	// Signatures made by ProfileFed handlers are preferred,
+	// but any label is accepted for other implementations.
+	label := httpSigLabel
+	if _, ok := inputs[label]; !ok {
+		for l := range inputs {
+			if _, ok := sigs[l]; ok {
+				label = l
+				break
+			}
+		}
+	}
+
+	params, ok := inputs[label]
+	if !ok || !strings.HasPrefix(params, "(") {
+		return nil, nil, ErrInvalidHTTPSignature
+	}
+
+	encoded, ok := sigs[label]
+	if !ok || len(encoded) < 2 || encoded[0] != ':' || encoded[len(encoded)-1] != ':' {
+		return nil, nil, ErrInvalidHTTPSignature
+	}
+
+	sig, err = base64.StdEncoding.DecodeString(encoded[1 : len(encoded)-1])
+	if err != nil {
+		return nil, nil, ErrInvalidHTTPSignature
+	}
+
+	end := strings.IndexByte(params, ')')
+	if end < 0 {
+		return nil, nil, ErrInvalidHTTPSignature
+	}
+	components := strings.Fields(params[1:end])
+
+	for _, required := range httpSigComponents {
+		if !slices.Contains(components, required) {
+			return nil, nil, ErrInvalidHTTPSignature
+		}
+	}
+
+	for _, param := range strings.Split(params[end+1:], ";") {
+		name, val, _ := strings.Cut(param, "=")
+		switch name {
+		case "alg":
+			if val != `"ed25519"` {
+				return nil, nil, ErrInvalidHTTPSignature
+			}
+		case "expires":
+			expires, err := strconv.ParseInt(val, 10, 64)
+			if err != nil || time.Now().Unix() > expires {
+				return nil, nil, ErrInvalidHTTPSignature
+			}
+		}
+	}
+
+	// The digest binds the signature to the body, so it can't be optional
+	ok, checked := matchDigests(parseDigests(res.Header.Get("Content-Digest"), true), data)
+	if !checked {
+		return nil, nil, ErrInvalidHTTPSignature
+	} else if !ok {
+		return nil, nil, ErrDigestMismatch
+	}
+
+	var b strings.Builder
+	for _, component := range components {
+		val, err := httpSigComponent(res, component)
+		if err != nil {
+			return nil, nil, err
+		}
+		b.WriteString(component + ": " + val + "\n")
+	}
+	b.WriteString(`"@signature-params": ` + params)
+
+	return sig, []byte(b.String()), nil
+}
+
+// httpSigComponent returns the value of a component covered by
+// an HTTP message signature of res.
+func httpSigComponent(res *http.Response, component string) (string, error) {
+	name, params, _ := strings.Cut(component, ";")
+	name, err := strconv.Unquote(name)
+	if err != nil {
+		return "", ErrInvalidHTTPSignature
+	}
+
+	fromReq := params == "req"
+	if (params != "" && !fromReq) || (fromReq && res.Request == nil) {
+		return "", ErrInvalidHTTPSignature
+	}
+
+	switch {
+	case name == "@status" && !fromReq:
+		return strconv.Itoa(res.StatusCode), nil
+	case name == "@method" && fromReq:
+		return res.Request.Method, nil
+	case name == "@request-target" && fromReq:
+		return res.Request.URL.RequestURI(), nil
+	case strings.HasPrefix(name, "@"):
+		return "", ErrInvalidHTTPSignature
+	}
+
+	h := res.Header
+	if fromReq {
+		h = res.Request.Header
+	}
+
+	if len(h.Values(name)) == 0 {
+		return "", ErrInvalidHTTPSignature
+	}
+
+	var vals []string
+	for _, val := range h.Values(name) {
+		vals = append(vals, strings.TrimSpace(val))
+	}
+	return strings.Join(vals, ", "), nil
+}
+
+// httpSigBody checks that an HTTP message signature base covers a Content-Digest
+// that matches data, which is needed to use the base as a signature of data.
+func httpSigBody(base, data []byte) bool {
+	for _, line := range strings.Split(string(base), "\n") {
+		if val, ok := strings.CutPrefix(line, `"content-digest": `); ok {
+			ok, checked := matchDigests(parseDigests(val, true), data)
+			return ok && checked
+		}
+	}
+	return false
+}
+
+// splitSFDict splits a structured field dictionary, such as a Signature-Input
+// header, into its members. Commas within strings and inner lists are ignored.
+func splitSFDict(val string) map[string]string {
+	out := map[string]string{}
+
+	var (
+		start   int
+		quoted  bool
+		escaped bool
+		depth   int
+	)
+	for i := 0; i <= len(val); i++ {
+		if i < len(val) {
+			ch := val[i]
+			switch {
+			case escaped:
+				escaped = false
+				continue
+			case quoted && ch == '\\':
+				escaped = true
+				continue
+			case ch == '"':
+				quoted = !quoted
+				continue
+			case quoted:
+				continue
+			case ch == '(':
+				depth++
+				continue
+			case ch == ')':
+				depth--
+				continue
+			case ch != ',' || depth > 0:
+				continue
+			}
+		}
+
+		member := strings.TrimSpace(val[start:i])
+		if key, value, ok := strings.Cut(member, "="); ok {
+			out[key] = value
+		}
+		start = i + 1
+	}
+
+	return out
+}
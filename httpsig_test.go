@@ -0,0 +1,62 @@
+package profilefed
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestHTTPMessageSignatures(t *testing.T) {
+	desc := &Descriptor{ID: "main", Username: "user", DisplayName: "User"}
+
+	mt := &MemoryTransport{}
+	mt.Register("example.test", newTenant(t, "example.test", desc, func(h *Handler) {
+		h.SignatureMode = SignatureHTTP
+	}))
+
+	c := mt.Client()
+	res, err := c.HTTPClient.Get("http://example.test/pfd/user")
+	if err != nil {
+		t.Fatalf("Get error: %s", err)
+	}
+	res.Body.Close()
+
+	if res.Header.Get("X-ProfileFed-Sig") != "" || res.Header.Get("Signature-Input") == "" {
+		t.Fatalf("Unexpected signature headers: %v", res.Header)
+	}
+
+	c.Cache = mapCache{}
+	c.CacheMaxAge = time.Hour
+	for range 2 {
+		got, err := c.Lookup("user@example.test")
+		if err != nil {
+			t.Fatalf("Lookup error: %s", err)
+		}
+
+		if !reflect.DeepEqual(got, desc) {
+			t.Errorf("Descriptors are not equal:\n%#v\n\n%#v", got, desc)
+		}
+	}
+
+	// Without the digest, the signature doesn't cover the body
+	c.Cache = nil
+	c.HTTPClient = &http.Client{Transport: headerStripper{mt, "Content-Digest"}}
+	_, err = c.Lookup("user@example.test")
+	if !errors.Is(err, ErrInvalidHTTPSignature) {
+		t.Errorf("Expected ErrInvalidHTTPSignature, got %v", err)
+	}
+}
+
+func TestSplitSFDict(t *testing.T) {
+	got := splitSFDict(`a=("@method";req "date");keyid="x,y", b=:YWJj:`)
+	expected := map[string]string{
+		"a": `("@method";req "date");keyid="x,y"`,
+		"b": ":YWJj:",
+	}
+
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Dictionaries are not equal:\n%#v\n\n%#v", got, expected)
+	}
+}
@@ -0,0 +1,34 @@
+package profilefed
+
+import "queerdevs.org/profilefed/internal/idna"
+
+// normalizeHost returns the ASCII form of host, so that internationalized
+// server names are pinned and compared the same way no matter how they're
+// spelled. Hosts that can't be converted are returned unchanged.
+func normalizeHost(host string) string {
+	ascii, err := idna.ToASCII(host)
+	if err != nil {
+		return host
+	}
+	return ascii
+}
+
+// normalizeHosts returns the ASCII forms of hosts.
+func normalizeHosts(hosts []string) []string {
+	if hosts == nil {
+		return nil
+	}
+
+	out := make([]string, len(hosts))
+	for i, host := range hosts {
+		out[i] = normalizeHost(host)
+	}
+	return out
+}
+
+// normalize converts the server names in the server info to their ASCII forms.
+func (info *serverInfoData) normalize() {
+	info.ServerName = normalizeHost(info.ServerName)
+	info.PreviousNames = normalizeHosts(info.PreviousNames)
+	info.AlternateNames = normalizeHosts(info.AlternateNames)
+}
@@ -0,0 +1,279 @@
+package profilefed
+
+import (
+	"crypto"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"queerdevs.org/profilefed/webfinger"
+)
+
+const (
+	// InboxPath is the path servers receive messages from other servers at.
+	InboxPath = "/_profilefed/inbox"
+	// DefaultMessageMaxAge is the maximum age of messages accepted by an
+	// [InboxHandler] if its MaxAge is zero.
+	DefaultMessageMaxAge = 5 * time.Minute
+
+	// messagePrefix is prepended to messages before they're signed,
+	// so that their signatures can't be mistaken for signatures of responses.
+	messagePrefix = "profilefed-message:"
+	// maxMessageSize is the maximum size of a message accepted by an [InboxHandler].
+	maxMessageSize = 1 << 20
+)
+
+var (
+	// ErrInvalidMessage signifies that a message is malformed, isn't addressed
+	// to the receiving server, or doesn't match its sender's key.
+	ErrInvalidMessage = errors.New("invalid message")
+	// ErrMessageExpired signifies that a message is too old to be accepted,
+	// or has already been received.
+	ErrMessageExpired = errors.New("message expired or replayed")
+	// ErrUnknownMessageType signifies that an inbox has no handler for a message's type.
+	ErrUnknownMessageType = errors.New("unknown message type")
+)
+
+// Message is a signed message sent from one server to another. Subsystems such
+// as reports or subscriptions define their own message types, and decode the
+// body depending on the type.
+type Message struct {
+	// ID is a random ID that identifies the message.
+	ID string `json:"id"`
+	// Type is the type of the message, such as a namespace URL with a fragment.
+	Type string `json:"type"`
+	// From is the server name of the sender.
+	From string `json:"from"`
+	// To is the server name of the recipient.
+	To string `json:"to"`
+	// Created is the time at which the message was sent. [Deliverer] updates
+	// it for every delivery attempt, since recipients reject old messages.
+	Created time.Time `json:"created"`
+	// Body contains the type-specific content of the message.
+	Body json.RawMessage `json:"body,omitempty"`
+}
+
+// NewMessage returns a new message of the given type from one server to another,
+// with a random ID. The body is marshaled into JSON.
+func NewMessage(from, to, mtype string, body any) (*Message, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Message{
+		ID:      hex.EncodeToString(id),
+		Type:    mtype,
+		From:    from,
+		To:      to,
+		Created: time.Now().UTC(),
+		Body:    data,
+	}, nil
+}
+
+// DecodeBody unmarshals the body of the message into v.
+func (m *Message) DecodeBody(v any) error {
+	return json.Unmarshal(m.Body, v)
+}
+
+// signMessage marshals msg and signs it using signer.
+func signMessage(signer crypto.Signer, msg *Message) (data, sig []byte, err error) {
+	data, err = json.Marshal(msg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sig, err = sign(signer, append([]byte(messagePrefix), data...))
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, sig, nil
+}
+
+// MessageHandlerFunc handles a verified message received by an [InboxHandler].
+type MessageHandlerFunc func(req *http.Request, msg *Message) error
+
+// InboxHandler receives signed messages from other servers. Messages are
+// verified using the key pinned for their sender, which is trusted on first
+// use, and dispatched to the handler registered for their type. The zero
+// value is not usable, since ServerName has to be set.
+type InboxHandler struct {
+	// ServerName is the name of this server. Messages addressed
+	// to other servers are rejected.
+	ServerName string
+	// Client is used to verify the keys of senders. Since senders are only
+	// known by the server name in their message, set its AllowHost to
+	// restrict which servers the inbox will contact to retrieve their keys.
+	Client Client
+	// Scheme is the URL scheme used to retrieve the server info
+	// of senders. If empty, https is used.
+	Scheme string
+	// MaxAge is the maximum age of accepted messages. Messages are only
+	// accepted once within this time. If it's zero, [DefaultMessageMaxAge] is used.
+	MaxAge time.Duration
+	// AllowLocalSenders accepts messages from senders whose server name is an
+	// IP address or a loopback name such as localhost. They're rejected by
+	// default, so that messages can't make the inbox connect to internal
+	// addresses. It should only be set for development.
+	AllowLocalSenders bool
+
+	// Handlers maps message types to the functions that handle them.
+	Handlers map[string]MessageHandlerFunc
+
+	// ErrorHandler is called whenever a message handler returns an error.
+	// If it's nil, [DefaultErrorHandler] is used.
+	ErrorHandler func(err error, res http.ResponseWriter)
+
+	mtx  sync.Mutex
+	seen map[string]time.Time
+}
+
+// ServeHTTP implements the [http.Handler] interface
+func (ih *InboxHandler) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	errorHandler := ih.ErrorHandler
+	if errorHandler == nil {
+		errorHandler = DefaultErrorHandler
+	}
+
+	if req.Method != http.MethodPost {
+		res.Header().Set("Allow", http.MethodPost)
+		http.Error(res, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	msg, err := ih.verify(req)
+	if errors.Is(err, ErrInvalidMessage) || errors.Is(err, ErrMessageExpired) {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		http.Error(res, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	handler, ok := ih.Handlers[msg.Type]
+	if !ok {
+		http.Error(res, ErrUnknownMessageType.Error(), http.StatusNotImplemented)
+		return
+	}
+
+	if err := handler(req, msg); err != nil {
+		errorHandler(err, res)
+		return
+	}
+
+	res.WriteHeader(http.StatusAccepted)
+}
+
+// verify reads the message in the body of req and verifies it. Errors
+// that aren't caused by the message itself, such as failing to retrieve
+// the sender's key, are returned as-is.
+func (ih *InboxHandler) verify(req *http.Request) (*Message, error) {
+	data, err := io.ReadAll(io.LimitReader(req.Body, maxMessageSize))
+	if err != nil {
+		return nil, err
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(req.Header.Get("X-ProfileFed-Sig"))
+	if err != nil || len(sig) == 0 {
+		return nil, ErrInvalidMessage
+	}
+
+	var msg Message
+	if err := json.Unmarshal(data, &msg); err != nil || msg.ID == "" || msg.From == "" {
+		return nil, ErrInvalidMessage
+	}
+
+	if msg.To != ih.ServerName || !validSender(msg.From, ih.AllowLocalSenders) {
+		return nil, ErrInvalidMessage
+	}
+
+	maxAge := ih.MaxAge
+	if maxAge == 0 {
+		maxAge = DefaultMessageMaxAge
+	}
+
+	now := time.Now()
+	if msg.Created.Before(now.Add(-maxAge)) || msg.Created.After(now.Add(maxAge)) {
+		return nil, ErrMessageExpired
+	}
+
+	scheme := ih.Scheme
+	if scheme == "" {
+		scheme = "https"
+	}
+
+	err = ih.Client.verifyServerSignature(scheme, msg.From, append([]byte(messagePrefix), data...), sig)
+	if errors.Is(err, ErrSignatureMismatch) {
+		return nil, ErrInvalidMessage
+	} else if err != nil {
+		return nil, err
+	}
+
+	// Only verified messages are recorded, so that forged
+	// messages can't block legitimate ones with the same ID.
+	if !ih.markSeen(msg.From+" "+msg.ID, now, maxAge) {
+		return nil, ErrMessageExpired
+	}
+
+	return &msg, nil
+}
+
+// validSender reports whether from is a valid server name for the sender of
+// a message, which is a normalized domain name with an optional port. IP
+// addresses and loopback names are only valid if allowLocal is true.
+func validSender(from string, allowLocal bool) bool {
+	acct, err := webfinger.ParseAcct("inbox@" + from)
+	if err != nil || acct.Host != from {
+		return false
+	}
+
+	if allowLocal {
+		return true
+	}
+
+	host := from
+	if h, _, err := net.SplitHostPort(from); err == nil {
+		host = h
+	}
+	host = strings.Trim(host, "[]")
+
+	return net.ParseIP(host) == nil && host != "localhost" && !strings.HasSuffix(host, ".localhost")
+}
+
+// markSeen records that the message with the given key has been received,
+// and reports whether it hasn't been received before within maxAge.
+func (ih *InboxHandler) markSeen(key string, now time.Time, maxAge time.Duration) bool {
+	ih.mtx.Lock()
+	defer ih.mtx.Unlock()
+
+	for k, t := range ih.seen {
+		// Messages are rejected once they're older than maxAge,
+		// so their IDs don't have to be remembered after that.
+		if now.Sub(t) > 2*maxAge {
+			delete(ih.seen, k)
+		}
+	}
+
+	if _, ok := ih.seen[key]; ok {
+		return false
+	}
+
+	if ih.seen == nil {
+		ih.seen = map[string]time.Time{}
+	}
+	ih.seen[key] = now
+	return true
+}
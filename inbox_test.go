@@ -0,0 +1,129 @@
+package profilefed
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestInboxDelivery(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey error: %s", err)
+	}
+
+	mt := &MemoryTransport{}
+	mt.Register("sender.test", ServerInfoHandler{ServerName: "sender.test", PublicKey: pub, PrivateKey: priv})
+
+	type report struct {
+		Resource string `json:"resource"`
+	}
+
+	var received []report
+	inbox := &InboxHandler{
+		ServerName: "receiver.test",
+		Client:     mt.Client(),
+		Scheme:     "http",
+		Handlers: map[string]MessageHandlerFunc{
+			"report": func(req *http.Request, msg *Message) error {
+				var r report
+				if err := msg.DecodeBody(&r); err != nil {
+					return err
+				}
+				received = append(received, r)
+				return nil
+			},
+		},
+	}
+
+	// Fail the first attempt to make sure deliveries are retried
+	attempts := 0
+	mt.Register("receiver.test", http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		attempts++
+		if attempts == 1 {
+			http.Error(res, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		inbox.ServeHTTP(res, req)
+	}))
+
+	d := Deliverer{PrivateKey: priv, Client: mt.Client(), Scheme: "http", Backoff: time.Millisecond}
+
+	msg, err := NewMessage("sender.test", "receiver.test", "report", report{Resource: "acct:spam@example.com"})
+	if err != nil {
+		t.Fatalf("NewMessage error: %s", err)
+	}
+
+	if err := d.Deliver(context.Background(), msg); err != nil {
+		t.Fatalf("Deliver error: %s", err)
+	}
+
+	if attempts != 2 || len(received) != 1 || received[0].Resource != "acct:spam@example.com" {
+		t.Fatalf("Unexpected delivery: %d attempts, received %#v", attempts, received)
+	}
+
+	// Replayed messages are rejected without retrying
+	var httpErr *HTTPError
+	err = d.Deliver(context.Background(), msg)
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 error for replayed message, got %v", err)
+	}
+
+	// Messages signed with another key are rejected
+	_, other, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey error: %s", err)
+	}
+
+	msg, err = NewMessage("sender.test", "receiver.test", "report", report{})
+	if err != nil {
+		t.Fatalf("NewMessage error: %s", err)
+	}
+
+	d.PrivateKey = other
+	err = d.Deliver(context.Background(), msg)
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 error for forged message, got %v", err)
+	}
+
+	if attempts != 4 || len(received) != 1 {
+		t.Errorf("Unexpected delivery: %d attempts, received %#v", attempts, received)
+	}
+}
+
+func TestInboxInvalidSender(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey error: %s", err)
+	}
+
+	mt := &MemoryTransport{}
+	inbox := &InboxHandler{ServerName: "receiver.test", Client: mt.Client()}
+
+	for _, from := range []string{"127.0.0.1", "[::1]:8080", "localhost:80", "app.localhost", "Sender.test", "sender.test/path", "sender.test#x", "user@sender.test"} {
+		msg, err := NewMessage(from, "receiver.test", "report", nil)
+		if err != nil {
+			t.Fatalf("NewMessage error: %s", err)
+		}
+
+		data, sig, err := signMessage(priv, msg)
+		if err != nil {
+			t.Fatalf("signMessage error: %s", err)
+		}
+
+		req := httptest.NewRequest(http.MethodPost, InboxPath, bytes.NewReader(data))
+		req.Header.Set("X-ProfileFed-Sig", base64.StdEncoding.EncodeToString(sig))
+
+		rec := httptest.NewRecorder()
+		inbox.ServeHTTP(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for sender %q, got %d", from, rec.Code)
+		}
+	}
+}
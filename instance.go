@@ -0,0 +1,122 @@
+package profilefed
+
+import (
+	"crypto"
+	"crypto/ed25519"
+
+	"queerdevs.org/profilefed/webfinger"
+)
+
+const (
+	// InstanceUsername is the username of the instance profile, which
+	// describes the server itself and the people who operate it.
+	InstanceUsername = "server"
+	// InstanceID is the descriptor ID of the instance profile.
+	InstanceID = "instance"
+	// InstancePath is the default path the instance profile is served at.
+	InstancePath = "/_profilefed/instance"
+)
+
+// InstanceResource returns the WebFinger resource of the instance
+// profile for the given host, such as acct:server@example.com.
+func InstanceResource(host string) string {
+	return "acct:" + InstanceUsername + "@" + host
+}
+
+// InstanceProfile configures the instance profile of a server, which describes
+// the server operator, for example for moderation or contact purposes.
+type InstanceProfile struct {
+	// Descriptor is the descriptor served for the instance. Its ID and
+	// username are set to [InstanceID] and [InstanceUsername] if empty.
+	// If it's nil, no instance profile is served.
+	Descriptor *Descriptor
+	// PrivateKey contains the server's Ed25519 private key for signing responses.
+	PrivateKey ed25519.PrivateKey
+	// Signer, if set, signs responses instead of PrivateKey. It has to hold
+	// an Ed25519 key. See [Handler] for details.
+	Signer crypto.Signer
+	// Rotator, if set, provides the key used to sign responses instead of PrivateKey.
+	Rotator *KeyRotator
+	// Path is the path the instance profile is served at.
+	// If empty, [InstancePath] is used.
+	Path string
+}
+
+// Handler returns a descriptor handler that serves the instance profile.
+// If the descriptor is nil, the handler responds with [ErrDescriptorNotFound].
+func (ip InstanceProfile) Handler() Handler {
+	h := Handler{
+		PrivateKey: ip.PrivateKey,
+		Signer:     ip.Signer,
+		Rotator:    ip.Rotator,
+		DescriptorFunc: func(*Request) (*Descriptor, error) {
+			return nil, ErrDescriptorNotFound
+		},
+		AllDescriptorsFunc: func(*Request) (map[string]*Descriptor, error) {
+			return nil, ErrDescriptorNotFound
+		},
+	}
+	if ip.Descriptor == nil {
+		return h
+	}
+
+	desc := *ip.Descriptor
+	if desc.ID == "" {
+		desc.ID = InstanceID
+	}
+	if desc.Username == "" {
+		desc.Username = InstanceUsername
+	}
+
+	h.DescriptorFunc = func(*Request) (*Descriptor, error) {
+		return &desc, nil
+	}
+	h.AllDescriptorsFunc = func(*Request) (map[string]*Descriptor, error) {
+		return map[string]*Descriptor{desc.ID: &desc}, nil
+	}
+	return h
+}
+
+// WrapWebFinger wraps a WebFinger descriptor function so that it answers
+// requests for the instance resource of host with a descriptor linking to
+// the instance profile. baseURL is the scheme and host the profile is
+// served at, such as https://example.com. All other requests are passed to
+// next, and so are requests for the instance resource if the descriptor is nil.
+func (ip InstanceProfile) WrapWebFinger(host, baseURL string, next func(resource string) (*webfinger.Descriptor, error)) func(resource string) (*webfinger.Descriptor, error) {
+	if ip.Descriptor == nil {
+		return next
+	}
+
+	path := ip.Path
+	if path == "" {
+		path = InstancePath
+	}
+
+	return func(resource string) (*webfinger.Descriptor, error) {
+		if resource != InstanceResource(host) {
+			return next(resource)
+		}
+
+		return &webfinger.Descriptor{
+			Subject: resource,
+			Links: []webfinger.Link{{
+				Rel:  "self",
+				Type: "application/x-pfd+json",
+				Href: baseURL + path,
+			}},
+		}, nil
+	}
+}
+
+// LookupInstance looks up the instance profile of the given host,
+// which describes the server and its operators.
+func (c Client) LookupInstance(host string) (*Descriptor, error) {
+	wfdesc, err := c.webfinger().Lookup(InstanceResource(host), host)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &Descriptor{}
+	_, err = c.lookup(wfdesc, lookupParams{}, out)
+	return out, err
+}
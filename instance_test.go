@@ -0,0 +1,65 @@
+package profilefed
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"queerdevs.org/profilefed/webfinger"
+)
+
+// newInstanceTenant returns a handler that serves the given instance profile for host.
+func newInstanceTenant(t *testing.T, host string, ip InstanceProfile) http.Handler {
+	t.Helper()
+
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey error: %s", err)
+	}
+	ip.PrivateKey = priv
+
+	notFound := func(string) (*webfinger.Descriptor, error) {
+		return nil, webfinger.ErrNotFound
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/.well-known/webfinger", webfinger.Handler{
+		DescriptorFunc: ip.WrapWebFinger(host, "http://"+host, notFound),
+	})
+	mux.Handle("/_profilefed/server", ServerInfoHandler{ServerName: host, PublicKey: pub, PrivateKey: priv})
+	mux.Handle(InstancePath, ip.Handler())
+	return mux
+}
+
+func TestInstanceProfile(t *testing.T) {
+	mt := &MemoryTransport{}
+	mt.Register("example.test", newInstanceTenant(t, "example.test", InstanceProfile{
+		Descriptor: &Descriptor{DisplayName: "Example", Bio: "Run by the example collective"},
+	}))
+	mt.Register("empty.test", newInstanceTenant(t, "empty.test", InstanceProfile{}))
+
+	c := mt.Client()
+	desc, err := c.LookupInstance("example.test")
+	if err != nil {
+		t.Fatalf("LookupInstance error: %s", err)
+	}
+
+	if desc.ID != InstanceID || desc.Username != InstanceUsername || desc.DisplayName != "Example" {
+		t.Errorf("Unexpected instance profile: %#v", desc)
+	}
+
+	// Without a descriptor, there's no instance profile to look up
+	var httpErr *webfinger.HTTPError
+	if _, err := c.LookupInstance("empty.test"); !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 error, got %v", err)
+	}
+
+	// The handler itself doesn't panic either
+	rec := httptest.NewRecorder()
+	InstanceProfile{}.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, InstancePath, nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 from handler without descriptor, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,119 @@
+// Package cli contains the exit codes and output helpers shared by the
+// command-line tools in this repository, so that scripts can tell
+// failures apart the same way for every tool.
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+
+	"queerdevs.org/profilefed"
+	"queerdevs.org/profilefed/webfinger"
+)
+
+// Exit codes
+const (
+	// ExitOK is returned when the command succeeded.
+	ExitOK = 0
+	// ExitError is returned for errors that don't fall into any other class.
+	ExitError = 1
+	// ExitUsage is returned when the command was invoked incorrectly.
+	ExitUsage = 2
+	// ExitNotFound is returned when the requested resource or profile doesn't exist.
+	ExitNotFound = 3
+	// ExitVerificationFailed is returned when a response couldn't be verified,
+	// for example because its signature doesn't match the server's pinned key.
+	ExitVerificationFailed = 4
+	// ExitNetwork is returned when a server couldn't be reached, rate limited
+	// the client, or failed with a server error.
+	ExitNetwork = 5
+	// ExitCheckFailed is returned by pfdcheck when at least one check failed.
+	ExitCheckFailed = 6
+)
+
+// trustErrors contains the errors, other than the ones reported by
+// [profilefed.IsVerificationError], that are returned when a response is
+// rejected because it couldn't be verified or because of the client's trust
+// decisions or policy.
+var trustErrors = []error{
+	profilefed.ErrKeyNotConfirmed,
+	profilefed.ErrHostQuarantined,
+	profilefed.ErrInsecureURL,
+	profilefed.ErrCrossSiteEndpoint,
+	profilefed.ErrHostNotAllowed,
+	webfinger.ErrHostNotAllowed,
+	webfinger.ErrNoJWS,
+	webfinger.ErrInvalidJWS,
+}
+
+// ExitCode returns the exit code for a command that failed with err.
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+
+	if profilefed.IsVerificationError(err) {
+		return ExitVerificationFailed
+	}
+	for _, target := range trustErrors {
+		if errors.Is(err, target) {
+			return ExitVerificationFailed
+		}
+	}
+
+	if errors.Is(err, webfinger.ErrNotFound) || errors.Is(err, profilefed.ErrDescriptorNotFound) {
+		return ExitNotFound
+	}
+
+	statusCode := 0
+	var httpErr *profilefed.HTTPError
+	var wfErr *webfinger.HTTPError
+	if errors.As(err, &httpErr) {
+		statusCode = httpErr.StatusCode
+	} else if errors.As(err, &wfErr) {
+		statusCode = wfErr.StatusCode
+	}
+
+	switch {
+	case statusCode == http.StatusNotFound || statusCode == http.StatusGone:
+		return ExitNotFound
+	case statusCode == http.StatusTooManyRequests || statusCode >= 500:
+		return ExitNetwork
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return ExitNetwork
+	}
+
+	return ExitError
+}
+
+// Output prints human-readable messages to stderr, unless Quiet is set.
+// Machine-readable results, such as JSON, should be printed to stdout directly.
+type Output struct {
+	// Quiet suppresses all messages.
+	Quiet bool
+}
+
+// Println prints a message to stderr.
+func (o Output) Println(v ...any) {
+	if o.Quiet {
+		return
+	}
+	fmt.Fprintln(os.Stderr, v...)
+}
+
+// Exit prints a message to stderr and exits with the given code.
+func (o Output) Exit(code int, v ...any) {
+	o.Println(v...)
+	os.Exit(code)
+}
+
+// Fatal prints msg and err to stderr and exits with the exit code for err.
+func (o Output) Fatal(msg string, err error) {
+	o.Exit(ExitCode(err), msg, err)
+}
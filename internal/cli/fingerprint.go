@@ -0,0 +1,53 @@
+package cli
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"io"
+	"strings"
+
+	"queerdevs.org/profilefed"
+)
+
+// PrintFingerprint writes the fingerprint of pubkey to w in every supported
+// format, so that operators can compare it using whichever is most convenient.
+func PrintFingerprint(w io.Writer, pubkey ed25519.PublicKey) {
+	symbols := profilefed.FingerprintSymbols(pubkey)
+	names := make([]string, len(symbols))
+	emoji := make([]string, len(symbols))
+	for i, sym := range symbols {
+		names[i] = sym.Name
+		emoji[i] = sym.Emoji
+	}
+
+	fmt.Fprintln(w, "base64:", profilefed.Fingerprint(pubkey))
+	fmt.Fprintln(w, "hex:   ", profilefed.FingerprintHex(pubkey))
+	fmt.Fprintln(w, "words: ", strings.Join(names, " "))
+	fmt.Fprintln(w, "emoji: ", strings.Join(emoji, " "))
+}
+
+// MatchFingerprint reports whether fp is the fingerprint of pubkey in any of
+// the formats printed by [PrintFingerprint]. Hex fingerprints and words are
+// compared case-insensitively, and separators in hex fingerprints are ignored.
+func MatchFingerprint(pubkey ed25519.PublicKey, fp string) bool {
+	fp = strings.TrimSpace(fp)
+	if fp == profilefed.Fingerprint(pubkey) {
+		return true
+	}
+
+	hex := strings.NewReplacer(":", "", " ", "").Replace(fp)
+	if strings.EqualFold(hex, profilefed.FingerprintHex(pubkey)) {
+		return true
+	}
+
+	symbols := profilefed.FingerprintSymbols(pubkey)
+	names := make([]string, len(symbols))
+	emoji := make([]string, len(symbols))
+	for i, sym := range symbols {
+		names[i] = strings.ReplaceAll(sym.Name, " ", "")
+		emoji[i] = sym.Emoji
+	}
+
+	words := strings.Join(strings.Fields(fp), "")
+	return strings.EqualFold(words, strings.Join(names, "")) || words == strings.Join(emoji, "")
+}
@@ -0,0 +1,162 @@
+// Package idna converts internationalized domain names to their ASCII form,
+// so that the same server is always identified by the same name, no matter
+// how it was spelled.
+//
+// Only the parts of IDNA that matter for comparing names are implemented:
+// labels are lower-cased and Punycode-encoded as described in RFC 3492.
+// Unicode normalization isn't performed, so names should be in NFC, which
+// is what most input methods produce.
+package idna
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// acePrefix is the prefix of Punycode-encoded labels.
+const acePrefix = "xn--"
+
+// maxLabelLength is the maximum length of a label, in bytes.
+const maxLabelLength = 63
+
+// dotReplacer replaces the full stops that IDNA treats as label separators.
+var dotReplacer = strings.NewReplacer("。", ".", "．", ".", "｡", ".")
+
+// ToASCII converts host, which may contain a port, to lower case and encodes
+// every label that contains non-ASCII characters using Punycode, such as
+// xn--bcher-kva.example for bücher.example. Trailing dots are removed, and
+// IP addresses are returned in lower case.
+func ToASCII(host string) (string, error) {
+	if strings.HasPrefix(host, "[") {
+		return strings.ToLower(host), nil
+	}
+
+	port := ""
+	if i := strings.LastIndexByte(host, ':'); i >= 0 {
+		host, port = host[:i], host[i:]
+	}
+
+	host = strings.TrimSuffix(dotReplacer.Replace(strings.ToLower(host)), ".")
+
+	labels := strings.Split(host, ".")
+	for i, label := range labels {
+		if !isASCII(label) {
+			if !utf8.ValidString(label) {
+				return "", fmt.Errorf("idna: invalid utf-8 in label %q", label)
+			}
+			labels[i] = acePrefix + encode(label)
+		}
+
+		if len(labels[i]) > maxLabelLength {
+			return "", fmt.Errorf("idna: label %q is too long", label)
+		}
+	}
+
+	return strings.Join(labels, ".") + port, nil
+}
+
+// isASCII reports whether s only contains ASCII characters.
+func isASCII(s string) bool {
+	for i := range len(s) {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// Punycode parameters, from RFC 3492 section 5
+const (
+	base        = 36
+	tmin        = 1
+	tmax        = 26
+	skew        = 38
+	damp        = 700
+	initialBias = 72
+	initialN    = 128
+)
+
+// encode encodes label using Punycode, without the ACE prefix.
+func encode(label string) string {
+	runes := []rune(label)
+
+	var sb strings.Builder
+	for _, r := range runes {
+		if r < utf8.RuneSelf {
+			sb.WriteRune(r)
+		}
+	}
+
+	basic := sb.Len()
+	if basic > 0 {
+		sb.WriteByte('-')
+	}
+
+	n, delta, bias := rune(initialN), 0, initialBias
+	for handled := basic; handled < len(runes); {
+		// Find the smallest code point that hasn't been handled yet
+		next := rune(utf8.MaxRune)
+		for _, r := range runes {
+			if r >= n && r < next {
+				next = r
+			}
+		}
+		delta += int(next-n) * (handled + 1)
+		n = next
+
+		for _, r := range runes {
+			if r < n {
+				delta++
+			}
+			if r != n {
+				continue
+			}
+
+			q := delta
+			for k := base; ; k += base {
+				t := min(max(k-bias, tmin), tmax)
+				if q < t {
+					break
+				}
+				sb.WriteByte(digit(t + (q-t)%(base-t)))
+				q = (q - t) / (base - t)
+			}
+			sb.WriteByte(digit(q))
+
+			bias = adapt(delta, handled+1, handled == basic)
+			delta = 0
+			handled++
+		}
+
+		delta++
+		n++
+	}
+
+	return sb.String()
+}
+
+// adapt is the bias adaptation function from RFC 3492 section 6.1.
+func adapt(delta, numPoints int, first bool) int {
+	if first {
+		delta /= damp
+	} else {
+		delta /= 2
+	}
+	delta += delta / numPoints
+
+	k := 0
+	for delta > ((base-tmin)*tmax)/2 {
+		delta /= base - tmin
+		k += base
+	}
+	return k + (base-tmin+1)*delta/(delta+skew)
+}
+
+// digit returns the character representing the Punycode digit d.
+func digit(d int) byte {
+	if d < 26 {
+		return byte('a' + d)
+	}
+	return byte('0' + d - 26)
+}
@@ -0,0 +1,24 @@
+package idna
+
+import "testing"
+
+func TestToASCII(t *testing.T) {
+	for host, expected := range map[string]string{
+		"bücher.example":        "xn--bcher-kva.example",
+		"Bücher.Example.":       "xn--bcher-kva.example",
+		"münchen.example:8080":  "xn--mnchen-3ya.example:8080",
+		"例え.テスト":                "xn--r8jz45g.xn--zckzah",
+		"例え。テスト":                "xn--r8jz45g.xn--zckzah",
+		"example.com":           "example.com",
+		"[::1]:443":             "[::1]:443",
+		"ليهمابتكلموشعربي؟.com": "xn--egbpdaj6bu4bxfgehfvwxn.com",
+	} {
+		got, err := ToASCII(host)
+		if err != nil {
+			t.Fatalf("ToASCII error: %s", err)
+		}
+		if got != expected {
+			t.Errorf("Expected %q for %q, got %q", expected, host, got)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package profilefed
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+// TestInterop decodes descriptors produced by other implementations
+// and compares the re-encoded results to golden files.
+func TestInterop(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "interop", "*.pfd.json"))
+	if err != nil {
+		t.Fatalf("Glob error: %s", err)
+	}
+
+	for _, path := range paths {
+		name := strings.TrimSuffix(filepath.Base(path), ".pfd.json")
+		t.Run(name, func(t *testing.T) {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("ReadFile error: %s", err)
+			}
+
+			desc := &Descriptor{}
+			if err := json.Unmarshal(data, desc); err != nil {
+				t.Fatalf("Unmarshal error: %s", err)
+			}
+
+			out, err := json.MarshalIndent(desc, "", "  ")
+			if err != nil {
+				t.Fatalf("MarshalIndent error: %s", err)
+			}
+			out = append(out, '\n')
+
+			golden := strings.TrimSuffix(path, ".pfd.json") + ".golden"
+			if *update {
+				if err := os.WriteFile(golden, out, 0o644); err != nil {
+					t.Fatalf("WriteFile error: %s", err)
+				}
+				return
+			}
+
+			expected, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("ReadFile error: %s", err)
+			}
+
+			if !bytes.Equal(out, expected) {
+				t.Errorf("Encoded descriptor doesn't match %s:\n%s\n\n%s", golden, out, expected)
+			}
+		})
+	}
+}
+
+func FuzzDescriptorRoundTrip(f *testing.F) {
+	paths, _ := filepath.Glob(filepath.Join("testdata", "interop", "*.pfd.json"))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			f.Fatalf("ReadFile error: %s", err)
+		}
+		f.Add(data)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		desc := &Descriptor{}
+		if json.Unmarshal(data, desc) != nil {
+			return
+		}
+
+		first, err := json.Marshal(desc)
+		if err != nil {
+			t.Fatalf("Marshal error: %s", err)
+		}
+
+		desc = &Descriptor{}
+		if err := json.Unmarshal(first, desc); err != nil {
+			t.Fatalf("Unmarshal error: %s", err)
+		}
+
+		second, err := json.Marshal(desc)
+		if err != nil {
+			t.Fatalf("Marshal error: %s", err)
+		}
+
+		if !bytes.Equal(first, second) {
+			t.Errorf("Descriptor round trip is not stable:\n%s\n\n%s", first, second)
+		}
+	})
+}
@@ -0,0 +1,137 @@
+package profilefed
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// JWKSPath is the path the server's JSON Web Key Set is served at.
+const JWKSPath = "/_profilefed/jwks"
+
+// ErrInvalidJWK signifies that a JSON Web Key isn't a valid Ed25519 key.
+var ErrInvalidJWK = errors.New("invalid ed25519 jwk")
+
+// JWK is an Ed25519 key in the JSON Web Key format defined by [RFC 8037],
+// for interoperability with JOSE tooling.
+//
+// [RFC 8037]: https://www.rfc-editor.org/rfc/rfc8037
+type JWK struct {
+	// KeyType is the key type, which is always OKP for Ed25519 keys.
+	KeyType string `json:"kty"`
+	// Curve is the curve of the key, which is always Ed25519.
+	Curve string `json:"crv"`
+	// X contains the base64url-encoded public key.
+	X string `json:"x"`
+	// D contains the base64url-encoded private key seed, if it's a private key.
+	D string `json:"d,omitempty"`
+	// KeyID identifies the key. Keys created by this package use
+	// their RFC 7638 thumbprint.
+	KeyID string `json:"kid,omitempty"`
+	// Use is the intended use of the key, such as sig.
+	Use string `json:"use,omitempty"`
+	// Algorithm is the algorithm the key is used with, such as EdDSA.
+	Algorithm string `json:"alg,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// PublicKeyJWK returns pubkey as a JWK.
+func PublicKeyJWK(pubkey ed25519.PublicKey) JWK {
+	jwk := JWK{
+		KeyType:   "OKP",
+		Curve:     "Ed25519",
+		X:         base64.RawURLEncoding.EncodeToString(pubkey),
+		Use:       "sig",
+		Algorithm: "EdDSA",
+	}
+	jwk.KeyID = jwk.Thumbprint()
+	return jwk
+}
+
+// PrivateKeyJWK returns priv as a JWK, including its private part.
+func PrivateKeyJWK(priv ed25519.PrivateKey) JWK {
+	jwk := PublicKeyJWK(priv.Public().(ed25519.PublicKey))
+	jwk.D = base64.RawURLEncoding.EncodeToString(priv.Seed())
+	return jwk
+}
+
+// PublicKey returns the public key contained in the JWK.
+func (jwk JWK) PublicKey() (ed25519.PublicKey, error) {
+	if jwk.KeyType != "OKP" || jwk.Curve != "Ed25519" {
+		return nil, ErrInvalidJWK
+	}
+
+	pubkey, err := base64.RawURLEncoding.DecodeString(jwk.X)
+	if err != nil || len(pubkey) != ed25519.PublicKeySize {
+		return nil, ErrInvalidJWK
+	}
+	return pubkey, nil
+}
+
+// PrivateKey returns the private key contained in the JWK. It returns
+// [ErrInvalidJWK] if the JWK only contains a public key, or if its
+// private key doesn't match its public key.
+func (jwk JWK) PrivateKey() (ed25519.PrivateKey, error) {
+	pubkey, err := jwk.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+
+	seed, err := base64.RawURLEncoding.DecodeString(jwk.D)
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, ErrInvalidJWK
+	}
+
+	priv := ed25519.NewKeyFromSeed(seed)
+	if !pubkey.Equal(priv.Public()) {
+		return nil, ErrInvalidJWK
+	}
+	return priv, nil
+}
+
+// Thumbprint returns the [RFC 7638] thumbprint of the JWK's public key,
+// using SHA-256, encoded as unpadded base64url.
+//
+// [RFC 7638]: https://www.rfc-editor.org/rfc/rfc7638
+func (jwk JWK) Thumbprint() string {
+	// The required members in lexicographic order, without whitespace
+	data, _ := json.Marshal(struct {
+		Curve   string `json:"crv"`
+		KeyType string `json:"kty"`
+		X       string `json:"x"`
+	}{jwk.Curve, jwk.KeyType, jwk.X})
+
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// JWKS returns a handler that serves the server's current public key as a
+// signed JSON Web Key Set, so that it can be consumed by JWKS-based
+// infrastructure. It's served at [JWKSPath] by [Server] if its JWKS
+// field is set.
+func (sih ServerInfoHandler) JWKS() http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		errorHandler := sih.ErrorHandler
+		if errorHandler == nil {
+			errorHandler = DefaultErrorHandler
+		}
+
+		pubkey, signer, _, err := sih.keys()
+		if err != nil {
+			errorHandler(err, res)
+			return
+		}
+
+		res.Header().Set("Content-Type", "application/jwk-set+json")
+		if err := SignedJSON(res, signer, JWKS{Keys: []JWK{PublicKeyJWK(pubkey)}}); err != nil {
+			errorHandler(err, res)
+		}
+	})
+}
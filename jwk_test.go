@@ -0,0 +1,71 @@
+package profilefed
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestJWK(t *testing.T) {
+	// Example key from RFC 8037, appendix A
+	jwk := JWK{
+		KeyType: "OKP",
+		Curve:   "Ed25519",
+		X:       "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo",
+		D:       "nWGxne_9WmC6hEr0kuwsxERJxWl7MmkZcDusAxyuf2A",
+	}
+
+	if tp := jwk.Thumbprint(); tp != "kPrK_qmxVWaYVA9wwBF6Iuo3vVzz7TxHCTwXBygrS4k" {
+		t.Errorf("Unexpected thumbprint: %s", tp)
+	}
+
+	priv, err := jwk.PrivateKey()
+	if err != nil {
+		t.Fatalf("PrivateKey error: %s", err)
+	}
+
+	out := PrivateKeyJWK(priv)
+	if out.X != jwk.X || out.D != jwk.D || out.KeyID != jwk.Thumbprint() {
+		t.Errorf("Unexpected JWK: %#v", out)
+	}
+
+	jwk.D = base64.RawURLEncoding.EncodeToString(make([]byte, 32))
+	if _, err := jwk.PrivateKey(); err != ErrInvalidJWK {
+		t.Errorf("Expected ErrInvalidJWK for mismatched private key, got %v", err)
+	}
+}
+
+func TestJWKSHandler(t *testing.T) {
+	pub, priv, err := GenerateKeys()
+	if err != nil {
+		t.Fatalf("GenerateKeys error: %s", err)
+	}
+
+	rec := httptest.NewRecorder()
+	ServerInfoHandler{ServerName: "example.com", PrivateKey: priv}.JWKS().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, JWKSPath, nil))
+
+	sig, err := base64.StdEncoding.DecodeString(rec.Header().Get("X-ProfileFed-Sig"))
+	if err != nil || !verify(pub, rec.Body.Bytes(), sig) {
+		t.Fatalf("JWKS signature does not verify")
+	}
+
+	var jwks JWKS
+	if err := json.Unmarshal(rec.Body.Bytes(), &jwks); err != nil {
+		t.Fatalf("Unmarshal error: %s", err)
+	}
+
+	if len(jwks.Keys) != 1 || jwks.Keys[0].D != "" {
+		t.Fatalf("Unexpected JWKS: %#v", jwks)
+	}
+
+	got, err := jwks.Keys[0].PublicKey()
+	if err != nil {
+		t.Fatalf("PublicKey error: %s", err)
+	}
+
+	if !got.Equal(pub) {
+		t.Error("JWKS key does not match server key")
+	}
+}
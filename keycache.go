@@ -0,0 +1,113 @@
+package profilefed
+
+import (
+	"crypto/ed25519"
+	"sync"
+)
+
+// KeyCache is an in-memory cache of decoded server public keys and their
+// fingerprints. It sits in front of the client's persistent keystore, so
+// that high-volume consumers don't have to hit it for every lookup.
+//
+// The zero value is ready to use.
+type KeyCache struct {
+	mtx  sync.RWMutex
+	keys map[string]cachedKey
+}
+
+type cachedKey struct {
+	pubkey      ed25519.PublicKey
+	fingerprint string
+}
+
+// get returns the cached key for the given server, if there is one.
+func (kc *KeyCache) get(serverName string) (cachedKey, bool) {
+	kc.mtx.RLock()
+	defer kc.mtx.RUnlock()
+	ck, ok := kc.keys[serverName]
+	return ck, ok
+}
+
+// put caches the key for the given server and evicts
+// the keys for any of its previous names.
+func (kc *KeyCache) put(serverName string, previousNames []string, pubkey ed25519.PublicKey) cachedKey {
+	ck := cachedKey{pubkey: pubkey, fingerprint: FingerprintHex(pubkey)}
+
+	kc.mtx.Lock()
+	defer kc.mtx.Unlock()
+
+	if kc.keys == nil {
+		kc.keys = map[string]cachedKey{}
+	}
+	kc.keys[serverName] = ck
+	for _, name := range previousNames {
+		delete(kc.keys, name)
+	}
+	return ck
+}
+
+// Forget removes the cached key for the given server, so that
+// the next lookup fetches it from the keystore again.
+func (kc *KeyCache) Forget(serverName string) {
+	kc.mtx.Lock()
+	defer kc.mtx.Unlock()
+	delete(kc.keys, serverName)
+}
+
+// getPubkey returns the public key for the given server, consulting
+// the key cache before the keystore.
+func (c Client) getPubkey(serverName string) (ed25519.PublicKey, error) {
+	serverName = normalizeHost(serverName)
+	if c.KeyCache != nil {
+		if ck, ok := c.KeyCache.get(serverName); ok {
+			return ck.pubkey, nil
+		}
+	}
+
+	pubkey, err := c.GetPubkey(serverName)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.KeyCache != nil {
+		c.KeyCache.put(serverName, nil, pubkey)
+	}
+	return pubkey, nil
+}
+
+// savePubkey saves the public key for the given server to
+// the keystore, and updates the key cache accordingly.
+func (c Client) savePubkey(serverName string, previousNames []string, pubkey ed25519.PublicKey) error {
+	serverName, previousNames = normalizeHost(serverName), normalizeHosts(previousNames)
+	err := c.SavePubkey(serverName, previousNames, pubkey)
+	if err != nil {
+		return err
+	}
+
+	if c.KeyCache != nil {
+		c.KeyCache.put(serverName, previousNames, pubkey)
+	}
+	return nil
+}
+
+// KeyFingerprint returns the hex-encoded SHA-256 fingerprint of the key
+// pinned for the given server. If the key is in the client's key cache,
+// the precomputed fingerprint is returned.
+func (c Client) KeyFingerprint(serverName string) (string, error) {
+	serverName = normalizeHost(serverName)
+	if c.KeyCache != nil {
+		if ck, ok := c.KeyCache.get(serverName); ok {
+			return ck.fingerprint, nil
+		}
+	}
+
+	pubkey, err := c.GetPubkey(serverName)
+	if err != nil {
+		return "", err
+	}
+
+	if c.KeyCache != nil {
+		return c.KeyCache.put(serverName, nil, pubkey).fingerprint, nil
+	}
+	return FingerprintHex(pubkey), nil
+}
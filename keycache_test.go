@@ -0,0 +1,133 @@
+package profilefed
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"testing"
+)
+
+// registerKeyCacheTenant registers a tenant for host on mt that signs with
+// priv, advertising the given previous names and keys.
+func registerKeyCacheTenant(mt *MemoryTransport, host string, priv ed25519.PrivateKey, prevNames []string, prevKeys ...ed25519.PrivateKey) {
+	desc := &Descriptor{ID: "main", Username: "user", DisplayName: "User"}
+	mt.Register(host, tenantMux(host, ServerInfoHandler{
+		ServerName:    host,
+		PrivateKey:    priv,
+		PreviousNames: prevNames,
+		PreviousKeys:  prevKeys,
+	}, Handler{
+		PrivateKey: priv,
+		DescriptorFunc: func(req *Request) (*Descriptor, error) {
+			return desc, nil
+		},
+	}))
+}
+
+func TestKeyCacheRotation(t *testing.T) {
+	oldPub, oldPriv, err := GenerateKeys()
+	if err != nil {
+		t.Fatalf("GenerateKeys error: %s", err)
+	}
+	newPub, newPriv, err := GenerateKeys()
+	if err != nil {
+		t.Fatalf("GenerateKeys error: %s", err)
+	}
+
+	mt := &MemoryTransport{}
+	registerKeyCacheTenant(mt, "example.test", oldPriv, nil)
+
+	c := mt.Client()
+	c.KeyCache = &KeyCache{}
+
+	if _, err := c.Lookup("user@example.test"); err != nil {
+		t.Fatalf("Lookup error: %s", err)
+	}
+	if fp, err := c.KeyFingerprint("example.test"); err != nil || fp != FingerprintHex(oldPub) {
+		t.Fatalf("Expected the old fingerprint, got %q (%v)", fp, err)
+	}
+
+	registerKeyCacheTenant(mt, "example.test", newPriv, nil, oldPriv)
+	if _, err := c.Lookup("user@example.test"); err != nil {
+		t.Fatalf("Lookup error after rotation: %s", err)
+	}
+
+	if fp, err := c.KeyFingerprint("example.test"); err != nil || fp != FingerprintHex(newPub) {
+		t.Errorf("Expected the cache to hold the new fingerprint, got %q (%v)", fp, err)
+	}
+	if pubkey, err := c.getPubkey("example.test"); err != nil || !pubkey.Equal(newPub) {
+		t.Errorf("Expected the cache to hold the new key, got %x (%v)", pubkey, err)
+	}
+}
+
+func TestKeyCacheDeleteHost(t *testing.T) {
+	_, oldPriv, err := GenerateKeys()
+	if err != nil {
+		t.Fatalf("GenerateKeys error: %s", err)
+	}
+	newPub, newPriv, err := GenerateKeys()
+	if err != nil {
+		t.Fatalf("GenerateKeys error: %s", err)
+	}
+
+	mt := &MemoryTransport{}
+	registerKeyCacheTenant(mt, "example.test", oldPriv, nil)
+
+	c := mt.Client()
+	c.KeyCache = &KeyCache{}
+
+	if _, err := c.Lookup("user@example.test"); err != nil {
+		t.Fatalf("Lookup error: %s", err)
+	}
+
+	if err := c.DeleteHost("example.test"); err != nil {
+		t.Fatalf("DeleteHost error: %s", err)
+	}
+	if _, err := c.KeyFingerprint("example.test"); !errors.Is(err, ErrPubkeyNotFound) {
+		t.Errorf("Expected ErrPubkeyNotFound after DeleteHost, got %v", err)
+	}
+
+	// An unrelated new key must be trusted on first use again,
+	// rather than rejected because of a stale cached key.
+	registerKeyCacheTenant(mt, "example.test", newPriv, nil)
+	if _, err := c.Lookup("user@example.test"); err != nil {
+		t.Fatalf("Lookup error after DeleteHost: %s", err)
+	}
+	if fp, err := c.KeyFingerprint("example.test"); err != nil || fp != FingerprintHex(newPub) {
+		t.Errorf("Expected the new fingerprint, got %q (%v)", fp, err)
+	}
+}
+
+func TestKeyCachePreviousNames(t *testing.T) {
+	pub, priv, err := GenerateKeys()
+	if err != nil {
+		t.Fatalf("GenerateKeys error: %s", err)
+	}
+
+	mt := &MemoryTransport{}
+	registerKeyCacheTenant(mt, "old.test", priv, nil)
+	registerKeyCacheTenant(mt, "new.test", priv, []string{"old.test"})
+
+	c := mt.Client()
+	c.KeyCache = &KeyCache{}
+
+	if _, err := c.Lookup("user@old.test"); err != nil {
+		t.Fatalf("Lookup error: %s", err)
+	}
+	if _, ok := c.KeyCache.get("old.test"); !ok {
+		t.Fatal("Expected the key for old.test to be cached")
+	}
+
+	if _, err := c.Lookup("user@new.test"); err != nil {
+		t.Fatalf("Lookup error after rename: %s", err)
+	}
+
+	if _, ok := c.KeyCache.get("old.test"); ok {
+		t.Error("Expected the key for the previous name to be evicted from the cache")
+	}
+	if _, err := c.KeyFingerprint("old.test"); !errors.Is(err, ErrPubkeyNotFound) {
+		t.Errorf("Expected ErrPubkeyNotFound for the previous name, got %v", err)
+	}
+	if fp, err := c.KeyFingerprint("new.test"); err != nil || fp != FingerprintHex(pub) {
+		t.Errorf("Expected the fingerprint for new.test, got %q (%v)", fp, err)
+	}
+}
@@ -0,0 +1,134 @@
+package profilefed
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// keyCertHeader is the header containing the certificate of the key
+// that signed a descriptor response.
+const keyCertHeader = "X-ProfileFed-Signing-Key"
+
+var (
+	// ErrInvalidKeyCertificate signifies that a signing key certificate is
+	// malformed or isn't signed by the server's identity key.
+	ErrInvalidKeyCertificate = errors.New("invalid signing key certificate")
+	// ErrKeyCertificateExpired signifies that a signing key certificate has expired.
+	ErrKeyCertificateExpired = errors.New("signing key certificate expired")
+)
+
+// KeyCertificate certifies an online signing key using the server's identity
+// key, which is the key in its server info. It lets the identity key be kept
+// offline, while handlers sign descriptors using a short-lived key that can
+// be replaced without a key rotation. See [Handler.KeyCertificate].
+type KeyCertificate struct {
+	// Key is the certified signing key.
+	Key ed25519.PublicKey
+	// Expiry is the time at which the certificate expires.
+	Expiry time.Time
+	// Signature is the signature made by the identity key.
+	Signature []byte
+}
+
+// keyCertData returns the data signed by a key certificate. The prefix makes
+// sure it can never be mistaken for a signed response body.
+func keyCertData(key ed25519.PublicKey, expiry int64) []byte {
+	prefix := fmt.Sprintf("profilefed-signing-key:%d:", expiry)
+	return append([]byte(prefix), key...)
+}
+
+// NewKeyCertificate certifies key until expiry, using identity to sign the
+// certificate. The identity has to hold the server's Ed25519 identity key.
+func NewKeyCertificate(identity crypto.Signer, key ed25519.PublicKey, expiry time.Time) (*KeyCertificate, error) {
+	if len(key) != ed25519.PublicKeySize {
+		return nil, ErrInvalidKeyCertificate
+	}
+
+	// The expiry is encoded with second precision
+	expiry = time.Unix(expiry.Unix(), 0)
+	sig, err := sign(identity, keyCertData(key, expiry.Unix()))
+	if err != nil {
+		return nil, err
+	}
+
+	return &KeyCertificate{Key: key, Expiry: expiry, Signature: sig}, nil
+}
+
+// ParseKeyCertificate parses a certificate in the format returned by
+// [KeyCertificate.String]. It doesn't verify the certificate.
+func ParseKeyCertificate(val string) (*KeyCertificate, error) {
+	kc := &KeyCertificate{}
+	for _, param := range strings.Split(val, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+		if !ok {
+			return nil, ErrInvalidKeyCertificate
+		}
+
+		var err error
+		switch key {
+		case "key":
+			kc.Key, err = base64.StdEncoding.DecodeString(value)
+		case "expires":
+			var expiry int64
+			expiry, err = strconv.ParseInt(value, 10, 64)
+			kc.Expiry = time.Unix(expiry, 0)
+		case "sig":
+			kc.Signature, err = base64.StdEncoding.DecodeString(value)
+		}
+		if err != nil {
+			return nil, ErrInvalidKeyCertificate
+		}
+	}
+
+	if len(kc.Key) != ed25519.PublicKeySize || kc.Expiry.IsZero() || kc.Signature == nil {
+		return nil, ErrInvalidKeyCertificate
+	}
+	return kc, nil
+}
+
+// String returns the certificate in the format sent in the X-ProfileFed-Signing-Key header.
+func (kc *KeyCertificate) String() string {
+	return fmt.Sprintf("key=%s, expires=%d, sig=%s",
+		base64.StdEncoding.EncodeToString(kc.Key),
+		kc.Expiry.Unix(),
+		base64.StdEncoding.EncodeToString(kc.Signature),
+	)
+}
+
+// Verify checks that the certificate is signed by identity and hasn't expired at now.
+func (kc *KeyCertificate) Verify(identity ed25519.PublicKey, now time.Time) error {
+	if !verify(identity, keyCertData(kc.Key, kc.Expiry.Unix()), kc.Signature) {
+		return ErrInvalidKeyCertificate
+	}
+
+	if now.After(kc.Expiry) {
+		return ErrKeyCertificateExpired
+	}
+
+	return nil
+}
+
+// certifiedKey returns the key that signed a response, given the identity key
+// of the server and the response's key certificate. Responses without a
+// certificate are signed by the identity key itself.
+func certifiedKey(identity ed25519.PublicKey, keyCert string) (ed25519.PublicKey, error) {
+	if keyCert == "" {
+		return identity, nil
+	}
+
+	kc, err := ParseKeyCertificate(keyCert)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := kc.Verify(identity, time.Now()); err != nil {
+		return nil, err
+	}
+	return kc.Key, nil
+}
@@ -0,0 +1,87 @@
+package profilefed
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"queerdevs.org/profilefed/webfinger"
+)
+
+// newCertifiedTenant returns a tenant whose server info contains identity,
+// and whose descriptors are signed using a separate key certified by certifier.
+func newCertifiedTenant(t *testing.T, host string, desc *Descriptor, identity, certifier ed25519.PrivateKey, expiry time.Time) http.Handler {
+	t.Helper()
+
+	pub, priv, err := GenerateKeys()
+	if err != nil {
+		t.Fatalf("GenerateKeys error: %s", err)
+	}
+
+	kc, err := NewKeyCertificate(certifier, pub, expiry)
+	if err != nil {
+		t.Fatalf("NewKeyCertificate error: %s", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/.well-known/webfinger", webfinger.Handler{
+		DescriptorFunc: func(resource string) (*webfinger.Descriptor, error) {
+			return &webfinger.Descriptor{
+				Subject: resource,
+				Links: []webfinger.Link{{
+					Rel:  "self",
+					Type: "application/x-pfd+json",
+					Href: "http://" + host + "/pfd/user",
+				}},
+			}, nil
+		},
+	})
+	mux.Handle("/_profilefed/server", ServerInfoHandler{ServerName: host, PrivateKey: identity})
+	mux.Handle("/pfd/user", Handler{
+		PrivateKey:     priv,
+		KeyCertificate: kc,
+		DescriptorFunc: func(req *Request) (*Descriptor, error) {
+			return desc, nil
+		},
+	})
+	return mux
+}
+
+func TestKeyCertificate(t *testing.T) {
+	desc := &Descriptor{ID: "main", Username: "user", DisplayName: "User"}
+
+	_, identity, err := GenerateKeys()
+	if err != nil {
+		t.Fatalf("GenerateKeys error: %s", err)
+	}
+	_, other, err := GenerateKeys()
+	if err != nil {
+		t.Fatalf("GenerateKeys error: %s", err)
+	}
+
+	mt := &MemoryTransport{}
+	mt.Register("valid.test", newCertifiedTenant(t, "valid.test", desc, identity, identity, time.Now().Add(time.Hour)))
+	mt.Register("expired.test", newCertifiedTenant(t, "expired.test", desc, identity, identity, time.Now().Add(-time.Hour)))
+	mt.Register("forged.test", newCertifiedTenant(t, "forged.test", desc, identity, other, time.Now().Add(time.Hour)))
+
+	c := mt.Client()
+	got, err := c.Lookup("user@valid.test")
+	if err != nil {
+		t.Fatalf("Lookup error: %s", err)
+	}
+
+	if !reflect.DeepEqual(got, desc) {
+		t.Errorf("Descriptors are not equal:\n%#v\n\n%#v", got, desc)
+	}
+
+	if _, err := c.Lookup("user@expired.test"); !errors.Is(err, ErrKeyCertificateExpired) {
+		t.Errorf("Expected ErrKeyCertificateExpired, got %v", err)
+	}
+
+	if _, err := c.Lookup("user@forged.test"); !errors.Is(err, ErrInvalidKeyCertificate) {
+		t.Errorf("Expected ErrInvalidKeyCertificate, got %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+package profilefed
+
+import "crypto/ed25519"
+
+// KeyChangeReason identifies why a server's pinned key was replaced.
+type KeyChangeReason string
+
+// Key change reasons
+const (
+	// KeyChangeRotation means the server presented a new key in its server
+	// info, which was signed by the previously pinned key.
+	KeyChangeRotation KeyChangeReason = "rotation"
+	// KeyChangeRename means the server was previously known under another
+	// name with a different key, and its server info under the new name
+	// was signed by the key pinned for the previous name.
+	KeyChangeRename KeyChangeReason = "rename"
+)
+
+// KeyChange describes the replacement of a server's pinned key, along
+// with the evidence the client used to accept it. See [Client.OnKeyChange].
+type KeyChange struct {
+	// Reason is the reason the key was replaced.
+	Reason KeyChangeReason
+	// ServerName is the name the new key is pinned under.
+	ServerName string
+	// PreviousName is the name the old key was pinned under,
+	// for [KeyChangeRename] changes.
+	PreviousName string
+
+	// OldKey and NewKey are the replaced key and the key replacing it.
+	OldKey ed25519.PublicKey
+	NewKey ed25519.PublicKey
+	// OldFingerprint and NewFingerprint are the [Fingerprint]s of OldKey and NewKey.
+	OldFingerprint string
+	NewFingerprint string
+
+	// ServerInfo is the server info document that contains the new key.
+	ServerInfo []byte
+	// OldKeySignature is the signature of ServerInfo made with the old key,
+	// which authorizes the change.
+	OldKeySignature []byte
+	// NewKeySignature is the signature of ServerInfo made with the new key.
+	NewKeySignature []byte
+}
+
+// newKeyChange returns a KeyChange with the given keys and their fingerprints.
+func newKeyChange(reason KeyChangeReason, serverName string, oldKey, newKey ed25519.PublicKey) KeyChange {
+	return KeyChange{
+		Reason:         reason,
+		ServerName:     serverName,
+		OldKey:         oldKey,
+		NewKey:         newKey,
+		OldFingerprint: Fingerprint(oldKey),
+		NewFingerprint: Fingerprint(newKey),
+	}
+}
+
+// keyChanged calls the client's OnKeyChange hook, if it has one.
+// If it returns an error, the change must not be saved.
+func (c Client) keyChanged(kc KeyChange) error {
+	if c.OnKeyChange == nil {
+		return nil
+	}
+
+	if err := c.OnKeyChange(kc); err != nil {
+		c.tracef("key change for %s from %s to %s was rejected: %s", kc.ServerName, kc.OldFingerprint, kc.NewFingerprint, err)
+		return err
+	}
+	return nil
+}
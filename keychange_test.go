@@ -0,0 +1,75 @@
+package profilefed
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"testing"
+)
+
+func TestClientOnKeyChange(t *testing.T) {
+	desc := &Descriptor{ID: "main", Username: "user", DisplayName: "User"}
+
+	oldPub, oldPriv, err := GenerateKeys()
+	if err != nil {
+		t.Fatalf("GenerateKeys error: %s", err)
+	}
+	newPub, newPriv, err := GenerateKeys()
+	if err != nil {
+		t.Fatalf("GenerateKeys error: %s", err)
+	}
+
+	register := func(mt *MemoryTransport, priv ed25519.PrivateKey, prevKeys ...ed25519.PrivateKey) {
+		mt.Register("example.test", tenantMux("example.test", ServerInfoHandler{
+			ServerName:   "example.test",
+			PrivateKey:   priv,
+			PreviousKeys: prevKeys,
+		}, Handler{
+			PrivateKey: priv,
+			DescriptorFunc: func(req *Request) (*Descriptor, error) {
+				return desc, nil
+			},
+		}))
+	}
+
+	mt := &MemoryTransport{}
+	register(mt, oldPriv)
+
+	var changes []KeyChange
+	errReview := errors.New("key change requires review")
+	c := mt.Client()
+	c.OnKeyChange = func(change KeyChange) error {
+		changes = append(changes, change)
+		return errReview
+	}
+
+	if _, err := c.Lookup("user@example.test"); err != nil {
+		t.Fatalf("Lookup error: %s", err)
+	}
+
+	register(mt, newPriv, oldPriv)
+	if _, err := c.Lookup("user@example.test"); !errors.Is(err, errReview) {
+		t.Fatalf("Expected review error, got %v", err)
+	}
+
+	if len(changes) != 1 {
+		t.Fatalf("Expected 1 key change, got %d", len(changes))
+	}
+
+	change := changes[0]
+	if change.Reason != KeyChangeRotation || change.OldFingerprint != Fingerprint(oldPub) || change.NewFingerprint != Fingerprint(newPub) {
+		t.Errorf("Unexpected key change: %#v", change)
+	}
+
+	if !verify(oldPub, change.ServerInfo, change.OldKeySignature) {
+		t.Error("Key change evidence isn't signed by the old key")
+	}
+
+	if pubkey, err := c.GetPubkey("example.test"); err != nil || !pubkey.Equal(oldPub) {
+		t.Errorf("Expected rejected key change not to replace the pinned key")
+	}
+
+	c.OnKeyChange = nil
+	if _, err := c.Lookup("user@example.test"); err != nil {
+		t.Fatalf("Lookup error: %s", err)
+	}
+}
@@ -0,0 +1,262 @@
+package profilefed
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"hash"
+)
+
+const (
+	// encryptedKeyType is the PEM type of encrypted PKCS #8 private keys.
+	encryptedKeyType = "ENCRYPTED PRIVATE KEY"
+	// keyIterations is the number of PBKDF2 iterations used to encrypt keys.
+	keyIterations = 600_000
+	// maxKeyIterations limits the work done to decrypt a key file.
+	maxKeyIterations = 10_000_000
+)
+
+var (
+	// ErrEncryptedKey signifies that a private key file is encrypted,
+	// but no passphrase was provided to decrypt it.
+	ErrEncryptedKey = errors.New("private key is encrypted")
+	// ErrIncorrectPassphrase signifies that a private key
+	// file couldn't be decrypted using the given passphrase.
+	ErrIncorrectPassphrase = errors.New("incorrect passphrase")
+	// ErrUnsupportedKeyEncryption signifies that a private key file is
+	// encrypted using an algorithm that isn't supported.
+	ErrUnsupportedKeyEncryption = errors.New("unsupported private key encryption")
+)
+
+var (
+	oidPBES2          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidHMACWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidAES128CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+)
+
+// PassphraseFunc returns the passphrase of the encrypted private key file
+// at path. It can prompt the operator, or read the passphrase from a secret
+// store. See [Passphrase] for a fixed passphrase.
+type PassphraseFunc func(path string) ([]byte, error)
+
+// Passphrase returns a [PassphraseFunc] that always returns passphrase.
+func Passphrase(passphrase string) PassphraseFunc {
+	return func(string) ([]byte, error) {
+		return []byte(passphrase), nil
+	}
+}
+
+// encryptedPrivateKeyInfo is the EncryptedPrivateKeyInfo structure from RFC 5208.
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+// pbes2Params contains the parameters of the PBES2 scheme from RFC 8018.
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+// pbkdf2Params contains the parameters of PBKDF2 from RFC 8018.
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// encryptKeyPEM encrypts PKCS #8 private key data using passphrase, with
+// PBES2, PBKDF2-HMAC-SHA256, and AES-256-CBC, so that the resulting block
+// can also be read by other tools, such as OpenSSL.
+func encryptKeyPEM(data, passphrase []byte) (*pem.Block, error) {
+	if len(passphrase) == 0 {
+		return nil, errors.New("empty passphrase")
+	}
+
+	salt := make([]byte, 16)
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(iv); err != nil {
+		return nil, err
+	}
+
+	kdfParams, err := asn1.Marshal(pbkdf2Params{
+		Salt:           salt,
+		IterationCount: keyIterations,
+		PRF:            pkix.AlgorithmIdentifier{Algorithm: oidHMACWithSHA256, Parameters: asn1.NullRawValue},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ivParam, err := asn1.Marshal(iv)
+	if err != nil {
+		return nil, err
+	}
+
+	params, err := asn1.Marshal(pbes2Params{
+		KeyDerivationFunc: pkix.AlgorithmIdentifier{Algorithm: oidPBKDF2, Parameters: asn1.RawValue{FullBytes: kdfParams}},
+		EncryptionScheme:  pkix.AlgorithmIdentifier{Algorithm: oidAES256CBC, Parameters: asn1.RawValue{FullBytes: ivParam}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(pbkdf2Key(sha256.New, passphrase, salt, keyIterations, 32))
+	if err != nil {
+		return nil, err
+	}
+
+	// PKCS #7 padding
+	padding := aes.BlockSize - len(data)%aes.BlockSize
+	encrypted := append(append([]byte(nil), data...), make([]byte, padding)...)
+	for i := len(data); i < len(encrypted); i++ {
+		encrypted[i] = byte(padding)
+	}
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, encrypted)
+
+	der, err := asn1.Marshal(encryptedPrivateKeyInfo{
+		Algorithm:     pkix.AlgorithmIdentifier{Algorithm: oidPBES2, Parameters: asn1.RawValue{FullBytes: params}},
+		EncryptedData: encrypted,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &pem.Block{Type: encryptedKeyType, Bytes: der}, nil
+}
+
+// decryptKeyDER decrypts the DER data of an encrypted PKCS #8 private key
+// using passphrase. Only PBES2 with PBKDF2 and AES-CBC is supported.
+func decryptKeyDER(der, passphrase []byte) ([]byte, error) {
+	var info encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, errors.New("invalid encrypted private key data")
+	}
+
+	if !info.Algorithm.Algorithm.Equal(oidPBES2) {
+		return nil, ErrUnsupportedKeyEncryption
+	}
+
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, ErrUnsupportedKeyEncryption
+	}
+
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, ErrUnsupportedKeyEncryption
+	}
+
+	var kdfParams pbkdf2Params
+	if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdfParams); err != nil {
+		return nil, ErrUnsupportedKeyEncryption
+	}
+
+	if kdfParams.IterationCount < 1 || kdfParams.IterationCount > maxKeyIterations {
+		return nil, ErrUnsupportedKeyEncryption
+	}
+
+	// The PRF defaults to HMAC-SHA1 if it's omitted
+	var newHash func() hash.Hash
+	switch prf := kdfParams.PRF.Algorithm; {
+	case len(prf) == 0, prf.Equal(oidHMACWithSHA1):
+		newHash = sha1.New
+	case prf.Equal(oidHMACWithSHA256):
+		newHash = sha256.New
+	default:
+		return nil, ErrUnsupportedKeyEncryption
+	}
+
+	var keyLen int
+	switch alg := params.EncryptionScheme.Algorithm; {
+	case alg.Equal(oidAES128CBC):
+		keyLen = 16
+	case alg.Equal(oidAES192CBC):
+		keyLen = 24
+	case alg.Equal(oidAES256CBC):
+		keyLen = 32
+	default:
+		return nil, ErrUnsupportedKeyEncryption
+	}
+
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil || len(iv) != aes.BlockSize {
+		return nil, ErrUnsupportedKeyEncryption
+	}
+
+	data := info.EncryptedData
+	if len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return nil, errors.New("invalid encrypted private key data")
+	}
+
+	block, err := aes.NewCipher(pbkdf2Key(newHash, passphrase, kdfParams.Salt, kdfParams.IterationCount, keyLen))
+	if err != nil {
+		return nil, err
+	}
+
+	decrypted := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(decrypted, data)
+
+	// An incorrect passphrase almost always results in invalid padding,
+	// and the key is parsed afterwards to catch the remaining cases.
+	padding := int(decrypted[len(decrypted)-1])
+	if padding == 0 || padding > aes.BlockSize {
+		return nil, ErrIncorrectPassphrase
+	}
+	expected := make([]byte, padding)
+	for i := range expected {
+		expected[i] = byte(padding)
+	}
+	if subtle.ConstantTimeCompare(decrypted[len(decrypted)-padding:], expected) != 1 {
+		return nil, ErrIncorrectPassphrase
+	}
+
+	return decrypted[:len(decrypted)-padding], nil
+}
+
+// pbkdf2Key derives a key of length keyLen from password and salt
+// using PBKDF2 as defined in RFC 8018, with HMAC using newHash as the PRF.
+func pbkdf2Key(newHash func() hash.Hash, password, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(newHash, password)
+	hashLen := prf.Size()
+	numBlocks := (keyLen + hashLen - 1) / hashLen
+
+	var counter [4]byte
+	out := make([]byte, 0, numBlocks*hashLen)
+	u := make([]byte, hashLen)
+	for block := 1; block <= numBlocks; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.BigEndian.PutUint32(counter[:], uint32(block))
+		prf.Write(counter[:])
+		out = prf.Sum(out)
+
+		t := out[len(out)-hashLen:]
+		copy(u, t)
+		for range iterations - 1 {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for i := range u {
+				t[i] ^= u[i]
+			}
+		}
+	}
+	return out[:keyLen]
+}
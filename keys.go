@@ -7,72 +7,79 @@ import (
 	"encoding/pem"
 	"errors"
 	"os"
+	"strings"
 )
 
 // LoadOrGenerateKeys checks whether the file at path exists. If it does,
 // the private and public keys at that path are loaded and returned.
 // If not, new keys are generated and saved to the given path.
 func LoadOrGenerateKeys(path string) (ed25519.PublicKey, ed25519.PrivateKey, error) {
+	return LoadOrGenerateEncryptedKeys(path, nil)
+}
+
+// LoadOrGenerateEncryptedKeys is like [LoadOrGenerateKeys], but newly generated
+// private keys are encrypted using the passphrase returned by passphrase, and
+// existing encrypted keys are decrypted using it. Existing keys that aren't
+// encrypted are loaded as-is. If passphrase is nil, keys aren't encrypted.
+func LoadOrGenerateEncryptedKeys(path string, passphrase PassphraseFunc) (ed25519.PublicKey, ed25519.PrivateKey, error) {
 	if _, err := os.Stat(path); err != nil {
-		return generateKeys(path)
+		return generateKeys(path, passphrase)
 	}
-	return loadKeys(path)
+	return loadKeys(path, passphrase)
 }
 
-func loadKeys(path string) (ed25519.PublicKey, ed25519.PrivateKey, error) {
-	privData, err := os.ReadFile(path)
+func loadKeys(path string, passphrase PassphraseFunc) (ed25519.PublicKey, ed25519.PrivateKey, error) {
+	priv, err := LoadEncryptedPrivateKey(path, passphrase)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	pubData, err := os.ReadFile(path + ".pub")
+	pub, err := LoadPublicKey(path + ".pub")
 	if err != nil {
 		return nil, nil, err
 	}
 
-	privBlock, _ := pem.Decode(privData)
-	pubBlock, _ := pem.Decode(pubData)
-
-	if privBlock == nil {
-		return nil, nil, errors.New("invalid private key data")
-	}
-
-	if pubBlock == nil {
-		return nil, nil, errors.New("invalid public key data")
-	}
+	return pub, priv, nil
+}
 
-	privkey, err := x509.ParsePKCS8PrivateKey(privBlock.Bytes)
+func generateKeys(path string, passphrase PassphraseFunc) (ed25519.PublicKey, ed25519.PrivateKey, error) {
+	pub, priv, err := GenerateKeys()
 	if err != nil {
 		return nil, nil, err
 	}
 
-	pubkey, err := x509.ParsePKIXPublicKey(pubBlock.Bytes)
+	err = SaveEncryptedKeys(path, priv, passphrase)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	priv, ok := privkey.(ed25519.PrivateKey)
-	if !ok {
-		return nil, nil, errors.New("invalid private key type")
-	}
+	return pub, priv, nil
+}
 
-	pub, ok := pubkey.(ed25519.PublicKey)
-	if !ok {
-		return nil, nil, errors.New("invalid public key type")
-	}
+// GenerateKeys generates a new Ed25519 keypair without saving it. Use
+// [SaveKeys] to save it to a file, or store it elsewhere, such as
+// in a secrets manager.
+func GenerateKeys() (ed25519.PublicKey, ed25519.PrivateKey, error) {
+	return ed25519.GenerateKey(rand.Reader)
+}
 
-	return pub, priv, nil
+// SaveKeys saves priv to the file at path, and its public key to the same path
+// with a .pub suffix, in the format read by [LoadOrGenerateKeys]. Existing
+// files are overwritten.
+func SaveKeys(path string, priv ed25519.PrivateKey) error {
+	return SaveEncryptedKeys(path, priv, nil)
 }
 
-func generateKeys(path string) (ed25519.PublicKey, ed25519.PrivateKey, error) {
-	pub, priv, err := ed25519.GenerateKey(rand.Reader)
-	if err != nil {
-		return nil, nil, err
+// SaveEncryptedKeys is like [SaveKeys], but the private key is encrypted using
+// the passphrase returned by passphrase. If passphrase is nil, it isn't encrypted.
+func SaveEncryptedKeys(path string, priv ed25519.PrivateKey, passphrase PassphraseFunc) error {
+	if len(priv) != ed25519.PrivateKeySize {
+		return errors.New("invalid private key size")
 	}
 
 	privData, err := x509.MarshalPKCS8PrivateKey(priv)
 	if err != nil {
-		return nil, nil, err
+		return err
 	}
 
 	privBlock := &pem.Block{
@@ -80,14 +87,26 @@ func generateKeys(path string) (ed25519.PublicKey, ed25519.PrivateKey, error) {
 		Bytes: privData,
 	}
 
+	if passphrase != nil {
+		pass, err := passphrase(path)
+		if err != nil {
+			return err
+		}
+
+		privBlock, err = encryptKeyPEM(privData, pass)
+		if err != nil {
+			return err
+		}
+	}
+
 	err = os.WriteFile(path, pem.EncodeToMemory(privBlock), 0o600)
 	if err != nil {
-		return nil, nil, err
+		return err
 	}
 
-	pubData, err := x509.MarshalPKIXPublicKey(pub)
+	pubData, err := x509.MarshalPKIXPublicKey(priv.Public())
 	if err != nil {
-		return nil, nil, err
+		return err
 	}
 
 	pubBlock := &pem.Block{
@@ -95,12 +114,7 @@ func generateKeys(path string) (ed25519.PublicKey, ed25519.PrivateKey, error) {
 		Bytes: pubData,
 	}
 
-	err = os.WriteFile(path+".pub", pem.EncodeToMemory(pubBlock), 0o644)
-	if err != nil {
-		return nil, nil, err
-	}
-
-	return pub, priv, nil
+	return os.WriteFile(path+".pub", pem.EncodeToMemory(pubBlock), 0o644)
 }
 
 // LoadPrivateKeys loads the private keys at all the provided paths.
@@ -118,8 +132,43 @@ func LoadPrivateKeys(paths ...string) []ed25519.PrivateKey {
 	return out
 }
 
+// LoadPublicKey loads a public Ed25519 key, such as
+// one saved by [SaveKeys], from the given path.
+func LoadPublicKey(path string) (ed25519.PublicKey, error) {
+	pubData, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	pubBlock, _ := pem.Decode(pubData)
+	if pubBlock == nil {
+		return nil, errors.New("invalid public key data")
+	}
+
+	pubkey, err := x509.ParsePKIXPublicKey(pubBlock.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	pub, ok := pubkey.(ed25519.PublicKey)
+	if !ok {
+		return nil, errors.New("invalid public key type")
+	}
+
+	return pub, nil
+}
+
 // LoadPrivateKey loads a private Ed25519 key from the given path.
+// If the key is encrypted, it returns [ErrEncryptedKey].
 func LoadPrivateKey(path string) (ed25519.PrivateKey, error) {
+	return LoadEncryptedPrivateKey(path, nil)
+}
+
+// LoadEncryptedPrivateKey loads a private Ed25519 key from the given path. If
+// the key is encrypted, it's decrypted using the passphrase returned by
+// passphrase, which isn't called for unencrypted keys. Encrypted PKCS #8 keys
+// using PBES2, such as ones encrypted by OpenSSL, are supported.
+func LoadEncryptedPrivateKey(path string, passphrase PassphraseFunc) (ed25519.PrivateKey, error) {
 	privData, err := os.ReadFile(path)
 	if err != nil {
 		return nil, err
@@ -131,8 +180,31 @@ func LoadPrivateKey(path string) (ed25519.PrivateKey, error) {
 		return nil, errors.New("invalid private key data")
 	}
 
-	privkey, err := x509.ParsePKCS8PrivateKey(privBlock.Bytes)
+	der := privBlock.Bytes
+	if privBlock.Type == encryptedKeyType {
+		if passphrase == nil {
+			return nil, ErrEncryptedKey
+		}
+
+		pass, err := passphrase(path)
+		if err != nil {
+			return nil, err
+		}
+
+		der, err = decryptKeyDER(der, pass)
+		if err != nil {
+			return nil, err
+		}
+	} else if strings.Contains(privBlock.Headers["Proc-Type"], "ENCRYPTED") {
+		// Legacy PEM encryption is insecure, so it isn't supported
+		return nil, ErrUnsupportedKeyEncryption
+	}
+
+	privkey, err := x509.ParsePKCS8PrivateKey(der)
 	if err != nil {
+		if privBlock.Type == encryptedKeyType {
+			return nil, ErrIncorrectPassphrase
+		}
 		return nil, err
 	}
 
@@ -0,0 +1,54 @@
+package profilefed
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncryptedKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "key.pem")
+
+	pub, priv, err := LoadOrGenerateEncryptedKeys(path, Passphrase("correct horse"))
+	if err != nil {
+		t.Fatalf("LoadOrGenerateEncryptedKeys error: %s", err)
+	}
+
+	if _, err := LoadPrivateKey(path); !errors.Is(err, ErrEncryptedKey) {
+		t.Errorf("Expected ErrEncryptedKey, got %v", err)
+	}
+
+	if _, err := LoadEncryptedPrivateKey(path, Passphrase("battery staple")); !errors.Is(err, ErrIncorrectPassphrase) {
+		t.Errorf("Expected ErrIncorrectPassphrase, got %v", err)
+	}
+
+	loadedPub, loadedPriv, err := LoadOrGenerateEncryptedKeys(path, Passphrase("correct horse"))
+	if err != nil {
+		t.Fatalf("LoadOrGenerateEncryptedKeys error: %s", err)
+	}
+
+	if !loadedPub.Equal(pub) || !loadedPriv.Equal(priv) {
+		t.Error("Loaded keys don't match generated keys")
+	}
+}
+
+func TestSaveKeys(t *testing.T) {
+	pub, priv, err := GenerateKeys()
+	if err != nil {
+		t.Fatalf("GenerateKeys error: %s", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "key.pem")
+	if err := SaveKeys(path, priv); err != nil {
+		t.Fatalf("SaveKeys error: %s", err)
+	}
+
+	loadedPub, loadedPriv, err := LoadOrGenerateKeys(path)
+	if err != nil {
+		t.Fatalf("LoadOrGenerateKeys error: %s", err)
+	}
+
+	if !loadedPub.Equal(pub) || !loadedPriv.Equal(priv) {
+		t.Error("Loaded keys don't match saved keys")
+	}
+}
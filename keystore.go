@@ -0,0 +1,434 @@
+package profilefed
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrNoKeyStore signifies that a client has no keystore to manage,
+// because none was set using [Client.WithKeyStore].
+var ErrNoKeyStore = errors.New("client has no keystore")
+
+// KeyStore persists server public keys and quarantines. See [MemoryKeyStore]
+// and the pfdstore package for implementations.
+type KeyStore interface {
+	// SavePubkey saves the public key for the given server and
+	// deletes the keys for its previous names.
+	SavePubkey(serverName string, previousNames []string, pubkey ed25519.PublicKey) error
+	// GetPubkey returns the public key for the given server,
+	// or [ErrPubkeyNotFound] if there isn't one.
+	GetPubkey(serverName string) (ed25519.PublicKey, error)
+	// SetQuarantined sets whether the given server is quarantined.
+	SetQuarantined(serverName string, quarantined bool) error
+	// IsQuarantined reports whether the given server is quarantined.
+	IsQuarantined(serverName string) (bool, error)
+	// SaveAlias records that alias is an alternate name of the given server.
+	SaveAlias(alias, serverName string) error
+	// GetAlias returns the name of the server that alias is an
+	// alternate name of, or an empty string if it isn't one.
+	GetAlias(alias string) (string, error)
+	// MarkVerified records that a response from the given server was verified
+	// using its pinned key at the given time. It does nothing if no key is
+	// pinned under the given name, such as for alternate names.
+	MarkVerified(serverName string, at time.Time) error
+	// ListHosts returns the names of all the servers with a pinned key.
+	ListHosts() ([]string, error)
+	// GetKeyInfo returns information about the key pinned for the
+	// given server, or [ErrPubkeyNotFound] if there isn't one.
+	GetKeyInfo(serverName string) (KeyInfo, error)
+	// DeleteHost deletes the key pinned for the given server, so that
+	// it's trusted on first use again the next time it's contacted.
+	DeleteHost(serverName string) error
+}
+
+// KeyInfo contains information about a pinned server key.
+type KeyInfo struct {
+	// ServerName is the name of the server.
+	ServerName string
+	// PublicKey is the server's pinned public key.
+	PublicKey ed25519.PublicKey
+	// FirstSeen is when the server was first trusted. It's kept when the
+	// server rotates its key or is renamed. It's zero for keys pinned
+	// before first-seen times were recorded.
+	FirstSeen time.Time
+	// LastVerified is when a response from the server was last verified
+	// using the pinned key. It's zero if none has been verified since the
+	// key was pinned.
+	LastVerified time.Time
+}
+
+// MemoryKeyStore is an in-memory, thread-safe keystore for server public keys and
+// quarantines. Its contents can be exported to and imported from JSON, which makes
+// it useful for tests and command-line tools. The zero value is ready to use.
+//
+// Use [Client.WithKeyStore] to make a client use it.
+type MemoryKeyStore struct {
+	mtx         sync.RWMutex
+	keys        map[string]ed25519.PublicKey
+	quarantined map[string]bool
+	aliases     map[string]string
+	info        map[string]keyTimes
+}
+
+// keyTimes contains the timestamps recorded for a pinned key.
+type keyTimes struct {
+	FirstSeen    time.Time `json:"first_seen"`
+	LastVerified time.Time `json:"last_verified"`
+}
+
+// memoryKeyStoreData is the JSON representation of a [MemoryKeyStore].
+type memoryKeyStoreData struct {
+	Keys        map[string][]byte   `json:"keys"`
+	Quarantined []string            `json:"quarantined,omitempty"`
+	Aliases     map[string]string   `json:"aliases,omitempty"`
+	Info        map[string]keyTimes `json:"info,omitempty"`
+}
+
+// SavePubkey saves the public key for the given server and
+// deletes the keys for its previous names.
+func (mks *MemoryKeyStore) SavePubkey(serverName string, previousNames []string, pubkey ed25519.PublicKey) error {
+	mks.mtx.Lock()
+	defer mks.mtx.Unlock()
+
+	if mks.keys == nil {
+		mks.keys = map[string]ed25519.PublicKey{}
+	}
+	if mks.info == nil {
+		mks.info = map[string]keyTimes{}
+	}
+
+	// Renamed servers keep the earliest first-seen time of their previous names
+	times, ok := mks.info[serverName]
+	if !ok {
+		times.FirstSeen = time.Now().UTC()
+	}
+	for _, name := range previousNames {
+		if prev, ok := mks.info[name]; ok && !prev.FirstSeen.IsZero() && prev.FirstSeen.Before(times.FirstSeen) {
+			times.FirstSeen = prev.FirstSeen
+		}
+	}
+	if !bytes.Equal(mks.keys[serverName], pubkey) {
+		times.LastVerified = time.Time{}
+	}
+
+	mks.keys[serverName] = slices.Clone(pubkey)
+	mks.info[serverName] = times
+	for _, name := range previousNames {
+		delete(mks.keys, name)
+		delete(mks.info, name)
+	}
+	return nil
+}
+
+// GetPubkey returns the public key for the given server,
+// or [ErrPubkeyNotFound] if there isn't one.
+func (mks *MemoryKeyStore) GetPubkey(serverName string) (ed25519.PublicKey, error) {
+	mks.mtx.RLock()
+	defer mks.mtx.RUnlock()
+
+	pubkey, ok := mks.keys[serverName]
+	if !ok {
+		return nil, ErrPubkeyNotFound
+	}
+	return pubkey, nil
+}
+
+// SetQuarantined sets whether the given server is quarantined.
+func (mks *MemoryKeyStore) SetQuarantined(serverName string, quarantined bool) error {
+	mks.mtx.Lock()
+	defer mks.mtx.Unlock()
+
+	if !quarantined {
+		delete(mks.quarantined, serverName)
+		return nil
+	}
+
+	if mks.quarantined == nil {
+		mks.quarantined = map[string]bool{}
+	}
+	mks.quarantined[serverName] = true
+	return nil
+}
+
+// IsQuarantined reports whether the given server is quarantined.
+func (mks *MemoryKeyStore) IsQuarantined(serverName string) (bool, error) {
+	mks.mtx.RLock()
+	defer mks.mtx.RUnlock()
+	return mks.quarantined[serverName], nil
+}
+
+// SaveAlias records that alias is an alternate name of the given server.
+func (mks *MemoryKeyStore) SaveAlias(alias, serverName string) error {
+	mks.mtx.Lock()
+	defer mks.mtx.Unlock()
+
+	if mks.aliases == nil {
+		mks.aliases = map[string]string{}
+	}
+	mks.aliases[alias] = serverName
+	return nil
+}
+
+// GetAlias returns the name of the server that alias is an
+// alternate name of, or an empty string if it isn't one.
+func (mks *MemoryKeyStore) GetAlias(alias string) (string, error) {
+	mks.mtx.RLock()
+	defer mks.mtx.RUnlock()
+	return mks.aliases[alias], nil
+}
+
+// MarkVerified records that a response from the given server was
+// verified using its pinned key at the given time.
+func (mks *MemoryKeyStore) MarkVerified(serverName string, at time.Time) error {
+	mks.mtx.Lock()
+	defer mks.mtx.Unlock()
+
+	if _, ok := mks.keys[serverName]; !ok {
+		return nil
+	}
+
+	if mks.info == nil {
+		mks.info = map[string]keyTimes{}
+	}
+	times := mks.info[serverName]
+	times.LastVerified = at.UTC()
+	mks.info[serverName] = times
+	return nil
+}
+
+// ListHosts returns the names of all the servers with a saved key, in sorted order.
+func (mks *MemoryKeyStore) ListHosts() ([]string, error) {
+	return mks.Hosts(), nil
+}
+
+// GetKeyInfo returns information about the key pinned for the
+// given server, or [ErrPubkeyNotFound] if there isn't one.
+func (mks *MemoryKeyStore) GetKeyInfo(serverName string) (KeyInfo, error) {
+	mks.mtx.RLock()
+	defer mks.mtx.RUnlock()
+
+	pubkey, ok := mks.keys[serverName]
+	if !ok {
+		return KeyInfo{}, ErrPubkeyNotFound
+	}
+
+	times := mks.info[serverName]
+	return KeyInfo{
+		ServerName:   serverName,
+		PublicKey:    pubkey,
+		FirstSeen:    times.FirstSeen,
+		LastVerified: times.LastVerified,
+	}, nil
+}
+
+// DeleteHost deletes the key pinned for the given server. Its
+// quarantine and alternate names are kept.
+func (mks *MemoryKeyStore) DeleteHost(serverName string) error {
+	mks.mtx.Lock()
+	defer mks.mtx.Unlock()
+	delete(mks.keys, serverName)
+	delete(mks.info, serverName)
+	return nil
+}
+
+// Hosts returns the names of all the servers with a saved key, in sorted order.
+func (mks *MemoryKeyStore) Hosts() []string {
+	mks.mtx.RLock()
+	defer mks.mtx.RUnlock()
+
+	out := make([]string, 0, len(mks.keys))
+	for name := range mks.keys {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Export writes the contents of the keystore to w as JSON.
+// The output is deterministic, so it can be compared or checked into version control.
+func (mks *MemoryKeyStore) Export(w io.Writer) error {
+	mks.mtx.RLock()
+	data := memoryKeyStoreData{Keys: make(map[string][]byte, len(mks.keys))}
+	for name, pubkey := range mks.keys {
+		data.Keys[name] = pubkey
+	}
+	for name := range mks.quarantined {
+		data.Quarantined = append(data.Quarantined, name)
+	}
+	if len(mks.aliases) > 0 {
+		data.Aliases = maps.Clone(mks.aliases)
+	}
+	if len(mks.info) > 0 {
+		data.Info = maps.Clone(mks.info)
+	}
+	mks.mtx.RUnlock()
+
+	sort.Strings(data.Quarantined)
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(data)
+}
+
+// Import reads JSON produced by [MemoryKeyStore.Export] from r and adds
+// its contents to the keystore, replacing existing keys for the same servers.
+func (mks *MemoryKeyStore) Import(r io.Reader) error {
+	var data memoryKeyStoreData
+	if err := json.NewDecoder(r).Decode(&data); err != nil {
+		return err
+	}
+
+	for name, pubkey := range data.Keys {
+		if len(pubkey) != ed25519.PublicKeySize {
+			return fmt.Errorf("invalid public key for %s", name)
+		}
+	}
+
+	mks.mtx.Lock()
+	defer mks.mtx.Unlock()
+
+	if mks.keys == nil {
+		mks.keys = map[string]ed25519.PublicKey{}
+	}
+	for name, pubkey := range data.Keys {
+		mks.keys[name] = pubkey
+	}
+
+	if len(data.Quarantined) > 0 && mks.quarantined == nil {
+		mks.quarantined = map[string]bool{}
+	}
+	for _, name := range data.Quarantined {
+		mks.quarantined[name] = true
+	}
+
+	if len(data.Aliases) > 0 && mks.aliases == nil {
+		mks.aliases = map[string]string{}
+	}
+	maps.Copy(mks.aliases, data.Aliases)
+
+	if len(data.Info) > 0 && mks.info == nil {
+		mks.info = map[string]keyTimes{}
+	}
+	maps.Copy(mks.info, data.Info)
+
+	return nil
+}
+
+// WithKeyStore returns a copy of the client that pins keys and
+// persists quarantines and alternate names using the given keystore.
+func (c Client) WithKeyStore(ks KeyStore) Client {
+	c.SavePubkey = ks.SavePubkey
+	c.GetPubkey = ks.GetPubkey
+	c.SetQuarantined = ks.SetQuarantined
+	c.IsQuarantined = ks.IsQuarantined
+	c.SaveAlias = ks.SaveAlias
+	c.GetAlias = ks.GetAlias
+	c.MarkVerified = ks.MarkVerified
+	c.keyStore = ks
+	return c
+}
+
+// ListHosts returns the names of all the servers whose keys are
+// pinned in the keystore set using [Client.WithKeyStore].
+func (c Client) ListHosts() ([]string, error) {
+	if c.keyStore == nil {
+		return nil, ErrNoKeyStore
+	}
+	return c.keyStore.ListHosts()
+}
+
+// GetKeyInfo returns information about the key pinned for the given server
+// in the keystore set using [Client.WithKeyStore], such as when the server
+// was first trusted and when a response from it was last verified.
+func (c Client) GetKeyInfo(serverName string) (KeyInfo, error) {
+	if c.keyStore == nil {
+		return KeyInfo{}, ErrNoKeyStore
+	}
+	return c.keyStore.GetKeyInfo(normalizeHost(serverName))
+}
+
+// DeleteHost deletes the key pinned for the given server from the keystore
+// set using [Client.WithKeyStore] and the client's key cache, so that the
+// server's key is trusted on first use again the next time it's contacted.
+// Use it when a server has legitimately lost its key. To stop trusting a
+// server altogether, use [Client.QuarantineHost] instead.
+func (c Client) DeleteHost(serverName string) error {
+	if c.keyStore == nil {
+		return ErrNoKeyStore
+	}
+
+	serverName = normalizeHost(serverName)
+	info, err := c.keyStore.GetKeyInfo(serverName)
+	if errors.Is(err, ErrPubkeyNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if err := c.keyStore.DeleteHost(serverName); err != nil {
+		return err
+	}
+	if c.KeyCache != nil {
+		c.KeyCache.Forget(serverName)
+	}
+	c.emit(KeyEvent{Type: KeyEventHostDeleted, ServerName: serverName, OldFingerprint: FingerprintHex(info.PublicKey)})
+	return nil
+}
+
+// LoadKeyStoreFile loads a keystore exported to the file at path. If the
+// file doesn't exist, an empty keystore is returned, so that command-line
+// tools can create it on first use.
+func LoadKeyStoreFile(path string) (*MemoryKeyStore, error) {
+	mks := &MemoryKeyStore{}
+
+	fl, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return mks, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer fl.Close()
+
+	return mks, mks.Import(fl)
+}
+
+// SaveFile exports the keystore to the file at path. The file is
+// replaced atomically, so a failed write never corrupts it.
+func (mks *MemoryKeyStore) SaveFile(path string) error {
+	return writeFileAtomic(path, mks.Export)
+}
+
+// writeFileAtomic replaces the file at path with the data written by
+// write. The data is written to a temporary file in the same directory
+// first, which is renamed once it's complete. The file is only
+// readable and writable by its owner.
+func writeFileAtomic(path string, write func(w io.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,123 @@
+package profilefed
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestMemoryKeyStoreExport(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Error generating key: %s", err)
+	}
+
+	ks := &MemoryKeyStore{}
+	ks.SavePubkey("b.example.com", nil, pub)
+	ks.SavePubkey("a.example.com", nil, pub)
+	ks.SetQuarantined("b.example.com", true)
+
+	var buf bytes.Buffer
+	if err := ks.Export(&buf); err != nil {
+		t.Fatalf("Export error: %s", err)
+	}
+
+	imported := &MemoryKeyStore{}
+	if err := imported.Import(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatalf("Import error: %s", err)
+	}
+
+	if hosts := imported.Hosts(); !reflect.DeepEqual(hosts, []string{"a.example.com", "b.example.com"}) {
+		t.Errorf("Unexpected hosts: %q", hosts)
+	}
+
+	if q, _ := imported.IsQuarantined("b.example.com"); !q {
+		t.Errorf("Quarantine was not imported")
+	}
+
+	var again bytes.Buffer
+	if err := imported.Export(&again); err != nil {
+		t.Fatalf("Export error: %s", err)
+	}
+
+	if !bytes.Equal(buf.Bytes(), again.Bytes()) {
+		t.Errorf("Export is not deterministic:\n%s\n\n%s", buf.Bytes(), again.Bytes())
+	}
+}
+
+func TestClientKeyInfo(t *testing.T) {
+	mt := &MemoryTransport{}
+	mt.Register("info.test", newTenant(t, "info.test", &Descriptor{ID: "main", Username: "user", DisplayName: "User"}))
+
+	c := mt.Client()
+	if _, err := c.Lookup("user@info.test"); err != nil {
+		t.Fatalf("Lookup error: %s", err)
+	}
+
+	hosts, err := c.ListHosts()
+	if err != nil {
+		t.Fatalf("ListHosts error: %s", err)
+	}
+	if !reflect.DeepEqual(hosts, []string{"info.test"}) {
+		t.Errorf("Unexpected hosts: %q", hosts)
+	}
+
+	info, err := c.GetKeyInfo("info.test")
+	if err != nil {
+		t.Fatalf("GetKeyInfo error: %s", err)
+	}
+	if info.FirstSeen.IsZero() || info.LastVerified.Before(info.FirstSeen) {
+		t.Errorf("Unexpected timestamps: first seen %s, last verified %s", info.FirstSeen, info.LastVerified)
+	}
+
+	if err := c.DeleteHost("info.test"); err != nil {
+		t.Fatalf("DeleteHost error: %s", err)
+	}
+	if _, err := c.GetKeyInfo("info.test"); !errors.Is(err, ErrPubkeyNotFound) {
+		t.Errorf("Expected ErrPubkeyNotFound after DeleteHost, got %v", err)
+	}
+
+	if _, err := (Client{}).ListHosts(); !errors.Is(err, ErrNoKeyStore) {
+		t.Errorf("Expected ErrNoKeyStore, got %v", err)
+	}
+}
+
+func TestClientIDNHost(t *testing.T) {
+	mt := &MemoryTransport{}
+	mt.Register("xn--bcher-kva.test", newTenant(t, "bücher.test", &Descriptor{ID: "main", Username: "user", DisplayName: "User"}))
+
+	c := mt.Client()
+	for _, acct := range []string{"user@bücher.test", "user@Bücher.test", "user@xn--bcher-kva.test"} {
+		if _, err := c.Lookup(acct); err != nil {
+			t.Fatalf("Lookup error: %s", err)
+		}
+	}
+
+	hosts, err := c.ListHosts()
+	if err != nil {
+		t.Fatalf("ListHosts error: %s", err)
+	}
+	if !reflect.DeepEqual(hosts, []string{"xn--bcher-kva.test"}) {
+		t.Errorf("Unexpected hosts: %q", hosts)
+	}
+
+	if _, err := c.GetKeyInfo("bücher.test"); err != nil {
+		t.Errorf("GetKeyInfo error: %s", err)
+	}
+
+	if err := c.QuarantineHost("Bücher.test"); err != nil {
+		t.Fatalf("QuarantineHost error: %s", err)
+	}
+	if _, err := c.Lookup("user@xn--bcher-kva.test"); !errors.Is(err, ErrHostQuarantined) {
+		t.Fatalf("Expected ErrHostQuarantined, got %v", err)
+	}
+	if err := c.ClearQuarantine("xn--bcher-kva.test"); err != nil {
+		t.Fatalf("ClearQuarantine error: %s", err)
+	}
+	if _, err := c.Lookup("user@bücher.test"); err != nil {
+		t.Errorf("Lookup error after clearing quarantine: %s", err)
+	}
+}
@@ -0,0 +1,163 @@
+package profilefed
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// LocationNamespace is the namespace of the location extra.
+	// See [Descriptor.AddLocation].
+	LocationNamespace = "https://queerdevs.org/profilefed/ns/location"
+	// LocationExtraType is the type of the location extra.
+	LocationExtraType = "location"
+
+	// MaxGeohashPrecision is the maximum number of geohash characters a
+	// location may contain. Five characters correspond to a cell that's
+	// roughly 5 km wide, which is enough for maps without revealing
+	// where someone lives.
+	MaxGeohashPrecision = 5
+
+	// maxPlaceLength is the maximum length of a place name, in characters.
+	maxPlaceLength = 100
+)
+
+// geohashAlphabet is the base32 alphabet used by geohashes.
+const geohashAlphabet = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// ErrInvalidLocation signifies that a location contains invalid values.
+var ErrInvalidLocation = errors.New("invalid location")
+
+// Location is the data of a location extra. Every field is optional.
+type Location struct {
+	// Place is a free-form place name, such as "Berlin".
+	Place string `json:"place,omitempty"`
+	// Country is an ISO 3166-1 alpha-2 country code, such as DE.
+	Country string `json:"country,omitempty"`
+	// Geohash is a coarse geohash of the location, with at
+	// most [MaxGeohashPrecision] characters.
+	Geohash string `json:"geohash,omitempty"`
+}
+
+// Validate returns an error wrapping [ErrInvalidLocation]
+// if any of the location's fields are invalid.
+func (l Location) Validate() error {
+	if utf8.RuneCountInString(l.Place) > maxPlaceLength || strings.ContainsFunc(l.Place, unicode.IsControl) {
+		return fmt.Errorf("%w: place is too long or contains control characters", ErrInvalidLocation)
+	}
+
+	if l.Country != "" && !isCountryCode(l.Country) {
+		return fmt.Errorf("%w: %q is not an iso 3166-1 alpha-2 country code", ErrInvalidLocation, l.Country)
+	}
+
+	if len(l.Geohash) > MaxGeohashPrecision {
+		return fmt.Errorf("%w: geohash is more precise than %d characters", ErrInvalidLocation, MaxGeohashPrecision)
+	}
+
+	for _, char := range l.Geohash {
+		if !strings.ContainsRune(geohashAlphabet, char) {
+			return fmt.Errorf("%w: invalid geohash character %q", ErrInvalidLocation, char)
+		}
+	}
+
+	return nil
+}
+
+// isCountryCode reports whether code consists of two upper-case ASCII letters.
+func isCountryCode(code string) bool {
+	return len(code) == 2 &&
+		code[0] >= 'A' && code[0] <= 'Z' &&
+		code[1] >= 'A' && code[1] <= 'Z'
+}
+
+// LocationPolicy controls how precisely a location is published.
+// The zero value publishes the place and country, but no geohash.
+type LocationPolicy struct {
+	// HidePlace prevents the place name from being published.
+	HidePlace bool
+	// HideCountry prevents the country from being published.
+	HideCountry bool
+	// GeohashPrecision is the number of geohash characters that are published.
+	// If it's zero, no geohash is published. It's capped at [MaxGeohashPrecision].
+	GeohashPrecision int
+}
+
+// Apply returns the location to publish for the user's location loc,
+// whose geohash may be more precise than what's published.
+func (lp LocationPolicy) Apply(loc Location) Location {
+	if lp.HidePlace {
+		loc.Place = ""
+	}
+
+	if lp.HideCountry {
+		loc.Country = ""
+	}
+
+	precision := min(lp.GeohashPrecision, MaxGeohashPrecision, len(loc.Geohash))
+	loc.Geohash = loc.Geohash[:max(precision, 0)]
+	return loc
+}
+
+// Geohash encodes the given coordinates as a geohash with the given number of
+// characters. The precision is capped at [MaxGeohashPrecision].
+func Geohash(lat, lon float64, precision int) string {
+	precision = min(precision, MaxGeohashPrecision)
+
+	latRange := [2]float64{-90, 90}
+	lonRange := [2]float64{-180, 180}
+
+	var sb strings.Builder
+	bits, idx, even := 0, 0, true
+	for sb.Len() < precision {
+		// Even bits encode the longitude, odd bits encode the latitude
+		val, rng := lon, &lonRange
+		if !even {
+			val, rng = lat, &latRange
+		}
+
+		mid := (rng[0] + rng[1]) / 2
+		idx <<= 1
+		if val >= mid {
+			idx |= 1
+			rng[0] = mid
+		} else {
+			rng[1] = mid
+		}
+		even = !even
+
+		if bits++; bits == 5 {
+			sb.WriteByte(geohashAlphabet[idx])
+			bits, idx = 0, 0
+		}
+	}
+	return sb.String()
+}
+
+// AddLocation is a convenience function that adds a location extra to the
+// descriptor. It returns an error if the location is invalid.
+func (d *Descriptor) AddLocation(loc Location) error {
+	if err := loc.Validate(); err != nil {
+		return err
+	}
+	return d.AddExtra(LocationNamespace, LocationExtraType, loc)
+}
+
+// Location returns the location published in the descriptor's location extra,
+// if it has a valid one.
+func (d *Descriptor) Location() (*Location, bool) {
+	for _, extra := range d.Extra {
+		if extra.Namespace != LocationNamespace || extra.Type != LocationExtraType {
+			continue
+		}
+
+		loc := &Location{}
+		if err := json.Unmarshal(extra.Data, loc); err == nil && loc.Validate() == nil {
+			return loc, true
+		}
+	}
+	return nil, false
+}
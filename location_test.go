@@ -0,0 +1,41 @@
+package profilefed
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestLocation(t *testing.T) {
+	// Berlin, whose full geohash starts with u33dc
+	hash := Geohash(52.52, 13.405, 7)
+	if hash != "u33dc" {
+		t.Fatalf("Unexpected geohash: %q", hash)
+	}
+
+	loc := LocationPolicy{GeohashPrecision: 3}.Apply(Location{Place: "Berlin", Country: "DE", Geohash: hash})
+	expected := Location{Place: "Berlin", Country: "DE", Geohash: "u33"}
+	if loc != expected {
+		t.Errorf("Locations are not equal:\n%#v\n\n%#v", loc, expected)
+	}
+
+	desc := &Descriptor{ID: "main"}
+	if err := desc.AddLocation(loc); err != nil {
+		t.Fatalf("AddLocation error: %s", err)
+	}
+
+	got, ok := desc.Location()
+	if !ok || !reflect.DeepEqual(*got, expected) {
+		t.Errorf("Locations are not equal:\n%#v\n\n%#v", got, expected)
+	}
+
+	for _, invalid := range []Location{
+		{Country: "Germany"},
+		{Geohash: "u33dc8"},
+		{Geohash: "u3a"},
+	} {
+		if err := desc.AddLocation(invalid); !errors.Is(err, ErrInvalidLocation) {
+			t.Errorf("Expected ErrInvalidLocation for %#v, got %v", invalid, err)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package profilefed
+
+import (
+	"context"
+	"sync"
+
+	"queerdevs.org/profilefed/webfinger"
+)
+
+// DefaultLookupConcurrency is the number of concurrent lookups made
+// by [Client.LookupMany] if the Concurrency option is zero.
+const DefaultLookupConcurrency = 8
+
+// LookupManyOptions configures [Client.LookupMany].
+type LookupManyOptions struct {
+	// Concurrency is the maximum number of lookups in flight at once.
+	// If it's zero, [DefaultLookupConcurrency] is used.
+	Concurrency int
+}
+
+// LookupResult is the result of looking up a single resource using [Client.LookupMany].
+type LookupResult struct {
+	// Resource is the resource that was looked up.
+	Resource string
+	// Descriptor is the resource's descriptor, if the lookup succeeded.
+	Descriptor *Descriptor
+	// Err is the error the lookup failed with, if any.
+	Err error
+}
+
+// LookupMany looks up the descriptors of many accounts concurrently, the same
+// way as [Client.Lookup], and returns a result for every resource, in the same
+// order. Duplicate resources are only looked up once, and only one lookup per
+// server is made until the server's key is pinned, so that its server info is
+// only fetched once. If ctx is canceled, lookups that haven't started yet
+// fail with the context's error.
+func (c Client) LookupMany(ctx context.Context, resources []string, opts LookupManyOptions) []LookupResult {
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultLookupConcurrency
+	}
+
+	type job struct {
+		resource string
+		// ready is closed once the first lookup for the resource's server is done.
+		// Leaders close it, while followers wait for it to be closed.
+		ready  chan struct{}
+		leader bool
+	}
+
+	// Leaders are queued before followers, so that followers never
+	// occupy every worker while their leaders are still waiting.
+	var leaders, followers []job
+	hosts := map[string]chan struct{}{}
+	seen := map[string]bool{}
+	for _, res := range resources {
+		if seen[res] {
+			continue
+		}
+		seen[res] = true
+
+		host := lookupHost(res)
+		if ready, ok := hosts[host]; ok && host != "" {
+			followers = append(followers, job{resource: res, ready: ready})
+			continue
+		}
+
+		ready := make(chan struct{})
+		hosts[host] = ready
+		leaders = append(leaders, job{resource: res, ready: ready, leader: true})
+	}
+
+	var (
+		wg      sync.WaitGroup
+		mtx     sync.Mutex
+		results = make(map[string]LookupResult, len(seen))
+		jobs    = make(chan job)
+	)
+	for range concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				result := LookupResult{Resource: j.resource}
+				if j.leader {
+					result.Descriptor, result.Err = c.lookupContext(ctx, j.resource)
+					close(j.ready)
+				} else {
+					select {
+					case <-j.ready:
+						result.Descriptor, result.Err = c.lookupContext(ctx, j.resource)
+					case <-ctx.Done():
+						result.Err = ctx.Err()
+					}
+				}
+
+				mtx.Lock()
+				results[j.resource] = result
+				mtx.Unlock()
+			}
+		}()
+	}
+
+	for _, j := range append(leaders, followers...) {
+		jobs <- j
+	}
+	close(jobs)
+	wg.Wait()
+
+	out := make([]LookupResult, len(resources))
+	for i, res := range resources {
+		out[i] = results[res]
+	}
+	return out
+}
+
+// lookupContext looks up resource using [Client.Lookup],
+// unless ctx has already been canceled.
+func (c Client) lookupContext(ctx context.Context, resource string) (*Descriptor, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.Lookup(resource)
+}
+
+// lookupHost returns the server of the account resource the same way
+// [Client.Lookup] does. It's empty if the resource doesn't contain one.
+func lookupHost(resource string) string {
+	acct, err := webfinger.ParseAcct(resource)
+	if err != nil {
+		return ""
+	}
+	return acct.Host
+}
@@ -0,0 +1,69 @@
+package profilefed
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+// serverInfoCounter is an [http.RoundTripper] that counts server info requests per host.
+type serverInfoCounter struct {
+	transport http.RoundTripper
+	mtx       sync.Mutex
+	counts    map[string]int
+}
+
+func (sic *serverInfoCounter) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Path == "/_profilefed/server" {
+		sic.mtx.Lock()
+		sic.counts[req.URL.Host]++
+		sic.mtx.Unlock()
+	}
+	return sic.transport.RoundTrip(req)
+}
+
+func TestClientLookupMany(t *testing.T) {
+	mt := &MemoryTransport{}
+	for _, host := range []string{"a.test", "b.test"} {
+		mt.Register(host, newTenant(t, host, &Descriptor{ID: "main", Username: "user", DisplayName: host}))
+	}
+
+	sic := &serverInfoCounter{transport: mt, counts: map[string]int{}}
+	c := mt.Client()
+	c.HTTPClient = &http.Client{Transport: sic}
+
+	resources := []string{"one@a.test", "two@a.test", "one@b.test", "three@a.test", "one@a.test", "one@unknown.test"}
+	results := c.LookupMany(context.Background(), resources, LookupManyOptions{Concurrency: 4})
+
+	if len(results) != len(resources) {
+		t.Fatalf("Expected %d results, got %d", len(resources), len(results))
+	}
+
+	for i, result := range results[:5] {
+		if result.Resource != resources[i] || result.Err != nil {
+			t.Fatalf("Unexpected result for %s: %#v", resources[i], result)
+		}
+	}
+
+	if results[2].Descriptor.DisplayName != "b.test" {
+		t.Errorf("Unexpected descriptor for %s: %#v", resources[2], results[2].Descriptor)
+	}
+
+	if !errors.Is(results[5].Err, ErrUnknownHost) {
+		t.Errorf("Expected ErrUnknownHost, got %v", results[5].Err)
+	}
+
+	if sic.counts["a.test"] != 1 || sic.counts["b.test"] != 1 {
+		t.Errorf("Expected server info to be fetched once per host, got %v", sic.counts)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, result := range c.LookupMany(ctx, resources, LookupManyOptions{}) {
+		if !errors.Is(result.Err, context.Canceled) {
+			t.Errorf("Expected context.Canceled, got %v", result.Err)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package mastodon
+
+import (
+	"html"
+	"strings"
+)
+
+// textToHTML converts plain text to HTML the way Mastodon formats notes,
+// with paragraphs separated by blank lines and line breaks within them.
+func textToHTML(text string) string {
+	text = strings.TrimSpace(strings.ReplaceAll(text, "\r\n", "\n"))
+	if text == "" {
+		return ""
+	}
+
+	var sb strings.Builder
+	for _, para := range strings.Split(text, "\n\n") {
+		para = strings.Trim(para, "\n")
+		if para == "" {
+			continue
+		}
+		sb.WriteString("<p>")
+		sb.WriteString(strings.ReplaceAll(html.EscapeString(para), "\n", "<br />"))
+		sb.WriteString("</p>")
+	}
+	return sb.String()
+}
+
+// htmlToText converts HTML, such as a Mastodon note, to plain text. Paragraphs
+// are separated by blank lines, line breaks are kept, and every other tag is
+// removed.
+func htmlToText(s string) string {
+	var sb strings.Builder
+	for s != "" {
+		start := strings.IndexByte(s, '<')
+		if start < 0 {
+			sb.WriteString(html.UnescapeString(s))
+			break
+		}
+		sb.WriteString(html.UnescapeString(s[:start]))
+
+		end := strings.IndexByte(s[start:], '>')
+		if end < 0 {
+			break
+		}
+		tag := strings.ToLower(strings.Trim(s[start+1:start+end], "/ "))
+		name, _, _ := strings.Cut(tag, " ")
+		switch name {
+		case "br":
+			sb.WriteByte('\n')
+		case "p":
+			if s[start+1] == '/' {
+				sb.WriteString("\n\n")
+			}
+		}
+		s = s[start+end+1:]
+	}
+	return strings.TrimSpace(sb.String())
+}
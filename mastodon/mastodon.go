@@ -0,0 +1,269 @@
+// Package mastodon converts between ProfileFed descriptors and the account
+// entity of the Mastodon client API, for apps that bridge the two.
+//
+// The conversions are best-effort, since neither format can represent
+// everything the other one can. Everything that couldn't be converted is
+// reported as a [Loss], so that apps can decide whether to show it some
+// other way or warn the user.
+package mastodon
+
+import (
+	"html"
+	"strconv"
+	"strings"
+	"time"
+
+	"queerdevs.org/profilefed"
+)
+
+// Account is an account entity of the Mastodon client API.
+type Account struct {
+	ID             string        `json:"id"`
+	Username       string        `json:"username"`
+	Acct           string        `json:"acct"`
+	URL            string        `json:"url"`
+	URI            string        `json:"uri,omitempty"`
+	DisplayName    string        `json:"display_name"`
+	Note           string        `json:"note"`
+	Avatar         string        `json:"avatar"`
+	AvatarStatic   string        `json:"avatar_static"`
+	Header         string        `json:"header"`
+	HeaderStatic   string        `json:"header_static"`
+	Locked         bool          `json:"locked"`
+	Fields         []Field       `json:"fields"`
+	Emojis         []CustomEmoji `json:"emojis"`
+	Bot            bool          `json:"bot"`
+	Group          bool          `json:"group"`
+	Discoverable   *bool         `json:"discoverable"`
+	CreatedAt      string        `json:"created_at"`
+	LastStatusAt   *string       `json:"last_status_at"`
+	StatusesCount  int64         `json:"statuses_count"`
+	FollowersCount int64         `json:"followers_count"`
+	FollowingCount int64         `json:"following_count"`
+}
+
+// Field is a profile metadata field of an [Account].
+type Field struct {
+	Name string `json:"name"`
+	// Value is the HTML value of the field.
+	Value      string  `json:"value"`
+	VerifiedAt *string `json:"verified_at"`
+}
+
+// CustomEmoji is a custom emoji used in an [Account]'s display name, note, or fields.
+type CustomEmoji struct {
+	Shortcode       string `json:"shortcode"`
+	URL             string `json:"url"`
+	StaticURL       string `json:"static_url"`
+	VisibleInPicker bool   `json:"visible_in_picker"`
+}
+
+// Loss describes information that was lost in a conversion.
+type Loss struct {
+	// Field is the name of the field in the source format, such as
+	// content_warning or fields[2]. Extras are named after their
+	// namespace and type, such as extra:https://example.com/ns#type.
+	Field string
+	// Reason describes why the field couldn't be converted.
+	Reason string
+}
+
+// Well-known names of Mastodon profile metadata fields,
+// which are converted to the equivalent descriptor data.
+const (
+	pronounsField = "Pronouns"
+	locationField = "Location"
+)
+
+// ToAccount converts desc to a Mastodon account with the given acct, such as
+// user@example.com. The bio is converted to HTML, the pronouns and location
+// place name are converted to profile metadata fields, and the stats extra is
+// converted to the account's counts and creation date. The linked ActivityPub
+// actor, if any, is used as the account's URL and URI.
+func ToAccount(desc *profilefed.Descriptor, acct string) (*Account, []Loss) {
+	acc := &Account{
+		ID:           desc.ID,
+		Username:     desc.Username,
+		Acct:         acct,
+		DisplayName:  desc.DisplayName,
+		Note:         textToHTML(desc.Bio),
+		Avatar:       desc.AvatarURL,
+		AvatarStatic: desc.AvatarURL,
+		Header:       desc.BannerURL,
+		HeaderStatic: desc.BannerURL,
+		Fields:       []Field{},
+		Emojis:       []CustomEmoji{},
+	}
+
+	var losses []Loss
+	lose := func(field, reason string) {
+		losses = append(losses, Loss{Field: field, Reason: reason})
+	}
+
+	if desc.Pronouns != "" {
+		acc.Fields = append(acc.Fields, Field{Name: pronounsField, Value: html.EscapeString(desc.Pronouns)})
+	}
+
+	if actor, ok := desc.Actor(); ok {
+		acc.URL, acc.URI = actor, actor
+	}
+
+	if loc, ok := desc.Location(); ok {
+		if loc.Place != "" {
+			acc.Fields = append(acc.Fields, Field{Name: locationField, Value: html.EscapeString(loc.Place)})
+		}
+		if loc.Country != "" || loc.Geohash != "" {
+			lose(extraName(profilefed.LocationNamespace, profilefed.LocationExtraType), "Mastodon accounts only have a free-form location field, so only the place name is kept")
+		}
+	}
+
+	if stats, ok := desc.Stats(); ok {
+		acc.FollowersCount = statCount(stats.Followers, "followers", lose)
+		acc.FollowingCount = statCount(stats.Following, "following", lose)
+		acc.StatusesCount = statCount(stats.Posts, "posts", lose)
+
+		switch len(stats.Joined) {
+		case len("2006-01-02"):
+			acc.CreatedAt = stats.Joined + "T00:00:00.000Z"
+		case len("2006-01"):
+			acc.CreatedAt = stats.Joined + "-01T00:00:00.000Z"
+			lose("stats.joined", "the join month is published as the first day of the month")
+		}
+
+		if stats.LastActive != "" {
+			lose("stats.last_active", "Mastodon accounts only have an exact last status date")
+		}
+	}
+
+	for _, extra := range desc.Extra {
+		switch {
+		case extra.Namespace == profilefed.ActivityPubNamespace && extra.Type == profilefed.ActorExtraType,
+			extra.Namespace == profilefed.LocationNamespace && extra.Type == profilefed.LocationExtraType,
+			extra.Namespace == profilefed.StatsNamespace && extra.Type == profilefed.StatsExtraType:
+			continue
+		}
+		lose(extraName(extra.Namespace, extra.Type), "extra has no Mastodon equivalent")
+	}
+
+	if desc.Role != "" && desc.Role != profilefed.RoleUser {
+		lose("role", "Mastodon roles are specific to the server the client is connected to")
+	}
+	if desc.DID != "" {
+		lose("did", "Mastodon accounts can't be anchored to a DID")
+	}
+	if desc.AvatarAlt != "" {
+		lose("avatar_alt", "Mastodon accounts have no text alternative for the avatar")
+	}
+	if desc.BannerAlt != "" {
+		lose("banner_alt", "Mastodon accounts have no text alternative for the header")
+	}
+	if desc.ContentWarning != "" {
+		lose("content_warning", "Mastodon accounts can't have a content warning")
+	}
+	if desc.Sensitive || desc.AvatarSensitive || desc.BannerSensitive {
+		lose("sensitive", "Mastodon accounts can't mark their media as sensitive")
+	}
+	if desc.Audience != "" && desc.Audience != profilefed.AudienceGeneral {
+		lose("audience", "Mastodon accounts have no audience rating")
+	}
+
+	return acc, losses
+}
+
+// FromAccount converts a Mastodon account to a descriptor. The note and field
+// values are converted to plain text, the pronouns and location fields are
+// converted to the equivalent descriptor data, and the counts and dates are
+// converted to a stats extra. The account's URI, or its URL if it has none,
+// is added as the descriptor's ActivityPub actor.
+func FromAccount(acc *Account) (*profilefed.Descriptor, []Loss) {
+	desc := &profilefed.Descriptor{
+		ID:          acc.ID,
+		Username:    acc.Username,
+		DisplayName: acc.DisplayName,
+		Bio:         htmlToText(acc.Note),
+		AvatarURL:   acc.Avatar,
+		BannerURL:   acc.Header,
+	}
+
+	var losses []Loss
+	lose := func(field, reason string) {
+		losses = append(losses, Loss{Field: field, Reason: reason})
+	}
+
+	if actor := acc.URI; actor != "" || acc.URL != "" {
+		if actor == "" {
+			actor = acc.URL
+		}
+		desc.AddActor(actor)
+	}
+
+	for i, field := range acc.Fields {
+		name := "fields[" + strconv.Itoa(i) + "]"
+		switch {
+		case strings.EqualFold(field.Name, pronounsField) && desc.Pronouns == "":
+			desc.Pronouns = htmlToText(field.Value)
+		case strings.EqualFold(field.Name, locationField):
+			if err := desc.AddLocation(profilefed.Location{Place: htmlToText(field.Value)}); err != nil {
+				lose(name, err.Error())
+				continue
+			}
+		default:
+			lose(name, "profile metadata fields have no ProfileFed equivalent")
+			continue
+		}
+
+		if field.VerifiedAt != nil {
+			lose(name+".verified_at", "link verification isn't carried over")
+		}
+	}
+
+	raw := profilefed.RawStats{
+		Followers: acc.FollowersCount,
+		Following: acc.FollowingCount,
+		Posts:     acc.StatusesCount,
+	}
+	if created, err := time.Parse(time.RFC3339, acc.CreatedAt); err == nil {
+		raw.Joined = created
+	}
+	if acc.LastStatusAt != nil {
+		if last, err := time.Parse(time.DateOnly, *acc.LastStatusAt); err == nil {
+			raw.LastActive = last
+			lose("last_status_at", "the last status date is published as an activity bucket")
+		}
+	}
+	desc.AddStats(profilefed.StatsPolicy{}.Apply(raw, time.Now()))
+
+	if len(acc.Emojis) > 0 {
+		lose("emojis", "custom emoji are left as shortcodes")
+	}
+	if acc.Locked {
+		lose("locked", "ProfileFed has no follow approval")
+	}
+	if acc.Bot {
+		lose("bot", "ProfileFed can't mark automated accounts")
+	}
+	if acc.Group {
+		lose("group", "ProfileFed can't mark group accounts")
+	}
+	if acc.Discoverable != nil {
+		lose("discoverable", "ProfileFed has no discoverability setting")
+	}
+
+	return desc, losses
+}
+
+// extraName returns the name of an extra used in a [Loss].
+func extraName(namespace, etype string) string {
+	return "extra:" + namespace + "#" + etype
+}
+
+// statCount returns the count in sc, reporting bucketed counts as a loss.
+func statCount(sc *profilefed.StatCount, name string, lose func(field, reason string)) int64 {
+	if sc == nil {
+		return 0
+	}
+	if sc.Bucketed {
+		lose("stats."+name, "the bucketed count is published as an exact count")
+	}
+	return sc.Count
+}
@@ -0,0 +1,79 @@
+package mastodon
+
+import (
+	"reflect"
+	"testing"
+
+	"queerdevs.org/profilefed"
+)
+
+func TestRoundTrip(t *testing.T) {
+	desc := &profilefed.Descriptor{
+		ID:             "main",
+		Username:       "alice",
+		DisplayName:    "Alice",
+		Bio:            "Hi <3\nI write Go.\n\nShe/her",
+		AvatarURL:      "https://example.com/avatar.png",
+		AvatarAlt:      "A cat",
+		Pronouns:       "she/her",
+		ContentWarning: "spoilers",
+	}
+	if err := desc.AddActor("https://example.com/users/alice"); err != nil {
+		t.Fatalf("AddActor error: %s", err)
+	}
+	if err := desc.AddLocation(profilefed.Location{Place: "Berlin", Country: "DE"}); err != nil {
+		t.Fatalf("AddLocation error: %s", err)
+	}
+	stats := profilefed.Stats{
+		Followers: &profilefed.StatCount{Count: 50, Bucketed: true},
+		Following: &profilefed.StatCount{Count: 12},
+		Posts:     &profilefed.StatCount{Count: 345},
+		Joined:    "2022-11-07",
+	}
+	if err := desc.AddStats(stats); err != nil {
+		t.Fatalf("AddStats error: %s", err)
+	}
+
+	acc, losses := ToAccount(desc, "alice@example.com")
+	if acc.Note != "<p>Hi &lt;3<br />I write Go.</p><p>She/her</p>" {
+		t.Errorf("Unexpected note: %q", acc.Note)
+	}
+	if acc.URI != "https://example.com/users/alice" || acc.CreatedAt != "2022-11-07T00:00:00.000Z" || acc.FollowersCount != 50 {
+		t.Errorf("Unexpected account: %#v", acc)
+	}
+
+	var lost []string
+	for _, loss := range losses {
+		lost = append(lost, loss.Field)
+	}
+	expected := []string{
+		"extra:" + profilefed.LocationNamespace + "#" + profilefed.LocationExtraType,
+		"stats.followers",
+		"avatar_alt",
+		"content_warning",
+	}
+	if !reflect.DeepEqual(lost, expected) {
+		t.Errorf("Losses are not equal:\n%#v\n\n%#v", lost, expected)
+	}
+
+	acc.Fields = append(acc.Fields, Field{Name: "Website", Value: `<a href="https://example.com">example.com</a>`})
+	got, losses := FromAccount(acc)
+	if len(losses) != 1 || losses[0].Field != "fields[2]" {
+		t.Errorf("Unexpected losses: %#v", losses)
+	}
+
+	if got.Bio != desc.Bio || got.Pronouns != desc.Pronouns || got.AvatarURL != desc.AvatarURL {
+		t.Errorf("Unexpected descriptor: %#v", got)
+	}
+	if actor, _ := got.Actor(); actor != "https://example.com/users/alice" {
+		t.Errorf("Unexpected actor: %q", actor)
+	}
+	if loc, ok := got.Location(); !ok || loc.Place != "Berlin" {
+		t.Errorf("Unexpected location: %#v", loc)
+	}
+
+	stats.Followers.Bucketed = false
+	if gotStats, ok := got.Stats(); !ok || !reflect.DeepEqual(*gotStats, stats) {
+		t.Errorf("Stats are not equal:\n%#v\n\n%#v", gotStats, stats)
+	}
+}
@@ -0,0 +1,162 @@
+package profilefed
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+)
+
+const (
+	// MembershipNamespace is the namespace of the membership extras.
+	MembershipNamespace = "https://queerdevs.org/profilefed/ns/memberships"
+	// MembershipExtraType is the type of the extra a profile uses to declare
+	// its membership in an organization. See [Descriptor.AddMembership].
+	MembershipExtraType = "membership"
+	// MemberExtraType is the type of the extra an organization's profile
+	// uses to list one of its members. See [Descriptor.AddMember].
+	MemberExtraType = "member"
+)
+
+var (
+	// ErrNoMembership signifies that a profile doesn't declare membership in an organization.
+	ErrNoMembership = errors.New("profile does not declare membership in organization")
+	// ErrMembershipNotListed signifies that an organization doesn't list a profile as a member.
+	ErrMembershipNotListed = errors.New("organization does not list profile as member")
+	// ErrInvalidMembershipSignature signifies that a membership's signature doesn't
+	// match the owner key of the organization's profile.
+	ErrInvalidMembershipSignature = errors.New("membership signature does not match organization owner key")
+)
+
+// Membership is the data of a membership extra.
+type Membership struct {
+	// Org is the resource of the organization's profile, such as acct:org@example.com.
+	Org string `json:"org"`
+	// Role is the member's role in the organization, such as maintainer.
+	Role string `json:"role,omitempty"`
+	// Signature, if set, is an attestation of the membership by the
+	// owner of the organization's profile. See [SignMembership].
+	Signature []byte `json:"sig,omitempty"`
+}
+
+// Member is the data of a member extra.
+type Member struct {
+	// Member is the resource of the member's profile, such as acct:user@example.com.
+	Member string `json:"member"`
+	// Role is the member's role in the organization, such as maintainer.
+	Role string `json:"role,omitempty"`
+}
+
+// AddMembership is a convenience function that declares
+// the profile's membership in an organization.
+func (d *Descriptor) AddMembership(m Membership) error {
+	return d.AddExtra(MembershipNamespace, MembershipExtraType, m)
+}
+
+// Memberships returns the organization memberships declared by the profile.
+func (d *Descriptor) Memberships() []Membership {
+	var out []Membership
+	for _, extra := range d.Extra {
+		if extra.Namespace != MembershipNamespace || extra.Type != MembershipExtraType {
+			continue
+		}
+
+		var m Membership
+		if err := json.Unmarshal(extra.Data, &m); err == nil && m.Org != "" {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// AddMember is a convenience function that lists a member
+// of the organization whose profile this is.
+func (d *Descriptor) AddMember(m Member) error {
+	return d.AddExtra(MembershipNamespace, MemberExtraType, m)
+}
+
+// Members returns the members listed by the organization's profile.
+func (d *Descriptor) Members() []Member {
+	var out []Member
+	for _, extra := range d.Extra {
+		if extra.Namespace != MembershipNamespace || extra.Type != MemberExtraType {
+			continue
+		}
+
+		var m Member
+		if err := json.Unmarshal(extra.Data, &m); err == nil && m.Member != "" {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// SignMembership returns an attestation that member is a member of org, signed
+// using priv, which should be the owner key of the organization's profile (see
+// [Descriptor.SignOwner]). Members can include it in their [Membership], so
+// that the membership can be verified even if the organization's server is
+// compromised.
+func SignMembership(priv ed25519.PrivateKey, member, org string) []byte {
+	return ed25519.Sign(priv, membershipData(member, org))
+}
+
+// membershipData returns the data signed by [SignMembership].
+func membershipData(member, org string) []byte {
+	data, _ := json.Marshal([]string{"profilefed-membership", member, org})
+	return data
+}
+
+// VerifiedMembership contains the result of verifying a membership.
+type VerifiedMembership struct {
+	// Org is the resource of the organization's profile.
+	Org string
+	// Role is the member's role, as listed by the organization.
+	Role string
+	// Signed is true if the membership is also signed by
+	// the owner key of the organization's profile.
+	Signed bool
+}
+
+// VerifyMembership verifies that the profile of member, which was looked up
+// for the given resource, is a member of the organization whose profile is at
+// org. Both directions have to match: the member has to declare the membership
+// and the organization has to list the member. If the membership includes a
+// signature, it has to match the owner key of the organization's profile.
+func (c Client) VerifyMembership(member *Descriptor, resource, org string) (*VerifiedMembership, error) {
+	var membership *Membership
+	for _, m := range member.Memberships() {
+		if m.Org == org {
+			membership = &m
+			break
+		}
+	}
+	if membership == nil {
+		return nil, ErrNoMembership
+	}
+
+	orgDesc, err := c.LookupResource(org)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &VerifiedMembership{Org: org}
+	listed := false
+	for _, m := range orgDesc.Members() {
+		if m.Member == resource {
+			out.Role, listed = m.Role, true
+			break
+		}
+	}
+	if !listed {
+		return nil, ErrMembershipNotListed
+	}
+
+	if membership.Signature != nil {
+		ownerKey := orgDesc.ownerKey(nil)
+		if ownerKey == nil || !verify(ownerKey, membershipData(resource, org), membership.Signature) {
+			return nil, ErrInvalidMembershipSignature
+		}
+		out.Signed = true
+	}
+
+	return out, nil
+}
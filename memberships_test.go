@@ -0,0 +1,64 @@
+package profilefed
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"testing"
+)
+
+func TestVerifyMembership(t *testing.T) {
+	_, ownerPriv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey error: %s", err)
+	}
+
+	orgDesc := &Descriptor{ID: "main", Username: "org", DisplayName: "Org"}
+	orgSrv := newTestServer(t, map[string]*Descriptor{"main": orgDesc})
+	org := "acct:org@" + orgSrv.Listener.Addr().String()
+
+	memberDesc := &Descriptor{ID: "main", Username: "user", DisplayName: "User"}
+	memberSrv := newTestServer(t, map[string]*Descriptor{"main": memberDesc})
+	member := "acct:user@" + memberSrv.Listener.Addr().String()
+
+	err = memberDesc.AddMembership(Membership{
+		Org:       org,
+		Signature: SignMembership(ownerPriv, member, org),
+	})
+	if err != nil {
+		t.Fatalf("AddMembership error: %s", err)
+	}
+
+	c := DefaultClient()
+	_, err = c.VerifyMembership(memberDesc, member, org)
+	if !errors.Is(err, ErrMembershipNotListed) {
+		t.Fatalf("Expected ErrMembershipNotListed, got %v", err)
+	}
+
+	if err := orgDesc.AddMember(Member{Member: member, Role: "maintainer"}); err != nil {
+		t.Fatalf("AddMember error: %s", err)
+	}
+
+	// The organization's profile doesn't have an owner signature yet
+	_, err = c.VerifyMembership(memberDesc, member, org)
+	if !errors.Is(err, ErrInvalidMembershipSignature) {
+		t.Fatalf("Expected ErrInvalidMembershipSignature, got %v", err)
+	}
+
+	if err := orgDesc.SignOwner(ownerPriv, "id", "username"); err != nil {
+		t.Fatalf("SignOwner error: %s", err)
+	}
+
+	vm, err := c.VerifyMembership(memberDesc, member, org)
+	if err != nil {
+		t.Fatalf("VerifyMembership error: %s", err)
+	}
+
+	if vm.Role != "maintainer" || !vm.Signed {
+		t.Errorf("Unexpected membership: %#v", vm)
+	}
+
+	_, err = c.VerifyMembership(memberDesc, member, "acct:other@example.com")
+	if !errors.Is(err, ErrNoMembership) {
+		t.Errorf("Expected ErrNoMembership, got %v", err)
+	}
+}
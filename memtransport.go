@@ -0,0 +1,74 @@
+package profilefed
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+)
+
+// ErrUnknownHost signifies that a [MemoryTransport] has no handler for the requested host.
+var ErrUnknownHost = errors.New("no handler registered for host")
+
+// MemoryTransport is an [http.RoundTripper] that routes requests directly to
+// handlers registered for their host, without any network connections. It lets
+// ProfileFed servers federate in-process, such as tenants of a single binary or
+// servers in an integration test, while still signing and verifying every
+// response. The zero value is ready to use.
+type MemoryTransport struct {
+	mtx      sync.RWMutex
+	handlers map[string]http.Handler
+}
+
+// Register makes the transport route requests for host, which may include
+// a port, to h. It replaces any handler previously registered for host.
+func (mt *MemoryTransport) Register(host string, h http.Handler) {
+	mt.mtx.Lock()
+	defer mt.mtx.Unlock()
+
+	if mt.handlers == nil {
+		mt.handlers = map[string]http.Handler{}
+	}
+	mt.handlers[host] = h
+}
+
+// RoundTrip implements the [http.RoundTripper] interface
+func (mt *MemoryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	mt.mtx.RLock()
+	h, ok := mt.handlers[req.URL.Host]
+	mt.mtx.RUnlock()
+
+	if !ok {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, fmt.Errorf("%w: %s", ErrUnknownHost, req.URL.Host)
+	}
+
+	// The request must not be modified, so the handler gets a copy
+	// that looks like it was received by a server.
+	srvReq := req.Clone(req.Context())
+	srvReq.Host = req.URL.Host
+	srvReq.RequestURI = req.URL.RequestURI()
+	srvReq.RemoteAddr = "memory"
+	if srvReq.Body == nil {
+		srvReq.Body = http.NoBody
+	}
+	defer srvReq.Body.Close()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, srvReq)
+
+	res := rec.Result()
+	res.Request = req
+	return res, nil
+}
+
+// Client returns a client that uses the transport for all its requests,
+// with the same configuration as [DefaultClient] otherwise.
+func (mt *MemoryTransport) Client() Client {
+	c := DefaultClient()
+	c.HTTPClient = &http.Client{Transport: mt}
+	return c
+}
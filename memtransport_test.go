@@ -0,0 +1,107 @@
+package profilefed
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"queerdevs.org/profilefed/webfinger"
+)
+
+// newTenant returns a handler that serves ProfileFed for host using the given
+// descriptor. The given functions can modify the descriptor handler.
+func newTenant(t *testing.T, host string, desc *Descriptor, opts ...func(*Handler)) http.Handler {
+	t.Helper()
+
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey error: %s", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/.well-known/webfinger", webfinger.Handler{
+		DescriptorFunc: func(resource string) (*webfinger.Descriptor, error) {
+			return &webfinger.Descriptor{
+				Subject: resource,
+				Links: []webfinger.Link{{
+					Rel:  "self",
+					Type: "application/x-pfd+json",
+					Href: "http://" + host + "/pfd/user",
+				}},
+			}, nil
+		},
+	})
+	mux.Handle("/_profilefed/server", ServerInfoHandler{
+		ServerName: host,
+		PublicKey:  pub,
+		PrivateKey: priv,
+	})
+
+	h := Handler{
+		PrivateKey: priv,
+		DescriptorFunc: func(req *Request) (*Descriptor, error) {
+			return desc, nil
+		},
+	}
+	for _, opt := range opts {
+		opt(&h)
+	}
+	mux.Handle("/pfd/user", h)
+	return mux
+}
+
+// tenantMux returns a handler serving WebFinger, the given server info,
+// and the given descriptor handler at /pfd/user for host.
+func tenantMux(host string, sih ServerInfoHandler, h Handler) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle("/.well-known/webfinger", webfinger.Handler{
+		DescriptorFunc: func(resource string) (*webfinger.Descriptor, error) {
+			return &webfinger.Descriptor{
+				Subject: resource,
+				Links: []webfinger.Link{{
+					Rel:  "self",
+					Type: "application/x-pfd+json",
+					Href: "http://" + host + "/pfd/user",
+				}},
+			}, nil
+		},
+	})
+	mux.Handle("/_profilefed/server", sih)
+	mux.Handle("/pfd/user", h)
+	return mux
+}
+
+func TestMemoryTransport(t *testing.T) {
+	alice := &Descriptor{ID: "main", Username: "alice", DisplayName: "Alice"}
+	bob := &Descriptor{ID: "main", Username: "bob", DisplayName: "Bob"}
+
+	mt := &MemoryTransport{}
+	mt.Register("alice.test", newTenant(t, "alice.test", alice))
+	mt.Register("bob.test", newTenant(t, "bob.test", bob))
+
+	c := mt.Client()
+	for acct, expected := range map[string]*Descriptor{"alice@alice.test": alice, "bob@bob.test": bob} {
+		desc, err := c.Lookup(acct)
+		if err != nil {
+			t.Fatalf("Lookup error: %s", err)
+		}
+
+		if !reflect.DeepEqual(desc, expected) {
+			t.Errorf("Descriptors are not equal:\n%#v\n\n%#v", desc, expected)
+		}
+	}
+
+	// Responses signed with a different key than the pinned one must still be rejected
+	mt.Register("alice.test", newTenant(t, "alice.test", alice))
+	_, err := c.Lookup("alice@alice.test")
+	if !errors.Is(err, ErrSignatureMismatch) {
+		t.Errorf("Expected ErrSignatureMismatch, got %v", err)
+	}
+
+	_, err = c.Lookup("carol@carol.test")
+	if !errors.Is(err, ErrUnknownHost) {
+		t.Errorf("Expected ErrUnknownHost, got %v", err)
+	}
+}
@@ -0,0 +1,115 @@
+// Package metrics counts the outcomes of the verification steps taken by
+// ProfileFed clients, segmented by host and by failure reason, so that
+// operators can spot targeted attacks or broken peers.
+//
+// The counters can be served in the Prometheus text exposition format,
+// so they can be scraped without any additional dependencies.
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"queerdevs.org/profilefed"
+)
+
+// Counters counts verification outcomes. It implements [profilefed.MetricsSink],
+// so it can be used as a client's Metrics. The zero value is ready to use.
+//
+// Counters are kept per host, so the number of series grows with the number
+// of servers the client contacts. Set Hostless if that's a problem.
+type Counters struct {
+	// Hostless, if set, disables counting outcomes per host.
+	Hostless bool
+
+	mtx    sync.Mutex
+	counts map[key]uint64
+}
+
+// key identifies a single counter.
+type key struct {
+	host    string
+	outcome profilefed.VerificationOutcome
+}
+
+// Sample is the value of a single counter.
+type Sample struct {
+	// Host is the host the outcomes were observed for. It's
+	// empty if the counters don't count outcomes per host.
+	Host    string
+	Outcome profilefed.VerificationOutcome
+	Count   uint64
+}
+
+// ObserveVerification implements [profilefed.MetricsSink]
+func (c *Counters) ObserveVerification(host string, outcome profilefed.VerificationOutcome) {
+	if c.Hostless {
+		host = ""
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if c.counts == nil {
+		c.counts = map[key]uint64{}
+	}
+	c.counts[key{host, outcome}]++
+}
+
+// Count returns the number of times the given outcome was observed, across all hosts.
+func (c *Counters) Count(outcome profilefed.VerificationOutcome) uint64 {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	var out uint64
+	for k, n := range c.counts {
+		if k.outcome == outcome {
+			out += n
+		}
+	}
+	return out
+}
+
+// Snapshot returns the current values of all the counters,
+// sorted by host and outcome.
+func (c *Counters) Snapshot() []Sample {
+	c.mtx.Lock()
+	out := make([]Sample, 0, len(c.counts))
+	for k, n := range c.counts {
+		out = append(out, Sample{Host: k.host, Outcome: k.outcome, Count: n})
+	}
+	c.mtx.Unlock()
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Host != out[j].Host {
+			return out[i].Host < out[j].Host
+		}
+		return out[i].Outcome < out[j].Outcome
+	})
+	return out
+}
+
+// ServeHTTP serves the counters in the Prometheus text exposition format.
+func (c *Counters) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	res.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintln(res, "# HELP profilefed_client_verifications_total Outcomes of ProfileFed verification steps.")
+	fmt.Fprintln(res, "# TYPE profilefed_client_verifications_total counter")
+	for _, s := range c.Snapshot() {
+		if c.Hostless {
+			fmt.Fprintf(res, "profilefed_client_verifications_total{outcome=%s} %d\n", quoteLabel(string(s.Outcome)), s.Count)
+		} else {
+			fmt.Fprintf(res, "profilefed_client_verifications_total{host=%s,outcome=%s} %d\n", quoteLabel(s.Host), quoteLabel(string(s.Outcome)), s.Count)
+		}
+	}
+}
+
+// labelReplacer escapes label values as required by the exposition format.
+var labelReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// quoteLabel quotes a label value for the exposition format.
+func quoteLabel(s string) string {
+	return `"` + labelReplacer.Replace(s) + `"`
+}
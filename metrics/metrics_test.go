@@ -0,0 +1,37 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"queerdevs.org/profilefed"
+)
+
+func TestCounters(t *testing.T) {
+	c := &Counters{}
+	c.ObserveVerification("b.example.com", profilefed.OutcomeVerified)
+	c.ObserveVerification("a.example.com", profilefed.OutcomeMismatchRotation)
+	c.ObserveVerification("b.example.com", profilefed.OutcomeVerified)
+
+	if n := c.Count(profilefed.OutcomeVerified); n != 2 {
+		t.Errorf("Unexpected count: %d", n)
+	}
+
+	expected := []Sample{
+		{Host: "a.example.com", Outcome: profilefed.OutcomeMismatchRotation, Count: 1},
+		{Host: "b.example.com", Outcome: profilefed.OutcomeVerified, Count: 2},
+	}
+	if snapshot := c.Snapshot(); !reflect.DeepEqual(snapshot, expected) {
+		t.Errorf("Snapshots are not equal:\n%#v\n\n%#v", snapshot, expected)
+	}
+
+	rec := httptest.NewRecorder()
+	c.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	line := `profilefed_client_verifications_total{host="b.example.com",outcome="verified"} 2`
+	if !strings.Contains(rec.Body.String(), line) {
+		t.Errorf("Metrics output doesn't contain %q:\n%s", line, rec.Body.String())
+	}
+}
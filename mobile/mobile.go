@@ -0,0 +1,253 @@
+// Package mobile provides a facade over the ProfileFed client that's suitable
+// for use with gomobile bind, so that native iOS and Android apps can reuse
+// the lookup and verification logic.
+//
+// Only types supported by gomobile are used in the exported API: strings,
+// byte slices, integers, booleans, errors, structs with fields of those
+// types, and interfaces that are implemented by the native app.
+package mobile
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"queerdevs.org/profilefed"
+)
+
+// KeyStore persists server public keys. It has to be implemented by the native app.
+type KeyStore interface {
+	// SavePubkey saves the public key for the given server. The previous names
+	// of the server are separated by newlines, and their keys should be deleted.
+	SavePubkey(serverName, previousNames string, pubkey []byte) error
+	// GetPubkey returns the public key for the given server. If no key
+	// is saved for the server, it should return an empty byte slice.
+	GetPubkey(serverName string) ([]byte, error)
+}
+
+// Cache stores verified descriptor responses. It can optionally be implemented
+// by the native app. Entries are opaque JSON-encoded byte slices.
+type Cache interface {
+	// Get returns the entry stored under key. If there's
+	// no such entry, it should return an empty byte slice.
+	Get(key string) ([]byte, error)
+	// Put stores an entry under key, replacing any existing entry.
+	Put(key string, entry []byte) error
+}
+
+// Client performs ProfileFed lookups.
+type Client struct {
+	client profilefed.Client
+}
+
+// NewClient creates a new client that pins server keys using store.
+func NewClient(store KeyStore) *Client {
+	return &Client{client: profilefed.Client{
+		SavePubkey: func(serverName string, previousNames []string, pubkey ed25519.PublicKey) error {
+			return store.SavePubkey(serverName, strings.Join(previousNames, "\n"), pubkey)
+		},
+		GetPubkey: func(serverName string) (ed25519.PublicKey, error) {
+			pubkey, err := store.GetPubkey(serverName)
+			if err != nil {
+				return nil, err
+			}
+			if len(pubkey) == 0 {
+				return nil, profilefed.ErrPubkeyNotFound
+			}
+			return pubkey, nil
+		},
+		Group:    &profilefed.LookupGroup{},
+		KeyCache: &profilefed.KeyCache{},
+	}}
+}
+
+// SetCache makes the client store verified responses in cache and reuse
+// them for up to maxAgeSeconds. Cached responses are always re-verified
+// against the pinned key before they're used.
+func (c *Client) SetCache(cache Cache, maxAgeSeconds int64) {
+	c.client.Cache = cacheAdapter{cache}
+	c.client.CacheMaxAge = time.Duration(maxAgeSeconds) * time.Second
+}
+
+// SetRequireHTTPS sets whether the client refuses to contact servers over plain HTTP.
+func (c *Client) SetRequireHTTPS(require bool) {
+	c.client.Policy = &profilefed.TransportPolicy{RequireHTTPS: require}
+}
+
+// SetTimeoutSeconds sets the timeout for every request the client makes.
+func (c *Client) SetTimeoutSeconds(timeout int64) {
+	c.client.HTTPClient = &http.Client{Timeout: time.Duration(timeout) * time.Second}
+}
+
+// Lookup looks up the profile descriptor for the given acct resource.
+func (c *Client) Lookup(resource string) (*Descriptor, error) {
+	desc, err := c.client.Lookup(resource)
+	if err != nil {
+		return nil, err
+	}
+	return newDescriptor(desc)
+}
+
+// LookupID looks up the profile descriptor with the given ID for the given acct resource.
+func (c *Client) LookupID(resource, id string) (*Descriptor, error) {
+	desc, err := c.client.LookupID(resource, id)
+	if err != nil {
+		return nil, err
+	}
+	return newDescriptor(desc)
+}
+
+// LookupAll looks up all the profile descriptors for the given acct resource.
+func (c *Client) LookupAll(resource string) (*DescriptorList, error) {
+	descs, err := c.client.LookupAll(resource)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(descs))
+	for id := range descs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	out := &DescriptorList{}
+	for _, id := range ids {
+		desc, err := newDescriptor(descs[id])
+		if err != nil {
+			return nil, err
+		}
+		out.items = append(out.items, desc)
+	}
+	return out, nil
+}
+
+// KeyFingerprint returns the hex-encoded SHA-256 fingerprint of the key pinned
+// for the given server, so that it can be shown to users for verification.
+func (c *Client) KeyFingerprint(serverName string) (string, error) {
+	return c.client.KeyFingerprint(serverName)
+}
+
+// ForgetKey removes the key for the given server from the client's
+// in-memory key cache. It should be called if the native app deletes
+// the key from its keystore.
+func (c *Client) ForgetKey(serverName string) {
+	c.client.KeyCache.Forget(serverName)
+}
+
+// Descriptor represents a verified ProfileFed descriptor.
+type Descriptor struct {
+	ID          string
+	DisplayName string
+	Username    string
+	Bio         string
+	Role        string
+	DID         string
+	AvatarURL   string
+	BannerURL   string
+	Pronouns    string
+	// AvatarAlt and BannerAlt contain the text alternatives for the avatar
+	// and banner, which should be set as their accessibility labels.
+	AvatarAlt string
+	BannerAlt string
+	// ContentWarning is the warning to show instead of the bio and media
+	// until the reader chooses to reveal them.
+	ContentWarning string
+	// BioHidden, AvatarHidden, and BannerHidden are true if the bio, avatar,
+	// or banner should be hidden until the reader chooses to reveal them.
+	BioHidden    bool
+	AvatarHidden bool
+	BannerHidden bool
+	// Audience is the audience rating of the profile, such as adult.
+	Audience string
+	// Namespaces contains the descriptor's namespaces, separated by newlines.
+	Namespaces string
+	// ExtraJSON contains the descriptor's extra data objects as a JSON array.
+	ExtraJSON string
+	// JSON contains the entire descriptor encoded as JSON.
+	JSON string
+}
+
+func newDescriptor(desc *profilefed.Descriptor) (*Descriptor, error) {
+	extra, err := json.Marshal(desc.Extra)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(desc)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Descriptor{
+		ID:             desc.ID,
+		DisplayName:    desc.DisplayName,
+		Username:       desc.Username,
+		Bio:            desc.Bio,
+		Role:           string(desc.Role),
+		DID:            desc.DID,
+		AvatarURL:      desc.AvatarURL,
+		BannerURL:      desc.BannerURL,
+		Pronouns:       desc.Pronouns,
+		AvatarAlt:      desc.AvatarAlt,
+		BannerAlt:      desc.BannerAlt,
+		ContentWarning: desc.ContentWarning,
+		BioHidden:      desc.NeedsReveal("bio"),
+		AvatarHidden:   desc.NeedsReveal("avatar_url"),
+		BannerHidden:   desc.NeedsReveal("banner_url"),
+		Audience:       string(desc.Audience),
+		Namespaces:     strings.Join(desc.Namespaces, "\n"),
+		ExtraJSON:      string(extra),
+		JSON:           string(data),
+	}, nil
+}
+
+// DescriptorList is a list of descriptors, sorted by ID.
+type DescriptorList struct {
+	items []*Descriptor
+}
+
+// Len returns the number of descriptors in the list.
+func (dl *DescriptorList) Len() int {
+	return len(dl.items)
+}
+
+// Get returns the descriptor at index i.
+func (dl *DescriptorList) Get(i int) (*Descriptor, error) {
+	if i < 0 || i >= len(dl.items) {
+		return nil, errors.New("index out of range")
+	}
+	return dl.items[i], nil
+}
+
+// cacheAdapter adapts a native [Cache] to [profilefed.DescriptorCache].
+type cacheAdapter struct {
+	cache Cache
+}
+
+func (ca cacheAdapter) Get(key string) (*profilefed.CacheEntry, error) {
+	data, err := ca.cache.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, profilefed.ErrCacheMiss
+	}
+
+	entry := &profilefed.CacheEntry{}
+	if err := json.Unmarshal(data, entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+func (ca cacheAdapter) Put(key string, entry *profilefed.CacheEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return ca.cache.Put(key, data)
+}
@@ -0,0 +1,187 @@
+package mobile
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"queerdevs.org/profilefed"
+	"queerdevs.org/profilefed/webfinger"
+)
+
+// memKeyStore is an in-memory [KeyStore] like the one a native app would implement.
+type memKeyStore struct {
+	keys          map[string][]byte
+	previousNames map[string]string
+}
+
+func (ks *memKeyStore) SavePubkey(serverName, previousNames string, pubkey []byte) error {
+	ks.keys[serverName] = pubkey
+	ks.previousNames[serverName] = previousNames
+	return nil
+}
+
+func (ks *memKeyStore) GetPubkey(serverName string) ([]byte, error) {
+	// Native apps return an empty slice rather than nil for missing keys
+	if pubkey, ok := ks.keys[serverName]; ok {
+		return pubkey, nil
+	}
+	return []byte{}, nil
+}
+
+// memCache is an in-memory [Cache] like the one a native app would implement.
+type memCache map[string][]byte
+
+func (mc memCache) Get(key string) ([]byte, error) {
+	if entry, ok := mc[key]; ok {
+		return entry, nil
+	}
+	return []byte{}, nil
+}
+
+func (mc memCache) Put(key string, entry []byte) error {
+	mc[key] = entry
+	return nil
+}
+
+// newTestClient returns a client for an in-memory tenant at host that
+// advertises the given previous names, along with a counter of the
+// descriptor requests the tenant served.
+func newTestClient(t *testing.T, host string, previousNames []string) (*Client, *memKeyStore, *atomic.Int32) {
+	t.Helper()
+
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey error: %s", err)
+	}
+
+	requests := &atomic.Int32{}
+	desc := &profilefed.Descriptor{ID: "main", Username: "user", DisplayName: "User"}
+
+	mux := http.NewServeMux()
+	mux.Handle("/.well-known/webfinger", webfinger.Handler{
+		DescriptorFunc: func(resource string) (*webfinger.Descriptor, error) {
+			return &webfinger.Descriptor{
+				Subject: resource,
+				Links: []webfinger.Link{{
+					Rel:  "self",
+					Type: "application/x-pfd+json",
+					Href: "http://" + host + "/pfd/user",
+				}},
+			}, nil
+		},
+	})
+	mux.Handle("/_profilefed/server", profilefed.ServerInfoHandler{
+		ServerName:    host,
+		PreviousNames: previousNames,
+		PublicKey:     pub,
+		PrivateKey:    priv,
+	})
+	mux.Handle("/pfd/user", profilefed.Handler{
+		PrivateKey: priv,
+		DescriptorFunc: func(req *profilefed.Request) (*profilefed.Descriptor, error) {
+			requests.Add(1)
+			return desc, nil
+		},
+	})
+
+	mt := &profilefed.MemoryTransport{}
+	mt.Register(host, mux)
+
+	store := &memKeyStore{keys: map[string][]byte{}, previousNames: map[string]string{}}
+	c := NewClient(store)
+	c.client.HTTPClient = &http.Client{Transport: mt}
+	return c, store, requests
+}
+
+func TestKeyStoreAdapter(t *testing.T) {
+	c, store, _ := newTestClient(t, "new.test", []string{"old.test", "older.test"})
+
+	// An empty slice from the native keystore means there's no key
+	if _, err := c.client.GetPubkey("new.test"); !errors.Is(err, profilefed.ErrPubkeyNotFound) {
+		t.Fatalf("Expected ErrPubkeyNotFound for an empty key, got %v", err)
+	}
+	if _, err := c.KeyFingerprint("new.test"); !errors.Is(err, profilefed.ErrPubkeyNotFound) {
+		t.Fatalf("Expected ErrPubkeyNotFound from KeyFingerprint, got %v", err)
+	}
+
+	desc, err := c.Lookup("user@new.test")
+	if err != nil {
+		t.Fatalf("Lookup error: %s", err)
+	}
+	if desc.Username != "user" || desc.DisplayName != "User" {
+		t.Errorf("Unexpected descriptor: %+v", desc)
+	}
+
+	if len(store.keys["new.test"]) != ed25519.PublicKeySize {
+		t.Fatalf("Expected the key to be saved to the native keystore, got %x", store.keys["new.test"])
+	}
+	if names := store.previousNames["new.test"]; names != "old.test\nolder.test" {
+		t.Errorf("Expected newline-separated previous names, got %q", names)
+	}
+
+	fp, err := c.KeyFingerprint("new.test")
+	if err != nil {
+		t.Fatalf("KeyFingerprint error: %s", err)
+	}
+	if fp != profilefed.FingerprintHex(store.keys["new.test"]) {
+		t.Errorf("Unexpected fingerprint %q", fp)
+	}
+}
+
+func TestCacheAdapter(t *testing.T) {
+	ca := cacheAdapter{memCache{}}
+
+	// An empty slice from the native cache means there's no entry
+	if _, err := ca.Get("missing"); !errors.Is(err, profilefed.ErrCacheMiss) {
+		t.Errorf("Expected ErrCacheMiss for an empty entry, got %v", err)
+	}
+
+	if err := ca.Put("key", &profilefed.CacheEntry{Data: []byte("{}"), Signature: []byte("sig"), ETag: `"etag"`}); err != nil {
+		t.Fatalf("Put error: %s", err)
+	}
+	entry, err := ca.Get("key")
+	if err != nil {
+		t.Fatalf("Get error: %s", err)
+	}
+	if string(entry.Data) != "{}" || string(entry.Signature) != "sig" || entry.ETag != `"etag"` {
+		t.Errorf("Unexpected entry: %+v", entry)
+	}
+
+	ca = cacheAdapter{memCache{"bad": []byte("not json")}}
+	if _, err := ca.Get("bad"); err == nil || errors.Is(err, profilefed.ErrCacheMiss) {
+		t.Errorf("Expected a decoding error for a corrupt entry, got %v", err)
+	}
+}
+
+func TestClientCache(t *testing.T) {
+	c, _, requests := newTestClient(t, "example.test", nil)
+
+	cache := memCache{}
+	c.SetCache(cache, 3600)
+
+	for range 2 {
+		if _, err := c.Lookup("user@example.test"); err != nil {
+			t.Fatalf("Lookup error: %s", err)
+		}
+	}
+
+	if n := requests.Load(); n != 1 {
+		t.Errorf("Expected the second lookup to be served from the cache, got %d requests", n)
+	}
+
+	var found bool
+	for key, entry := range cache {
+		if strings.Contains(string(entry), `"data"`) {
+			found = true
+		} else {
+			t.Errorf("Unexpected cache entry for %s: %s", key, entry)
+		}
+	}
+	if !found {
+		t.Error("Expected the response to be stored in the native cache")
+	}
+}
@@ -0,0 +1,66 @@
+package profilefed
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"net/http"
+)
+
+// PeerIdentity contains the identity of a federating server that
+// authenticated itself using a TLS client certificate.
+type PeerIdentity struct {
+	// CommonName is the subject common name of the client certificate.
+	CommonName string
+	// DNSNames contains the DNS subject alternative names of the certificate.
+	DNSNames []string
+	// URIs contains the URI subject alternative names of the certificate.
+	URIs []string
+	// Fingerprint is the hex-encoded SHA-256 hash of the certificate.
+	Fingerprint string
+	// Certificate is the client certificate itself.
+	Certificate *x509.Certificate
+}
+
+// PeerFromRequest returns the identity of the peer that made the request, if it
+// presented a client certificate that was verified by the server's TLS config.
+// DescriptorFunc implementations can use this to decide what to disclose to a peer.
+func PeerFromRequest(req *http.Request) (*PeerIdentity, bool) {
+	if req.TLS == nil || len(req.TLS.VerifiedChains) == 0 || len(req.TLS.VerifiedChains[0]) == 0 {
+		return nil, false
+	}
+
+	cert := req.TLS.VerifiedChains[0][0]
+	sum := sha256.Sum256(cert.Raw)
+
+	pi := &PeerIdentity{
+		CommonName:  cert.Subject.CommonName,
+		DNSNames:    cert.DNSNames,
+		Fingerprint: hex.EncodeToString(sum[:]),
+		Certificate: cert,
+	}
+	for _, u := range cert.URIs {
+		pi.URIs = append(pi.URIs, u.String())
+	}
+
+	return pi, true
+}
+
+// MutualTLSConfig returns a server TLS config that asks federating servers
+// for client certificates and verifies them against clientCAs. If require
+// is true, clients that don't present a valid certificate are rejected during
+// the handshake. Otherwise, they're served like any other client, and only
+// get the [VisibilityPeer] tier if they present one.
+func MutualTLSConfig(cert tls.Certificate, clientCAs *x509.CertPool, require bool) *tls.Config {
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    clientCAs,
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+		MinVersion:   tls.VersionTLS12,
+	}
+	if require {
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg
+}
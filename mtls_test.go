@@ -0,0 +1,114 @@
+package profilefed
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newClientCert returns a client certificate for cn issued by ca.
+func newClientCert(t *testing.T, ca *x509.Certificate, caKey *ecdsa.PrivateKey, cn string) tls.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Error generating key: %s", err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     []string{cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, key.Public(), caKey)
+	if err != nil {
+		t.Fatalf("CreateCertificate error: %s", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// newMutualTLSServer starts a TLS server using [MutualTLSConfig] that responds
+// with the visibility tier and peer common name of every request.
+func newMutualTLSServer(t *testing.T, clientCAs *x509.CertPool, require bool) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		cn := ""
+		if peer, ok := PeerFromRequest(req); ok {
+			cn = peer.CommonName
+		}
+		res.Write([]byte(string(RequestVisibility(req)) + " " + cn))
+	}))
+
+	// httptest's own certificate is used when none is configured
+	srv.TLS = MutualTLSConfig(tls.Certificate{}, clientCAs, require)
+	srv.TLS.Certificates = nil
+	// Rejected handshakes are expected
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// mutualTLSGet makes a request to srv presenting the given client certificates.
+func mutualTLSGet(srv *httptest.Server, certs ...tls.Certificate) (string, error) {
+	// A new transport is used, so that connections made with
+	// other certificates aren't reused
+	t := srv.Client().Transport.(*http.Transport).Clone()
+	t.TLSClientConfig.Certificates = certs
+
+	res, err := (&http.Client{Transport: t}).Get(srv.URL)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	buf := make([]byte, 128)
+	n, _ := res.Body.Read(buf)
+	return string(buf[:n]), nil
+}
+
+func TestMutualTLS(t *testing.T) {
+	ca, caKey := newTestCA(t)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+
+	otherCA, otherKey := newTestCA(t)
+
+	peer := newClientCert(t, ca, caKey, "peer.example.com")
+	stranger := newClientCert(t, otherCA, otherKey, "stranger.example.com")
+
+	required := newMutualTLSServer(t, pool, true)
+	if _, err := mutualTLSGet(required); err == nil {
+		t.Errorf("Expected request without a client certificate to be rejected")
+	}
+	if _, err := mutualTLSGet(required, stranger); err == nil {
+		t.Errorf("Expected request with an untrusted client certificate to be rejected")
+	}
+	if body, err := mutualTLSGet(required, peer); err != nil || body != "peer peer.example.com" {
+		t.Errorf("Unexpected response for trusted peer: %q, %v", body, err)
+	}
+
+	optional := newMutualTLSServer(t, pool, false)
+	if body, err := mutualTLSGet(optional); err != nil || body != "public " {
+		t.Errorf("Unexpected response without a client certificate: %q, %v", body, err)
+	}
+	if body, err := mutualTLSGet(optional, peer); err != nil || body != "peer peer.example.com" {
+		t.Errorf("Unexpected response for trusted peer: %q, %v", body, err)
+	}
+}
@@ -0,0 +1,114 @@
+package profilefed
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Deprecation describes why an extras namespace is deprecated.
+// See [DeprecateNamespace].
+type Deprecation struct {
+	// ReplacedBy is the namespace that replaces the deprecated one, if any.
+	ReplacedBy string
+	// Message is a human-readable explanation, such as a migration hint.
+	Message string
+}
+
+var (
+	deprecationsMtx sync.RWMutex
+	// deprecations contains the deprecated namespaces, without fragments.
+	deprecations = map[string]Deprecation{}
+)
+
+// DeprecateNamespace marks namespace as deprecated, so that clients warn
+// when they encounter it in a descriptor. The fragment of the namespace
+// URL is ignored, the same way as in [Descriptor.AddExtra].
+func DeprecateNamespace(namespace string, dep Deprecation) {
+	deprecationsMtx.Lock()
+	defer deprecationsMtx.Unlock()
+	deprecations[namespaceKey(namespace)] = dep
+}
+
+// NamespaceDeprecation returns the deprecation registered for namespace
+// using [DeprecateNamespace], if it's deprecated.
+func NamespaceDeprecation(namespace string) (Deprecation, bool) {
+	deprecationsMtx.RLock()
+	defer deprecationsMtx.RUnlock()
+	dep, ok := deprecations[namespaceKey(namespace)]
+	return dep, ok
+}
+
+// NamespaceVersion splits a namespace URL into its base URL and version.
+// Incompatible versions of a namespace are published by appending /v2, /v3,
+// and so on to the URL of the first version, which has no version suffix.
+// The fragment of the namespace URL is ignored.
+func NamespaceVersion(namespace string) (base string, version int) {
+	base = namespaceKey(namespace)
+	i := strings.LastIndex(base, "/v")
+	if i < 0 {
+		return base, 1
+	}
+
+	version, err := strconv.Atoi(base[i+2:])
+	if err != nil || version < 2 {
+		return base, 1
+	}
+	return base[:i], version
+}
+
+// VersionedNamespace returns the URL of the given version of the namespace
+// with the base URL base. It's the inverse of [NamespaceVersion].
+func VersionedNamespace(base string, version int) string {
+	if version <= 1 {
+		return base
+	}
+	return base + "/v" + strconv.Itoa(version)
+}
+
+// namespaceKey returns namespace without its fragment.
+func namespaceKey(namespace string) string {
+	urlStr, _, _ := strings.Cut(namespace, "#")
+	return urlStr
+}
+
+// checkDeprecated reports the deprecated namespaces used by the descriptors in
+// dest, which must be a descriptor or a map of descriptors, to the client's
+// Trace function and event sink. Deprecated namespaces are only warned about,
+// so the descriptors are never rejected.
+func (c Client) checkDeprecated(resource, host string, dest any) {
+	if c.Events == nil && c.Trace == nil {
+		return
+	}
+
+	for _, desc := range destDescriptors(dest) {
+		seen := map[string]bool{}
+		namespaces := slices.Clone(desc.Namespaces)
+		for _, extra := range desc.Extra {
+			namespaces = append(namespaces, extra.Namespace)
+		}
+
+		for _, namespace := range namespaces {
+			namespace = namespaceKey(namespace)
+			if seen[namespace] {
+				continue
+			}
+			seen[namespace] = true
+
+			dep, ok := NamespaceDeprecation(namespace)
+			if !ok {
+				continue
+			}
+
+			c.tracef("descriptor %s uses deprecated namespace %s (replaced by %q): %s", desc.ID, namespace, dep.ReplacedBy, dep.Message)
+			c.emit(KeyEvent{
+				Type:         KeyEventDeprecatedNamespace,
+				ServerName:   host,
+				Resource:     resource,
+				DescriptorID: desc.ID,
+				Namespace:    namespace,
+			})
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package profilefed
+
+import "testing"
+
+func TestNamespaceVersion(t *testing.T) {
+	for namespace, expected := range map[string]struct {
+		base    string
+		version int
+	}{
+		"https://example.com/ns/test":         {"https://example.com/ns/test", 1},
+		"https://example.com/ns/test/v2":      {"https://example.com/ns/test", 2},
+		"https://example.com/ns/test/v3#type": {"https://example.com/ns/test", 3},
+		"https://example.com/ns/test/v1":      {"https://example.com/ns/test/v1", 1},
+		"https://example.com/ns/test/vx":      {"https://example.com/ns/test/vx", 1},
+	} {
+		base, version := NamespaceVersion(namespace)
+		if base != expected.base || version != expected.version {
+			t.Errorf("Expected %s version %d for %s, got %s version %d", expected.base, expected.version, namespace, base, version)
+		}
+		if expected.version > 1 && VersionedNamespace(base, version) != namespaceKey(namespace) {
+			t.Errorf("VersionedNamespace doesn't round-trip %s", namespace)
+		}
+	}
+}
+
+func TestDeprecatedNamespace(t *testing.T) {
+	const namespace = "https://deprecated.test/ns/old"
+	DeprecateNamespace(namespace+"#type", Deprecation{ReplacedBy: namespace + "/v2"})
+
+	desc := &Descriptor{ID: "main", Username: "user", DisplayName: "User"}
+	if err := desc.AddExtra(namespace+"#type", "test", "data"); err != nil {
+		t.Fatalf("AddExtra error: %s", err)
+	}
+
+	mt := &MemoryTransport{}
+	mt.Register("deprecated.test", newTenant(t, "deprecated.test", desc))
+
+	var events []KeyEvent
+	c := mt.Client()
+	c.Events = KeyEventSinkFunc(func(ev KeyEvent) {
+		if ev.Type == KeyEventDeprecatedNamespace {
+			events = append(events, ev)
+		}
+	})
+
+	if _, err := c.Lookup("user@deprecated.test"); err != nil {
+		t.Fatalf("Lookup error: %s", err)
+	}
+	if len(events) != 1 || events[0].Namespace != namespace || events[0].DescriptorID != "main" {
+		t.Errorf("Unexpected events: %#v", events)
+	}
+
+	extras, err := desc.DecodeExtras()
+	if err != nil {
+		t.Fatalf("DecodeExtras error: %s", err)
+	}
+	if !extras[0].Deprecated {
+		t.Error("Expected extra to be marked as deprecated")
+	}
+}
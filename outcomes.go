@@ -0,0 +1,53 @@
+package profilefed
+
+// VerificationOutcome identifies the outcome of a verification step taken by [Client].
+type VerificationOutcome string
+
+// Verification outcomes
+const (
+	// OutcomeVerified is reported when a response's signature is verified.
+	OutcomeVerified VerificationOutcome = "verified"
+	// OutcomeFirstTrust is reported when a server's key is trusted on first use.
+	OutcomeFirstTrust VerificationOutcome = "first_trust"
+	// OutcomeRotationAccepted is reported when a server's new key is accepted.
+	OutcomeRotationAccepted VerificationOutcome = "rotation_accepted"
+	// OutcomeMismatchInitial is reported when a response doesn't match
+	// the server's pinned key, and the server hasn't rotated its key.
+	OutcomeMismatchInitial VerificationOutcome = "signature_mismatch_initial"
+	// OutcomeMismatchRotation is reported when a server presents a new key
+	// that isn't properly signed, or when a response doesn't match the new key.
+	OutcomeMismatchRotation VerificationOutcome = "signature_mismatch_rotation"
+	// OutcomeMismatchPreviousName is reported when a server claims a previous
+	// name, but none of its signatures match the key pinned for that name.
+	OutcomeMismatchPreviousName VerificationOutcome = "signature_mismatch_previous_name"
+	// OutcomeDigestMismatch is reported when a response body doesn't match
+	// its Content-Digest header, so it was corrupted in transit.
+	OutcomeDigestMismatch VerificationOutcome = "digest_mismatch"
+	// OutcomeQuorumNotMet is reported when a server info isn't co-signed
+	// by enough of its co-signers.
+	OutcomeQuorumNotMet VerificationOutcome = "quorum_not_met"
+	// OutcomeKeyNotConfirmed is reported when a server's key
+	// isn't confirmed by [Client.ConfirmNewKey].
+	OutcomeKeyNotConfirmed VerificationOutcome = "key_not_confirmed"
+	// OutcomeKeyFetchFailed is reported when a server's info couldn't be retrieved.
+	OutcomeKeyFetchFailed VerificationOutcome = "key_fetch_failed"
+	// OutcomeQuarantineHit is reported when a response is rejected
+	// because the server is quarantined.
+	OutcomeQuarantineHit VerificationOutcome = "quarantine_hit"
+)
+
+// MetricsSink receives the outcomes of the verification steps taken by
+// [Client], so that operators can spot targeted attacks or broken peers.
+// See the metrics package for an implementation. ObserveVerification
+// is called synchronously during lookups, so it must be fast.
+type MetricsSink interface {
+	ObserveVerification(host string, outcome VerificationOutcome)
+}
+
+// observe reports a verification outcome to the client's metrics sink, if it has one.
+func (c Client) observe(host string, outcome VerificationOutcome) {
+	if c.Metrics == nil {
+		return
+	}
+	c.Metrics.ObserveVerification(host, outcome)
+}
@@ -0,0 +1,172 @@
+// Package pfdqueue implements a persistent [profilefed.DeliveryQueue], so that
+// outbound messages survive restarts.
+//
+// [FileQueue] keeps one file per queued message in a directory. Every write
+// replaces a single file atomically, so a crash never leaves a partially
+// written delivery behind.
+package pfdqueue
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"queerdevs.org/profilefed"
+)
+
+// FileQueue is a [profilefed.DeliveryQueue] that stores deliveries in a directory.
+// It should only be used by a single process at a time.
+type FileQueue struct {
+	dir string
+}
+
+// NewFileQueue creates a new file queue in the given directory,
+// creating it if it doesn't exist.
+func NewFileQueue(dir string) (*FileQueue, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &FileQueue{dir: dir}, nil
+}
+
+// Put implements [profilefed.DeliveryQueue]
+func (fq *FileQueue) Put(d *profilefed.QueuedDelivery) error {
+	data, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	return writeAtomic(fq.path(d.Message.ID), data)
+}
+
+// Get implements [profilefed.DeliveryQueue]
+func (fq *FileQueue) Get(id string) (*profilefed.QueuedDelivery, error) {
+	d, err := readDelivery(fq.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, profilefed.ErrDeliveryNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	if d.Message.ID != id {
+		return nil, fmt.Errorf("pfdqueue: corrupted delivery file for %s", id)
+	}
+	return d, nil
+}
+
+// Remove implements [profilefed.DeliveryQueue]
+func (fq *FileQueue) Remove(id string) error {
+	err := os.Remove(fq.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// Due implements [profilefed.DeliveryQueue]
+func (fq *FileQueue) Due(now time.Time, limit int) ([]*profilefed.QueuedDelivery, error) {
+	all, err := fq.all()
+	if err != nil {
+		return nil, err
+	}
+
+	var out []*profilefed.QueuedDelivery
+	for _, d := range all {
+		if !d.Dead && !d.NextAttempt.After(now) {
+			out = append(out, d)
+		}
+	}
+	return profilefed.SortDeliveries(out, limit), nil
+}
+
+// DeadLetters implements [profilefed.DeliveryQueue]
+func (fq *FileQueue) DeadLetters() ([]*profilefed.QueuedDelivery, error) {
+	all, err := fq.all()
+	if err != nil {
+		return nil, err
+	}
+
+	var out []*profilefed.QueuedDelivery
+	for _, d := range all {
+		if d.Dead {
+			out = append(out, d)
+		}
+	}
+	return profilefed.SortDeliveries(out, 0), nil
+}
+
+// all returns all the deliveries in the queue.
+func (fq *FileQueue) all() ([]*profilefed.QueuedDelivery, error) {
+	entries, err := os.ReadDir(fq.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []*profilefed.QueuedDelivery
+	for _, entry := range entries {
+		// Skip temporary files of writes in progress
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		d, err := readDelivery(filepath.Join(fq.dir, entry.Name()))
+		if errors.Is(err, os.ErrNotExist) {
+			continue // Removed since the directory was read
+		} else if err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	return out, nil
+}
+
+// path returns the path of the file for the delivery of the message with the
+// given ID. IDs are hashed, so they're always valid file names.
+func (fq *FileQueue) path(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return filepath.Join(fq.dir, hex.EncodeToString(sum[:]))
+}
+
+// readDelivery reads the delivery stored in the file at path.
+func readDelivery(path string) (*profilefed.QueuedDelivery, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var d profilefed.QueuedDelivery
+	if err := json.Unmarshal(data, &d); err != nil {
+		return nil, err
+	}
+
+	if d.Message == nil {
+		return nil, fmt.Errorf("pfdqueue: corrupted delivery file %s", filepath.Base(path))
+	}
+	return &d, nil
+}
+
+// writeAtomic writes data to path by writing it to a temporary
+// file first and renaming it, so readers never see partial writes.
+func writeAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,53 @@
+package pfdqueue
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"queerdevs.org/profilefed"
+)
+
+func TestFileQueue(t *testing.T) {
+	fq, err := NewFileQueue(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileQueue error: %s", err)
+	}
+
+	now := time.Now()
+	later := &profilefed.QueuedDelivery{Message: &profilefed.Message{ID: "later"}, NextAttempt: now.Add(time.Hour)}
+	due := &profilefed.QueuedDelivery{Message: &profilefed.Message{ID: "due"}, NextAttempt: now.Add(-time.Minute)}
+	dead := &profilefed.QueuedDelivery{Message: &profilefed.Message{ID: "dead"}, Attempts: 5, LastError: "503 Service Unavailable", Dead: true}
+
+	for _, d := range []*profilefed.QueuedDelivery{later, due, dead} {
+		if err := fq.Put(d); err != nil {
+			t.Fatalf("Put error: %s", err)
+		}
+	}
+
+	got, err := fq.Due(now, 10)
+	if err != nil {
+		t.Fatalf("Due error: %s", err)
+	}
+
+	if len(got) != 1 || got[0].Message.ID != "due" {
+		t.Errorf("Unexpected due deliveries: %#v", got)
+	}
+
+	letters, err := fq.DeadLetters()
+	if err != nil {
+		t.Fatalf("DeadLetters error: %s", err)
+	}
+
+	if len(letters) != 1 || letters[0].LastError != dead.LastError {
+		t.Errorf("Unexpected dead letters: %#v", letters)
+	}
+
+	if err := fq.Remove("dead"); err != nil {
+		t.Fatalf("Remove error: %s", err)
+	}
+
+	if _, err := fq.Get("dead"); !errors.Is(err, profilefed.ErrDeliveryNotFound) {
+		t.Errorf("Expected ErrDeliveryNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,347 @@
+// Package pfdstore implements persistent keystores for ProfileFed clients,
+// so that pinned server keys survive restarts.
+//
+// [FileStore] keeps one file per server in a directory. Every write replaces
+// a single file atomically, and verification times are kept in files of their
+// own, tied to the key that was verified, so recording a verification can never
+// undo a concurrent key rotation. This lets the store be shared between
+// processes without any locking.
+package pfdstore
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"queerdevs.org/profilefed"
+)
+
+const (
+	keysName       = "keys"
+	quarantineName = "quarantine"
+	aliasesName    = "aliases"
+	verifiedName   = "verified"
+)
+
+// FileStore is a [profilefed.KeyStore] that stores keys in a directory.
+type FileStore struct {
+	dir string
+}
+
+// keyFile is the contents of the file stored for each server.
+type keyFile struct {
+	ServerName    string    `json:"server_name"`
+	PreviousNames []string  `json:"previous_names,omitempty"`
+	PublicKey     []byte    `json:"pubkey"`
+	SavedAt       time.Time `json:"saved_at"`
+	FirstSeen     time.Time `json:"first_seen"`
+	// LastVerified is only set in key files written by older versions,
+	// MarkVerified writes a verifiedFile instead.
+	LastVerified time.Time `json:"last_verified,omitempty"`
+}
+
+// verifiedFile is the contents of the file recording when
+// a response signed with a server's key was last verified.
+type verifiedFile struct {
+	ServerName string    `json:"server_name"`
+	PublicKey  []byte    `json:"pubkey"`
+	At         time.Time `json:"at"`
+}
+
+// aliasFile is the contents of the file stored for each alternate name.
+type aliasFile struct {
+	Alias      string `json:"alias"`
+	ServerName string `json:"server_name"`
+}
+
+// NewFileStore creates a new file store in the given directory,
+// creating it if it doesn't exist.
+func NewFileStore(dir string) (*FileStore, error) {
+	for _, name := range []string{keysName, quarantineName, aliasesName, verifiedName} {
+		err := os.MkdirAll(filepath.Join(dir, name), 0o700)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+// SavePubkey implements [profilefed.KeyStore]
+func (fs *FileStore) SavePubkey(serverName string, previousNames []string, pubkey ed25519.PublicKey) error {
+	now := time.Now().UTC()
+	kf := keyFile{
+		ServerName:    serverName,
+		PreviousNames: previousNames,
+		PublicKey:     pubkey,
+		SavedAt:       now,
+		FirstSeen:     now,
+	}
+
+	// Renamed servers keep the earliest first-seen time of their previous names
+	for _, name := range append([]string{serverName}, previousNames...) {
+		old, err := fs.readKeyFile(name)
+		if errors.Is(err, profilefed.ErrPubkeyNotFound) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		if !old.FirstSeen.IsZero() && old.FirstSeen.Before(kf.FirstSeen) {
+			kf.FirstSeen = old.FirstSeen
+		}
+		if name == serverName && bytes.Equal(old.PublicKey, pubkey) {
+			kf.LastVerified = old.LastVerified
+		}
+	}
+
+	if err := fs.writeKeyFile(kf); err != nil {
+		return err
+	}
+
+	for _, name := range previousNames {
+		if err := fs.remove(name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetPubkey implements [profilefed.KeyStore]
+func (fs *FileStore) GetPubkey(serverName string) (ed25519.PublicKey, error) {
+	kf, err := fs.readKeyFile(serverName)
+	if err != nil {
+		return nil, err
+	}
+	return kf.PublicKey, nil
+}
+
+// MarkVerified implements [profilefed.KeyStore]. The time is recorded for the
+// key that's currently pinned, so if the key is rotated concurrently, the
+// verification is ignored instead of overwriting the new key.
+func (fs *FileStore) MarkVerified(serverName string, at time.Time) error {
+	kf, err := fs.readKeyFile(serverName)
+	if errors.Is(err, profilefed.ErrPubkeyNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(verifiedFile{ServerName: serverName, PublicKey: kf.PublicKey, At: at.UTC()})
+	if err != nil {
+		return err
+	}
+	return writeAtomic(fs.path(verifiedName, serverName), data)
+}
+
+// lastVerified returns when a response signed with pubkey was last verified
+// for the given server, or the zero time if it never was.
+func (fs *FileStore) lastVerified(serverName string, pubkey ed25519.PublicKey) (time.Time, error) {
+	data, err := os.ReadFile(fs.path(verifiedName, serverName))
+	if errors.Is(err, os.ErrNotExist) {
+		return time.Time{}, nil
+	} else if err != nil {
+		return time.Time{}, err
+	}
+
+	var vf verifiedFile
+	if err := json.Unmarshal(data, &vf); err != nil {
+		return time.Time{}, err
+	}
+
+	if vf.ServerName != serverName || !bytes.Equal(vf.PublicKey, pubkey) {
+		return time.Time{}, nil
+	}
+	return vf.At, nil
+}
+
+// ListHosts implements [profilefed.KeyStore]
+func (fs *FileStore) ListHosts() ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(fs.dir, keysName))
+	if err != nil {
+		return nil, err
+	}
+
+	var out []string
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".tmp-") {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(fs.dir, keysName, entry.Name()))
+		if errors.Is(err, os.ErrNotExist) {
+			// The key was deleted while listing
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		var kf keyFile
+		if err := json.Unmarshal(data, &kf); err != nil {
+			return nil, fmt.Errorf("pfdstore: corrupted key file %s: %w", entry.Name(), err)
+		}
+		out = append(out, kf.ServerName)
+	}
+
+	sort.Strings(out)
+	return out, nil
+}
+
+// GetKeyInfo implements [profilefed.KeyStore]
+func (fs *FileStore) GetKeyInfo(serverName string) (profilefed.KeyInfo, error) {
+	kf, err := fs.readKeyFile(serverName)
+	if err != nil {
+		return profilefed.KeyInfo{}, err
+	}
+
+	verified, err := fs.lastVerified(serverName, kf.PublicKey)
+	if err != nil {
+		return profilefed.KeyInfo{}, err
+	}
+	if verified.IsZero() {
+		verified = kf.LastVerified
+	}
+
+	return profilefed.KeyInfo{
+		ServerName:   kf.ServerName,
+		PublicKey:    kf.PublicKey,
+		FirstSeen:    kf.FirstSeen,
+		LastVerified: verified,
+	}, nil
+}
+
+// DeleteHost implements [profilefed.KeyStore]
+func (fs *FileStore) DeleteHost(serverName string) error {
+	return fs.remove(serverName)
+}
+
+// remove removes the key file and verification time of the given server.
+func (fs *FileStore) remove(serverName string) error {
+	for _, subdir := range []string{keysName, verifiedName} {
+		err := os.Remove(fs.path(subdir, serverName))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// readKeyFile reads the key file for the given server, returning
+// [profilefed.ErrPubkeyNotFound] if there isn't one.
+func (fs *FileStore) readKeyFile(serverName string) (keyFile, error) {
+	data, err := os.ReadFile(fs.path(keysName, serverName))
+	if errors.Is(err, os.ErrNotExist) {
+		return keyFile{}, profilefed.ErrPubkeyNotFound
+	} else if err != nil {
+		return keyFile{}, err
+	}
+
+	var kf keyFile
+	if err := json.Unmarshal(data, &kf); err != nil {
+		return keyFile{}, err
+	}
+
+	if kf.ServerName != serverName || len(kf.PublicKey) != ed25519.PublicKeySize {
+		return keyFile{}, fmt.Errorf("pfdstore: corrupted key file for %s", serverName)
+	}
+
+	return kf, nil
+}
+
+// writeKeyFile replaces the key file for kf's server.
+func (fs *FileStore) writeKeyFile(kf keyFile) error {
+	data, err := json.Marshal(kf)
+	if err != nil {
+		return err
+	}
+	return writeAtomic(fs.path(keysName, kf.ServerName), data)
+}
+
+// SetQuarantined implements [profilefed.KeyStore]
+func (fs *FileStore) SetQuarantined(serverName string, quarantined bool) error {
+	path := fs.path(quarantineName, serverName)
+	if !quarantined {
+		err := os.Remove(path)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	return writeAtomic(path, []byte(serverName))
+}
+
+// IsQuarantined implements [profilefed.KeyStore]
+func (fs *FileStore) IsQuarantined(serverName string) (bool, error) {
+	_, err := os.Stat(fs.path(quarantineName, serverName))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// SaveAlias implements [profilefed.KeyStore]
+func (fs *FileStore) SaveAlias(alias, serverName string) error {
+	data, err := json.Marshal(aliasFile{Alias: alias, ServerName: serverName})
+	if err != nil {
+		return err
+	}
+	return writeAtomic(fs.path(aliasesName, alias), data)
+}
+
+// GetAlias implements [profilefed.KeyStore]
+func (fs *FileStore) GetAlias(alias string) (string, error) {
+	data, err := os.ReadFile(fs.path(aliasesName, alias))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+
+	var af aliasFile
+	if err := json.Unmarshal(data, &af); err != nil {
+		return "", err
+	}
+
+	if af.Alias != alias {
+		return "", fmt.Errorf("pfdstore: corrupted alias file for %s", alias)
+	}
+
+	return af.ServerName, nil
+}
+
+// path returns the path of the file for the given server in the given
+// subdirectory. Server names are hashed, so they're always valid file names.
+func (fs *FileStore) path(subdir, serverName string) string {
+	sum := sha256.Sum256([]byte(serverName))
+	return filepath.Join(fs.dir, subdir, hex.EncodeToString(sum[:]))
+}
+
+// writeAtomic writes data to path by writing it to a temporary
+// file first and renaming it, so readers never see partial writes.
+func writeAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,123 @@
+package pfdstore
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"queerdevs.org/profilefed"
+)
+
+func TestFileStore(t *testing.T) {
+	fs, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore error: %s", err)
+	}
+
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Error generating key: %s", err)
+	}
+
+	if err := fs.SavePubkey("old.example.com", nil, pub); err != nil {
+		t.Fatalf("SavePubkey error: %s", err)
+	}
+
+	if err := fs.SavePubkey("example.com:8080", []string{"old.example.com"}, pub); err != nil {
+		t.Fatalf("SavePubkey error: %s", err)
+	}
+
+	got, err := fs.GetPubkey("example.com:8080")
+	if err != nil {
+		t.Fatalf("GetPubkey error: %s", err)
+	}
+
+	if !got.Equal(pub) {
+		t.Errorf("Keys are not equal")
+	}
+
+	if _, err := fs.GetPubkey("old.example.com"); !errors.Is(err, profilefed.ErrPubkeyNotFound) {
+		t.Errorf("Expected ErrPubkeyNotFound for previous name, got %v", err)
+	}
+
+	if err := fs.MarkVerified("example.com:8080", time.Now()); err != nil {
+		t.Fatalf("MarkVerified error: %s", err)
+	}
+
+	info, err := fs.GetKeyInfo("example.com:8080")
+	if err != nil {
+		t.Fatalf("GetKeyInfo error: %s", err)
+	}
+	if info.FirstSeen.IsZero() || info.LastVerified.IsZero() {
+		t.Errorf("Expected timestamps to be set, got %+v", info)
+	}
+
+	if hosts, err := fs.ListHosts(); err != nil || !reflect.DeepEqual(hosts, []string{"example.com:8080"}) {
+		t.Errorf("Unexpected hosts: %q, %v", hosts, err)
+	}
+
+	if err := fs.SetQuarantined("example.com:8080", true); err != nil {
+		t.Fatalf("SetQuarantined error: %s", err)
+	}
+
+	if q, err := fs.IsQuarantined("example.com:8080"); err != nil || !q {
+		t.Errorf("Expected server to be quarantined, got %t, %v", q, err)
+	}
+
+	if err := fs.DeleteHost("example.com:8080"); err != nil {
+		t.Fatalf("DeleteHost error: %s", err)
+	}
+
+	if _, err := fs.GetPubkey("example.com:8080"); !errors.Is(err, profilefed.ErrPubkeyNotFound) {
+		t.Errorf("Expected ErrPubkeyNotFound after DeleteHost, got %v", err)
+	}
+}
+
+func TestFileStoreVerifiedRotation(t *testing.T) {
+	fs, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore error: %s", err)
+	}
+
+	oldPub, _, _ := ed25519.GenerateKey(rand.Reader)
+	newPub, _, _ := ed25519.GenerateKey(rand.Reader)
+
+	if err := fs.SavePubkey("example.com", nil, oldPub); err != nil {
+		t.Fatalf("SavePubkey error: %s", err)
+	}
+	if err := fs.SavePubkey("example.com", nil, newPub); err != nil {
+		t.Fatalf("SavePubkey error: %s", err)
+	}
+
+	// A MarkVerified that read the old key before the rotation
+	// finishes writing after it
+	data, err := json.Marshal(verifiedFile{ServerName: "example.com", PublicKey: oldPub, At: time.Now()})
+	if err != nil {
+		t.Fatalf("Marshal error: %s", err)
+	}
+	if err := writeAtomic(fs.path(verifiedName, "example.com"), data); err != nil {
+		t.Fatalf("writeAtomic error: %s", err)
+	}
+
+	info, err := fs.GetKeyInfo("example.com")
+	if err != nil {
+		t.Fatalf("GetKeyInfo error: %s", err)
+	}
+	if !info.PublicKey.Equal(newPub) {
+		t.Errorf("Stale verification undid the key rotation")
+	}
+	if !info.LastVerified.IsZero() {
+		t.Errorf("Expected the old key's verification to be ignored, got %s", info.LastVerified)
+	}
+
+	if err := fs.MarkVerified("example.com", time.Now()); err != nil {
+		t.Fatalf("MarkVerified error: %s", err)
+	}
+	if info, err := fs.GetKeyInfo("example.com"); err != nil || info.LastVerified.IsZero() {
+		t.Errorf("Expected the new key to be verified, got %+v, %v", info, err)
+	}
+}
@@ -0,0 +1,280 @@
+package profilefed
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"io"
+	"slices"
+	"sort"
+	"sync"
+)
+
+const (
+	// OwnerNamespace is the namespace of the owner signature extra.
+	// See [Descriptor.SignOwner].
+	OwnerNamespace = "https://queerdevs.org/profilefed/ns/owner"
+	// OwnerSignatureType is the type of the owner signature extra.
+	OwnerSignatureType = "signature"
+)
+
+// ErrPinnedFieldsChanged signifies that pinned descriptor fields changed without a valid owner signature.
+var ErrPinnedFieldsChanged = errors.New("pinned descriptor fields changed")
+
+// defaultPinnedFields contains the fields pinned by [DescriptorPins] if none are configured.
+var defaultPinnedFields = []string{"id", "username", "display_name", "did"}
+
+// ownerSignature is the data of an owner signature extra.
+type ownerSignature struct {
+	PublicKey ed25519.PublicKey `json:"pubkey"`
+	Fields    []string          `json:"fields"`
+	Signature []byte            `json:"sig"`
+}
+
+// SignOwner adds a signature by the profile owner's key over the given fields
+// to the descriptor, replacing any existing owner signature. Clients that
+// pinned the fields using [DescriptorPins] accept changes to them if they're
+// signed by the same owner key as the version they pinned.
+//
+// SignOwner has to be called after the signed fields are final, since
+// any later change invalidates the signature.
+func (d *Descriptor) SignOwner(priv ed25519.PrivateKey, fields ...string) error {
+	if err := validateFields(fields); err != nil {
+		return err
+	}
+
+	d.Extra = slices.DeleteFunc(slices.Clone(d.Extra), isOwnerSignature)
+
+	hash, err := pinHash(d, fields)
+	if err != nil {
+		return err
+	}
+
+	return d.AddExtra(OwnerNamespace, OwnerSignatureType, ownerSignature{
+		PublicKey: priv.Public().(ed25519.PublicKey),
+		Fields:    fields,
+		Signature: ed25519.Sign(priv, []byte(hash)),
+	})
+}
+
+// ownerKey returns the key of the descriptor's owner signature, if it has
+// a valid one that covers all the given fields.
+func (d *Descriptor) ownerKey(fields []string) ed25519.PublicKey {
+	i := slices.IndexFunc(d.Extra, isOwnerSignature)
+	if i < 0 {
+		return nil
+	}
+
+	var os ownerSignature
+	if err := json.Unmarshal(d.Extra[i].Data, &os); err != nil {
+		return nil
+	}
+
+	for _, field := range fields {
+		if !slices.Contains(os.Fields, field) {
+			return nil
+		}
+	}
+
+	hash, err := pinHash(d, os.Fields)
+	if err != nil || !verify(os.PublicKey, []byte(hash), os.Signature) {
+		return nil
+	}
+	return os.PublicKey
+}
+
+// isOwnerSignature reports whether e is an owner signature extra.
+func isOwnerSignature(e Extra) bool {
+	return e.Namespace == OwnerNamespace && e.Type == OwnerSignatureType
+}
+
+// pinHash returns the content hash of the given fields of desc. Owner
+// signatures are excluded from the extras, since they sign the hash.
+func pinHash(desc *Descriptor, fields []string) (string, error) {
+	if err := validateFields(fields); err != nil {
+		return "", err
+	}
+
+	d := *desc
+	d.Extra = slices.DeleteFunc(slices.Clone(d.Extra), isOwnerSignature)
+
+	data, err := json.Marshal(&d)
+	if err != nil {
+		return "", err
+	}
+
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(data, &members); err != nil {
+		return "", err
+	}
+
+	selected := make(map[string]json.RawMessage, len(fields))
+	for _, field := range fields {
+		selected[field] = members[field]
+	}
+	return ContentHash(selected), nil
+}
+
+// DescriptorPins detects changes to critical descriptor fields, such as a
+// profile's display name or DID. The first time a client sees a descriptor,
+// a hash of its pinned fields is recorded. If they change later, the change
+// is only accepted silently if it's signed by the same owner key as the
+// pinned version. Otherwise, a [KeyEventPinViolation] event is emitted.
+// The zero value is ready to use.
+type DescriptorPins struct {
+	// Fields contains the JSON names of the pinned fields. If it's empty,
+	// the id, username, display_name, and did fields are pinned.
+	Fields []string
+	// Reject makes lookups of descriptors with changed pinned fields fail with
+	// [ErrPinnedFieldsChanged], rather than only emitting an event. Rejected
+	// changes aren't pinned, so lookups keep failing until the fields change
+	// back or the pin is removed with [DescriptorPins.Forget].
+	Reject bool
+
+	mtx  sync.Mutex
+	pins map[string]descriptorPin
+}
+
+// descriptorPin is the pinned state of a single descriptor.
+type descriptorPin struct {
+	Hash     string            `json:"hash"`
+	OwnerKey ed25519.PublicKey `json:"owner_key,omitempty"`
+}
+
+// fields returns the pinned fields.
+func (dp *DescriptorPins) fields() []string {
+	if len(dp.Fields) == 0 {
+		return defaultPinnedFields
+	}
+	return dp.Fields
+}
+
+// Forget removes the pin of the descriptor with the given ID for the given
+// resource, so that its current version is pinned the next time it's looked up.
+func (dp *DescriptorPins) Forget(resource, id string) {
+	dp.mtx.Lock()
+	defer dp.mtx.Unlock()
+	delete(dp.pins, pinKey(resource, id))
+}
+
+// check compares desc to its pin, pinning it if necessary. It returns
+// the type of event to emit, if any, and whether the change is accepted.
+func (dp *DescriptorPins) check(resource string, desc *Descriptor) (KeyEventType, bool, error) {
+	fields := dp.fields()
+	hash, err := pinHash(desc, fields)
+	if err != nil {
+		return "", false, err
+	}
+	ownerKey := desc.ownerKey(fields)
+
+	dp.mtx.Lock()
+	defer dp.mtx.Unlock()
+
+	key := pinKey(resource, desc.ID)
+	pin, ok := dp.pins[key]
+	switch {
+	case !ok:
+		// Pin the descriptor, along with its owner key if it has one. Owner
+		// keys are only pinned along with the first version of a descriptor.
+		if dp.pins == nil {
+			dp.pins = map[string]descriptorPin{}
+		}
+		dp.pins[key] = descriptorPin{Hash: hash, OwnerKey: ownerKey}
+		return "", true, nil
+	case pin.Hash == hash:
+		return "", true, nil
+	case pin.OwnerKey != nil && pin.OwnerKey.Equal(ownerKey):
+		dp.pins[key] = descriptorPin{Hash: hash, OwnerKey: ownerKey}
+		return KeyEventPinUpdated, true, nil
+	case dp.Reject:
+		return KeyEventPinViolation, false, nil
+	default:
+		// The change is reported once, and the new version is pinned
+		dp.pins[key] = descriptorPin{Hash: hash, OwnerKey: pin.OwnerKey}
+		return KeyEventPinViolation, true, nil
+	}
+}
+
+// Export writes the pins to w as JSON.
+func (dp *DescriptorPins) Export(w io.Writer) error {
+	dp.mtx.Lock()
+	data, err := json.Marshal(dp.pins)
+	dp.mtx.Unlock()
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// Import reads pins produced by [DescriptorPins.Export] from r,
+// replacing existing pins for the same descriptors.
+func (dp *DescriptorPins) Import(r io.Reader) error {
+	var pins map[string]descriptorPin
+	if err := json.NewDecoder(r).Decode(&pins); err != nil {
+		return err
+	}
+
+	dp.mtx.Lock()
+	defer dp.mtx.Unlock()
+
+	if dp.pins == nil {
+		dp.pins = map[string]descriptorPin{}
+	}
+	for key, pin := range pins {
+		dp.pins[key] = pin
+	}
+	return nil
+}
+
+// pinKey returns the key under which the descriptor with the given ID is pinned.
+func pinKey(resource, id string) string {
+	return resource + "#" + id
+}
+
+// checkPins checks the descriptors in dest, which must be a descriptor or
+// a map of descriptors, against the client's pins, if it has any.
+func (c Client) checkPins(resource, host string, dest any) error {
+	if c.Pins == nil {
+		return nil
+	}
+
+	for _, desc := range destDescriptors(dest) {
+		evType, accepted, err := c.Pins.check(resource, desc)
+		if err != nil {
+			return err
+		}
+
+		if evType != "" {
+			c.tracef("pinned fields of %s changed: %s", pinKey(resource, desc.ID), evType)
+			c.emit(KeyEvent{Type: evType, ServerName: host, Resource: resource, DescriptorID: desc.ID})
+		}
+
+		if !accepted {
+			return ErrPinnedFieldsChanged
+		}
+	}
+
+	return nil
+}
+
+// destDescriptors returns the descriptors in dest, which must be a descriptor
+// or a map of descriptors. Descriptors in a map are sorted by ID.
+func destDescriptors(dest any) []*Descriptor {
+	var descs []*Descriptor
+	switch dest := dest.(type) {
+	case *Descriptor:
+		descs = append(descs, dest)
+	case *map[string]*Descriptor:
+		ids := make([]string, 0, len(*dest))
+		for id := range *dest {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		for _, id := range ids {
+			descs = append(descs, (*dest)[id])
+		}
+	}
+	return descs
+}
@@ -0,0 +1,46 @@
+package profilefed
+
+import (
+	"crypto/ed25519"
+	"testing"
+)
+
+func TestDescriptorPins(t *testing.T) {
+	_, owner, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey error: %s", err)
+	}
+
+	desc := &Descriptor{ID: "main", Username: "user", DisplayName: "User", Bio: "Hi"}
+	if err := desc.SignOwner(owner, "id", "username", "display_name", "did"); err != nil {
+		t.Fatalf("SignOwner error: %s", err)
+	}
+
+	dp := &DescriptorPins{Reject: true}
+	check := func(desc *Descriptor, expectedType KeyEventType, expectedAccepted bool) {
+		t.Helper()
+		evType, accepted, err := dp.check("acct:user@example.com", desc)
+		if err != nil {
+			t.Fatalf("check error: %s", err)
+		}
+		if evType != expectedType || accepted != expectedAccepted {
+			t.Errorf("Unexpected result: %q, %t", evType, accepted)
+		}
+	}
+
+	check(desc, "", true)
+
+	// Unpinned fields can change freely
+	changed := *desc
+	changed.Bio = "Hello"
+	check(&changed, "", true)
+
+	// Pinned fields can't change without a valid owner signature
+	changed.DisplayName = "Someone Else"
+	check(&changed, KeyEventPinViolation, false)
+
+	if err := changed.SignOwner(owner, "id", "username", "display_name", "did"); err != nil {
+		t.Fatalf("SignOwner error: %s", err)
+	}
+	check(&changed, KeyEventPinUpdated, true)
+}
@@ -0,0 +1,251 @@
+package profilefed
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"queerdevs.org/profilefed/publicsuffix"
+)
+
+var (
+	// ErrInsecureURL signifies that a request to a non-HTTPS URL was
+	// blocked because the client's policy requires HTTPS.
+	ErrInsecureURL = errors.New("refusing to connect to non-https url")
+	// ErrCrossSiteEndpoint signifies that a descriptor endpoint is on a different
+	// site than the resource it describes, which the client's policy doesn't allow.
+	ErrCrossSiteEndpoint = errors.New("descriptor endpoint is on a different site than the resource")
+	// ErrUnenforceablePolicy signifies that a request was blocked because the client's
+	// policy has TLS or resolver settings that can't be applied to its transport.
+	ErrUnenforceablePolicy = errors.New("transport policy can't be applied to the client's transport")
+)
+
+// TransportPolicy configures security requirements enforced for all the
+// WebFinger, server info, and descriptor requests made by a [Client].
+//
+// The TLS and resolver settings can only be applied to an [*http.Transport],
+// optionally wrapped in a [TraceTransport] or [RetryTransport]. If they're set
+// and the client uses any other transport, all its requests fail with
+// [ErrUnenforceablePolicy] instead of silently ignoring them.
+type TransportPolicy struct {
+	// RequireHTTPS makes the client refuse to contact any server over plain HTTP,
+	// including when following redirects. WebFinger lookups are made over HTTPS.
+	RequireHTTPS bool
+	// MinTLSVersion is the minimum TLS version accepted from remote servers,
+	// such as [tls.VersionTLS13]. If zero, Go's default minimum is used.
+	MinTLSVersion uint16
+	// PinnedCAs maps host names to the pool of CA certificates that the host's
+	// certificate chain must lead to. Hosts without an entry are verified
+	// using the system roots only. Since the host name is taken from the TLS
+	// server name, servers reached by IP address can't be pinned.
+	PinnedCAs map[string]*x509.CertPool
+	// Certificates contains client certificates presented to servers that
+	// request one, for use in closed federations that rely on mutual TLS.
+	Certificates []tls.Certificate
+	// Resolver, if set, is used to resolve host names for all outgoing
+	// connections. See [NewDoHResolver] and [NewDoTResolver] for encrypted DNS.
+	Resolver *net.Resolver
+
+	// SameSiteEndpoints makes the client reject descriptor endpoints, including
+	// the targets of signed redirects, whose host doesn't belong to the same site
+	// as the resource being looked up. For example, an endpoint on
+	// profile.users.example.co.uk is allowed for acct:user@example.co.uk,
+	// but one on evil.co.uk isn't.
+	SameSiteEndpoints bool
+	// PublicSuffixes is the public suffix list used to determine which site
+	// a host belongs to. If nil, [publicsuffix.Default] is used.
+	PublicSuffixes *publicsuffix.List
+
+	mtx     sync.Mutex
+	clients map[*http.Client]*http.Client
+}
+
+// checkURL returns an error if u isn't allowed by the policy.
+func (tp *TransportPolicy) checkURL(u *url.URL) error {
+	if tp.RequireHTTPS && u.Scheme != "https" {
+		return ErrInsecureURL
+	}
+	return nil
+}
+
+// checkSite returns an error if the policy requires descriptor endpoints to be
+// on the same site as the resource and endpoint isn't on the same site as resourceHost.
+func (tp *TransportPolicy) checkSite(resourceHost string, endpoint *url.URL) error {
+	if !tp.SameSiteEndpoints {
+		return nil
+	}
+
+	list := tp.PublicSuffixes
+	if list == nil {
+		list = publicsuffix.Default()
+	}
+
+	resourceURL := url.URL{Host: resourceHost}
+	if resourceHost == "" || !list.SameSite(resourceURL.Hostname(), endpoint.Hostname()) {
+		return ErrCrossSiteEndpoint
+	}
+	return nil
+}
+
+// client returns a copy of base that enforces the policy. Copies are
+// cached so that connections can be reused between requests.
+func (tp *TransportPolicy) client(base *http.Client) *http.Client {
+	tp.mtx.Lock()
+	defer tp.mtx.Unlock()
+
+	if c, ok := tp.clients[base]; ok {
+		return c
+	}
+
+	out := *base
+	if tp.MinTLSVersion != 0 || len(tp.PinnedCAs) > 0 || len(tp.Certificates) > 0 || tp.Resolver != nil {
+		out.Transport = tp.transport(base.Transport)
+	}
+
+	checkRedirect := base.CheckRedirect
+	out.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if err := tp.checkURL(req.URL); err != nil {
+			return err
+		}
+		if checkRedirect != nil {
+			return checkRedirect(req, via)
+		}
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		return nil
+	}
+
+	if tp.clients == nil {
+		tp.clients = map[*http.Client]*http.Client{}
+	}
+	tp.clients[base] = &out
+	return &out
+}
+
+// transport returns a copy of rt with the policy's TLS settings applied.
+// Only [*http.Transport] can be configured, other round trippers are
+// replaced with one that fails every request.
+func (tp *TransportPolicy) transport(rt http.RoundTripper) http.RoundTripper {
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+
+	if tt, ok := rt.(TraceTransport); ok {
+		tt.Transport = tp.transport(tt.Transport)
+		return tt
+	}
+
+	if rt, ok := rt.(RetryTransport); ok {
+		rt.Transport = tp.transport(rt.Transport)
+		return rt
+	}
+
+	t, ok := rt.(*http.Transport)
+	if !ok {
+		return unenforceableTransport{rt}
+	}
+	t = t.Clone()
+
+	if t.TLSClientConfig == nil {
+		t.TLSClientConfig = &tls.Config{}
+	}
+
+	if tp.MinTLSVersion != 0 {
+		t.TLSClientConfig.MinVersion = tp.MinTLSVersion
+	}
+
+	if len(tp.PinnedCAs) > 0 {
+		t.TLSClientConfig.VerifyConnection = tp.verifyPinnedCA
+	}
+
+	if len(tp.Certificates) > 0 {
+		t.TLSClientConfig.Certificates = tp.Certificates
+	}
+
+	if tp.Resolver != nil {
+		d := &net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+			Resolver:  tp.Resolver,
+		}
+		t.DialContext = d.DialContext
+	}
+
+	return t
+}
+
+// unenforceableTransport fails every request, because the
+// policy's TLS settings couldn't be applied to the wrapped transport.
+type unenforceableTransport struct {
+	rt http.RoundTripper
+}
+
+// RoundTrip implements the [http.RoundTripper] interface
+func (ut unenforceableTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	return nil, fmt.Errorf("%w: %T", ErrUnenforceablePolicy, ut.rt)
+}
+
+// verifyPinnedCA verifies that the peer's certificate chain leads to
+// the CA pinned for its host, if there is one.
+func (tp *TransportPolicy) verifyPinnedCA(cs tls.ConnectionState) error {
+	pool, ok := tp.PinnedCAs[cs.ServerName]
+	if !ok {
+		return nil
+	}
+
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("no peer certificates presented")
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range cs.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	_, err := cs.PeerCertificates[0].Verify(x509.VerifyOptions{
+		DNSName:       cs.ServerName,
+		Roots:         pool,
+		Intermediates: intermediates,
+	})
+	return err
+}
+
+// httpClient returns the HTTP client that should be used for all requests.
+func (c Client) httpClient() *http.Client {
+	base := c.HTTPClient
+	if base == nil {
+		base = http.DefaultClient
+	}
+
+	if c.Policy != nil {
+		base = c.Policy.client(base)
+	}
+	return withAllowlist(withUserAgent(base, c.userAgent()), c.AllowHost)
+}
+
+// checkURL returns an error if the client's policy doesn't allow requests to u.
+func (c Client) checkURL(u *url.URL) error {
+	if c.Policy != nil {
+		return c.Policy.checkURL(u)
+	}
+	return nil
+}
+
+// checkSite returns an error if the client's policy doesn't allow the
+// descriptor endpoint at u for a resource hosted on resourceHost.
+func (c Client) checkSite(resourceHost string, u *url.URL) error {
+	if c.Policy != nil {
+		return c.Policy.checkSite(resourceHost, u)
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package profilefed
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTransportPolicyPinnedCA(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.NotFoundHandler())
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	pinned := x509.NewCertPool()
+	pinned.AddCert(srv.Certificate())
+
+	other := x509.NewCertPool()
+	ca, _ := newTestCA(t)
+	other.AddCert(ca)
+
+	for _, tc := range []struct {
+		name string
+		pool *x509.CertPool
+		ok   bool
+	}{
+		{"matching", pinned, true},
+		{"mismatched", other, false},
+	} {
+		c := Client{
+			HTTPClient: exampleClient(srv),
+			Policy:     &TransportPolicy{PinnedCAs: map[string]*x509.CertPool{"example.com": tc.pool}},
+		}
+
+		res, err := c.httpClient().Get("https://example.com/")
+		if err == nil {
+			res.Body.Close()
+		}
+		if (err == nil) != tc.ok {
+			t.Errorf("%s CA: unexpected error: %v", tc.name, err)
+		}
+	}
+}
+
+func TestTransportPolicyMinTLSVersion(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.NotFoundHandler())
+	srv.TLS = &tls.Config{MaxVersion: tls.VersionTLS12}
+	// Rejected handshakes are expected
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	for _, tc := range []struct {
+		version uint16
+		ok      bool
+	}{
+		{tls.VersionTLS12, true},
+		{tls.VersionTLS13, false},
+	} {
+		c := Client{
+			HTTPClient: srv.Client(),
+			Policy:     &TransportPolicy{MinTLSVersion: tc.version},
+		}
+
+		res, err := c.httpClient().Get(srv.URL)
+		if err == nil {
+			res.Body.Close()
+		}
+		if (err == nil) != tc.ok {
+			t.Errorf("Minimum version %x: unexpected error: %v", tc.version, err)
+		}
+	}
+}
+
+func TestTransportPolicyUnenforceable(t *testing.T) {
+	mt := &MemoryTransport{}
+	mt.Register("example.test", http.NotFoundHandler())
+
+	c := mt.Client()
+	c.Policy = &TransportPolicy{MinTLSVersion: tls.VersionTLS13}
+
+	_, err := c.httpClient().Get("https://example.test/")
+	if !errors.Is(err, ErrUnenforceablePolicy) {
+		t.Fatalf("Expected ErrUnenforceablePolicy, got %v", err)
+	}
+
+	// Policies without TLS settings work with any transport
+	c.Policy = &TransportPolicy{RequireHTTPS: true}
+	res, err := c.httpClient().Get("https://example.test/")
+	if err != nil {
+		t.Fatalf("Get error: %s", err)
+	}
+	res.Body.Close()
+}
+
+// exampleClient returns a client trusting srv's certificate, which
+// connects to srv for every request, so that it can be reached as
+// example.com, one of the names in httptest's certificate.
+func exampleClient(srv *httptest.Server) *http.Client {
+	t := srv.Client().Transport.(*http.Transport).Clone()
+	t.DialContext = func(ctx context.Context, network, _ string) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, network, srv.Listener.Addr().String())
+	}
+	return &http.Client{Transport: t}
+}
+
+// newTestCA returns a new self-signed CA certificate and its key.
+func newTestCA(t *testing.T) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Error generating key: %s", err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		t.Fatalf("CreateCertificate error: %s", err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("ParseCertificate error: %s", err)
+	}
+	return cert, key
+}
@@ -0,0 +1,297 @@
+package profilefed
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"queerdevs.org/profilefed/webfinger"
+)
+
+// Severity represents the severity of a preflight finding.
+type Severity string
+
+// Finding severities
+const (
+	SeverityPass Severity = "pass"
+	SeverityWarn Severity = "warn"
+	SeverityFail Severity = "fail"
+)
+
+// Finding represents the result of a single preflight check.
+type Finding struct {
+	// Check is a short name for the check that produced the finding.
+	Check string `json:"check"`
+	// Severity is the severity of the finding.
+	Severity Severity `json:"severity"`
+	// Message describes what was found.
+	Message string `json:"message"`
+	// Hint describes how to fix the problem, if there is one.
+	Hint string `json:"hint,omitempty"`
+}
+
+// PreflightOptions configures the checks performed by [Preflight].
+type PreflightOptions struct {
+	// Resource is a resource served by the server (e.g. acct:user@example.com)
+	// used to check the WebFinger and descriptor endpoints. If empty, those
+	// checks are skipped.
+	Resource string
+	// KeyFile is the path to the server's private key file. If set, its
+	// permissions are checked. This only makes sense when running on the server.
+	KeyFile string
+	// HTTPClient is the client used to make requests. If nil, a client
+	// with a 10 second timeout is used.
+	HTTPClient *http.Client
+}
+
+// Preflight performs a series of external checks against the ProfileFed server
+// at domain, to help operators validate their setup before going live. It
+// returns a finding for every check that was performed.
+func Preflight(domain string, opts PreflightOptions) []Finding {
+	pc := preflightChecker{client: opts.HTTPClient}
+	if pc.client == nil {
+		pc.client = &http.Client{Timeout: 10 * time.Second}
+	}
+	pc.client = withUserAgent(pc.client, DefaultUserAgent)
+
+	scheme := pc.checkHTTPS(domain)
+	pubkey := pc.checkServerInfo(scheme, domain)
+	if opts.Resource != "" {
+		pc.checkWebFinger(scheme, domain, opts.Resource, pubkey)
+	}
+	if opts.KeyFile != "" {
+		pc.checkKeyFile(opts.KeyFile)
+	}
+
+	return pc.findings
+}
+
+type preflightChecker struct {
+	client   *http.Client
+	findings []Finding
+}
+
+func (pc *preflightChecker) add(check string, sev Severity, msg, hint string) {
+	pc.findings = append(pc.findings, Finding{Check: check, Severity: sev, Message: msg, Hint: hint})
+}
+
+// checkHTTPS checks whether the server is reachable over HTTPS,
+// and returns the scheme that should be used for further checks.
+func (pc *preflightChecker) checkHTTPS(domain string) string {
+	res, err := pc.client.Get("https://" + domain + "/_profilefed/server")
+	if err == nil {
+		res.Body.Close()
+		pc.add("https", SeverityPass, "server is reachable over HTTPS", "")
+		return "https"
+	}
+
+	pc.add("https", SeverityFail, "server is not reachable over HTTPS: "+err.Error(),
+		"Configure TLS for your domain, for example using a reverse proxy with an ACME certificate.")
+	return "http"
+}
+
+// checkServerInfo checks the server info endpoint and returns the
+// server's public key if it could be verified.
+func (pc *preflightChecker) checkServerInfo(scheme, domain string) ed25519.PublicKey {
+	const check = "server-info"
+
+	res, err := pc.client.Get(scheme + "://" + domain + "/_profilefed/server")
+	if err != nil {
+		pc.add(check, SeverityFail, "server info request failed: "+err.Error(),
+			"Make sure a ServerInfoHandler is mounted at /_profilefed/server.")
+		return nil
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		pc.add(check, SeverityFail, "server info returned "+res.Status,
+			"Make sure a ServerInfoHandler is mounted at /_profilefed/server.")
+		return nil
+	}
+
+	pc.checkContentType(check, res, "application/json")
+
+	data, err := io.ReadAll(io.LimitReader(res.Body, responseSizeLimit))
+	if err != nil {
+		pc.add(check, SeverityFail, "failed to read server info: "+err.Error(), "")
+		return nil
+	}
+
+	var info serverInfoData
+	if err := json.Unmarshal(data, &info); err != nil {
+		pc.add(check, SeverityFail, "server info is not valid JSON: "+err.Error(), "")
+		return nil
+	}
+
+	if normalizeHost(info.ServerName) != normalizeHost(domain) {
+		pc.add(check, SeverityWarn, fmt.Sprintf("server_name is %q, expected %q", info.ServerName, domain),
+			"Set ServerInfoHandler.ServerName to the domain used to access the server.")
+	}
+
+	pubkey, err := base64.StdEncoding.DecodeString(info.PublicKey)
+	if err != nil || len(pubkey) != ed25519.PublicKeySize {
+		pc.add(check, SeverityFail, "pubkey is not a valid base64-encoded Ed25519 key", "")
+		return nil
+	}
+
+	if _, err := info.pubkey(); err != nil {
+		pc.add(check, SeverityFail, "fingerprint does not match pubkey", "")
+		return nil
+	}
+
+	sig, err := getSignature(res)
+	if err != nil {
+		pc.add(check, SeverityFail, "server info signature is missing or invalid: "+err.Error(),
+			"Make sure ServerInfoHandler.PrivateKey is set.")
+		return nil
+	}
+
+	if !ed25519.Verify(pubkey, data, sig) {
+		pc.add(check, SeverityFail, "server info signature does not match its pubkey",
+			"Make sure ServerInfoHandler.PublicKey and PrivateKey belong to the same keypair.")
+		return nil
+	}
+
+	pc.add(check, SeverityPass, "server info signature verifies", "")
+	return pubkey
+}
+
+// checkWebFinger checks the WebFinger endpoint and the descriptor endpoint it links to.
+func (pc *preflightChecker) checkWebFinger(scheme, domain, resource string, pubkey ed25519.PublicKey) {
+	const check = "webfinger"
+
+	u := url.URL{
+		Scheme:   scheme,
+		Host:     domain,
+		Path:     "/.well-known/webfinger",
+		RawQuery: "resource=" + url.QueryEscape(resource),
+	}
+
+	res, err := pc.client.Get(u.String())
+	if err != nil {
+		pc.add(check, SeverityFail, "webfinger request failed: "+err.Error(),
+			"Make sure a webfinger.Handler is mounted at /.well-known/webfinger.")
+		return
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		pc.add(check, SeverityFail, "webfinger returned "+res.Status,
+			"Make sure your DescriptorFunc can resolve "+resource+".")
+		return
+	}
+
+	pc.checkContentType(check, res, "application/jrd+json")
+
+	var wfdesc webfinger.Descriptor
+	if err := json.NewDecoder(io.LimitReader(res.Body, responseSizeLimit)).Decode(&wfdesc); err != nil {
+		pc.add(check, SeverityFail, "webfinger response is not valid JSON: "+err.Error(), "")
+		return
+	}
+
+	link, ok := wfdesc.LinkByType("application/x-pfd+json")
+	if !ok {
+		pc.add(check, SeverityFail, "webfinger response has no application/x-pfd+json link",
+			`Add a link with rel "self" and type "application/x-pfd+json" pointing to your descriptor endpoint.`)
+		return
+	}
+
+	pc.add(check, SeverityPass, "webfinger response links to a profile descriptor", "")
+	pc.checkDescriptor(link.Href, pubkey)
+}
+
+// checkDescriptor checks the descriptor endpoint at href.
+func (pc *preflightChecker) checkDescriptor(href string, pubkey ed25519.PublicKey) {
+	const check = "descriptor"
+
+	res, err := pc.client.Get(href)
+	if err != nil {
+		pc.add(check, SeverityFail, "descriptor request failed: "+err.Error(), "")
+		return
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		pc.add(check, SeverityFail, "descriptor endpoint returned "+res.Status, "")
+		return
+	}
+
+	pc.checkContentType(check, res, "application/x-pfd+json")
+
+	data, err := io.ReadAll(io.LimitReader(res.Body, responseSizeLimit))
+	if err != nil {
+		pc.add(check, SeverityFail, "failed to read descriptor: "+err.Error(), "")
+		return
+	}
+
+	if err := json.Unmarshal(data, &Descriptor{}); err != nil {
+		pc.add(check, SeverityFail, "descriptor is not valid JSON: "+err.Error(), "")
+		return
+	}
+
+	if pubkey == nil {
+		pc.add(check, SeverityWarn, "descriptor signature was not checked since the server key is unknown", "")
+		return
+	}
+
+	signingKey, err := certifiedKey(pubkey, res.Header.Get(keyCertHeader))
+	if err != nil {
+		pc.add(check, SeverityFail, "descriptor signing key certificate is invalid: "+err.Error(),
+			"Make sure Handler.KeyCertificate is signed by the key used by ServerInfoHandler and hasn't expired.")
+		return
+	}
+
+	sig, signed, err := responseSignature(res, data)
+	if err != nil || !ed25519.Verify(signingKey, signed, sig) {
+		pc.add(check, SeverityFail, "descriptor signature does not match the server key",
+			"Make sure Handler.PrivateKey is the same key used by ServerInfoHandler, or the key certified by Handler.KeyCertificate.")
+		return
+	}
+
+	pc.add(check, SeverityPass, "descriptor signature verifies", "")
+}
+
+// checkContentType adds a warning if res doesn't have the expected media type.
+func (pc *preflightChecker) checkContentType(check string, res *http.Response, expected string) {
+	mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	if mediaType != expected {
+		pc.add(check, SeverityWarn, fmt.Sprintf("content type is %q, expected %q", mediaType, expected),
+			"Check that no proxy or middleware is overriding the Content-Type header.")
+	}
+}
+
+// checkKeyFile checks the permissions of the private key file at path.
+func (pc *preflightChecker) checkKeyFile(path string) {
+	const check = "key-file"
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		pc.add(check, SeverityFail, "cannot stat key file: "+err.Error(), "")
+		return
+	}
+
+	if perm := fi.Mode().Perm(); perm&0o077 != 0 {
+		pc.add(check, SeverityFail, fmt.Sprintf("private key file is accessible by other users (mode %04o)", perm),
+			"Run chmod 600 on the private key file.")
+	} else {
+		pc.add(check, SeverityPass, "private key file permissions are restrictive", "")
+	}
+
+	if _, err := LoadPrivateKey(path); errors.Is(err, ErrEncryptedKey) {
+		pc.add(check, SeverityPass, "private key file is encrypted", "")
+	} else if err != nil {
+		pc.add(check, SeverityFail, "private key file is invalid: "+err.Error(), "")
+	}
+
+	if _, err := os.Stat(path + ".pub"); err != nil {
+		pc.add(check, SeverityWarn, "public key file is missing: "+err.Error(), "")
+	}
+}
@@ -0,0 +1,166 @@
+package profilefed
+
+import (
+	"crypto/ed25519"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"queerdevs.org/profilefed/webfinger"
+)
+
+// newPreflightServer returns a handler serving WebFinger, the given server
+// info, and a descriptor signed with priv, linked using the given scheme.
+func newPreflightServer(scheme string, sih ServerInfoHandler, priv ed25519.PrivateKey) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle("/.well-known/webfinger", webfinger.Handler{
+		DescriptorFunc: func(resource string) (*webfinger.Descriptor, error) {
+			return &webfinger.Descriptor{
+				Subject: resource,
+				Links: []webfinger.Link{{
+					Rel:  "self",
+					Type: "application/x-pfd+json",
+					Href: scheme + "://" + sih.ServerName + "/pfd/user",
+				}},
+			}, nil
+		},
+	})
+	mux.Handle("/_profilefed/server", sih)
+	mux.Handle("/pfd/user", Handler{
+		PrivateKey: priv,
+		DescriptorFunc: func(req *Request) (*Descriptor, error) {
+			return &Descriptor{ID: "main", Username: "user", DisplayName: "User"}, nil
+		},
+	})
+	return mux
+}
+
+// findingSeverities returns the severities of the findings of each check.
+func findingSeverities(findings []Finding) map[string][]Severity {
+	out := map[string][]Severity{}
+	for _, f := range findings {
+		out[f.Check] = append(out[f.Check], f.Severity)
+	}
+	return out
+}
+
+// hasSeverity reports whether any of sevs is sev.
+func hasSeverity(sevs []Severity, sev Severity) bool {
+	for _, s := range sevs {
+		if s == sev {
+			return true
+		}
+	}
+	return false
+}
+
+func TestPreflightTLS(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey error: %s", err)
+	}
+
+	mux := http.NewServeMux()
+	srv := httptest.NewTLSServer(mux)
+	t.Cleanup(srv.Close)
+	domain := srv.Listener.Addr().String()
+
+	mux.Handle("/", newPreflightServer("https", ServerInfoHandler{ServerName: domain, PublicKey: pub, PrivateKey: priv}, priv))
+
+	findings := Preflight(domain, PreflightOptions{Resource: "acct:user@" + domain, HTTPClient: srv.Client()})
+	for _, f := range findings {
+		if f.Severity != SeverityPass {
+			t.Errorf("Unexpected finding: %#v", f)
+		}
+	}
+
+	sevs := findingSeverities(findings)
+	for _, check := range []string{"https", "server-info", "webfinger", "descriptor"} {
+		if !hasSeverity(sevs[check], SeverityPass) {
+			t.Errorf("Check %s didn't pass: %v", check, sevs[check])
+		}
+	}
+}
+
+func TestPreflightFailures(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey error: %s", err)
+	}
+
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	domain := srv.Listener.Addr().String()
+
+	// Without TLS, the checks fall back to plain HTTP
+	sih := ServerInfoHandler{ServerName: "other.test", PublicKey: pub, PrivateKey: priv}
+	mux.Handle("/", newPreflightServer("http", sih, priv))
+
+	sevs := findingSeverities(Preflight(domain, PreflightOptions{}))
+	if !hasSeverity(sevs["https"], SeverityFail) {
+		t.Errorf("Expected https check to fail, got %v", sevs["https"])
+	}
+	if !hasSeverity(sevs["server-info"], SeverityWarn) {
+		t.Errorf("Expected a warning for the wrong server name, got %v", sevs["server-info"])
+	}
+	if !hasSeverity(sevs["server-info"], SeverityPass) {
+		t.Errorf("Expected the server info signature to verify, got %v", sevs["server-info"])
+	}
+
+	// Server info without a private key
+	mux = http.NewServeMux()
+	srv = httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	domain = srv.Listener.Addr().String()
+	mux.Handle("/", newPreflightServer("http", ServerInfoHandler{ServerName: domain, PublicKey: pub}, priv))
+
+	sevs = findingSeverities(Preflight(domain, PreflightOptions{}))
+	if !hasSeverity(sevs["server-info"], SeverityFail) || hasSeverity(sevs["server-info"], SeverityPass) {
+		t.Errorf("Expected server info check to fail without a key, got %v", sevs["server-info"])
+	}
+}
+
+func TestPreflightKeyFile(t *testing.T) {
+	dir := t.TempDir()
+
+	_, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey error: %s", err)
+	}
+
+	valid := filepath.Join(dir, "valid.key")
+	if err := SaveKeys(valid, priv); err != nil {
+		t.Fatalf("SaveKeys error: %s", err)
+	}
+
+	invalid := filepath.Join(dir, "invalid.key")
+	if err := os.WriteFile(invalid, []byte("not a key"), 0o600); err != nil {
+		t.Fatalf("WriteFile error: %s", err)
+	}
+
+	readable := filepath.Join(dir, "readable.key")
+	if err := SaveKeys(readable, priv); err != nil {
+		t.Fatalf("SaveKeys error: %s", err)
+	}
+	if err := os.Chmod(readable, 0o644); err != nil {
+		t.Fatalf("Chmod error: %s", err)
+	}
+
+	for path, ok := range map[string]bool{
+		valid:                             true,
+		invalid:                           false,
+		readable:                          false,
+		filepath.Join(dir, "missing.key"): false,
+	} {
+		pc := preflightChecker{}
+		pc.checkKeyFile(path)
+
+		sevs := findingSeverities(pc.findings)["key-file"]
+		if hasSeverity(sevs, SeverityFail) == ok {
+			t.Errorf("%s: unexpected findings: %#v", filepath.Base(path), pc.findings)
+		}
+	}
+}
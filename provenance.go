@@ -0,0 +1,95 @@
+package profilefed
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// Provenance describes where and when a verified descriptor was obtained.
+type Provenance struct {
+	// Resource is the WebFinger subject the descriptor was looked up for.
+	Resource string
+	// Host is the host that served the descriptor.
+	Host string
+	// URL is the URL the descriptor was fetched from.
+	URL string
+	// FetchedAt is the time at which the descriptor was fetched from the server.
+	FetchedAt time.Time
+	// FromCache is true if the descriptor was served from the client's cache.
+	FromCache bool
+	// ContentHash is the canonical content hash of the verified payload.
+	// Descriptors with the same content hash are identical, even if they
+	// were fetched from different hosts or via different aliases.
+	ContentHash string
+}
+
+// ContentHash returns the canonical content hash of v, which should be a descriptor
+// or a map of descriptors. The hash is computed over the canonical JSON encoding
+// of v, so it doesn't depend on the formatting used by the server that sent it.
+func ContentHash(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// contentHashJSON computes the canonical content hash of a raw descriptor
+// response. If all is true, data is expected to contain a map of descriptors.
+func contentHashJSON(data []byte, all bool) string {
+	if all {
+		var descs map[string]*Descriptor
+		if err := json.Unmarshal(data, &descs); err != nil {
+			return ""
+		}
+		return ContentHash(descs)
+	}
+
+	desc := &Descriptor{}
+	if err := json.Unmarshal(data, desc); err != nil {
+		return ""
+	}
+	return ContentHash(desc)
+}
+
+// GroupByContent groups copies of what's supposed to be the same profile
+// by their content hash. The copies map can be keyed by anything that
+// identifies where each copy came from, such as a host or alias. The
+// returned map contains the sorted keys of the copies for each hash.
+func GroupByContent(copies map[string]*Descriptor) map[string][]string {
+	out := map[string][]string{}
+	for key, desc := range copies {
+		hash := ContentHash(desc)
+		out[hash] = append(out[hash], key)
+	}
+	for _, keys := range out {
+		sort.Strings(keys)
+	}
+	return out
+}
+
+// Divergent reports whether the given copies of what's supposed to
+// be the same profile differ from each other in any way.
+func Divergent(copies map[string]*Descriptor) bool {
+	return len(GroupByContent(copies)) > 1
+}
+
+// LookupProvenance is the same as [Client.Lookup], but it also returns
+// the provenance of the descriptor.
+func (c Client) LookupProvenance(resource string) (*Descriptor, *Provenance, error) {
+	wfdesc, err := c.webfinger().LookupAcct(resource)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	out := &Descriptor{}
+	prov, err := c.lookup(wfdesc, lookupParams{}, out)
+	if err != nil {
+		return nil, nil, err
+	}
+	return out, prov, nil
+}
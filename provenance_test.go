@@ -0,0 +1,85 @@
+package profilefed
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestContentHash(t *testing.T) {
+	desc := &Descriptor{ID: "main", Username: "user", DisplayName: "User"}
+
+	hash := ContentHash(desc)
+	if !strings.HasPrefix(hash, "sha256:") {
+		t.Fatalf("Unexpected hash format: %q", hash)
+	}
+
+	// The hash doesn't depend on the formatting of the response
+	compact := `{"id":"main","username":"user","display_name":"User"}`
+	formatted := "{\n  \"display_name\": \"User\",\n  \"username\": \"user\",\n  \"id\": \"main\"\n}"
+	if contentHashJSON([]byte(compact), false) != hash || contentHashJSON([]byte(formatted), false) != hash {
+		t.Errorf("Hashes of differently formatted responses don't match")
+	}
+
+	all := `{"main":` + compact + `}`
+	if got := contentHashJSON([]byte(all), true); got != ContentHash(map[string]*Descriptor{"main": desc}) {
+		t.Errorf("Unexpected hash for all descriptors: %q", got)
+	}
+
+	if ContentHash(&Descriptor{ID: "main", Username: "user", DisplayName: "Other"}) == hash {
+		t.Errorf("Different descriptors have the same hash")
+	}
+
+	if contentHashJSON([]byte("not json"), false) != "" {
+		t.Errorf("Expected empty hash for invalid response")
+	}
+}
+
+func TestDivergent(t *testing.T) {
+	desc := &Descriptor{ID: "main", Username: "user", DisplayName: "User"}
+	same := &Descriptor{ID: "main", Username: "user", DisplayName: "User"}
+	other := &Descriptor{ID: "main", Username: "user", DisplayName: "Impostor"}
+
+	if Divergent(map[string]*Descriptor{"a.test": desc, "b.test": same}) {
+		t.Errorf("Identical copies reported as divergent")
+	}
+
+	copies := map[string]*Descriptor{"a.test": desc, "b.test": same, "c.test": other}
+	if !Divergent(copies) {
+		t.Errorf("Divergent copies not reported")
+	}
+
+	groups := GroupByContent(copies)
+	expected := map[string][]string{
+		ContentHash(desc):  {"a.test", "b.test"},
+		ContentHash(other): {"c.test"},
+	}
+	if !reflect.DeepEqual(groups, expected) {
+		t.Errorf("Unexpected groups: %v", groups)
+	}
+}
+
+func TestLookupProvenanceContentHash(t *testing.T) {
+	desc := &Descriptor{ID: "main", Username: "user", DisplayName: "User"}
+
+	mt := &MemoryTransport{}
+	mt.Register("a.test", newTenant(t, "a.test", desc))
+	mt.Register("b.test", newTenant(t, "b.test", desc))
+
+	c := mt.Client()
+	_, provA, err := c.LookupProvenance("user@a.test")
+	if err != nil {
+		t.Fatalf("LookupProvenance error: %s", err)
+	}
+	_, provB, err := c.LookupProvenance("user@b.test")
+	if err != nil {
+		t.Fatalf("LookupProvenance error: %s", err)
+	}
+
+	if provA.ContentHash != ContentHash(desc) || provA.ContentHash != provB.ContentHash {
+		t.Errorf("Unexpected content hashes: %q, %q", provA.ContentHash, provB.ContentHash)
+	}
+	if provA.Host != "a.test" || provB.Host != "b.test" {
+		t.Errorf("Unexpected hosts: %q, %q", provA.Host, provB.Host)
+	}
+}
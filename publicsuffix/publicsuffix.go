@@ -0,0 +1,174 @@
+// Package publicsuffix determines the public suffix and registrable domain of
+// host names using the [Public Suffix List], so that hosts can be compared by
+// the site they belong to. For example, profile.users.example.co.uk and
+// example.co.uk belong to the same site, but alice.github.io and bob.github.io
+// don't.
+//
+// An abridged snapshot of the list is embedded in this package and returned by
+// [Default]. Applications can load an up-to-date copy of the full list using
+// [Parse], and add their own private suffixes using [List.WithPrivate].
+//
+// [Public Suffix List]: https://publicsuffix.org
+package publicsuffix
+
+import (
+	"bufio"
+	"bytes"
+	_ "embed"
+	"errors"
+	"io"
+	"maps"
+	"strings"
+	"sync"
+)
+
+// ErrPublicSuffix signifies that a domain is itself a public
+// suffix, so it doesn't have a registrable domain.
+var ErrPublicSuffix = errors.New("domain is a public suffix")
+
+// privateMarker marks the beginning of the private section of the list.
+const privateMarker = "// ===BEGIN PRIVATE DOMAINS==="
+
+//go:embed public_suffix_list.dat
+var embeddedList []byte
+
+var defaultList = sync.OnceValue(func() *List {
+	l, err := Parse(bytes.NewReader(embeddedList))
+	if err != nil {
+		panic("publicsuffix: invalid embedded list: " + err.Error())
+	}
+	return l
+})
+
+// Default returns the list embedded in this package.
+func Default() *List {
+	return defaultList()
+}
+
+// List is a parsed public suffix list. Lists are immutable,
+// so they can be shared between goroutines.
+type List struct {
+	// rules maps the rules in the list, including their "*." or "!"
+	// prefixes, to whether they're in the private section.
+	rules map[string]bool
+}
+
+// Parse parses a list in the format of public_suffix_list.dat.
+// Rules after the "===BEGIN PRIVATE DOMAINS===" marker are
+// treated as private suffixes.
+func Parse(r io.Reader) (*List, error) {
+	l := &List{rules: map[string]bool{}}
+	private := false
+
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if strings.HasPrefix(line, privateMarker) {
+			private = true
+			continue
+		}
+		if line == "" || strings.HasPrefix(line, "//") {
+			continue
+		}
+
+		// Only the first field of each line is part of the rule
+		rule, _, _ := strings.Cut(line, " ")
+		l.rules[normalize(rule)] = private
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(l.rules) == 0 {
+		return nil, errors.New("publicsuffix: list contains no rules")
+	}
+	return l, nil
+}
+
+// WithPrivate returns a copy of the list with the given private suffixes added.
+// This is useful for services that give each user their own subdomain, such as
+// users.example.com, but aren't listed in the Public Suffix List.
+func (l *List) WithPrivate(suffixes ...string) *List {
+	out := &List{rules: maps.Clone(l.rules)}
+	for _, suffix := range suffixes {
+		out.rules[normalize(suffix)] = true
+	}
+	return out
+}
+
+// WithoutPrivate returns a copy of the list without its private suffixes,
+// so that, for example, all github.io subdomains belong to the same site.
+func (l *List) WithoutPrivate() *List {
+	out := &List{rules: map[string]bool{}}
+	for rule, private := range l.rules {
+		if !private {
+			out.rules[rule] = false
+		}
+	}
+	return out
+}
+
+// PublicSuffix returns the public suffix of domain, such as co.uk for
+// example.co.uk, and whether it's a private suffix. If no rule matches,
+// the last label of domain is its public suffix.
+func (l *List) PublicSuffix(domain string) (suffix string, private bool) {
+	domain = normalize(domain)
+	labels := strings.Split(domain, ".")
+
+	for i := range labels {
+		candidate := strings.Join(labels[i:], ".")
+
+		// Exception rules take precedence over the wildcard rules they override
+		if private, ok := l.rules["!"+candidate]; ok {
+			return strings.Join(labels[i+1:], "."), private
+		}
+
+		if private, ok := l.rules[candidate]; ok {
+			return candidate, private
+		}
+
+		if i < len(labels)-1 {
+			if private, ok := l.rules["*."+strings.Join(labels[i+1:], ".")]; ok {
+				return candidate, private
+			}
+		}
+	}
+
+	return labels[len(labels)-1], false
+}
+
+// Domain returns the registrable domain of domain, which is its public suffix
+// plus one more label, such as example.co.uk for profile.users.example.co.uk.
+// If domain is a public suffix, Domain returns [ErrPublicSuffix].
+func (l *List) Domain(domain string) (string, error) {
+	domain = normalize(domain)
+	suffix, _ := l.PublicSuffix(domain)
+	if len(suffix) >= len(domain) {
+		return "", ErrPublicSuffix
+	}
+
+	rest := strings.TrimSuffix(domain, "."+suffix)
+	i := strings.LastIndexByte(rest, '.')
+	return rest[i+1:] + "." + suffix, nil
+}
+
+// SameSite reports whether a and b have the same registrable domain.
+// Public suffixes are only the same site as themselves.
+func (l *List) SameSite(a, b string) bool {
+	a, b = normalize(a), normalize(b)
+	if a == b {
+		return true
+	}
+
+	da, err := l.Domain(a)
+	if err != nil {
+		return false
+	}
+	db, err := l.Domain(b)
+	return err == nil && da == db
+}
+
+// normalize converts a domain or rule to lower case and removes any trailing dot.
+func normalize(domain string) string {
+	return strings.TrimSuffix(strings.ToLower(domain), ".")
+}
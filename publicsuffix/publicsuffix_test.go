@@ -0,0 +1,68 @@
+package publicsuffix
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDomain(t *testing.T) {
+	l := Default()
+
+	tests := map[string]string{
+		"example.com":                 "example.com",
+		"profile.users.example.co.uk": "example.co.uk",
+		"Example.CO.UK.":              "example.co.uk",
+		"alice.github.io":             "alice.github.io",
+		"www.example.ck":              "www.example.ck",
+		"www.ck":                      "www.ck",
+		"foo.bar.kawasaki.jp":         "foo.bar.kawasaki.jp",
+		"www.city.kawasaki.jp":        "city.kawasaki.jp",
+		"social.example.unlisted-tld": "example.unlisted-tld",
+	}
+
+	for domain, expected := range tests {
+		got, err := l.Domain(domain)
+		if err != nil {
+			t.Fatalf("Domain error for %s: %s", domain, err)
+		}
+
+		if got != expected {
+			t.Errorf("Unexpected domain for %s: %q, expected %q", domain, got, expected)
+		}
+	}
+
+	for _, domain := range []string{"co.uk", "github.io", "example.ck"} {
+		if _, err := l.Domain(domain); !errors.Is(err, ErrPublicSuffix) {
+			t.Errorf("Expected ErrPublicSuffix for %s, got %v", domain, err)
+		}
+	}
+}
+
+func TestSameSite(t *testing.T) {
+	l := Default()
+
+	if !l.SameSite("profile.users.example.co.uk", "example.co.uk") {
+		t.Error("Expected subdomain to be the same site")
+	}
+
+	if l.SameSite("example.co.uk", "other.co.uk") {
+		t.Error("Expected domains under a public suffix to be different sites")
+	}
+
+	if l.SameSite("alice.github.io", "bob.github.io") {
+		t.Error("Expected domains under a private suffix to be different sites")
+	}
+
+	if !l.WithoutPrivate().SameSite("alice.github.io", "bob.github.io") {
+		t.Error("Expected private suffixes to be ignored")
+	}
+
+	custom := l.WithPrivate("users.example.com")
+	if custom.SameSite("alice.users.example.com", "bob.users.example.com") {
+		t.Error("Expected custom private suffix to separate sites")
+	}
+
+	if !l.SameSite("alice.users.example.com", "bob.users.example.com") {
+		t.Error("Expected custom private suffix not to modify the original list")
+	}
+}
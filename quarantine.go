@@ -0,0 +1,59 @@
+package profilefed
+
+import "errors"
+
+// QuarantineHost freezes trust in the given server, for example after its key
+// has been publicly compromised. Until the quarantine is cleared with
+// [Client.ClearQuarantine], every response from the server is rejected with
+// [ErrHostQuarantined], including cached ones, and so is any server that claims
+// it as a previous name.
+//
+// The quarantine is persisted using SetQuarantined, so it requires the client's
+// keystore to support it.
+func (c Client) QuarantineHost(serverName string) error {
+	if c.SetQuarantined == nil {
+		return errors.New("client keystore does not support quarantine")
+	}
+	serverName = normalizeHost(serverName)
+	if err := c.SetQuarantined(serverName, true); err != nil {
+		return err
+	}
+	c.emit(KeyEvent{Type: KeyEventQuarantined, ServerName: serverName})
+	return nil
+}
+
+// ClearQuarantine lifts the quarantine of the given server. The server's
+// pinned key is kept, so if it has rotated its key since it was quarantined,
+// the rotation still has to be signed by the pinned key to be accepted.
+func (c Client) ClearQuarantine(serverName string) error {
+	if c.SetQuarantined == nil {
+		return errors.New("client keystore does not support quarantine")
+	}
+	serverName = normalizeHost(serverName)
+	if err := c.SetQuarantined(serverName, false); err != nil {
+		return err
+	}
+	c.emit(KeyEvent{Type: KeyEventQuarantineCleared, ServerName: serverName})
+	return nil
+}
+
+// checkQuarantine returns [ErrHostQuarantined] if any of the given servers is quarantined.
+func (c Client) checkQuarantine(serverNames ...string) error {
+	if c.IsQuarantined == nil {
+		return nil
+	}
+
+	for _, name := range normalizeHosts(serverNames) {
+		quarantined, err := c.IsQuarantined(name)
+		if err != nil {
+			return err
+		}
+
+		if quarantined {
+			c.observe(name, OutcomeQuarantineHit)
+			return ErrHostQuarantined
+		}
+	}
+
+	return nil
+}
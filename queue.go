@@ -0,0 +1,215 @@
+package profilefed
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultPollInterval is how often a [Deliverer] checks its queue for due
+// deliveries if its PollInterval is zero.
+const DefaultPollInterval = time.Second
+
+// ErrDeliveryNotFound signifies that a delivery doesn't exist in a [DeliveryQueue].
+var ErrDeliveryNotFound = errors.New("delivery not found")
+
+// QueuedDelivery is a message waiting in a [DeliveryQueue].
+type QueuedDelivery struct {
+	// Message is the message to deliver. Its ID identifies the delivery.
+	Message *Message `json:"message"`
+	// Attempts is the number of failed delivery attempts so far.
+	Attempts int `json:"attempts"`
+	// NextAttempt is the time at which the next attempt is due.
+	NextAttempt time.Time `json:"next_attempt"`
+	// LastError describes why the last attempt failed, if there was one.
+	LastError string `json:"last_error,omitempty"`
+	// Dead is true if the delivery was given up on, either because it failed
+	// permanently or because it reached the maximum number of attempts.
+	// Dead letters stay in the queue until they're removed or retried.
+	Dead bool `json:"dead,omitempty"`
+}
+
+// DeliveryQueue stores outbound messages until they're delivered by a [Deliverer],
+// so that deliveries survive restarts. See [MemoryQueue] and the pfdqueue package
+// for implementations.
+type DeliveryQueue interface {
+	// Put stores a delivery, replacing any existing delivery with the same message ID.
+	Put(d *QueuedDelivery) error
+	// Get returns the delivery of the message with the given ID,
+	// or [ErrDeliveryNotFound] if there isn't one.
+	Get(id string) (*QueuedDelivery, error)
+	// Remove removes the delivery of the message with the given ID, if it exists.
+	Remove(id string) error
+	// Due returns up to limit deliveries that aren't dead and whose next
+	// attempt is due at now, ordered by the time their attempt is due.
+	Due(now time.Time, limit int) ([]*QueuedDelivery, error)
+	// DeadLetters returns all the deliveries that were given up on.
+	DeadLetters() ([]*QueuedDelivery, error)
+}
+
+// MemoryQueue is an in-memory, thread-safe [DeliveryQueue]. Deliveries don't
+// survive restarts, so it's mostly useful for tests. The zero value is ready to use.
+type MemoryQueue struct {
+	mtx        sync.Mutex
+	deliveries map[string]QueuedDelivery
+}
+
+// Put implements the [DeliveryQueue] interface
+func (mq *MemoryQueue) Put(d *QueuedDelivery) error {
+	mq.mtx.Lock()
+	defer mq.mtx.Unlock()
+
+	if mq.deliveries == nil {
+		mq.deliveries = map[string]QueuedDelivery{}
+	}
+	mq.deliveries[d.Message.ID] = *d
+	return nil
+}
+
+// Get implements the [DeliveryQueue] interface
+func (mq *MemoryQueue) Get(id string) (*QueuedDelivery, error) {
+	mq.mtx.Lock()
+	defer mq.mtx.Unlock()
+
+	d, ok := mq.deliveries[id]
+	if !ok {
+		return nil, ErrDeliveryNotFound
+	}
+	return &d, nil
+}
+
+// Remove implements the [DeliveryQueue] interface
+func (mq *MemoryQueue) Remove(id string) error {
+	mq.mtx.Lock()
+	defer mq.mtx.Unlock()
+	delete(mq.deliveries, id)
+	return nil
+}
+
+// Due implements the [DeliveryQueue] interface
+func (mq *MemoryQueue) Due(now time.Time, limit int) ([]*QueuedDelivery, error) {
+	mq.mtx.Lock()
+	defer mq.mtx.Unlock()
+
+	var out []*QueuedDelivery
+	for _, d := range mq.deliveries {
+		if !d.Dead && !d.NextAttempt.After(now) {
+			out = append(out, &d)
+		}
+	}
+	return SortDeliveries(out, limit), nil
+}
+
+// DeadLetters implements the [DeliveryQueue] interface
+func (mq *MemoryQueue) DeadLetters() ([]*QueuedDelivery, error) {
+	mq.mtx.Lock()
+	defer mq.mtx.Unlock()
+
+	var out []*QueuedDelivery
+	for _, d := range mq.deliveries {
+		if d.Dead {
+			out = append(out, &d)
+		}
+	}
+	return SortDeliveries(out, 0), nil
+}
+
+// SortDeliveries sorts deliveries by the time their next attempt is due, and
+// returns at most limit of them. If limit is zero, all of them are returned.
+// It's useful for implementing [DeliveryQueue].
+func SortDeliveries(deliveries []*QueuedDelivery, limit int) []*QueuedDelivery {
+	sort.Slice(deliveries, func(i, j int) bool {
+		if !deliveries[i].NextAttempt.Equal(deliveries[j].NextAttempt) {
+			return deliveries[i].NextAttempt.Before(deliveries[j].NextAttempt)
+		}
+		return deliveries[i].Message.ID < deliveries[j].Message.ID
+	})
+
+	if limit > 0 && len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+	return deliveries
+}
+
+// Enqueue adds msg to the deliverer's queue, so that it's delivered by [Deliverer.Run].
+func (d Deliverer) Enqueue(msg *Message) error {
+	return d.Queue.Put(&QueuedDelivery{Message: msg, NextAttempt: time.Now()})
+}
+
+// Run delivers the messages in the deliverer's queue until ctx is canceled.
+// Failed deliveries are retried on the same schedule as [Deliverer.Deliver],
+// and once they fail permanently or reach MaxAttempts, they're kept as dead
+// letters, which can be inspected using the queue's DeadLetters method.
+func (d Deliverer) Run(ctx context.Context) error {
+	interval := d.PollInterval
+	if interval == 0 {
+		interval = DefaultPollInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := d.ProcessQueue(ctx); err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// ProcessQueue makes a delivery attempt for every message in the deliverer's
+// queue that's due. It's called periodically by [Deliverer.Run].
+func (d Deliverer) ProcessQueue(ctx context.Context) error {
+	due, err := d.Queue.Due(time.Now(), 100)
+	if err != nil {
+		return err
+	}
+
+	for _, qd := range due {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		err := d.attempt(ctx, qd.Message)
+		if err == nil {
+			if err := d.Queue.Remove(qd.Message.ID); err != nil {
+				return err
+			}
+			continue
+		}
+
+		qd.Attempts++
+		qd.LastError = err.Error()
+		if !retryable(err) || qd.Attempts >= d.maxAttempts() {
+			d.Client.tracef("giving up on delivery of message %s to %s: %s", qd.Message.ID, qd.Message.To, err)
+			qd.Dead = true
+		} else {
+			qd.NextAttempt = time.Now().Add(d.retryDelay(qd.Attempts, err))
+		}
+
+		if err := d.Queue.Put(qd); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RetryDeadLetter moves the dead letter with the given message
+// ID back into the queue, resetting its number of attempts.
+func (d Deliverer) RetryDeadLetter(id string) error {
+	qd, err := d.Queue.Get(id)
+	if err != nil {
+		return err
+	}
+
+	qd.Dead, qd.Attempts, qd.NextAttempt = false, 0, time.Now()
+	return d.Queue.Put(qd)
+}
@@ -0,0 +1,88 @@
+package profilefed
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestDelivererQueue(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey error: %s", err)
+	}
+
+	mt := &MemoryTransport{}
+	mt.Register("sender.test", ServerInfoHandler{ServerName: "sender.test", PublicKey: pub, PrivateKey: priv})
+
+	received := 0
+	inbox := &InboxHandler{
+		ServerName: "receiver.test",
+		Client:     mt.Client(),
+		Scheme:     "http",
+		Handlers: map[string]MessageHandlerFunc{
+			"ping": func(req *http.Request, msg *Message) error {
+				received++
+				return nil
+			},
+		},
+	}
+
+	available := false
+	mt.Register("receiver.test", http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if !available {
+			http.Error(res, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		inbox.ServeHTTP(res, req)
+	}))
+
+	q := &MemoryQueue{}
+	d := Deliverer{PrivateKey: priv, Client: mt.Client(), Scheme: "http", Queue: q, MaxAttempts: 2, Backoff: time.Nanosecond}
+
+	msg, err := NewMessage("sender.test", "receiver.test", "ping", nil)
+	if err != nil {
+		t.Fatalf("NewMessage error: %s", err)
+	}
+
+	if err := d.Enqueue(msg); err != nil {
+		t.Fatalf("Enqueue error: %s", err)
+	}
+
+	// Both attempts fail, so the delivery becomes a dead letter
+	for range 2 {
+		time.Sleep(time.Millisecond)
+		if err := d.ProcessQueue(context.Background()); err != nil {
+			t.Fatalf("ProcessQueue error: %s", err)
+		}
+	}
+
+	letters, err := q.DeadLetters()
+	if err != nil {
+		t.Fatalf("DeadLetters error: %s", err)
+	}
+
+	if len(letters) != 1 || letters[0].Attempts != 2 || letters[0].LastError == "" {
+		t.Fatalf("Unexpected dead letters: %#v", letters)
+	}
+
+	available = true
+	if err := d.RetryDeadLetter(msg.ID); err != nil {
+		t.Fatalf("RetryDeadLetter error: %s", err)
+	}
+
+	if err := d.ProcessQueue(context.Background()); err != nil {
+		t.Fatalf("ProcessQueue error: %s", err)
+	}
+
+	if received != 1 {
+		t.Errorf("Unexpected number of received messages: %d", received)
+	}
+
+	if _, err := q.Get(msg.ID); !errors.Is(err, ErrDeliveryNotFound) {
+		t.Errorf("Expected delivered message to be removed, got %v", err)
+	}
+}
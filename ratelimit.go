@@ -0,0 +1,100 @@
+package profilefed
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// maxBuckets is the amount of client buckets a [RateLimiter] keeps
+// before it starts pruning ones that have fully refilled.
+const maxBuckets = 10_000
+
+// RateLimiter is a simple per-client token bucket rate limiter.
+type RateLimiter struct {
+	// Rate is the number of requests per second each client is allowed to make.
+	Rate float64
+	// Burst is the maximum number of requests a client can make at once.
+	Burst int
+	// KeyFunc returns the key used to identify a client. If nil, [ClientIP] is used.
+	KeyFunc func(req *http.Request) string
+
+	mtx     sync.Mutex
+	buckets map[string]*bucket
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter creates a new rate limiter that allows rate requests
+// per second for each client, with bursts of up to burst requests.
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	return &RateLimiter{Rate: rate, Burst: burst}
+}
+
+// Key returns the key used to identify the client that made the request.
+func (rl *RateLimiter) Key(req *http.Request) string {
+	if rl.KeyFunc != nil {
+		return rl.KeyFunc(req)
+	}
+	return ClientIP(req)
+}
+
+// Allow reports whether the client that made the given request
+// is allowed to make another request.
+func (rl *RateLimiter) Allow(req *http.Request) bool {
+	return rl.AllowKey(rl.Key(req))
+}
+
+// AllowKey reports whether the client identified by key
+// is allowed to make another request.
+func (rl *RateLimiter) AllowKey(key string) bool {
+	rl.mtx.Lock()
+	defer rl.mtx.Unlock()
+
+	now := time.Now()
+	if rl.buckets == nil {
+		rl.buckets = map[string]*bucket{}
+	}
+
+	b, ok := rl.buckets[key]
+	if !ok {
+		if len(rl.buckets) >= maxBuckets {
+			rl.prune(now)
+		}
+		b = &bucket{tokens: float64(rl.Burst), last: now}
+		rl.buckets[key] = b
+	}
+
+	b.tokens = min(float64(rl.Burst), b.tokens+now.Sub(b.last).Seconds()*rl.Rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// prune removes any buckets that would have fully refilled by now.
+func (rl *RateLimiter) prune(now time.Time) {
+	for key, b := range rl.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*rl.Rate >= float64(rl.Burst) {
+			delete(rl.buckets, key)
+		}
+	}
+}
+
+// ClientIP returns the IP address of the client that made the request.
+// It doesn't take any proxy headers into account, so if your server is
+// behind a reverse proxy, you should provide your own key function.
+func ClientIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
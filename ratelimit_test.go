@@ -0,0 +1,40 @@
+package profilefed
+
+import (
+	"crypto/ed25519"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandlerRateLimit(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey error: %s", err)
+	}
+
+	h := Handler{
+		PrivateKey:  priv,
+		RateLimiter: NewRateLimiter(0.001, 2),
+		DescriptorFunc: func(req *Request) (*Descriptor, error) {
+			return &Descriptor{ID: "main", Username: "user", DisplayName: "User"}, nil
+		},
+	}
+
+	for i, expected := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/pfd/user", nil))
+		if rec.Code != expected {
+			t.Errorf("Request %d: expected %d, got %d", i, expected, rec.Code)
+		}
+	}
+
+	// Other clients have their own buckets
+	req := httptest.NewRequest(http.MethodGet, "/pfd/user", nil)
+	req.RemoteAddr = "198.51.100.1:1234"
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 for another client, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,197 @@
+package profilefed
+
+import (
+	"crypto"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// maxRedirects is the maximum number of signed redirects followed in a single lookup.
+	maxRedirects = 5
+
+	// redirectPrefix is prepended to redirect documents before they're signed,
+	// so that a redirect signature can't be mistaken for the signature of
+	// a descriptor or any other signed response, and vice versa.
+	redirectPrefix = "profilefed-redirect:"
+)
+
+var (
+	// ErrTooManyRedirects signifies that a descriptor endpoint redirected the client too many times.
+	ErrTooManyRedirects = errors.New("too many descriptor redirects")
+	// ErrInvalidRedirect signifies that a signed redirect doesn't apply to the requested endpoint.
+	ErrInvalidRedirect = errors.New("invalid descriptor redirect")
+
+	// errMoved is returned by fetchDescriptor if the server responded
+	// with a signed redirect, which still has to be verified.
+	errMoved = errors.New("descriptor endpoint moved")
+)
+
+// redirectData is the signed redirect document served by
+// descriptor endpoints that have permanently moved.
+type redirectData struct {
+	// Path is the path of the endpoint that moved. It prevents the document
+	// from being replayed in response to requests for other endpoints.
+	Path     string `json:"path"`
+	Location string `json:"location"`
+	// IssuedAt and ExpiresAt are the Unix times at which the redirect was
+	// signed and stops being valid, so that it can't be replayed forever.
+	IssuedAt  int64 `json:"issued"`
+	ExpiresAt int64 `json:"expires"`
+}
+
+// movedError is returned by [Client.fetch] once a signed redirect has been
+// verified, so that the lookup can continue at the new location.
+type movedError struct {
+	location *url.URL
+}
+
+func (me *movedError) Error() string {
+	return "descriptor endpoint moved to " + me.location.String()
+}
+
+// serveMoved responds with a signed redirect to h.MovedTo, keeping the query
+// parameters of the request, so that clients that don't verify the redirect
+// can still follow it. The redirect expires after the handler's EnvelopeTTL.
+func (h Handler) serveMoved(res http.ResponseWriter, req *http.Request, signer crypto.Signer) {
+	ttl := h.EnvelopeTTL
+	if ttl == 0 {
+		ttl = DefaultEnvelopeTTL
+	}
+
+	now := time.Now()
+	data, err := json.Marshal(redirectData{
+		Path:      req.URL.Path,
+		Location:  h.MovedTo,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(ttl).Unix(),
+	})
+	if err != nil {
+		h.ErrorHandler(err, res)
+		return
+	}
+
+	sig, err := sign(signer, append([]byte(redirectPrefix), data...))
+	if err != nil {
+		h.ErrorHandler(err, res)
+		return
+	}
+
+	location := h.MovedTo
+	if req.URL.RawQuery != "" {
+		if strings.Contains(location, "?") {
+			location += "&" + req.URL.RawQuery
+		} else {
+			location += "?" + req.URL.RawQuery
+		}
+	}
+
+	// Redirects are always signed using the X-ProfileFed-Sig header,
+	// since clients use it to tell signed redirects apart.
+	res.Header().Set("Location", location)
+	res.Header().Set("Content-Type", "application/json")
+	res.Header().Set("X-ProfileFed-Sig", base64.StdEncoding.EncodeToString(sig))
+	if h.KeyCertificate != nil {
+		res.Header().Set(keyCertHeader, h.KeyCertificate.String())
+	}
+	setContentDigest(res.Header(), data)
+	res.Header().Set("Date", now.UTC().Format(http.TimeFormat))
+	res.WriteHeader(http.StatusPermanentRedirect)
+	res.Write(data)
+}
+
+// isRedirect reports whether status is a redirect status code.
+func isRedirect(status int) bool {
+	switch status {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	default:
+		return false
+	}
+}
+
+// followRedirect checks a verified redirect document received in response
+// to a request for pfdURL, and records the new location of the endpoint.
+// Expired redirects, and redirects from HTTPS to plain HTTP, are rejected.
+// It returns a [movedError] containing the new location.
+func (c Client) followRedirect(pfdURL *url.URL, data []byte) error {
+	var rd redirectData
+	if err := json.Unmarshal(data, &rd); err != nil {
+		return err
+	}
+
+	if rd.Path != pfdURL.Path || rd.IssuedAt == 0 || rd.ExpiresAt == 0 {
+		return ErrInvalidRedirect
+	}
+
+	now := time.Now()
+	if now.After(time.Unix(rd.ExpiresAt, 0)) {
+		return ErrStaleDescriptor
+	}
+	if c.MaxDescriptorAge > 0 && now.Sub(time.Unix(rd.IssuedAt, 0)) > c.MaxDescriptorAge {
+		return ErrStaleDescriptor
+	}
+
+	location, err := pfdURL.Parse(rd.Location)
+	if err != nil {
+		return err
+	}
+
+	if location.Scheme != "http" && location.Scheme != "https" {
+		return ErrInvalidRedirect
+	}
+
+	// A downgrade would expose the client's bearer token
+	if pfdURL.Scheme == "https" && location.Scheme != "https" {
+		return ErrInvalidRedirect
+	}
+
+	c.tracef("following signed redirect from %s to %s", endpointKey(pfdURL), endpointKey(location))
+	if c.SaveEndpoint != nil {
+		err = c.SaveEndpoint(endpointKey(pfdURL), endpointKey(location))
+		if err != nil {
+			return err
+		}
+	}
+
+	return &movedError{location: location}
+}
+
+// movedEndpoint returns the URL that the endpoint at pfdURL has moved to,
+// according to a previously followed redirect. If it hasn't moved,
+// pfdURL is returned.
+func (c Client) movedEndpoint(pfdURL *url.URL) (*url.URL, error) {
+	if c.GetEndpoint == nil {
+		return pfdURL, nil
+	}
+
+	moved, err := c.GetEndpoint(endpointKey(pfdURL))
+	if err != nil {
+		return nil, err
+	}
+
+	if moved == "" {
+		return pfdURL, nil
+	}
+	return url.Parse(moved)
+}
+
+// endpointKey returns the URL of the endpoint at u, without
+// the query parameters added by the client for a lookup.
+func endpointKey(u *url.URL) string {
+	q := u.Query()
+	for _, param := range []string{"id", "all", "fields", ShareParam} {
+		q.Del(param)
+	}
+
+	out := *u
+	out.RawQuery = q.Encode()
+	out.Fragment = ""
+	return out.String()
+}
@@ -0,0 +1,61 @@
+package profilefed
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Request represents a parsed descriptor request.
+type Request struct {
+	// ID is the requested descriptor ID, from the id query parameter.
+	// If it's empty, the server may decide which descriptor to respond with.
+	ID string
+	// All is true if the client requested all of the user's descriptors.
+	All bool
+	// Fields contains the descriptor fields the client requested, from the
+	// comma-separated fields query parameter. If it's empty, all fields
+	// should be returned.
+	Fields []string
+	// Version is the descriptor version requested by the client, from
+	// the version query parameter, if any.
+	Version string
+	// Query contains all the query parameters of the request, including
+	// custom ones that aren't defined by ProfileFed.
+	Query url.Values
+	// HTTPRequest is the underlying HTTP request.
+	HTTPRequest *http.Request
+}
+
+// Context returns the context of the underlying HTTP request.
+func (r *Request) Context() context.Context {
+	return r.HTTPRequest.Context()
+}
+
+// Visibility returns the visibility tier that applies to the request.
+// See [RequestVisibility] for details.
+func (r *Request) Visibility() Visibility {
+	return RequestVisibility(r.HTTPRequest)
+}
+
+// parseRequest parses the ProfileFed query parameters of req.
+func parseRequest(req *http.Request) *Request {
+	q := req.URL.Query()
+
+	out := &Request{
+		ID:          q.Get("id"),
+		All:         q.Get("all") == "1",
+		Version:     q.Get("version"),
+		Query:       q,
+		HTTPRequest: req,
+	}
+
+	for _, field := range strings.Split(q.Get("fields"), ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			out.Fields = append(out.Fields, field)
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,182 @@
+package profilefed
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// NewDoHResolver returns a resolver that sends all DNS queries to the given
+// DNS-over-HTTPS endpoint (RFC 8484), such as https://cloudflare-dns.com/dns-query.
+//
+// The endpoint itself is contacted using httpClient, which should not use the
+// returned resolver, since that would make it impossible to resolve the endpoint.
+// If httpClient is nil, [http.DefaultClient] is used.
+func NewDoHResolver(endpoint string, httpClient *http.Client) *net.Resolver {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return &dohConn{ctx: ctx, endpoint: endpoint, client: httpClient}, nil
+		},
+	}
+}
+
+// NewDoTResolver returns a resolver that sends all DNS queries to the given
+// DNS-over-TLS server (RFC 7858). The addr parameter should contain the host
+// and port of the server, such as 1.1.1.1:853, and serverName should contain
+// the name used to verify its certificate, such as cloudflare-dns.com.
+func NewDoTResolver(addr, serverName string) *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			d := tls.Dialer{Config: &tls.Config{ServerName: serverName, MinVersion: tls.VersionTLS12}}
+			return d.DialContext(ctx, "tcp", addr)
+		},
+	}
+}
+
+// dohConn is a fake stream connection used by the Go DNS resolver. It collects
+// length-prefixed DNS messages written to it, sends them to a DoH endpoint,
+// and returns the length-prefixed responses on subsequent reads.
+type dohConn struct {
+	ctx      context.Context
+	endpoint string
+	client   *http.Client
+
+	mtx      sync.Mutex
+	wbuf     bytes.Buffer
+	rbuf     bytes.Buffer
+	deadline time.Time
+	closed   bool
+}
+
+func (dc *dohConn) Write(b []byte) (int, error) {
+	dc.mtx.Lock()
+	defer dc.mtx.Unlock()
+
+	if dc.closed {
+		return 0, net.ErrClosed
+	}
+
+	dc.wbuf.Write(b)
+	for dc.wbuf.Len() >= 2 {
+		msgLen := int(binary.BigEndian.Uint16(dc.wbuf.Bytes()[:2]))
+		if dc.wbuf.Len() < 2+msgLen {
+			break
+		}
+
+		msg := make([]byte, msgLen)
+		dc.wbuf.Next(2)
+		dc.wbuf.Read(msg)
+
+		resp, err := dc.query(msg)
+		if err != nil {
+			return 0, err
+		}
+
+		binary.Write(&dc.rbuf, binary.BigEndian, uint16(len(resp)))
+		dc.rbuf.Write(resp)
+	}
+
+	return len(b), nil
+}
+
+func (dc *dohConn) Read(b []byte) (int, error) {
+	dc.mtx.Lock()
+	defer dc.mtx.Unlock()
+
+	if dc.closed {
+		return 0, net.ErrClosed
+	}
+
+	if dc.rbuf.Len() == 0 {
+		return 0, io.EOF
+	}
+	return dc.rbuf.Read(b)
+}
+
+// query sends a single DNS message to the DoH endpoint and returns the response.
+func (dc *dohConn) query(msg []byte) ([]byte, error) {
+	ctx := dc.ctx
+	if !dc.deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, dc.deadline)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, dc.endpoint, bytes.NewReader(msg))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+
+	res, err := dc.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if err := checkResp(res, "dohQuery"); err != nil {
+		return nil, err
+	}
+
+	resp, err := io.ReadAll(io.LimitReader(res.Body, 65535))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(resp) == 0 {
+		return nil, errors.New("empty doh response")
+	}
+	return resp, nil
+}
+
+func (dc *dohConn) Close() error {
+	dc.mtx.Lock()
+	defer dc.mtx.Unlock()
+	dc.closed = true
+	return nil
+}
+
+func (dc *dohConn) SetDeadline(t time.Time) error {
+	dc.mtx.Lock()
+	defer dc.mtx.Unlock()
+	dc.deadline = t
+	return nil
+}
+
+func (dc *dohConn) SetReadDeadline(t time.Time) error  { return nil }
+func (dc *dohConn) SetWriteDeadline(t time.Time) error { return dc.SetDeadline(t) }
+func (dc *dohConn) LocalAddr() net.Addr                { return dohAddr{} }
+func (dc *dohConn) RemoteAddr() net.Addr               { return dohAddr{} }
+
+type dohAddr struct{}
+
+func (dohAddr) Network() string { return "doh" }
+func (dohAddr) String() string  { return "doh" }
+
+// WithResolver returns a copy of the client that uses r to resolve host
+// names for all its outgoing connections. This can be used to override
+// the resolver for individual lookups, for example in tests.
+func (c Client) WithResolver(r *net.Resolver) Client {
+	policy := &TransportPolicy{}
+	if c.Policy != nil {
+		// The clients configured for the old policy use the old resolver
+		policy = cloneExported(c.Policy)
+	}
+	policy.Resolver = r
+	c.Policy = policy
+	return c
+}
@@ -0,0 +1,169 @@
+package profilefed
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// dohHandler answers every A query with 127.0.0.1 and every other query
+// with an empty answer, counting the queries it receives.
+func dohHandler(queries *atomic.Int32) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost || req.Header.Get("Content-Type") != "application/dns-message" {
+			http.Error(res, "bad request", http.StatusBadRequest)
+			return
+		}
+
+		msg, err := io.ReadAll(req.Body)
+		if err != nil || len(msg) < 12 {
+			http.Error(res, "bad request", http.StatusBadRequest)
+			return
+		}
+		queries.Add(1)
+
+		// Skip the question name to find the end of the question
+		end := 12
+		for end < len(msg) && msg[end] != 0 {
+			end += int(msg[end]) + 1
+		}
+		end += 5
+		if end > len(msg) {
+			http.Error(res, "bad request", http.StatusBadRequest)
+			return
+		}
+		qtype := binary.BigEndian.Uint16(msg[end-4 : end-2])
+
+		resp := append([]byte{}, msg[:end]...)
+		binary.BigEndian.PutUint16(resp[2:], 0x8180)
+		binary.BigEndian.PutUint16(resp[6:], 0)
+		binary.BigEndian.PutUint16(resp[8:], 0)
+		binary.BigEndian.PutUint16(resp[10:], 0)
+		if qtype == 1 {
+			binary.BigEndian.PutUint16(resp[6:], 1)
+			resp = append(resp,
+				0xc0, 0x0c, // Pointer to the question name
+				0, 1, 0, 1, // Type A, class IN
+				0, 0, 0, 60, // TTL
+				0, 4, 127, 0, 0, 1,
+			)
+		}
+
+		res.Header().Set("Content-Type", "application/dns-message")
+		res.Write(resp)
+	}
+}
+
+func TestDoHResolver(t *testing.T) {
+	var queries atomic.Int32
+	srv := httptest.NewServer(dohHandler(&queries))
+	defer srv.Close()
+
+	r := NewDoHResolver(srv.URL, srv.Client())
+	addrs, err := r.LookupHost(context.Background(), "profile.example.")
+	if err != nil {
+		t.Fatalf("LookupHost error: %s", err)
+	}
+	if len(addrs) != 1 || addrs[0] != "127.0.0.1" {
+		t.Errorf("expected [127.0.0.1], got %v", addrs)
+	}
+	if queries.Load() == 0 {
+		t.Error("expected the resolver to query the DoH endpoint")
+	}
+}
+
+func TestDoHConnFraming(t *testing.T) {
+	var queries atomic.Int32
+	srv := httptest.NewServer(dohHandler(&queries))
+	defer srv.Close()
+
+	query := []byte{
+		0x12, 0x34, 0x01, 0x00, 0, 1, 0, 0, 0, 0, 0, 0,
+		7, 'p', 'r', 'o', 'f', 'i', 'l', 'e', 7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 0,
+		0, 1, 0, 1,
+	}
+	framed := binary.BigEndian.AppendUint16(nil, uint16(len(query)))
+	framed = append(framed, query...)
+
+	dc := &dohConn{ctx: context.Background(), endpoint: srv.URL, client: srv.Client()}
+
+	// A message split across writes is only sent once it's complete
+	if _, err := dc.Write(framed[:1]); err != nil {
+		t.Fatalf("Write error: %s", err)
+	}
+	if _, err := dc.Write(framed[1:10]); err != nil {
+		t.Fatalf("Write error: %s", err)
+	}
+	if n := queries.Load(); n != 0 {
+		t.Fatalf("expected no queries for a partial message, got %d", n)
+	}
+	if _, err := dc.Read(make([]byte, 2)); err != io.EOF {
+		t.Fatalf("expected EOF before a response, got %v", err)
+	}
+
+	// The rest of the message and a second message in one write
+	if _, err := dc.Write(append(framed[10:], framed...)); err != nil {
+		t.Fatalf("Write error: %s", err)
+	}
+	if n := queries.Load(); n != 2 {
+		t.Fatalf("expected 2 queries, got %d", n)
+	}
+
+	for i := range 2 {
+		var msgLen uint16
+		if err := binary.Read(dc, binary.BigEndian, &msgLen); err != nil {
+			t.Fatalf("response %d: Read error: %s", i, err)
+		}
+		resp := make([]byte, msgLen)
+		if _, err := io.ReadFull(dc, resp); err != nil {
+			t.Fatalf("response %d: Read error: %s", i, err)
+		}
+		if resp[0] != 0x12 || resp[1] != 0x34 {
+			t.Errorf("response %d: expected ID 0x1234, got %#x", i, resp[:2])
+		}
+		if ancount := binary.BigEndian.Uint16(resp[6:8]); ancount != 1 {
+			t.Errorf("response %d: expected 1 answer, got %d", i, ancount)
+		}
+	}
+
+	if err := dc.Close(); err != nil {
+		t.Fatalf("Close error: %s", err)
+	}
+	if _, err := dc.Write(framed); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("expected net.ErrClosed after Close, got %v", err)
+	}
+}
+
+func TestDoHConnHTTPError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, _ *http.Request) {
+		http.Error(res, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	dc := &dohConn{ctx: context.Background(), endpoint: srv.URL, client: srv.Client()}
+	_, err := dc.Write([]byte{0, 2, 0x12, 0x34})
+
+	var herr *HTTPError
+	if !errors.As(err, &herr) || herr.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected a 503 HTTPError, got %v", err)
+	}
+}
+
+func TestWithResolverKeepsPolicy(t *testing.T) {
+	c := Client{Policy: &TransportPolicy{RequireHTTPS: true, SameSiteEndpoints: true, MinTLSVersion: 0x0304}}
+
+	r := &net.Resolver{}
+	c = c.WithResolver(r)
+	if c.Policy.Resolver != r {
+		t.Error("WithResolver didn't set the resolver")
+	}
+	if !c.Policy.SameSiteEndpoints || !c.Policy.RequireHTTPS || c.Policy.MinTLSVersion != 0x0304 {
+		t.Errorf("WithResolver didn't keep the policy: %+v", c.Policy)
+	}
+}
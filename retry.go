@@ -0,0 +1,148 @@
+package profilefed
+
+import (
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	"queerdevs.org/profilefed/webfinger"
+)
+
+const (
+	// DefaultRetryAttempts is the number of attempts made by
+	// a [RetryTransport] if its MaxAttempts is zero.
+	DefaultRetryAttempts = 3
+	// DefaultRetryBackoff is the delay before the first retry made
+	// by a [RetryTransport] if its Backoff is zero.
+	DefaultRetryBackoff = 500 * time.Millisecond
+	// DefaultRetryMaxDelay is the maximum delay between two attempts
+	// made by a [RetryTransport] if its MaxDelay is zero.
+	DefaultRetryMaxDelay = 30 * time.Second
+)
+
+// RetryTransport is an [http.RoundTripper] that retries GET and HEAD requests
+// that failed temporarily because of network errors, rate limiting, or server
+// errors, so that lookups against flaky servers don't fail on the first hiccup.
+// Use [Client.WithRetry] to add it to a client.
+type RetryTransport struct {
+	// Transport is the underlying transport. If nil,
+	// [http.DefaultTransport] is used.
+	Transport http.RoundTripper
+	// MaxAttempts is the maximum number of attempts for a request.
+	// If it's zero, [DefaultRetryAttempts] is used.
+	MaxAttempts int
+	// Backoff is the delay before the first retry, which doubles after every
+	// attempt. If a server sends a Retry-After header, the delay it asks for
+	// is used instead. If it's zero, [DefaultRetryBackoff] is used.
+	Backoff time.Duration
+	// MaxDelay is the maximum delay between two attempts. If a server asks
+	// for a longer delay, its response is returned without retrying.
+	// If it's zero, [DefaultRetryMaxDelay] is used.
+	MaxDelay time.Duration
+	// Jitter is the fraction of every backoff delay that's randomized, such as
+	// 0.2, so that clients that failed at the same time don't all retry at the
+	// same time. Delays requested by servers aren't randomized.
+	Jitter float64
+}
+
+// RoundTrip implements the [http.RoundTripper] interface
+func (rt RetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport := rt.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return transport.RoundTrip(req)
+	}
+
+	for attempt := 1; ; attempt++ {
+		res, err := transport.RoundTrip(req)
+		if attempt == rt.maxAttempts() || req.Context().Err() != nil {
+			return res, err
+		}
+
+		var delay time.Duration
+		if err != nil {
+			if !retryableNetError(err) {
+				return nil, err
+			}
+			delay = rt.retryDelay(attempt)
+		} else {
+			if !retryableStatus(res.StatusCode) {
+				return res, nil
+			}
+
+			delay = rt.retryDelay(attempt)
+			if retryAfter, ok := webfinger.ParseRetryAfter(res.Header.Get("Retry-After"), time.Now()); ok {
+				if retryAfter > rt.maxDelay() {
+					return res, nil
+				}
+				delay = retryAfter
+			}
+
+			// Drain the body, so that the connection can be reused
+			io.Copy(io.Discard, io.LimitReader(res.Body, maxErrorBodySize))
+			res.Body.Close()
+		}
+
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// maxAttempts returns the maximum number of attempts for a request.
+func (rt RetryTransport) maxAttempts() int {
+	if rt.MaxAttempts == 0 {
+		return DefaultRetryAttempts
+	}
+	return rt.MaxAttempts
+}
+
+// maxDelay returns the maximum delay between two attempts.
+func (rt RetryTransport) maxDelay() time.Duration {
+	if rt.MaxDelay == 0 {
+		return DefaultRetryMaxDelay
+	}
+	return rt.MaxDelay
+}
+
+// retryDelay returns the backoff delay before the next attempt after
+// the given number of failed attempts, including jitter.
+func (rt RetryTransport) retryDelay(attempts int) time.Duration {
+	delay := rt.Backoff
+	if delay == 0 {
+		delay = DefaultRetryBackoff
+	}
+
+	for range attempts - 1 {
+		delay *= 2
+		if delay >= rt.maxDelay() {
+			delay = rt.maxDelay()
+			break
+		}
+	}
+
+	if jitter := min(max(rt.Jitter, 0), 1); jitter > 0 {
+		delay -= time.Duration(rand.Float64() * jitter * float64(delay))
+	}
+	return delay
+}
+
+// WithRetry returns a copy of the client that retries requests which failed
+// temporarily using rt. The client's current transport is used as the
+// Transport of rt.
+func (c Client) WithRetry(rt RetryTransport) Client {
+	httpClient := &http.Client{}
+	if c.HTTPClient != nil {
+		*httpClient = *c.HTTPClient
+	}
+	rt.Transport = httpClient.Transport
+	httpClient.Transport = rt
+	c.HTTPClient = httpClient
+	return c
+}
@@ -0,0 +1,70 @@
+package profilefed
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// flakyTransport is an [http.RoundTripper] that responds to the first
+// failures descriptor requests with status, before passing them on.
+type flakyTransport struct {
+	transport  http.RoundTripper
+	failures   int
+	status     int
+	retryAfter string
+	requests   int
+}
+
+func (ft *flakyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !strings.HasPrefix(req.URL.Path, "/pfd/") {
+		return ft.transport.RoundTrip(req)
+	}
+
+	ft.requests++
+	if ft.requests > ft.failures {
+		return ft.transport.RoundTrip(req)
+	}
+
+	rec := httptest.NewRecorder()
+	if ft.retryAfter != "" {
+		rec.Header().Set("Retry-After", ft.retryAfter)
+	}
+	rec.WriteHeader(ft.status)
+	res := rec.Result()
+	res.Request = req
+	return res, nil
+}
+
+func TestClientRetry(t *testing.T) {
+	desc := &Descriptor{ID: "main", Username: "user", DisplayName: "User"}
+
+	mt := &MemoryTransport{}
+	mt.Register("example.test", newTenant(t, "example.test", desc))
+
+	ft := &flakyTransport{transport: mt, failures: 2, status: http.StatusServiceUnavailable}
+	c := mt.Client()
+	c.HTTPClient = &http.Client{Transport: ft}
+	c = c.WithRetry(RetryTransport{Backoff: time.Millisecond, Jitter: 0.5})
+
+	if _, err := c.Lookup("user@example.test"); err != nil {
+		t.Fatalf("Lookup error: %s", err)
+	}
+
+	if ft.requests != 3 {
+		t.Errorf("Expected 3 descriptor requests, got %d", ft.requests)
+	}
+
+	// Servers that ask for a longer wait than MaxDelay aren't retried
+	ft.requests, ft.failures, ft.status, ft.retryAfter = 0, 1, http.StatusTooManyRequests, "3600"
+	_, err := c.Lookup("user@example.test")
+	if d, ok := RetryAfter(err); !ok || d != time.Hour {
+		t.Errorf("Expected error with Retry-After of 1h, got %v", err)
+	}
+
+	if ft.requests != 1 {
+		t.Errorf("Expected 1 descriptor request, got %d", ft.requests)
+	}
+}
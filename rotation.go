@@ -0,0 +1,185 @@
+package profilefed
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// ErrInvalidHandover signifies that a key handover record isn't signed by both of its keys.
+var ErrInvalidHandover = errors.New("invalid key handover signature")
+
+// Handover records a key rotation. It's signed by both the old and the new key,
+// so it proves that the holder of the old key authorized the new one, and
+// that the holder of the new key accepted it.
+type Handover struct {
+	// OldKey is the public key that was replaced.
+	OldKey ed25519.PublicKey `json:"old_pubkey"`
+	// NewKey is the public key that replaced OldKey.
+	NewKey ed25519.PublicKey `json:"new_pubkey"`
+	// Time is the time of the rotation.
+	Time time.Time `json:"time"`
+
+	// OldSignature is the signature of the record by the old key.
+	OldSignature []byte `json:"old_sig"`
+	// NewSignature is the signature of the record by the new key.
+	NewSignature []byte `json:"new_sig"`
+}
+
+// signedData returns the data signed by both keys of the handover.
+func (h *Handover) signedData() []byte {
+	data, _ := json.Marshal(struct {
+		OldKey ed25519.PublicKey `json:"old_pubkey"`
+		NewKey ed25519.PublicKey `json:"new_pubkey"`
+		Time   time.Time         `json:"time"`
+	}{h.OldKey, h.NewKey, h.Time})
+	return data
+}
+
+// Verify checks the signatures of both keys of the handover.
+func (h *Handover) Verify() error {
+	data := h.signedData()
+	if !verify(h.OldKey, data, h.OldSignature) || !verify(h.NewKey, data, h.NewSignature) {
+		return ErrInvalidHandover
+	}
+	return nil
+}
+
+// KeyRotator manages a server's signing keys. It rotates them on demand,
+// keeping every previous key so that clients that pinned an old one can
+// verify the new one, and persists its state to a single file that's
+// replaced atomically on every rotation.
+//
+// Set it as the Rotator of a [ServerInfoHandler] and a [Handler] to make
+// them sign responses with its current key, and include the previous keys
+// in the server info, without having to wire them up manually.
+type KeyRotator struct {
+	path string
+
+	mtx   sync.RWMutex
+	state rotatorState
+}
+
+// rotatorState is the persisted state of a [KeyRotator].
+type rotatorState struct {
+	PrivateKey   ed25519.PrivateKey   `json:"private_key"`
+	PreviousKeys []ed25519.PrivateKey `json:"previous_keys,omitempty"`
+	Handovers    []*Handover          `json:"handovers,omitempty"`
+}
+
+// LoadKeyRotator loads the key rotator state stored at path. If the file
+// doesn't exist, a new state is created using initial as the current key,
+// or using a newly generated key if initial is nil, and saved to path.
+func LoadKeyRotator(path string, initial ed25519.PrivateKey) (*KeyRotator, error) {
+	kr := &KeyRotator{path: path}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		if initial == nil {
+			_, initial, err = ed25519.GenerateKey(rand.Reader)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		kr.state.PrivateKey = initial
+		return kr, kr.save(kr.state)
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &kr.state); err != nil {
+		return nil, err
+	}
+
+	if len(kr.state.PrivateKey) != ed25519.PrivateKeySize {
+		return nil, errors.New("invalid private key in key rotator state")
+	}
+
+	return kr, nil
+}
+
+// Rotate generates a new key and makes it the current one. The old key is
+// kept as a previous key, and a handover record signed by both keys is
+// returned. The new state is saved before it takes effect, so if saving
+// fails, the current key is kept.
+func (kr *KeyRotator) Rotate() (*Handover, error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	kr.mtx.Lock()
+	defer kr.mtx.Unlock()
+
+	old := kr.state.PrivateKey
+	ho := &Handover{
+		OldKey: old.Public().(ed25519.PublicKey),
+		NewKey: pub,
+		Time:   time.Now().UTC(),
+	}
+	data := ho.signedData()
+	ho.OldSignature = ed25519.Sign(old, data)
+	ho.NewSignature = ed25519.Sign(priv, data)
+
+	state := rotatorState{
+		PrivateKey:   priv,
+		PreviousKeys: append(slices.Clone(kr.state.PreviousKeys), old),
+		Handovers:    append(slices.Clone(kr.state.Handovers), ho),
+	}
+
+	if err := kr.save(state); err != nil {
+		return nil, err
+	}
+
+	kr.state = state
+	return ho, nil
+}
+
+// PrivateKey returns the current private key.
+func (kr *KeyRotator) PrivateKey() ed25519.PrivateKey {
+	kr.mtx.RLock()
+	defer kr.mtx.RUnlock()
+	return kr.state.PrivateKey
+}
+
+// PublicKey returns the current public key.
+func (kr *KeyRotator) PublicKey() ed25519.PublicKey {
+	return kr.PrivateKey().Public().(ed25519.PublicKey)
+}
+
+// PreviousKeys returns all the previously-used private keys, oldest first.
+func (kr *KeyRotator) PreviousKeys() []ed25519.PrivateKey {
+	kr.mtx.RLock()
+	defer kr.mtx.RUnlock()
+	return slices.Clone(kr.state.PreviousKeys)
+}
+
+// keys returns the current private key and the previous keys
+// as a consistent snapshot.
+func (kr *KeyRotator) keys() (ed25519.PrivateKey, []ed25519.PrivateKey) {
+	kr.mtx.RLock()
+	defer kr.mtx.RUnlock()
+	return kr.state.PrivateKey, kr.state.PreviousKeys
+}
+
+// Handovers returns the handover records of all past rotations, oldest first.
+func (kr *KeyRotator) Handovers() []*Handover {
+	kr.mtx.RLock()
+	defer kr.mtx.RUnlock()
+	return slices.Clone(kr.state.Handovers)
+}
+
+// save atomically writes state to the rotator's file.
+func (kr *KeyRotator) save(state rotatorState) error {
+	return writeFileAtomic(kr.path, func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(state)
+	})
+}
@@ -0,0 +1,88 @@
+package profilefed
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"queerdevs.org/profilefed/webfinger"
+)
+
+func TestKeyRotator(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	kr, err := LoadKeyRotator(path, nil)
+	if err != nil {
+		t.Fatalf("LoadKeyRotator error: %s", err)
+	}
+
+	desc := &Descriptor{ID: "main", Username: "user", DisplayName: "User", Role: RoleUser}
+
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	mux.Handle("/.well-known/webfinger", webfinger.Handler{
+		DescriptorFunc: func(resource string) (*webfinger.Descriptor, error) {
+			return &webfinger.Descriptor{
+				Subject: resource,
+				Links: []webfinger.Link{{
+					Rel:  "self",
+					Type: "application/x-pfd+json",
+					Href: srv.URL + "/pfd/user",
+				}},
+			}, nil
+		},
+	})
+	mux.Handle("/_profilefed/server", ServerInfoHandler{
+		ServerName: srv.Listener.Addr().String(),
+		Rotator:    kr,
+	})
+	mux.Handle("/pfd/user", Handler{
+		Rotator: kr,
+		DescriptorFunc: func(req *Request) (*Descriptor, error) {
+			return desc, nil
+		},
+	})
+
+	var events []KeyEventType
+	c := DefaultClient()
+	c.Events = KeyEventSinkFunc(func(ev KeyEvent) {
+		events = append(events, ev.Type)
+	})
+
+	acct := "user@" + srv.Listener.Addr().String()
+	if _, err := c.Lookup(acct); err != nil {
+		t.Fatalf("Lookup error: %s", err)
+	}
+
+	for range 2 {
+		ho, err := kr.Rotate()
+		if err != nil {
+			t.Fatalf("Rotate error: %s", err)
+		}
+
+		if err := ho.Verify(); err != nil {
+			t.Fatalf("Verify error: %s", err)
+		}
+
+		if _, err := c.Lookup(acct); err != nil {
+			t.Fatalf("Lookup error after rotation: %s", err)
+		}
+	}
+
+	expected := []KeyEventType{KeyEventFirstTrust, KeyEventRotationAccepted, KeyEventRotationAccepted}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("Unexpected events: %q", events)
+	}
+
+	loaded, err := LoadKeyRotator(path, nil)
+	if err != nil {
+		t.Fatalf("LoadKeyRotator error: %s", err)
+	}
+
+	if !loaded.PrivateKey().Equal(kr.PrivateKey()) || len(loaded.PreviousKeys()) != 2 || len(loaded.Handovers()) != 2 {
+		t.Errorf("Loaded state doesn't match saved state")
+	}
+}
@@ -0,0 +1,67 @@
+package profilefed
+
+import "net/http"
+
+// Route describes an endpoint that has to be registered on a router.
+type Route struct {
+	// Methods contains the HTTP methods the endpoint accepts.
+	Methods []string
+	// Path is the path of the endpoint.
+	Path string
+	// Handler handles requests to the endpoint.
+	Handler http.Handler
+}
+
+// Routes returns the routes needed to serve ProfileFed, so that they can be
+// registered consistently on any router, including ones like chi, echo, and gin
+// that don't use [http.ServeMux]. The descriptor handler is served at descPath.
+// The given middleware is applied to every handler, with the first middleware
+// being the outermost one.
+//
+// Paths use the wildcard syntax of [http.ServeMux], such as /pfd/{user}, and
+// [Request.User] reads the user using [http.Request.PathValue]. With chi, which
+// uses the same syntax, the routes can be registered as they are:
+//
+//	for _, route := range profilefed.Routes(wf, serverInfo, "/pfd/{user}", pfd) {
+//		for _, method := range route.Methods {
+//			r.Method(method, route.Path, route.Handler)
+//		}
+//	}
+//
+// Routers like echo and gin use a different syntax, such as /pfd/:user, so the
+// wildcard has to be translated, and the user has to be set as a path value
+// before calling the handler. For example, with gin:
+//
+//	path := strings.ReplaceAll(route.Path, "{user}", ":user")
+//	r.Handle(method, path, func(c *gin.Context) {
+//		c.Request.SetPathValue("user", c.Param("user"))
+//		route.Handler.ServeHTTP(c.Writer, c.Request)
+//	})
+func Routes(webfinger, serverInfo http.Handler, descPath string, desc http.Handler, middleware ...func(http.Handler) http.Handler) []Route {
+	routes := []Route{
+		{
+			// POST is only accepted if the WebFinger handler allows it
+			Methods: []string{http.MethodGet, http.MethodPost},
+			Path:    "/.well-known/webfinger",
+			Handler: webfinger,
+		},
+		{
+			Methods: []string{http.MethodGet},
+			Path:    "/_profilefed/server",
+			Handler: serverInfo,
+		},
+		{
+			Methods: []string{http.MethodGet},
+			Path:    descPath,
+			Handler: desc,
+		},
+	}
+
+	for i := range routes {
+		for j := len(middleware) - 1; j >= 0; j-- {
+			routes[i].Handler = middleware[j](routes[i].Handler)
+		}
+	}
+
+	return routes
+}
@@ -0,0 +1,77 @@
+package profilefed
+
+import (
+	"crypto/ed25519"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"queerdevs.org/profilefed/webfinger"
+)
+
+func TestRoutesServeMux(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey error: %s", err)
+	}
+
+	descs := map[string]*Descriptor{
+		"alice": {ID: "main", Username: "alice", DisplayName: "Alice"},
+	}
+
+	wf := webfinger.Handler{
+		DescriptorFunc: func(resource string) (*webfinger.Descriptor, error) {
+			return &webfinger.Descriptor{
+				Subject: resource,
+				Links: []webfinger.Link{{
+					Rel:  "self",
+					Type: "application/x-pfd+json",
+					Href: "http://example.test/profiles/alice",
+				}},
+			}, nil
+		},
+	}
+
+	pfd := Handler{
+		PrivateKey: priv,
+		DescriptorFunc: func(req *Request) (*Descriptor, error) {
+			desc, ok := descs[req.User()]
+			if !ok {
+				return nil, ErrDescriptorNotFound
+			}
+			return desc, nil
+		},
+	}
+
+	var calls int
+	count := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			calls++
+			next.ServeHTTP(res, req)
+		})
+	}
+
+	mux := http.NewServeMux()
+	sih := ServerInfoHandler{ServerName: "example.test", PublicKey: pub, PrivateKey: priv}
+	for _, route := range Routes(wf, sih, "/profiles/{user}", pfd, count) {
+		for _, method := range route.Methods {
+			mux.Handle(method+" "+route.Path, route.Handler)
+		}
+	}
+
+	mt := &MemoryTransport{}
+	mt.Register("example.test", mux)
+
+	desc, err := mt.Client().Lookup("alice@example.test")
+	if err != nil {
+		t.Fatalf("Lookup error: %s", err)
+	}
+
+	if !reflect.DeepEqual(desc, descs["alice"]) {
+		t.Errorf("Descriptors are not equal:\n%#v\n\n%#v", desc, descs["alice"])
+	}
+
+	if calls != 3 {
+		t.Errorf("Expected middleware to be called for 3 requests, got %d", calls)
+	}
+}
@@ -0,0 +1,250 @@
+package profilefed
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"queerdevs.org/profilefed/webfinger"
+)
+
+// DefaultDescriptorPath is the default path a [Server] serves descriptors at.
+const DefaultDescriptorPath = "/pfd/{user}"
+
+var (
+	// ErrMissingKey signifies that a [Server] or handler has no key to sign responses with.
+	ErrMissingKey = errors.New("server has no signing key")
+	// ErrMissingServerName signifies that a [Server] has no server name.
+	ErrMissingServerName = errors.New("server has no server name")
+)
+
+// Server serves all the ProfileFed endpoints with consistent configuration.
+// It generates the WebFinger links to the descriptor endpoint automatically,
+// so that they always match the path it's served at.
+type Server struct {
+	// ServerName is the name of the server, which should be the host clients
+	// use to access it, such as example.com.
+	ServerName string
+	// PreviousNames should contain any previous names this server used.
+	PreviousNames []string
+	// AlternateNames should contain any other domains that serve the same
+	// content as this server. See [ServerInfoHandler.AlternateNames].
+	AlternateNames []string
+	// BaseURL is the scheme and host the endpoints are served at, such as
+	// https://example.com. If empty, https and the server name are used.
+	BaseURL string
+
+	// PrivateKey contains the server's Ed25519 private key.
+	PrivateKey ed25519.PrivateKey
+	// PreviousKeys should contain any previously-used private keys.
+	PreviousKeys []ed25519.PrivateKey
+	// Signer, if set, signs responses instead of PrivateKey. See [Handler.Signer].
+	Signer crypto.Signer
+	// Rotator, if set, provides the server's keys instead of PrivateKey.
+	Rotator *KeyRotator
+
+	// DescriptorPath is the path the descriptor endpoint is served at, which
+	// should contain a {user} wildcard. If empty, [DefaultDescriptorPath] is used.
+	DescriptorPath string
+	// UserFunc returns the user whose descriptors are served for the given
+	// WebFinger resource, or [webfinger.ErrNotFound] if there isn't one. If it's
+	// nil, acct resources for the server name or one of the alternate names
+	// are mapped to their user part, such as alice for acct:alice@example.com.
+	UserFunc func(resource string) (string, error)
+
+	// Handler configures the descriptor endpoint. Its keys are set by the
+	// server. The requested user is available via [Request.User].
+	Handler Handler
+	// WebFinger configures the WebFinger endpoint. If its DescriptorFunc is
+	// set, it's used to get the rest of the WebFinger descriptor, and the link
+	// to the descriptor endpoint is added to it.
+	WebFinger webfinger.Handler
+	// InstanceProfile, if set, is served along with the other endpoints.
+	// If it has no private key, the server's key or signer is used.
+	InstanceProfile *InstanceProfile
+	// JWKS, if set, serves the server's public key as a JSON Web Key Set
+	// at [JWKSPath]. See [ServerInfoHandler.JWKS].
+	JWKS bool
+	// Inbox, if set, receives messages from other servers at [InboxPath].
+	// If its ServerName is empty, the server's name is used.
+	Inbox *InboxHandler
+
+	// Middleware is applied to every handler, with the first
+	// middleware being the outermost one.
+	Middleware []func(http.Handler) http.Handler
+}
+
+// Routes validates the server's configuration and returns the routes
+// needed to serve it. See [Routes] for how to register them on a router.
+func (s Server) Routes() ([]Route, error) {
+	if s.ServerName == "" {
+		return nil, ErrMissingServerName
+	}
+
+	var pubkey ed25519.PublicKey
+	if s.Signer != nil {
+		var err error
+		pubkey, err = signerPublicKey(s.Signer)
+		if err != nil {
+			return nil, err
+		}
+	} else if s.Rotator == nil {
+		if len(s.PrivateKey) != ed25519.PrivateKeySize {
+			return nil, ErrMissingKey
+		}
+		pubkey = s.PrivateKey.Public().(ed25519.PublicKey)
+	}
+
+	serverInfo := ServerInfoHandler{
+		ServerName:     s.ServerName,
+		PreviousNames:  s.PreviousNames,
+		AlternateNames: s.AlternateNames,
+		PublicKey:      pubkey,
+		PrivateKey:     s.PrivateKey,
+		Signer:         s.Signer,
+		PreviousKeys:   s.PreviousKeys,
+		Rotator:        s.Rotator,
+	}
+
+	desc := s.Handler
+	desc.PrivateKey, desc.Signer, desc.Rotator = s.PrivateKey, s.Signer, s.Rotator
+
+	wf := s.WebFinger
+	wf.DescriptorFunc = s.webfingerFunc(s.WebFinger.DescriptorFunc)
+
+	var instance *Route
+	if s.InstanceProfile != nil {
+		ip := *s.InstanceProfile
+		if ip.PrivateKey == nil && ip.Signer == nil && ip.Rotator == nil {
+			ip.PrivateKey, ip.Signer, ip.Rotator = s.PrivateKey, s.Signer, s.Rotator
+		}
+		if ip.Path == "" {
+			ip.Path = InstancePath
+		}
+
+		h := ip.Handler()
+
+		wf.DescriptorFunc = ip.WrapWebFinger(s.ServerName, s.baseURL(), wf.DescriptorFunc)
+		instance = &Route{Methods: []string{http.MethodGet}, Path: ip.Path, Handler: h}
+	}
+
+	routes := Routes(wf, serverInfo, s.descriptorPath(), desc)
+	if instance != nil {
+		routes = append(routes, *instance)
+	}
+
+	if s.JWKS {
+		routes = append(routes, Route{Methods: []string{http.MethodGet}, Path: JWKSPath, Handler: serverInfo.JWKS()})
+	}
+
+	if s.Inbox != nil {
+		inbox := s.Inbox
+		if inbox.ServerName == "" {
+			// Don't modify the caller's handler
+			inbox = cloneExported(inbox)
+			inbox.ServerName = s.ServerName
+		}
+		routes = append(routes, Route{Methods: []string{http.MethodPost}, Path: InboxPath, Handler: inbox})
+	}
+
+	for i := range routes {
+		for j := len(s.Middleware) - 1; j >= 0; j-- {
+			routes[i].Handler = s.Middleware[j](routes[i].Handler)
+		}
+	}
+
+	return routes, nil
+}
+
+// Mount validates the server's configuration and registers
+// all of its endpoints on mux.
+func (s Server) Mount(mux *http.ServeMux) error {
+	routes, err := s.Routes()
+	if err != nil {
+		return err
+	}
+
+	for _, route := range routes {
+		for _, method := range route.Methods {
+			mux.Handle(method+" "+route.Path, route.Handler)
+		}
+	}
+	return nil
+}
+
+// webfingerFunc returns the WebFinger descriptor function of the server,
+// which adds a link to the user's descriptors to the descriptors returned by next.
+func (s Server) webfingerFunc(next func(resource string) (*webfinger.Descriptor, error)) func(resource string) (*webfinger.Descriptor, error) {
+	return func(resource string) (*webfinger.Descriptor, error) {
+		user, err := s.user(resource)
+		if err != nil {
+			if next != nil && errors.Is(err, webfinger.ErrNotFound) {
+				return next(resource)
+			}
+			return nil, err
+		}
+
+		wfdesc := &webfinger.Descriptor{Subject: resource}
+		if next != nil {
+			wfdesc, err = next(resource)
+			if errors.Is(err, webfinger.ErrNotFound) {
+				wfdesc = &webfinger.Descriptor{Subject: resource}
+			} else if err != nil {
+				return nil, err
+			}
+		}
+
+		out := *wfdesc
+		out.Links = append(slices.Clip(wfdesc.Links), webfinger.Link{
+			Rel:  "self",
+			Type: "application/x-pfd+json",
+			Href: s.baseURL() + strings.Replace(s.descriptorPath(), "{user}", url.PathEscape(user), 1),
+		})
+		return &out, nil
+	}
+}
+
+// user returns the user whose descriptors are served for resource.
+func (s Server) user(resource string) (string, error) {
+	if s.UserFunc != nil {
+		return s.UserFunc(resource)
+	}
+
+	user, host, ok := strings.Cut(strings.TrimPrefix(resource, "acct:"), "@")
+	if !ok || user == "" || !strings.HasPrefix(resource, "acct:") {
+		return "", webfinger.ErrNotFound
+	}
+
+	if host != s.ServerName && !slices.Contains(s.AlternateNames, host) {
+		return "", webfinger.ErrNotFound
+	}
+	return user, nil
+}
+
+// baseURL returns the base URL of the server's endpoints.
+func (s Server) baseURL() string {
+	if s.BaseURL != "" {
+		return strings.TrimSuffix(s.BaseURL, "/")
+	}
+	return "https://" + s.ServerName
+}
+
+// descriptorPath returns the path of the descriptor endpoint.
+func (s Server) descriptorPath() string {
+	if s.DescriptorPath != "" {
+		return s.DescriptorPath
+	}
+	return DefaultDescriptorPath
+}
+
+// User returns the user whose descriptors were requested, from the {user}
+// wildcard of the descriptor path. It's only available if the handler is
+// registered on an [http.ServeMux], such as by [Server.Mount], or if the
+// router sets it using [http.Request.SetPathValue]. See [Routes] for details.
+func (r *Request) User() string {
+	return r.HTTPRequest.PathValue("user")
+}
@@ -1,10 +1,11 @@
 package profilefed
 
 import (
+	"crypto"
 	"crypto/ed25519"
 	"encoding/base64"
-	"encoding/json"
 	"net/http"
+	"slices"
 )
 
 // ServerInfoHandler handles the server info endpoint
@@ -15,50 +16,100 @@ type ServerInfoHandler struct {
 	ServerName string
 	// PreviousNames should contain any previous names this server used.
 	PreviousNames []string
+	// AlternateNames should contain any other domains that serve the same
+	// content as this server, such as a www subdomain. Clients pin a single
+	// key for the server and all its alternate names.
+	AlternateNames []string
 
 	// PublicKey should contain the server's public Ed25519 key.
 	PublicKey ed25519.PublicKey
 	// PrivateKey should contain the server's private Ed25519 key.
 	PrivateKey ed25519.PrivateKey
+	// Signer, if set, signs responses instead of PrivateKey, so that keys held
+	// in an HSM or a KMS can be used. If PublicKey is empty, the signer's
+	// public key is served.
+	Signer crypto.Signer
 	// PreviousKeys should contain any previously-used private keys.
 	// If this is not provided when the key changes, servers will not
 	// trust the new key and all responses will be rejected.
 	PreviousKeys []ed25519.PrivateKey
 
+	// Cosigners, if set, declares that the server info has to be co-signed
+	// by several parties. Cosignatures has to contain enough signatures of
+	// the server info made using [Cosign], which have to be renewed whenever
+	// the server info changes.
+	Cosigners *CosignerPolicy
+	// Cosignatures contains the co-signatures of the server info.
+	Cosignatures []Cosignature
+
+	// Rotator, if set, provides the server's current key instead of PublicKey
+	// and PrivateKey. Its previous keys are used in addition to PreviousKeys.
+	Rotator *KeyRotator
+
 	// ErrorHandler is called whenever an error is encountered.
+	// If it's nil, [DefaultErrorHandler] is used.
 	ErrorHandler func(err error, res http.ResponseWriter)
 }
 
 type serverInfoData struct {
-	ServerName    string   `json:"server_name"`
-	PreviousNames []string `json:"previous_names"`
-	PublicKey     string   `json:"pubkey"`
+	ServerName     string   `json:"server_name"`
+	PreviousNames  []string `json:"previous_names"`
+	AlternateNames []string `json:"alternate_names,omitempty"`
+	PublicKey      string   `json:"pubkey"`
+	Fingerprint    string   `json:"fingerprint,omitempty"`
+
+	Cosigners *CosignerPolicy `json:"cosigners,omitempty"`
 }
 
 // ServeHTTP implements the http.Handler interface
 func (sih ServerInfoHandler) ServeHTTP(res http.ResponseWriter, req *http.Request) {
-	data, err := json.Marshal(serverInfoData{
-		ServerName:    sih.ServerName,
-		PreviousNames: sih.PreviousNames,
-		PublicKey:     base64.StdEncoding.EncodeToString(sih.PublicKey),
-	})
+	if sih.ErrorHandler == nil {
+		sih.ErrorHandler = DefaultErrorHandler
+	}
+
+	pubkey, signer, prevKeys, err := sih.keys()
 	if err != nil {
 		sih.ErrorHandler(err, res)
 		return
 	}
 
-	for _, key := range sih.PreviousKeys {
+	data, err := sih.document(pubkey)
+	if err != nil {
+		sih.ErrorHandler(err, res)
+		return
+	}
+	setCosignatures(res.Header(), sih.Cosignatures)
+
+	for _, key := range prevKeys {
 		sig := ed25519.Sign(key, data)
 		res.Header().Add("X-ProfileFed-Previous", base64.StdEncoding.EncodeToString(sig))
 	}
 
-	sig := ed25519.Sign(sih.PrivateKey, data)
-	res.Header().Set("X-ProfileFed-Sig", base64.StdEncoding.EncodeToString(sig))
-
 	res.Header().Set("Content-Type", "application/json")
-	_, err = res.Write(data)
+	err = writeSigned(res, signer, data)
 	if err != nil {
 		sih.ErrorHandler(err, res)
 		return
 	}
 }
+
+// keys returns the server's current public key, the signer for
+// its current key, and its previously-used private keys.
+func (sih ServerInfoHandler) keys() (ed25519.PublicKey, crypto.Signer, []ed25519.PrivateKey, error) {
+	pubkey, signer, prevKeys := sih.PublicKey, keySigner(sih.Signer, sih.PrivateKey), sih.PreviousKeys
+	if sih.Rotator != nil && sih.Signer == nil {
+		privkey, rotated := sih.Rotator.keys()
+		signer, pubkey = privkey, privkey.Public().(ed25519.PublicKey)
+		prevKeys = append(slices.Clone(prevKeys), rotated...)
+	}
+
+	if len(pubkey) == 0 {
+		var err error
+		pubkey, err = signerPublicKey(signer)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	return pubkey, signer, prevKeys, nil
+}
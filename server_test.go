@@ -0,0 +1,80 @@
+package profilefed
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestServerMount(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey error: %s", err)
+	}
+
+	descs := map[string]*Descriptor{
+		"alice": {ID: "main", Username: "alice", DisplayName: "Alice"},
+	}
+
+	srv := Server{
+		ServerName: "example.test",
+		BaseURL:    "http://example.test",
+		PrivateKey: priv,
+		Handler: Handler{
+			DescriptorFunc: func(req *Request) (*Descriptor, error) {
+				desc, ok := descs[req.User()]
+				if !ok {
+					return nil, ErrDescriptorNotFound
+				}
+				return desc, nil
+			},
+		},
+		InstanceProfile: &InstanceProfile{
+			Descriptor: &Descriptor{DisplayName: "Example"},
+		},
+		Inbox: &InboxHandler{},
+	}
+
+	if err := (Server{ServerName: "example.test"}).Mount(http.NewServeMux()); !errors.Is(err, ErrMissingKey) {
+		t.Fatalf("Expected ErrMissingKey, got %v", err)
+	}
+
+	mux := http.NewServeMux()
+	if err := srv.Mount(mux); err != nil {
+		t.Fatalf("Mount error: %s", err)
+	}
+
+	if srv.Inbox.ServerName != "" {
+		t.Errorf("Mount modified the inbox handler")
+	}
+
+	mt := &MemoryTransport{}
+	mt.Register("example.test", mux)
+	c := mt.Client()
+
+	desc, err := c.Lookup("alice@example.test")
+	if err != nil {
+		t.Fatalf("Lookup error: %s", err)
+	}
+
+	if !reflect.DeepEqual(desc, descs["alice"]) {
+		t.Errorf("Descriptors are not equal:\n%#v\n\n%#v", desc, descs["alice"])
+	}
+
+	instance, err := c.LookupInstance("example.test")
+	if err != nil {
+		t.Fatalf("LookupInstance error: %s", err)
+	}
+
+	if instance.DisplayName != "Example" || instance.Username != InstanceUsername {
+		t.Errorf("Unexpected instance profile: %#v", instance)
+	}
+
+	_, err = c.Lookup("bob@example.test")
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 error, got %v", err)
+	}
+}
@@ -0,0 +1,164 @@
+package profilefed
+
+import (
+	"context"
+	"crypto"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ShareParam is the query parameter that carries share tokens.
+const ShareParam = "share"
+
+// sharePrefix is prepended to share token payloads before they're signed,
+// so that signed responses containing the same members can't be used as
+// share tokens.
+const sharePrefix = "profilefed-share:"
+
+// ShareGrant contains the claims of a validated share token.
+type ShareGrant struct {
+	// Path is the descriptor path the token grants access to.
+	Path string `json:"path"`
+	// ID is the descriptor ID the token grants access to.
+	// If it's empty, the token grants access to all of the user's descriptors.
+	ID string `json:"id,omitempty"`
+	// Expiry is the time at which the token expires.
+	Expiry time.Time `json:"exp"`
+}
+
+type shareGrantKey struct{}
+
+// ShareGrantFromContext returns the share grant attached to ctx
+// by [Handler], if the request contained a valid share token.
+func ShareGrantFromContext(ctx context.Context) (*ShareGrant, bool) {
+	sg, ok := ctx.Value(shareGrantKey{}).(*ShareGrant)
+	return sg, ok
+}
+
+// NewShareToken mints a share token that grants temporary access to the extended
+// view of the descriptor at path, such as /pfd/user, until expiry. If id is empty,
+// the token grants access to all of the user's descriptors. The token is signed
+// using the server's key, so it can be validated without storing it. The signer
+// has to hold an Ed25519 key, such as an ed25519.PrivateKey.
+func NewShareToken(signer crypto.Signer, path, id string, expiry time.Time) (string, error) {
+	payload, err := json.Marshal(ShareGrant{Path: path, ID: id, Expiry: expiry.UTC()})
+	if err != nil {
+		return "", err
+	}
+
+	sig, err := sign(signer, append([]byte(sharePrefix), payload...))
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// NewShareLink is the same as [NewShareToken], but it returns a capability URL
+// that can be shared directly, consisting of descURL with the token attached.
+func NewShareLink(signer crypto.Signer, descURL, id string, expiry time.Time) (string, error) {
+	u, err := url.Parse(descURL)
+	if err != nil {
+		return "", err
+	}
+
+	token, err := NewShareToken(signer, u.Path, id, expiry)
+	if err != nil {
+		return "", err
+	}
+
+	q := u.Query()
+	q.Set(ShareParam, token)
+	if id != "" {
+		q.Set("id", id)
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// checkShare validates the request's share token if there is one, and
+// returns the request with the share grant attached to its context.
+func (h Handler) checkShare(req *http.Request) (*http.Request, error) {
+	q := req.URL.Query()
+	token := q.Get(ShareParam)
+	if token == "" {
+		return req, nil
+	}
+
+	payloadStr, sigStr, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(payloadStr)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(sigStr)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	pubkey, err := signerPublicKey(h.signer())
+	if err != nil || !verify(pubkey, append([]byte(sharePrefix), payload...), sig) {
+		return nil, ErrInvalidToken
+	}
+
+	sg := &ShareGrant{}
+	if err := json.Unmarshal(payload, sg); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	if time.Now().After(sg.Expiry) {
+		return nil, fmt.Errorf("%w: share link expired", ErrInvalidToken)
+	}
+
+	if sg.Path != req.URL.Path {
+		return nil, fmt.Errorf("%w: share link is for a different profile", ErrInvalidToken)
+	}
+
+	if sg.ID != "" && (q.Get("all") == "1" || q.Get("id") != sg.ID) {
+		return nil, fmt.Errorf("%w: share link is for a different profile", ErrInvalidToken)
+	}
+
+	return req.WithContext(context.WithValue(req.Context(), shareGrantKey{}, sg)), nil
+}
+
+// LookupWithToken is the same as [Client.Lookup], but it passes a share token to
+// the server, which grants access to the extended view of a private profile.
+func (c Client) LookupWithToken(resource, token string) (*Descriptor, error) {
+	wfdesc, err := c.webfinger().LookupAcct(resource)
+	if err != nil {
+		return nil, err
+	}
+
+	params := lookupParams{share: token}
+	if sg, ok := unverifiedShareGrant(token); ok {
+		params.id = sg.ID
+	}
+
+	out := &Descriptor{}
+	_, err = c.lookup(wfdesc, params, out)
+	return out, err
+}
+
+// unverifiedShareGrant decodes the claims of a share token without verifying it.
+// Clients use it to request the descriptor ID the token is restricted to.
+func unverifiedShareGrant(token string) (*ShareGrant, bool) {
+	payloadStr, _, _ := strings.Cut(token, ".")
+	payload, err := base64.RawURLEncoding.DecodeString(payloadStr)
+	if err != nil {
+		return nil, false
+	}
+
+	sg := &ShareGrant{}
+	if err := json.Unmarshal(payload, sg); err != nil {
+		return nil, false
+	}
+	return sg, true
+}
@@ -0,0 +1,80 @@
+package profilefed
+
+import (
+	"crypto"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// SignedJSON marshals v into JSON, signs it using signer, and writes it to res
+// along with the X-ProfileFed-Sig header, so that clients can verify it the
+// same way they verify descriptors. Extension endpoints should use it to
+// produce consistent, verifiable responses.
+//
+// The signer has to hold an Ed25519 key, such as an [ed25519.PrivateKey].
+// The Content-Type header is set to application/json unless it's already set.
+func SignedJSON(res http.ResponseWriter, signer crypto.Signer, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	if res.Header().Get("Content-Type") == "" {
+		res.Header().Set("Content-Type", "application/json")
+	}
+	return writeSigned(res, signer, data)
+}
+
+// writeSigned signs data using signer and writes it to res along with the
+// signature, Content-Digest, and Date headers. The Content-Type header has to be set by the caller.
+func writeSigned(res http.ResponseWriter, signer crypto.Signer, data []byte) error {
+	return writeSignedStatus(res, signer, http.StatusOK, data)
+}
+
+// writeSignedStatus is like writeSigned, but responds with the given status code.
+func writeSignedStatus(res http.ResponseWriter, signer crypto.Signer, status int, data []byte) error {
+	if err := setSignature(res.Header(), signer, data); err != nil {
+		return err
+	}
+	res.WriteHeader(status)
+	_, err := res.Write(data)
+	return err
+}
+
+// setSignature signs data using signer and sets the signature,
+// Content-Digest, and Date headers of a response in h.
+func setSignature(h http.Header, signer crypto.Signer, data []byte) error {
+	sig, err := sign(signer, data)
+	if err != nil {
+		return err
+	}
+
+	h.Set("X-ProfileFed-Sig", base64.StdEncoding.EncodeToString(sig))
+	// The digest lets clients tell transport corruption apart from a bad signature
+	setContentDigest(h, data)
+	// Clients use the Date header to detect clock skew. The standard
+	// library sets it automatically, but other servers might not.
+	h.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	return nil
+}
+
+// SignedHandlerFunc returns a value to be served as a signed JSON response.
+type SignedHandlerFunc func(req *http.Request) (any, error)
+
+// Sign returns a handler that serves the values returned by f as JSON signed
+// using signer. Errors returned by f are handled by [DefaultErrorHandler].
+func (f SignedHandlerFunc) Sign(signer crypto.Signer) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		v, err := f(req)
+		if err != nil {
+			DefaultErrorHandler(err, res)
+			return
+		}
+
+		if err := SignedJSON(res, signer, v); err != nil {
+			DefaultErrorHandler(err, res)
+		}
+	})
+}
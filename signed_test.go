@@ -0,0 +1,101 @@
+package profilefed
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSignedHandlerFunc(t *testing.T) {
+	_, priv, err := GenerateKeys()
+	if err != nil {
+		t.Fatalf("GenerateKeys error: %s", err)
+	}
+
+	errMissing := &HTTPError{StatusCode: http.StatusNotFound}
+	mux := http.NewServeMux()
+	mux.Handle("/_profilefed/server", ServerInfoHandler{ServerName: "example.test", PrivateKey: priv})
+	mux.Handle("/ext", SignedHandlerFunc(func(req *http.Request) (any, error) {
+		if req.URL.Query().Has("missing") {
+			return nil, errMissing
+		}
+		return map[string]string{"hello": "world"}, nil
+	}).Sign(opaqueSigner{priv}))
+
+	mt := &MemoryTransport{}
+	mt.Register("example.test", mux)
+	c := mt.Client()
+
+	res, err := c.httpClient().Get("http://example.test/ext")
+	if err != nil {
+		t.Fatalf("Get error: %s", err)
+	}
+	data, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		t.Fatalf("ReadAll error: %s", err)
+	}
+
+	if ct := res.Header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Expected Content-Type application/json, got %q", ct)
+	}
+	if date, err := http.ParseTime(res.Header.Get("Date")); err != nil || time.Since(date) > time.Minute {
+		t.Errorf("Expected a current Date header, got %q", res.Header.Get("Date"))
+	}
+	if res.Header.Get("Content-Digest") == "" {
+		t.Error("Expected a Content-Digest header")
+	}
+	if err := c.checkDigest(res, "example.test", data); err != nil {
+		t.Errorf("checkDigest error: %s", err)
+	}
+
+	var v map[string]string
+	if err := json.Unmarshal(data, &v); err != nil || v["hello"] != "world" {
+		t.Errorf("Unexpected body %s (%v)", data, err)
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(res.Header.Get("X-ProfileFed-Sig"))
+	if err != nil {
+		t.Fatalf("DecodeString error: %s", err)
+	}
+	if err := c.verifyServerSignature("http", "example.test", data, sig); err != nil {
+		t.Errorf("verifyServerSignature error: %s", err)
+	}
+
+	tampered := append(data[:len(data):len(data)], ' ')
+	if err := c.verifyServerSignature("http", "example.test", tampered, sig); !errors.Is(err, ErrSignatureMismatch) {
+		t.Errorf("Expected ErrSignatureMismatch for a tampered body, got %v", err)
+	}
+
+	// Errors are handled by DefaultErrorHandler and aren't signed
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ext?missing", nil))
+	if rec.Code == http.StatusOK || rec.Header().Get("X-ProfileFed-Sig") != "" {
+		t.Errorf("Expected an unsigned error response, got %d", rec.Code)
+	}
+}
+
+func TestSignedJSONContentType(t *testing.T) {
+	_, priv, err := GenerateKeys()
+	if err != nil {
+		t.Fatalf("GenerateKeys error: %s", err)
+	}
+
+	rec := httptest.NewRecorder()
+	rec.Header().Set("Content-Type", "application/activity+json")
+	if err := SignedJSON(rec, priv, []string{"a"}); err != nil {
+		t.Fatalf("SignedJSON error: %s", err)
+	}
+
+	if ct := rec.Header().Get("Content-Type"); ct != "application/activity+json" {
+		t.Errorf("Expected the existing Content-Type to be kept, got %q", ct)
+	}
+	if rec.Header().Get("X-ProfileFed-Sig") == "" || rec.Body.String() != `["a"]` {
+		t.Errorf("Unexpected response: %v %s", rec.Header(), rec.Body)
+	}
+}
@@ -0,0 +1,49 @@
+package profilefed
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+)
+
+// ErrUnsupportedSigner signifies that a [crypto.Signer] doesn't hold an Ed25519 key.
+var ErrUnsupportedSigner = errors.New("signer does not use an ed25519 key")
+
+// sign signs data using signer, which has to hold an Ed25519 key. Signers
+// backed by HSMs, PKCS#11 tokens, or cloud KMS can be used this way without
+// exposing the key. [ed25519.PrivateKey] implements [crypto.Signer] itself.
+func sign(signer crypto.Signer, data []byte) ([]byte, error) {
+	if _, err := signerPublicKey(signer); err != nil {
+		return nil, err
+	}
+
+	// Ed25519 signs the message itself, which is
+	// indicated by passing a zero hash function.
+	return signer.Sign(rand.Reader, data, crypto.Hash(0))
+}
+
+// signerPublicKey returns the Ed25519 public key of signer.
+func signerPublicKey(signer crypto.Signer) (ed25519.PublicKey, error) {
+	if signer == nil {
+		return nil, ErrMissingKey
+	}
+
+	pubkey, ok := signer.Public().(ed25519.PublicKey)
+	if !ok || len(pubkey) != ed25519.PublicKeySize {
+		return nil, ErrUnsupportedSigner
+	}
+	return pubkey, nil
+}
+
+// keySigner returns signer if it's set, and priv otherwise. It lets types that
+// have both a Signer and a PrivateKey field treat them the same way.
+func keySigner(signer crypto.Signer, priv ed25519.PrivateKey) crypto.Signer {
+	if signer != nil {
+		return signer
+	}
+	if priv == nil {
+		return nil
+	}
+	return priv
+}
@@ -0,0 +1,100 @@
+package profilefed
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"queerdevs.org/profilefed/webfinger"
+)
+
+// opaqueSigner is a [crypto.Signer] that doesn't expose its key,
+// like a signer backed by an HSM.
+type opaqueSigner struct {
+	priv ed25519.PrivateKey
+}
+
+func (s opaqueSigner) Public() crypto.PublicKey {
+	return s.priv.Public()
+}
+
+func (s opaqueSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return s.priv.Sign(rand, digest, opts)
+}
+
+func TestSigner(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey error: %s", err)
+	}
+	signer := opaqueSigner{priv}
+
+	desc := &Descriptor{ID: "main", Username: "user", DisplayName: "User"}
+
+	mux := http.NewServeMux()
+	mux.Handle("/.well-known/webfinger", webfinger.Handler{
+		DescriptorFunc: func(resource string) (*webfinger.Descriptor, error) {
+			return &webfinger.Descriptor{
+				Subject: resource,
+				Links: []webfinger.Link{{
+					Rel:  "self",
+					Type: "application/x-pfd+json",
+					Href: "http://signer.test/pfd/user",
+				}},
+			}, nil
+		},
+	})
+	mux.Handle("/_profilefed/server", ServerInfoHandler{ServerName: "signer.test", Signer: signer})
+	mux.Handle("/pfd/user", Handler{
+		Signer:        signer,
+		SignatureMode: SignatureBoth,
+		DescriptorFunc: func(req *Request) (*Descriptor, error) {
+			return desc, nil
+		},
+	})
+
+	mt := &MemoryTransport{}
+	mt.Register("signer.test", mux)
+
+	got, err := mt.Client().Lookup("user@signer.test")
+	if err != nil {
+		t.Fatalf("Lookup error: %s", err)
+	}
+
+	if !reflect.DeepEqual(got, desc) {
+		t.Errorf("Descriptors are not equal:\n%#v\n\n%#v", got, desc)
+	}
+}
+
+func TestUnsupportedSigner(t *testing.T) {
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey error: %s", err)
+	}
+
+	if _, err := NewShareToken(ecdsaKey, "/pfd/user", "", time.Now().Add(time.Hour)); !errors.Is(err, ErrUnsupportedSigner) {
+		t.Errorf("Expected ErrUnsupportedSigner, got %v", err)
+	}
+
+	h := Handler{
+		Signer: ecdsaKey,
+		DescriptorFunc: func(req *Request) (*Descriptor, error) {
+			return &Descriptor{ID: "main"}, nil
+		},
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/pfd/user", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status 500, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,130 @@
+package profilefed
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/url"
+
+	"queerdevs.org/profilefed/webfinger"
+)
+
+// verificationErrors contains the errors returned when a
+// response can't be verified. See [IsVerificationError].
+var verificationErrors = []error{
+	ErrSignatureMismatch,
+	ErrNoSignature,
+	ErrDigestMismatch,
+	ErrNoEnvelope,
+	ErrInvalidEnvelope,
+	ErrStaleDescriptor,
+	ErrClockSkew,
+	ErrInvalidKeyCertificate,
+	ErrKeyCertificateExpired,
+	ErrQuorumNotMet,
+	ErrFingerprintMismatch,
+	ErrAliasNotConfirmed,
+	ErrInvalidRedirect,
+	ErrPinnedFieldsChanged,
+	ErrExportInvalid,
+}
+
+// IsVerificationError reports whether err means that a response was received,
+// but couldn't be verified, for example because its signature doesn't match
+// the server's pinned key. Errors caused by the client's own trust decisions,
+// such as [ErrHostQuarantined] and [ErrKeyNotConfirmed], aren't verification
+// errors.
+func IsVerificationError(err error) bool {
+	for _, target := range verificationErrors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// SoftFailResult is the result of a lookup using [Client.LookupSoftFail].
+type SoftFailResult struct {
+	// Descriptor is the descriptor that was looked up.
+	Descriptor *Descriptor
+	// Verified is true if the descriptor was verified. If it's false,
+	// the descriptor must be treated as untrusted, since anyone able to
+	// tamper with the response could have written it.
+	Verified bool
+	// Err is the error verification failed with, if Verified is false.
+	Err error
+}
+
+// LookupSoftFail is the same as [Client.Lookup], but if the descriptor can't
+// be verified, it's fetched again without verification and returned with
+// Verified set to false, rather than failing with an error. It's meant for
+// read-only consumers, such as search indexers, which would rather ingest
+// unverified profiles and mark them as such than skip them. Nothing learned
+// from an unverified response is saved, so keys aren't pinned or rotated.
+//
+// Errors that aren't verification errors, as reported by
+// [IsVerificationError], are still returned, as is the verification
+// error if the descriptor can't be fetched again.
+func (c Client) LookupSoftFail(resource string) (*SoftFailResult, error) {
+	wfdesc, err := c.webfinger().LookupAcct(resource)
+	if err != nil {
+		return nil, err
+	}
+
+	desc := &Descriptor{}
+	_, err = c.lookup(wfdesc, lookupParams{}, desc)
+	if err == nil {
+		return &SoftFailResult{Descriptor: desc, Verified: true}, nil
+	} else if !IsVerificationError(err) {
+		return nil, err
+	}
+
+	c.tracef("verification failed: %s, fetching descriptor without verification", err)
+	desc, ferr := c.fetchUnverified(wfdesc)
+	if ferr != nil {
+		c.tracef("unverified fetch failed: %s", ferr)
+		return nil, err
+	}
+	return &SoftFailResult{Descriptor: desc, Err: err}, nil
+}
+
+// fetchUnverified fetches the descriptor linked from wfdesc without verifying
+// it. The client's policy and audience restrictions still apply.
+func (c Client) fetchUnverified(wfdesc *webfinger.Descriptor) (*Descriptor, error) {
+	pfdLink, ok := wfdesc.LinkByType("application/x-pfd+json")
+	if !ok {
+		return nil, errors.New("server does not support the profilefed protocol")
+	}
+
+	pfdURL, err := url.Parse(pfdLink.Href)
+	if err != nil {
+		return nil, err
+	}
+	pfdURL.Host = normalizeHost(pfdURL.Host)
+
+	resourceHost, _ := resourceServer(wfdesc.Subject)
+	if err := c.checkSite(resourceHost, pfdURL); err != nil {
+		return nil, err
+	}
+
+	res, err := c.getDescriptor(pfdURL, "")
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if err := checkResp(res, "getProfileDescriptor"); err != nil {
+		return nil, err
+	}
+
+	desc := &Descriptor{}
+	err = json.NewDecoder(io.LimitReader(res.Body, responseSizeLimit)).Decode(desc)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.filterAudience(pfdURL.Host, desc); err != nil {
+		return nil, err
+	}
+	return desc, nil
+}
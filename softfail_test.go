@@ -0,0 +1,49 @@
+package profilefed
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLookupSoftFail(t *testing.T) {
+	desc := &Descriptor{ID: "main", Username: "user", DisplayName: "User"}
+
+	_, other, err := GenerateKeys()
+	if err != nil {
+		t.Fatalf("GenerateKeys error: %s", err)
+	}
+
+	mt := &MemoryTransport{}
+	mt.Register("good.test", newTenant(t, "good.test", desc))
+	// The descriptor is signed by a key other than the one in the server info
+	mt.Register("bad.test", newTenant(t, "bad.test", desc, func(h *Handler) {
+		h.PrivateKey = other
+	}))
+
+	c := mt.Client()
+	res, err := c.LookupSoftFail("user@good.test")
+	if err != nil {
+		t.Fatalf("LookupSoftFail error: %s", err)
+	}
+	if !res.Verified || res.Err != nil {
+		t.Errorf("Expected verified result, got %+v", res)
+	}
+
+	res, err = c.LookupSoftFail("user@bad.test")
+	if err != nil {
+		t.Fatalf("LookupSoftFail error: %s", err)
+	}
+	if res.Verified || !errors.Is(res.Err, ErrSignatureMismatch) {
+		t.Errorf("Expected unverified result with ErrSignatureMismatch, got %+v", res)
+	}
+	if res.Descriptor.DisplayName != "User" {
+		t.Errorf("Unexpected display name: %q", res.Descriptor.DisplayName)
+	}
+
+	if err := c.QuarantineHost("bad.test"); err != nil {
+		t.Fatalf("QuarantineHost error: %s", err)
+	}
+	if _, err := c.LookupSoftFail("user@bad.test"); !errors.Is(err, ErrHostQuarantined) {
+		t.Errorf("Expected ErrHostQuarantined, got %v", err)
+	}
+}
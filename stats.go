@@ -0,0 +1,174 @@
+package profilefed
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	// StatsNamespace is the namespace of the stats extra.
+	// See [Descriptor.AddStats].
+	StatsNamespace = "https://queerdevs.org/profilefed/ns/stats"
+	// StatsExtraType is the type of the stats extra.
+	StatsExtraType = "stats"
+)
+
+// Granularity controls how precisely a statistic is published.
+type Granularity string
+
+// Granularities
+const (
+	// GranularityExact publishes the exact value.
+	GranularityExact Granularity = ""
+	// GranularityBucketed publishes an approximate value. Counts are
+	// rounded down to 1, 5, 10, 50, 100, and so on, and dates are
+	// reduced to the month.
+	GranularityBucketed Granularity = "bucketed"
+	// GranularityHidden doesn't publish the value at all.
+	GranularityHidden Granularity = "hidden"
+)
+
+// ActivityBucket describes roughly how recently a user was last active.
+type ActivityBucket string
+
+// Activity buckets
+const (
+	ActiveDay      ActivityBucket = "day"
+	ActiveWeek     ActivityBucket = "week"
+	ActiveMonth    ActivityBucket = "month"
+	ActiveYear     ActivityBucket = "year"
+	ActiveInactive ActivityBucket = "inactive"
+)
+
+// Stats contains the statistics published in a profile's stats extra.
+// Statistics that aren't published are nil or empty.
+type Stats struct {
+	Followers *StatCount `json:"followers,omitempty"`
+	Following *StatCount `json:"following,omitempty"`
+	Posts     *StatCount `json:"posts,omitempty"`
+	// Joined is the date the user joined, formatted as YYYY-MM-DD,
+	// or as YYYY-MM if it's bucketed.
+	Joined string `json:"joined,omitempty"`
+	// LastActive describes roughly how recently the user was last active.
+	LastActive ActivityBucket `json:"last_active,omitempty"`
+}
+
+// StatCount is a published count.
+type StatCount struct {
+	Count int64 `json:"count"`
+	// Bucketed is true if Count has been rounded down,
+	// which means it's a lower bound of the actual count.
+	Bucketed bool `json:"bucketed,omitempty"`
+}
+
+// RawStats contains a user's actual statistics, before a [StatsPolicy] is applied.
+type RawStats struct {
+	Followers  int64
+	Following  int64
+	Posts      int64
+	Joined     time.Time
+	LastActive time.Time
+}
+
+// StatsPolicy controls how precisely each statistic is published.
+// The zero value publishes everything exactly. Since the last active
+// time is always published as an [ActivityBucket], LastActive only
+// distinguishes between hidden and published.
+type StatsPolicy struct {
+	Followers  Granularity
+	Following  Granularity
+	Posts      Granularity
+	Joined     Granularity
+	LastActive Granularity
+}
+
+// Apply returns the stats to publish for raw according to the policy.
+// Zero times are never published.
+func (sp StatsPolicy) Apply(raw RawStats, now time.Time) Stats {
+	out := Stats{
+		Followers: statCount(raw.Followers, sp.Followers),
+		Following: statCount(raw.Following, sp.Following),
+		Posts:     statCount(raw.Posts, sp.Posts),
+	}
+
+	if !raw.Joined.IsZero() {
+		switch sp.Joined {
+		case GranularityExact:
+			out.Joined = raw.Joined.UTC().Format(time.DateOnly)
+		case GranularityBucketed:
+			out.Joined = raw.Joined.UTC().Format("2006-01")
+		}
+	}
+
+	if !raw.LastActive.IsZero() && sp.LastActive != GranularityHidden {
+		out.LastActive = activityBucket(now.Sub(raw.LastActive))
+	}
+
+	return out
+}
+
+// statCount returns the published version of n with the given granularity.
+func statCount(n int64, g Granularity) *StatCount {
+	switch g {
+	case GranularityHidden:
+		return nil
+	case GranularityBucketed:
+		return &StatCount{Count: bucketCount(n), Bucketed: true}
+	default:
+		return &StatCount{Count: n}
+	}
+}
+
+// bucketCount rounds n down to 0, 1, 5, 10, 50, 100, and so on.
+func bucketCount(n int64) int64 {
+	if n < 1 {
+		return 0
+	}
+
+	bucket := int64(1)
+	for {
+		if bucket*5 > n {
+			return bucket
+		} else if bucket*10 > n {
+			return bucket * 5
+		}
+		bucket *= 10
+	}
+}
+
+// activityBucket returns the activity bucket for a user
+// who was last active the given duration ago.
+func activityBucket(d time.Duration) ActivityBucket {
+	switch {
+	case d < 24*time.Hour:
+		return ActiveDay
+	case d < 7*24*time.Hour:
+		return ActiveWeek
+	case d < 31*24*time.Hour:
+		return ActiveMonth
+	case d < 366*24*time.Hour:
+		return ActiveYear
+	default:
+		return ActiveInactive
+	}
+}
+
+// AddStats is a convenience function that adds a stats extra to the descriptor.
+func (d *Descriptor) AddStats(stats Stats) error {
+	return d.AddExtra(StatsNamespace, StatsExtraType, stats)
+}
+
+// Stats returns the statistics published in the descriptor's stats extra, if any.
+func (d *Descriptor) Stats() (*Stats, bool) {
+	for _, extra := range d.Extra {
+		if extra.Namespace != StatsNamespace || extra.Type != StatsExtraType {
+			continue
+		}
+
+		stats := &Stats{}
+		if err := json.Unmarshal(extra.Data, stats); err == nil {
+			return stats, true
+		}
+	}
+	return nil, false
+}
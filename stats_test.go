@@ -0,0 +1,52 @@
+package profilefed
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	now := time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC)
+	raw := RawStats{
+		Followers:  1234,
+		Following:  7,
+		Posts:      42,
+		Joined:     time.Date(2023, 4, 26, 8, 0, 0, 0, time.UTC),
+		LastActive: now.Add(-3 * 24 * time.Hour),
+	}
+
+	policy := StatsPolicy{
+		Followers: GranularityBucketed,
+		Following: GranularityHidden,
+		Joined:    GranularityBucketed,
+	}
+
+	expected := Stats{
+		Followers:  &StatCount{Count: 1000, Bucketed: true},
+		Posts:      &StatCount{Count: 42},
+		Joined:     "2023-04",
+		LastActive: ActiveWeek,
+	}
+
+	stats := policy.Apply(raw, now)
+	if !reflect.DeepEqual(stats, expected) {
+		t.Errorf("Stats are not equal:\n%#v\n\n%#v", stats, expected)
+	}
+
+	desc := &Descriptor{ID: "main"}
+	if err := desc.AddStats(stats); err != nil {
+		t.Fatalf("AddStats error: %s", err)
+	}
+
+	got, ok := desc.Stats()
+	if !ok || !reflect.DeepEqual(*got, expected) {
+		t.Errorf("Stats are not equal:\n%#v\n\n%#v", got, expected)
+	}
+
+	for n, bucket := range map[int64]int64{0: 0, 1: 1, 4: 1, 5: 5, 9: 5, 10: 10, 49: 10, 50: 50, 99: 50, 5000: 5000} {
+		if got := bucketCount(n); got != bucket {
+			t.Errorf("Expected bucket %d for %d, got %d", bucket, n, got)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package profilefed
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Tarpit configures the honeypot mode used by [Handler] for abusive clients.
+//
+// Once a client trips the handler's rate limiter Threshold times within
+// Window, it's put into the tarpit for Duration. While it's there, every
+// request it makes is either answered with a decoy descriptor (if DecoyFunc
+// is set) or with a response that's dripped out very slowly.
+type Tarpit struct {
+	// Threshold is the number of times the rate limiter has to trip
+	// for a client within Window before the client is tarpitted.
+	Threshold int
+	// Window is the time window in which rate limiter trips are counted.
+	Window time.Duration
+	// Duration is how long a client stays in the tarpit.
+	Duration time.Duration
+
+	// DripInterval is the delay between each byte written to a tarpitted client.
+	// If zero, one second is used.
+	DripInterval time.Duration
+	// MaxDripTime is the maximum amount of time spent dripping a single response.
+	// If zero, one minute is used.
+	MaxDripTime time.Duration
+
+	// DecoyFunc, if set, returns a decoy descriptor that's served to tarpitted
+	// clients instead of the slow drip. Decoys are signed like any other response,
+	// so scrapers can't easily tell them apart from real ones.
+	DecoyFunc func(req *http.Request) *Descriptor
+
+	// OnOffender is called whenever a client is put into the tarpit.
+	OnOffender func(info OffenderInfo)
+
+	mtx     sync.Mutex
+	clients map[string]*tarpitClient
+}
+
+// OffenderInfo contains metadata about a client that was put into the tarpit.
+type OffenderInfo struct {
+	// Key is the rate limiter key that identifies the client.
+	Key string
+	// RemoteAddr is the remote address of the request that tripped the tarpit.
+	RemoteAddr string
+	// UserAgent is the user agent of the request that tripped the tarpit.
+	UserAgent string
+	// Path is the path requested by the client.
+	Path string
+	// Trips is the number of times the rate limiter tripped within the window.
+	Trips int
+	// Until is the time at which the client will be let out of the tarpit.
+	Until time.Time
+}
+
+type tarpitClient struct {
+	trips []time.Time
+	until time.Time
+}
+
+// Trapped reports whether the client identified by key is currently in the tarpit.
+func (t *Tarpit) Trapped(key string) bool {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	c, ok := t.clients[key]
+	if !ok {
+		return false
+	}
+	return time.Now().Before(c.until)
+}
+
+// Release removes the client identified by key from the tarpit.
+func (t *Tarpit) Release(key string) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	delete(t.clients, key)
+}
+
+// trip records a rate limiter trip for the client that made the request,
+// and reports whether the client is now in the tarpit.
+func (t *Tarpit) trip(key string, req *http.Request) bool {
+	t.mtx.Lock()
+
+	now := time.Now()
+	if t.clients == nil {
+		t.clients = map[string]*tarpitClient{}
+	}
+
+	c, ok := t.clients[key]
+	if !ok {
+		if len(t.clients) >= maxBuckets {
+			t.prune(now)
+		}
+		c = &tarpitClient{}
+		t.clients[key] = c
+	}
+
+	if now.Before(c.until) {
+		t.mtx.Unlock()
+		return true
+	}
+
+	// Drop any trips that have fallen out of the window
+	cutoff := now.Add(-t.Window)
+	i := 0
+	for i < len(c.trips) && c.trips[i].Before(cutoff) {
+		i++
+	}
+	c.trips = append(c.trips[i:], now)
+
+	if len(c.trips) < t.Threshold {
+		t.mtx.Unlock()
+		return false
+	}
+
+	info := OffenderInfo{
+		Key:        key,
+		RemoteAddr: req.RemoteAddr,
+		UserAgent:  req.UserAgent(),
+		Path:       req.URL.Path,
+		Trips:      len(c.trips),
+		Until:      now.Add(t.Duration),
+	}
+	c.until = info.Until
+	c.trips = nil
+	t.mtx.Unlock()
+
+	if t.OnOffender != nil {
+		t.OnOffender(info)
+	}
+	return true
+}
+
+// prune removes any clients that aren't tarpitted and have no recent trips.
+func (t *Tarpit) prune(now time.Time) {
+	cutoff := now.Add(-t.Window)
+	for key, c := range t.clients {
+		if now.After(c.until) && (len(c.trips) == 0 || c.trips[len(c.trips)-1].Before(cutoff)) {
+			delete(t.clients, key)
+		}
+	}
+}
+
+// drip writes data to res one byte at a time, waiting DripInterval between
+// each byte. It stops early if the client disconnects or MaxDripTime is exceeded.
+func (t *Tarpit) drip(res http.ResponseWriter, req *http.Request, data []byte) {
+	interval := t.DripInterval
+	if interval == 0 {
+		interval = time.Second
+	}
+
+	maxTime := t.MaxDripTime
+	if maxTime == 0 {
+		maxTime = time.Minute
+	}
+
+	flusher, _ := res.(http.Flusher)
+	timer := time.NewTimer(maxTime)
+	defer timer.Stop()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	res.WriteHeader(http.StatusOK)
+	for _, b := range data {
+		if _, err := res.Write([]byte{b}); err != nil {
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+
+		select {
+		case <-ticker.C:
+		case <-timer.C:
+			return
+		case <-req.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package profilefed
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHandlerTarpit(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey error: %s", err)
+	}
+
+	var offenders []OffenderInfo
+	tarpit := &Tarpit{
+		Threshold:    2,
+		Window:       time.Minute,
+		Duration:     time.Minute,
+		DripInterval: time.Millisecond,
+		OnOffender: func(info OffenderInfo) {
+			offenders = append(offenders, info)
+		},
+	}
+
+	h := Handler{
+		PrivateKey:  priv,
+		RateLimiter: NewRateLimiter(0.001, 1),
+		Tarpit:      tarpit,
+		DescriptorFunc: func(req *Request) (*Descriptor, error) {
+			return &Descriptor{ID: "main", Username: "user", DisplayName: "User"}, nil
+		},
+	}
+
+	// The first request is allowed, the second one trips the rate limiter,
+	// and the third one trips it again, which puts the client in the tarpit.
+	var rec *httptest.ResponseRecorder
+	for range 3 {
+		rec = httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/pfd/user", nil))
+	}
+
+	key := h.RateLimiter.Key(httptest.NewRequest(http.MethodGet, "/pfd/user", nil))
+	if !tarpit.Trapped(key) {
+		t.Fatalf("Client was not put into the tarpit")
+	}
+	if len(offenders) != 1 || offenders[0].Key != key || offenders[0].Trips != 2 || offenders[0].Path != "/pfd/user" {
+		t.Errorf("Unexpected offenders: %#v", offenders)
+	}
+
+	// Tarpitted clients get an empty descriptor, dripped out one byte at a time
+	var desc Descriptor
+	if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &desc) != nil || desc.Username != "" {
+		t.Errorf("Unexpected tarpit response: %d %q", rec.Code, rec.Body)
+	}
+
+	tarpit.Release(key)
+	if tarpit.Trapped(key) {
+		t.Errorf("Client is still trapped after Release")
+	}
+}
+
+func TestTarpitMaxDripTime(t *testing.T) {
+	tarpit := &Tarpit{DripInterval: 10 * time.Millisecond, MaxDripTime: 35 * time.Millisecond}
+
+	rec := httptest.NewRecorder()
+	tarpit.drip(rec, httptest.NewRequest(http.MethodGet, "/pfd/user", nil), make([]byte, 100))
+
+	if n := rec.Body.Len(); n == 0 || n >= 100 {
+		t.Errorf("Expected the drip to stop early, wrote %d bytes", n)
+	}
+}
+
+func TestTarpitDecoy(t *testing.T) {
+	decoy := &Descriptor{ID: "main", Username: "decoy", DisplayName: "Decoy"}
+	tarpit := &Tarpit{
+		Threshold: 1,
+		Window:    time.Minute,
+		Duration:  time.Minute,
+		DecoyFunc: func(req *http.Request) *Descriptor {
+			return decoy
+		},
+	}
+
+	mt := &MemoryTransport{}
+	mt.Register("example.test", newTenant(t, "example.test", &Descriptor{ID: "main", Username: "user", DisplayName: "User"}, func(h *Handler) {
+		h.RateLimiter = &RateLimiter{Rate: 0.001, Burst: 1, KeyFunc: func(*http.Request) string { return "client" }}
+		h.Tarpit = tarpit
+	}))
+
+	c := mt.Client()
+	if _, err := c.Lookup("user@example.test"); err != nil {
+		t.Fatalf("Lookup error: %s", err)
+	}
+
+	// Decoys are signed like real responses, so they verify
+	desc, err := c.Lookup("user@example.test")
+	if err != nil {
+		t.Fatalf("Lookup error for decoy: %s", err)
+	}
+	if desc.Username != "decoy" {
+		t.Errorf("Expected decoy descriptor, got %#v", desc)
+	}
+}
@@ -0,0 +1,105 @@
+package profilefed
+
+import (
+	"slices"
+	"strings"
+)
+
+// DescriptorTemplate contains defaults that are filled into descriptors
+// before they're signed, so that DescriptorFunc implementations only have
+// to provide the fields that actually differ between users.
+type DescriptorTemplate struct {
+	// Role is used if a descriptor has no role.
+	Role Role
+	// Bio is used if a descriptor has no bio.
+	Bio string
+	// UsernameFunc, if set, derives a username for descriptors that have none,
+	// for example from the request path.
+	UsernameFunc func(req *Request) string
+	// Namespaces are added to every descriptor that doesn't already define them.
+	Namespaces []string
+	// Extra contains extra data objects that are added to every descriptor
+	// that doesn't already have an extra with the same namespace and type.
+	Extra []Extra
+
+	// Tenants maps request hosts to templates that override this one for
+	// requests to that host. Non-zero fields of a tenant's template take
+	// precedence, and its namespaces and extras are added to this template's.
+	Tenants map[string]*DescriptorTemplate
+}
+
+// Apply returns a copy of desc with the template's defaults filled in.
+// Namespaces used by the descriptor's extras are always added to its namespace
+// list if they're missing. The descriptor passed to Apply is never modified.
+func (dt *DescriptorTemplate) Apply(req *Request, desc *Descriptor) *Descriptor {
+	tmpl := dt
+	if req != nil && req.HTTPRequest != nil {
+		if tenant, ok := dt.Tenants[req.HTTPRequest.Host]; ok {
+			tmpl = dt.merge(tenant)
+		}
+	}
+
+	out := *desc
+	out.Namespaces = slices.Clone(desc.Namespaces)
+	out.Extra = slices.Clone(desc.Extra)
+
+	if out.Role == "" {
+		out.Role = tmpl.Role
+	}
+
+	if out.Bio == "" {
+		out.Bio = tmpl.Bio
+	}
+
+	if out.Username == "" && tmpl.UsernameFunc != nil {
+		out.Username = tmpl.UsernameFunc(req)
+	}
+
+	for _, extra := range tmpl.Extra {
+		exists := slices.ContainsFunc(out.Extra, func(e Extra) bool {
+			return e.Namespace == extra.Namespace && e.Type == extra.Type
+		})
+		if !exists {
+			out.Extra = append(out.Extra, extra)
+		}
+	}
+
+	for _, ns := range tmpl.Namespaces {
+		if !slices.Contains(out.Namespaces, ns) {
+			out.Namespaces = append(out.Namespaces, ns)
+		}
+	}
+
+	for _, extra := range out.Extra {
+		ns, _, _ := strings.Cut(extra.Namespace, "#")
+		if !slices.Contains(out.Namespaces, ns) {
+			out.Namespaces = append(out.Namespaces, ns)
+		}
+	}
+
+	return &out
+}
+
+// merge returns a new template with the non-zero fields of override applied.
+func (dt *DescriptorTemplate) merge(override *DescriptorTemplate) *DescriptorTemplate {
+	out := *dt
+	out.Tenants = nil
+
+	if override.Role != "" {
+		out.Role = override.Role
+	}
+
+	if override.Bio != "" {
+		out.Bio = override.Bio
+	}
+
+	if override.UsernameFunc != nil {
+		out.UsernameFunc = override.UsernameFunc
+	}
+
+	// The override's extras come first, so they take
+	// precedence over the base template's.
+	out.Namespaces = append(slices.Clone(dt.Namespaces), override.Namespaces...)
+	out.Extra = append(slices.Clone(override.Extra), dt.Extra...)
+	return &out
+}
@@ -0,0 +1,39 @@
+package profilefed
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestDescriptorTemplate(t *testing.T) {
+	tmpl := &DescriptorTemplate{
+		Role:       RoleUser,
+		Namespaces: []string{"https://example.com/ns"},
+		UsernameFunc: func(req *Request) string {
+			return req.Query.Get("user")
+		},
+		Tenants: map[string]*DescriptorTemplate{
+			"tenant.example.com": {Bio: "Tenant user"},
+		},
+	}
+
+	desc := &Descriptor{ID: "main"}
+	req := parseRequest(httptest.NewRequest("GET", "http://tenant.example.com/pfd?user=alice", nil))
+
+	out := tmpl.Apply(req, desc)
+	expected := &Descriptor{
+		ID:         "main",
+		Username:   "alice",
+		Role:       RoleUser,
+		Bio:        "Tenant user",
+		Namespaces: []string{"https://example.com/ns"},
+	}
+	if !reflect.DeepEqual(out, expected) {
+		t.Errorf("Descriptors are not equal:\n%#v\n\n%#v", out, expected)
+	}
+
+	if desc.Role != "" || desc.Namespaces != nil {
+		t.Errorf("Original descriptor was modified: %#v", desc)
+	}
+}
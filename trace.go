@@ -0,0 +1,94 @@
+package profilefed
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// redactedParams contains query parameters whose values are never traced.
+var redactedParams = []string{"token", "access_token", "code", ShareParam}
+
+// TraceTransport is an [http.RoundTripper] that reports a summary of every
+// request and response it handles. Credentials such as the Authorization
+// header and token query parameters are redacted, so the output can be
+// shared in bug reports.
+type TraceTransport struct {
+	// Transport is the underlying transport. If nil,
+	// [http.DefaultTransport] is used.
+	Transport http.RoundTripper
+	// Trace is called with every line of the transcript.
+	Trace func(msg string)
+}
+
+// RoundTrip implements the [http.RoundTripper] interface
+func (tt TraceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport := tt.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	msg := "-> " + req.Method + " " + redactURL(req.URL)
+	if req.Header.Get("Authorization") != "" {
+		msg += " (Authorization: [redacted])"
+	}
+	tt.Trace(msg)
+
+	res, err := transport.RoundTrip(req)
+	if err != nil {
+		tt.Trace("<- error: " + err.Error())
+		return nil, err
+	}
+
+	msg = fmt.Sprintf("<- %s (Content-Type: %q, Content-Length: %d)", res.Status, res.Header.Get("Content-Type"), res.ContentLength)
+	if sig := res.Header.Get("X-ProfileFed-Sig"); sig != "" {
+		msg += ", signature: " + sig
+	}
+	if n := len(res.Header.Values("X-ProfileFed-Previous")); n > 0 {
+		msg += fmt.Sprintf(", previous signatures: %d", n)
+	}
+	tt.Trace(msg)
+
+	return res, nil
+}
+
+// redactURL returns u as a string with credentials removed.
+func redactURL(u *url.URL) string {
+	out := *u
+	if out.User != nil {
+		out.User = url.User("redacted")
+	}
+
+	q := out.Query()
+	for _, param := range redactedParams {
+		if q.Has(param) {
+			q.Set(param, "redacted")
+		}
+	}
+	out.RawQuery = q.Encode()
+	return out.String()
+}
+
+// WithTrace returns a copy of the client that reports every request it
+// makes and every verification decision it takes to trace, such as trusting
+// a server on first use or accepting a key rotation.
+func (c Client) WithTrace(trace func(msg string)) Client {
+	c.Trace = trace
+
+	httpClient := &http.Client{}
+	if c.HTTPClient != nil {
+		*httpClient = *c.HTTPClient
+	}
+	httpClient.Transport = TraceTransport{Transport: httpClient.Transport, Trace: trace}
+	c.HTTPClient = httpClient
+	return c
+}
+
+// tracef reports a verification step to the client's Trace function, if set.
+func (c Client) tracef(format string, args ...any) {
+	if c.Trace == nil {
+		return
+	}
+	c.Trace(strings.TrimSpace(fmt.Sprintf(format, args...)))
+}
@@ -31,8 +31,72 @@ type Descriptor struct {
 	Role Role `json:"role"`
 	// Extra is additional user data defined by namespaces
 	Extra []Extra `json:"extra"`
+	// DID is an optional decentralized identifier the profile is anchored to.
+	// Only did:web DIDs are currently supported for verification.
+	DID string `json:"did,omitempty"`
+	// AvatarURL is the URL of the user's avatar image.
+	AvatarURL string `json:"avatar_url,omitempty"`
+	// BannerURL is the URL of the user's banner image.
+	BannerURL string `json:"banner_url,omitempty"`
+	// AvatarAlt is the text alternative for the avatar image, which is
+	// read by screen readers and shown if the image can't be loaded.
+	AvatarAlt string `json:"avatar_alt,omitempty"`
+	// BannerAlt is the text alternative for the banner image.
+	BannerAlt string `json:"banner_alt,omitempty"`
+	// Pronouns contains the user's pronouns in free-form text, such as "they/them".
+	Pronouns string `json:"pronouns,omitempty"`
+
+	// ContentWarning, if set, is a short summary of why the profile's bio and
+	// media need a warning. Clients should hide them behind it until the
+	// reader chooses to reveal them.
+	ContentWarning string `json:"content_warning,omitempty"`
+	// Sensitive marks all of the profile's media as sensitive, so that clients
+	// hide it until the reader chooses to reveal it, even without a warning.
+	Sensitive bool `json:"sensitive,omitempty"`
+	// AvatarSensitive marks only the avatar image as sensitive.
+	AvatarSensitive bool `json:"avatar_sensitive,omitempty"`
+	// BannerSensitive marks only the banner image as sensitive.
+	BannerSensitive bool `json:"banner_sensitive,omitempty"`
+	// Audience is the audience the profile is suitable for. If not set,
+	// [AudienceGeneral] is assumed.
+	Audience Audience `json:"audience,omitempty"`
+
+	// Privacy controls how much of the profile is disclosed to anonymous
+	// clients. It's only used by [Handler] and [ExportHandler], and is never
+	// sent to clients.
+	Privacy Privacy `json:"-"`
+}
+
+// NeedsReveal reports whether the field with the given JSON name, such as bio
+// or avatar_url, should be hidden until the reader chooses to reveal it. The bio
+// and media are hidden if the descriptor has a content warning, and media is
+// hidden if it's marked as sensitive.
+func (d *Descriptor) NeedsReveal(field string) bool {
+	switch field {
+	case "bio":
+		return d.ContentWarning != ""
+	case "avatar_url":
+		return d.ContentWarning != "" || d.Sensitive || d.AvatarSensitive
+	case "banner_url":
+		return d.ContentWarning != "" || d.Sensitive || d.BannerSensitive
+	default:
+		return false
+	}
 }
 
+// Privacy represents a profile's privacy mode
+type Privacy string
+
+// Privacy modes
+const (
+	// PrivacyDefault discloses the full profile to every client.
+	PrivacyDefault Privacy = ""
+	// PrivacyMinimal discloses only a minimal profile to anonymous clients,
+	// reserving the full profile for authenticated clients and known peers.
+	// See [Handler.MinimalFields].
+	PrivacyMinimal Privacy = "minimal"
+)
+
 // Extra represents additional user data defined by namespaces
 type Extra struct {
 	// Namespace is the namespace URL used in this object
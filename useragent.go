@@ -0,0 +1,78 @@
+package profilefed
+
+import (
+	"cmp"
+	"net/http"
+	"runtime/debug"
+)
+
+// modulePath is the import path of this module.
+const modulePath = "queerdevs.org/profilefed"
+
+// DefaultUserAgent is the User-Agent header sent with WebFinger, server info,
+// and descriptor requests by clients whose UserAgent is empty, such as
+// "profilefed-go/v1.2.0". The version is read from the build info of the
+// binary, so it's omitted for development builds. Set it to an empty string
+// to send Go's default User-Agent instead.
+var DefaultUserAgent = defaultUserAgent()
+
+// defaultUserAgent returns the default User-Agent, including the
+// version of this module if the build info contains it.
+func defaultUserAgent() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "profilefed-go"
+	}
+
+	mod := &info.Main
+	for _, dep := range info.Deps {
+		if dep.Path == modulePath {
+			mod = dep
+			break
+		}
+	}
+
+	if mod.Path != modulePath || mod.Version == "" || mod.Version == "(devel)" {
+		return "profilefed-go"
+	}
+	return "profilefed-go/" + mod.Version
+}
+
+// userAgentTransport is an [http.RoundTripper] that sets the
+// User-Agent header of requests that don't already have one.
+type userAgentTransport struct {
+	transport http.RoundTripper
+	userAgent string
+}
+
+// RoundTrip implements the [http.RoundTripper] interface
+func (ut userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport := ut.transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	if req.Header.Get("User-Agent") == "" {
+		// RoundTrippers must not modify the request they're given
+		req = req.Clone(req.Context())
+		req.Header.Set("User-Agent", ut.userAgent)
+	}
+	return transport.RoundTrip(req)
+}
+
+// withUserAgent returns a copy of hc that sends userAgent
+// with every request, or hc itself if userAgent is empty.
+func withUserAgent(hc *http.Client, userAgent string) *http.Client {
+	if userAgent == "" {
+		return hc
+	}
+
+	out := *hc
+	out.Transport = userAgentTransport{transport: hc.Transport, userAgent: userAgent}
+	return &out
+}
+
+// userAgent returns the User-Agent sent with the client's requests.
+func (c Client) userAgent() string {
+	return cmp.Or(c.UserAgent, DefaultUserAgent)
+}
@@ -0,0 +1,35 @@
+package profilefed
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+)
+
+func TestUserAgent(t *testing.T) {
+	tenant := newTenant(t, "ua.test", &Descriptor{ID: "main", Username: "user", DisplayName: "User"})
+
+	var (
+		mtx    sync.Mutex
+		agents = map[string]string{}
+	)
+	mt := &MemoryTransport{}
+	mt.Register("ua.test", http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		mtx.Lock()
+		agents[req.URL.Path] = req.UserAgent()
+		mtx.Unlock()
+		tenant.ServeHTTP(res, req)
+	}))
+
+	c := mt.Client()
+	c.UserAgent = "uatest/1.0"
+	if _, err := c.Lookup("user@ua.test"); err != nil {
+		t.Fatalf("Lookup error: %s", err)
+	}
+
+	for _, path := range []string{"/.well-known/webfinger", "/_profilefed/server", "/pfd/user"} {
+		if agents[path] != "uatest/1.0" {
+			t.Errorf("Unexpected User-Agent for %s: %q", path, agents[path])
+		}
+	}
+}
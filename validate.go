@@ -0,0 +1,145 @@
+package profilefed
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// maxPronounsLength is the maximum length of the pronouns field, in characters.
+	maxPronounsLength = 64
+	// maxContentWarningLength is the maximum length of the content warning, in characters.
+	maxContentWarningLength = 200
+	// maxAltTextLength is the maximum length of the avatar and banner alt text, in characters.
+	maxAltTextLength = 1500
+)
+
+// ValidationOptions configures the checks performed by [Descriptor.ValidateWith].
+// The zero value performs all checks.
+type ValidationOptions struct {
+	// AllowMissingAltText allows the avatar and banner to be set without alt
+	// text, for servers whose users can't provide it yet.
+	AllowMissingAltText bool
+}
+
+// InvalidFieldError is returned by [Descriptor.Validate] when a descriptor field has an invalid value.
+type InvalidFieldError struct {
+	Field  string
+	Reason string
+}
+
+func (ife InvalidFieldError) Error() string {
+	return fmt.Sprintf("invalid descriptor field %q: %s", ife.Field, ife.Reason)
+}
+
+// Validate checks that the descriptor's fields have valid values. Currently,
+// the avatar and banner URLs have to be absolute http(s) URLs and need alt text
+// of at most 1500 characters, the pronouns can't be longer than 64 characters or
+// contain control characters, the content warning can't be longer than 200
+// characters or contain control characters, and the audience has to be known.
+func (d *Descriptor) Validate() error {
+	return d.ValidateWith(ValidationOptions{})
+}
+
+// ValidateWith is the same as [Descriptor.Validate], but it allows
+// some of the checks to be relaxed using opts.
+func (d *Descriptor) ValidateWith(opts ValidationOptions) error {
+	if err := ValidateImageURL(d.AvatarURL); err != nil {
+		return InvalidFieldError{Field: "avatar_url", Reason: err.Error()}
+	}
+
+	if err := ValidateImageURL(d.BannerURL); err != nil {
+		return InvalidFieldError{Field: "banner_url", Reason: err.Error()}
+	}
+
+	if err := validateAltText(d.AvatarURL, d.AvatarAlt, opts); err != nil {
+		return InvalidFieldError{Field: "avatar_alt", Reason: err.Error()}
+	}
+
+	if err := validateAltText(d.BannerURL, d.BannerAlt, opts); err != nil {
+		return InvalidFieldError{Field: "banner_alt", Reason: err.Error()}
+	}
+
+	if err := ValidatePronouns(d.Pronouns); err != nil {
+		return InvalidFieldError{Field: "pronouns", Reason: err.Error()}
+	}
+
+	if err := ValidateContentWarning(d.ContentWarning); err != nil {
+		return InvalidFieldError{Field: "content_warning", Reason: err.Error()}
+	}
+
+	if err := ValidateAudience(d.Audience); err != nil {
+		return InvalidFieldError{Field: "audience", Reason: err.Error()}
+	}
+
+	return nil
+}
+
+// ValidateImageURL returns an error if u isn't empty and isn't
+// an absolute http(s) URL, as required for avatar and banner URLs.
+func ValidateImageURL(u string) error {
+	if u == "" {
+		return nil
+	}
+
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return err
+	}
+
+	if parsed.Scheme != "https" && parsed.Scheme != "http" {
+		return fmt.Errorf("unsupported url scheme: %q", parsed.Scheme)
+	}
+
+	if parsed.Host == "" {
+		return errors.New("url has no host")
+	}
+
+	return nil
+}
+
+// ValidatePronouns returns an error if pronouns are too long
+// or contain control characters, such as line breaks.
+func ValidatePronouns(pronouns string) error {
+	if utf8.RuneCountInString(pronouns) > maxPronounsLength {
+		return fmt.Errorf("longer than %d characters", maxPronounsLength)
+	}
+
+	if strings.ContainsFunc(pronouns, unicode.IsControl) {
+		return errors.New("contains control characters")
+	}
+
+	return nil
+}
+
+// ValidateContentWarning returns an error if a content warning
+// is too long or contains control characters, such as line breaks.
+func ValidateContentWarning(cw string) error {
+	if utf8.RuneCountInString(cw) > maxContentWarningLength {
+		return fmt.Errorf("longer than %d characters", maxContentWarningLength)
+	}
+
+	if strings.ContainsFunc(cw, unicode.IsControl) {
+		return errors.New("contains control characters")
+	}
+
+	return nil
+}
+
+// validateAltText returns an error if alt is too long, or if it's
+// missing for the image at imageURL and opts require it.
+func validateAltText(imageURL, alt string, opts ValidationOptions) error {
+	if utf8.RuneCountInString(alt) > maxAltTextLength {
+		return fmt.Errorf("longer than %d characters", maxAltTextLength)
+	}
+
+	if imageURL != "" && strings.TrimSpace(alt) == "" && !opts.AllowMissingAltText {
+		return errors.New("image has no alt text")
+	}
+
+	return nil
+}
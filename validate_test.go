@@ -0,0 +1,67 @@
+package profilefed
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestDescriptorValidate(t *testing.T) {
+	desc := &Descriptor{
+		ID:        "main",
+		AvatarURL: "https://example.com/avatar.png",
+		BannerURL: "https://example.com/banner.png",
+		AvatarAlt: "A cartoon frog wearing a party hat",
+		BannerAlt: "A sunset over the sea",
+		Pronouns:  "they/them",
+
+		ContentWarning: "eye contact",
+	}
+
+	if err := desc.Validate(); err != nil {
+		t.Fatalf("Validate error: %s", err)
+	}
+
+	invalid := map[string]*Descriptor{
+		"avatar_url": {AvatarURL: "javascript:alert(1)"},
+		"banner_url": {BannerURL: "/banner.png"},
+		"pronouns":   {Pronouns: "they/them\nshe/her"},
+		"avatar_alt": {AvatarURL: "https://example.com/avatar.png"},
+		"banner_alt": {BannerURL: "https://example.com/banner.png", BannerAlt: " "},
+
+		"content_warning": {ContentWarning: strings.Repeat("a", 201)},
+		"audience":        {Audience: "everyone"},
+	}
+
+	for field, desc := range invalid {
+		var ife InvalidFieldError
+		err := desc.Validate()
+		if !errors.As(err, &ife) || ife.Field != field {
+			t.Errorf("Expected invalid %s error, got %v", field, err)
+		}
+	}
+}
+
+func TestDescriptorValidateWith(t *testing.T) {
+	desc := &Descriptor{ID: "main", AvatarURL: "https://example.com/avatar.png"}
+	if err := desc.ValidateWith(ValidationOptions{AllowMissingAltText: true}); err != nil {
+		t.Fatalf("ValidateWith error: %s", err)
+	}
+
+	desc.AvatarAlt = strings.Repeat("a", 1501)
+	if err := desc.ValidateWith(ValidationOptions{AllowMissingAltText: true}); err == nil {
+		t.Error("Expected error for alt text longer than 1500 characters")
+	}
+}
+
+func TestDescriptorNeedsReveal(t *testing.T) {
+	desc := &Descriptor{Bio: "bio", AvatarURL: "https://example.com/avatar.png", AvatarSensitive: true}
+	if desc.NeedsReveal("bio") || !desc.NeedsReveal("avatar_url") || desc.NeedsReveal("banner_url") {
+		t.Error("Only the avatar should be hidden if it's marked as sensitive")
+	}
+
+	desc.ContentWarning = "spiders"
+	if !desc.NeedsReveal("bio") || !desc.NeedsReveal("banner_url") || desc.NeedsReveal("display_name") {
+		t.Error("The bio and media should be hidden behind a content warning")
+	}
+}
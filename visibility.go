@@ -0,0 +1,35 @@
+package profilefed
+
+import "net/http"
+
+// Visibility represents the tier of a descriptor view served to a client.
+type Visibility string
+
+// Visibility tiers
+const (
+	// VisibilityPublic is the view served to anonymous clients.
+	VisibilityPublic Visibility = "public"
+	// VisibilityShareLink is the view served to clients that presented
+	// a valid share token. See [NewShareLink].
+	VisibilityShareLink Visibility = "share_link"
+	// VisibilityAuthenticated is the view served to clients
+	// that presented a valid bearer token.
+	VisibilityAuthenticated Visibility = "authenticated"
+	// VisibilityPeer is the view served to federating servers
+	// that authenticated using a TLS client certificate.
+	VisibilityPeer Visibility = "peer"
+)
+
+// RequestVisibility returns the visibility tier that applies to the given request.
+func RequestVisibility(req *http.Request) Visibility {
+	if _, ok := PeerFromRequest(req); ok {
+		return VisibilityPeer
+	}
+	if _, ok := TokenFromContext(req.Context()); ok {
+		return VisibilityAuthenticated
+	}
+	if _, ok := ShareGrantFromContext(req.Context()); ok {
+		return VisibilityShareLink
+	}
+	return VisibilityPublic
+}
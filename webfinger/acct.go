@@ -0,0 +1,120 @@
+package webfinger
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"queerdevs.org/profilefed/internal/idna"
+)
+
+// ErrInvalidAcct signifies that an acct URI or account
+// address isn't valid according to RFC 7565.
+var ErrInvalidAcct = errors.New("invalid acct")
+
+// Acct is an account identified by an acct URI, as defined in RFC 7565.
+type Acct struct {
+	// User is the local part of the account, such as user.
+	User string
+	// Host is the domain of the account, such as example.com, in lower
+	// case and with internationalized labels encoded using Punycode.
+	// It may include a port, which RFC 7565 doesn't allow, so that
+	// development servers can be used.
+	Host string
+}
+
+// ParseAcct parses an acct URI, such as acct:user@example.com, or an account
+// address with or without a leading @, such as @user@example.com. The local
+// part must only contain the characters allowed by RFC 7565, and the domain
+// is normalized to lower case and its ASCII form.
+func ParseAcct(s string) (Acct, error) {
+	addr := strings.TrimPrefix(s, "@")
+	if scheme, rest, ok := strings.Cut(s, ":"); ok && strings.EqualFold(scheme, "acct") {
+		addr = rest
+	}
+
+	user, host, ok := strings.Cut(addr, "@")
+	switch {
+	case !ok:
+		return Acct{}, fmt.Errorf("%w: %q has no domain", ErrInvalidAcct, s)
+	case strings.Contains(host, "@"):
+		return Acct{}, fmt.Errorf("%w: %q contains more than one @", ErrInvalidAcct, s)
+	case !validUser(user):
+		return Acct{}, fmt.Errorf("%w: invalid local part %q", ErrInvalidAcct, user)
+	}
+
+	host, err := idna.ToASCII(host)
+	if err != nil || !validHost(host) {
+		return Acct{}, fmt.Errorf("%w: invalid domain %q", ErrInvalidAcct, host)
+	}
+
+	return Acct{User: user, Host: host}, nil
+}
+
+// String returns the acct URI of the account, such as acct:user@example.com.
+func (a Acct) String() string {
+	return "acct:" + a.User + "@" + a.Host
+}
+
+// validUser reports whether user is a valid acct userpart, which consists
+// of unreserved characters, sub-delims, and percent-encoded octets, and
+// doesn't start with a percent-encoded octet.
+func validUser(user string) bool {
+	if user == "" || user[0] == '%' {
+		return false
+	}
+
+	for i := 0; i < len(user); i++ {
+		switch c := user[i]; {
+		case isUnreserved(c) || strings.IndexByte("!$&'()*+,;=", c) >= 0:
+		case c == '%' && i+2 < len(user) && isHex(user[i+1]) && isHex(user[i+2]):
+			i += 2
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// validHost reports whether host, which has already been converted to
+// ASCII, is a domain name or IP literal with an optional port.
+func validHost(host string) bool {
+	name, port := host, ""
+	if i := strings.LastIndexByte(host, ':'); i >= 0 && !strings.HasSuffix(host, "]") {
+		name, port = host[:i], host[i+1:]
+		if n, err := strconv.ParseUint(port, 10, 16); err != nil || n == 0 {
+			return false
+		}
+	}
+
+	if strings.HasPrefix(name, "[") {
+		return strings.HasSuffix(name, "]") && len(name) > 2
+	}
+
+	if name == "" {
+		return false
+	}
+	for _, label := range strings.Split(name, ".") {
+		if label == "" {
+			return false
+		}
+		for i := range len(label) {
+			if !isUnreserved(label[i]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// isUnreserved reports whether c is an unreserved URI character.
+func isUnreserved(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+// isHex reports whether c is a hexadecimal digit.
+func isHex(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
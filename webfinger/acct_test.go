@@ -0,0 +1,41 @@
+package webfinger
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseAcct(t *testing.T) {
+	for in, expected := range map[string]string{
+		"user@example.com":           "acct:user@example.com",
+		"@user@Example.COM":          "acct:user@example.com",
+		"acct:User.Name@example.com": "acct:User.Name@example.com",
+		"ACCT:user@bücher.example":   "acct:user@xn--bcher-kva.example",
+		"user%40x@127.0.0.1:8080":    "acct:user%40x@127.0.0.1:8080",
+	} {
+		acct, err := ParseAcct(in)
+		if err != nil {
+			t.Fatalf("ParseAcct error: %s", err)
+		}
+		if acct.String() != expected {
+			t.Errorf("Expected %q for %q, got %q", expected, in, acct)
+		}
+	}
+
+	for _, in := range []string{
+		"user",
+		"@user",
+		"user@",
+		"user@other@example.com",
+		"@@user@example.com",
+		"us er@example.com",
+		"%40user@example.com",
+		"user@exa mple.com",
+		"user@example..com",
+		"user@example.com:http",
+	} {
+		if _, err := ParseAcct(in); !errors.Is(err, ErrInvalidAcct) {
+			t.Errorf("Expected ErrInvalidAcct for %q, got %v", in, err)
+		}
+	}
+}
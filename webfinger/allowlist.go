@@ -0,0 +1,59 @@
+package webfinger
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ErrHostNotAllowed signifies that a lookup was blocked
+// because its host isn't allowed by [Client.AllowHost].
+var ErrHostNotAllowed = errors.New("host is not in the allowlist")
+
+// HostNotAllowedError is returned when a client in allowlist mode
+// refuses to contact a host. See [Client.AllowHost].
+type HostNotAllowedError struct {
+	// Host is the host that was blocked.
+	Host string
+}
+
+func (hna HostNotAllowedError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrHostNotAllowed, hna.Host)
+}
+
+// Is allows HostNotAllowedError to be matched with [errors.Is] against [ErrHostNotAllowed].
+func (hna HostNotAllowedError) Is(target error) bool {
+	return target == ErrHostNotAllowed
+}
+
+// checkHost returns a [HostNotAllowedError] if the client's AllowHost doesn't allow host.
+func (c Client) checkHost(host string) error {
+	if c.AllowHost != nil && !c.AllowHost(host) {
+		return HostNotAllowedError{Host: host}
+	}
+	return nil
+}
+
+// allowRedirects returns a copy of hc that doesn't follow redirects to hosts
+// that the client's AllowHost doesn't allow, or hc itself if it's nil.
+func (c Client) allowRedirects(hc *http.Client) *http.Client {
+	if c.AllowHost == nil {
+		return hc
+	}
+
+	out := *hc
+	checkRedirect := hc.CheckRedirect
+	out.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if err := c.checkHost(req.URL.Host); err != nil {
+			return err
+		}
+		if checkRedirect != nil {
+			return checkRedirect(req, via)
+		}
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		return nil
+	}
+	return &out
+}
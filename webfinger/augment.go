@@ -0,0 +1,135 @@
+package webfinger
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strconv"
+)
+
+// Augmenter wraps an existing WebFinger handler, such as one provided by
+// another library, and injects additional links into its responses.
+//
+// Members of the original response that aren't known to this package,
+// such as link titles or templates, are preserved.
+type Augmenter struct {
+	// Handler is the wrapped handler. Requests to paths other than
+	// /.well-known/webfinger are passed through unmodified.
+	Handler http.Handler
+
+	// LinksFunc returns the links to add to the response for the given
+	// resource. Links that are already present in the response are skipped.
+	// If it returns an error, the original response is sent unmodified.
+	// If it's nil, all requests are passed through to Handler.
+	LinksFunc func(resource string) ([]Link, error)
+}
+
+// ServeHTTP implements the http.Handler interface
+func (a Augmenter) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	if req.URL.Path != "/.well-known/webfinger" || a.LinksFunc == nil {
+		a.Handler.ServeHTTP(res, req)
+		return
+	}
+
+	rec := &responseBuffer{header: http.Header{}, status: http.StatusOK}
+	a.Handler.ServeHTTP(rec, req)
+
+	body := rec.body.Bytes()
+	if rec.status == http.StatusOK && isJRD(rec.header.Get("Content-Type")) {
+		if out, err := a.augment(req.FormValue("resource"), body); err == nil {
+			body = out
+		}
+	}
+
+	for key, vals := range rec.header {
+		res.Header()[key] = vals
+	}
+	res.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	res.WriteHeader(rec.status)
+	res.Write(body)
+}
+
+// augment adds the links returned by LinksFunc to the JRD in data.
+func (a Augmenter) augment(resource string, data []byte) ([]byte, error) {
+	links, err := a.LinksFunc(resource)
+	if err != nil {
+		return nil, err
+	}
+
+	var jrd map[string]json.RawMessage
+	if err := json.Unmarshal(data, &jrd); err != nil {
+		return nil, err
+	}
+
+	var rawLinks []json.RawMessage
+	if linksData, ok := jrd["links"]; ok {
+		if err := json.Unmarshal(linksData, &rawLinks); err != nil {
+			return nil, err
+		}
+	}
+
+	existing := make([]Link, len(rawLinks))
+	for i, raw := range rawLinks {
+		// Links that can't be decoded are kept as-is
+		_ = json.Unmarshal(raw, &existing[i])
+	}
+
+outer:
+	for _, link := range links {
+		for _, el := range existing {
+			if el.Equal(link) {
+				continue outer
+			}
+		}
+
+		raw, err := json.Marshal(link)
+		if err != nil {
+			return nil, err
+		}
+		rawLinks = append(rawLinks, raw)
+		existing = append(existing, link)
+	}
+
+	jrd["links"], err = json.Marshal(rawLinks)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(jrd)
+}
+
+// isJRD reports whether the given content type is a JSON content type.
+func isJRD(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/jrd+json" || mediaType == "application/json"
+}
+
+// responseBuffer buffers a response so that it can be modified
+// before it's sent to the client.
+type responseBuffer struct {
+	header      http.Header
+	body        bytes.Buffer
+	status      int
+	wroteHeader bool
+}
+
+func (rb *responseBuffer) Header() http.Header {
+	return rb.header
+}
+
+func (rb *responseBuffer) WriteHeader(status int) {
+	if rb.wroteHeader {
+		return
+	}
+	rb.status = status
+	rb.wroteHeader = true
+}
+
+func (rb *responseBuffer) Write(b []byte) (int, error) {
+	rb.wroteHeader = true
+	return rb.body.Write(b)
+}
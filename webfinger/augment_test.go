@@ -0,0 +1,64 @@
+package webfinger
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAugmenter(t *testing.T) {
+	thirdParty := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("Content-Type", "application/jrd+json")
+		io.WriteString(res, `{"subject":"acct:user@example.com","links":[{"rel":"self","type":"application/activity+json","href":"https://example.com/users/user","titles":{"en":"Actor"}}]}`)
+	})
+
+	pfdLink := Link{Rel: "self", Type: "application/x-pfd+json", Href: "https://example.com/pfd/user"}
+	srv := httptest.NewServer(Augmenter{
+		Handler: thirdParty,
+		LinksFunc: func(resource string) ([]Link, error) {
+			return []Link{pfdLink}, nil
+		},
+	})
+	defer srv.Close()
+
+	desc, err := Lookup("acct:user@example.com", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Lookup error: %s", err)
+	}
+
+	if link, ok := desc.LinkByType(pfdLink.Type); !ok || !link.Equal(pfdLink) {
+		t.Errorf("Injected link not found: %#v", desc.Links)
+	}
+
+	res, err := http.Get(srv.URL + "/.well-known/webfinger?resource=acct:user@example.com")
+	if err != nil {
+		t.Fatalf("Request error: %s", err)
+	}
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("Read error: %s", err)
+	}
+
+	if !strings.Contains(string(data), `"titles":{"en":"Actor"}`) {
+		t.Errorf("Unknown members were not preserved: %s", data)
+	}
+}
+
+func TestAugmenterNilLinksFunc(t *testing.T) {
+	const body = `{"subject":"acct:user@example.com","links":[]}`
+	thirdParty := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("Content-Type", "application/jrd+json")
+		io.WriteString(res, body)
+	})
+
+	rec := httptest.NewRecorder()
+	Augmenter{Handler: thirdParty}.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/.well-known/webfinger?resource=acct:user@example.com", nil))
+
+	if rec.Code != http.StatusOK || rec.Body.String() != body {
+		t.Errorf("Expected the original response, got %d: %s", rec.Code, rec.Body)
+	}
+}
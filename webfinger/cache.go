@@ -0,0 +1,151 @@
+package webfinger
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrCacheMiss should be returned by [Cache.Get] when no
+// entry exists for the given key.
+var ErrCacheMiss = errors.New("cache miss")
+
+// Cache stores WebFinger responses so that repeated lookups of the same
+// resource don't have to hit the network. Responses are only cached for as
+// long as their Cache-Control or Expires headers allow. See [MemoryCache]
+// for an in-memory implementation.
+type Cache interface {
+	// Get returns the entry stored under key. If there is no
+	// such entry, Get should return [ErrCacheMiss].
+	Get(key string) (*CacheEntry, error)
+	// Put stores entry under key, replacing any existing entry.
+	Put(key string, entry *CacheEntry) error
+}
+
+// CacheEntry represents a cached WebFinger response.
+type CacheEntry struct {
+	// Data is the JRD, encoded as JSON.
+	Data []byte `json:"data"`
+	// Expires is the time at which the entry expires.
+	Expires time.Time `json:"expires"`
+}
+
+// MemoryCache is an in-memory, thread-safe [Cache].
+// Expired entries are pruned as new ones are added.
+// The zero value is ready to use.
+type MemoryCache struct {
+	mtx     sync.Mutex
+	entries map[string]*CacheEntry
+}
+
+// Get implements [Cache]
+func (mc *MemoryCache) Get(key string) (*CacheEntry, error) {
+	mc.mtx.Lock()
+	defer mc.mtx.Unlock()
+
+	entry, ok := mc.entries[key]
+	if !ok {
+		return nil, ErrCacheMiss
+	}
+	return entry, nil
+}
+
+// Put implements [Cache]
+func (mc *MemoryCache) Put(key string, entry *CacheEntry) error {
+	mc.mtx.Lock()
+	defer mc.mtx.Unlock()
+
+	now := time.Now()
+	if mc.entries == nil {
+		mc.entries = map[string]*CacheEntry{}
+	} else if len(mc.entries) >= maxProxyEntries {
+		for key, entry := range mc.entries {
+			if now.After(entry.Expires) {
+				delete(mc.entries, key)
+			}
+		}
+	}
+
+	mc.entries[key] = entry
+	return nil
+}
+
+// WithRefresh makes a lookup bypass the client's cache. The
+// response is still cached if its headers allow it.
+func WithRefresh() LookupOption {
+	return func(lo *lookupOptions) {
+		lo.refresh = true
+	}
+}
+
+// getCached returns the cached descriptor stored under key, if it hasn't expired.
+func (c Client) getCached(key string) (*Descriptor, bool) {
+	entry, err := c.Cache.Get(key)
+	if err != nil || !time.Now().Before(entry.Expires) {
+		return nil, false
+	}
+
+	desc, err := c.decode(bytes.NewReader(entry.Data))
+	if err != nil {
+		return nil, false
+	}
+	return desc, true
+}
+
+// putCached caches desc under key if the response headers h allow it.
+func (c Client) putCached(key string, desc *Descriptor, h http.Header) {
+	ttl, ok := cacheTTL(h, time.Now())
+	if !ok {
+		return
+	}
+
+	data, err := json.Marshal(desc)
+	if err != nil {
+		return
+	}
+
+	// Errors are ignored, since a failed write only means a cache miss later
+	c.Cache.Put(key, &CacheEntry{Data: data, Expires: time.Now().Add(ttl)})
+}
+
+// cacheTTL returns how long a response with the given headers may be cached,
+// based on its Cache-Control, Age, and Expires headers. It returns false if
+// the response must not be cached.
+func cacheTTL(h http.Header, now time.Time) (time.Duration, bool) {
+	maxAge, hasMaxAge := time.Duration(0), false
+	for _, directive := range strings.Split(h.Get("Cache-Control"), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		switch strings.ToLower(name) {
+		case "no-store", "no-cache":
+			return 0, false
+		case "max-age":
+			secs, err := strconv.ParseInt(strings.Trim(value, `"`), 10, 64)
+			if err != nil {
+				return 0, false
+			}
+			maxAge, hasMaxAge = time.Duration(secs)*time.Second, true
+		}
+	}
+
+	var ttl time.Duration
+	if hasMaxAge {
+		ttl = maxAge
+		if age, err := strconv.ParseInt(h.Get("Age"), 10, 64); err == nil {
+			ttl -= time.Duration(age) * time.Second
+		}
+	} else if expires, err := http.ParseTime(h.Get("Expires")); err == nil {
+		// The Date header is preferred, since the local clock may be off
+		date, err := http.ParseTime(h.Get("Date"))
+		if err != nil {
+			date = now
+		}
+		ttl = expires.Sub(date)
+	}
+
+	return ttl, ttl > 0
+}
@@ -0,0 +1,80 @@
+package webfinger
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLookupCache(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		hits.Add(1)
+		if req.URL.Query().Get("resource") == "acct:user@example.com" {
+			res.Header().Set("Cache-Control", "public, max-age=60")
+		} else {
+			res.Header().Set("Cache-Control", "no-store")
+		}
+		Handler{
+			DescriptorFunc: func(resource string) (*Descriptor, error) {
+				return &Descriptor{Subject: resource}, nil
+			},
+		}.ServeHTTP(res, req)
+	}))
+	defer srv.Close()
+
+	addr := srv.Listener.Addr().String()
+	c := Client{Scheme: "http", Cache: &MemoryCache{}}
+	for range 2 {
+		desc, err := c.Lookup("acct:user@example.com", addr)
+		if err != nil {
+			t.Fatalf("Lookup error: %s", err)
+		}
+		if desc.Subject != "acct:user@example.com" {
+			t.Errorf("Unexpected subject: %q", desc.Subject)
+		}
+	}
+	if n := hits.Load(); n != 1 {
+		t.Errorf("Expected 1 request, got %d", n)
+	}
+
+	if _, err := c.Lookup("acct:user@example.com", addr, WithRefresh()); err != nil {
+		t.Fatalf("Lookup error: %s", err)
+	}
+	if n := hits.Load(); n != 2 {
+		t.Errorf("Expected refresh to bypass the cache, got %d requests", n)
+	}
+
+	for range 2 {
+		if _, err := c.Lookup("acct:other@example.com", addr); err != nil {
+			t.Fatalf("Lookup error: %s", err)
+		}
+	}
+	if n := hits.Load(); n != 4 {
+		t.Errorf("Expected no-store response not to be cached, got %d requests", n)
+	}
+}
+
+func TestCacheTTL(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		header http.Header
+		ttl    time.Duration
+		ok     bool
+	}{
+		{http.Header{"Cache-Control": {"max-age=300"}}, 5 * time.Minute, true},
+		{http.Header{"Cache-Control": {"max-age=300"}, "Age": {"100"}}, 200 * time.Second, true},
+		{http.Header{"Cache-Control": {"private, no-cache"}}, 0, false},
+		{http.Header{"Expires": {now.Add(time.Hour).Format(http.TimeFormat)}, "Date": {now.Format(http.TimeFormat)}}, time.Hour, true},
+		{http.Header{}, 0, false},
+	}
+
+	for _, test := range tests {
+		ttl, ok := cacheTTL(test.header, now)
+		if ttl != test.ttl || ok != test.ok {
+			t.Errorf("Unexpected TTL for %v: %s, %t", test.header, ttl, ok)
+		}
+	}
+}
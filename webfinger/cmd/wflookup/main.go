@@ -2,42 +2,86 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"flag"
-	"log"
+	"fmt"
+	"net/http"
 	"os"
 	"strings"
+	"time"
 
-	"queerdevs.org/go-webfinger"
+	"queerdevs.org/profilefed"
+	"queerdevs.org/profilefed/internal/cli"
+	"queerdevs.org/profilefed/webfinger"
 )
 
 func main() {
 	server := flag.String("server", "", "The server to query for the WebFinger descriptor (e.g. example.com)")
+	trace := flag.Bool("trace", false, "Print a transcript of every request and response to stderr, with credentials redacted")
+	batch := flag.Bool("batch", false, "Read resources from stdin, one per line, and print the results as NDJSON")
+	concurrency := flag.Int("concurrency", 8, "Maximum number of concurrent lookups in batch mode")
+	rate := flag.Float64("rate", 10, "Maximum number of lookups started per second in batch mode (0 for no limit)")
+	format := flag.String("format", "json", "Output format (json or ndjson). Batch mode always uses ndjson")
+	timeout := flag.Duration("timeout", 30*time.Second, "Maximum time a single lookup can take (0 for no limit)")
+	hostMeta := flag.Bool("host-meta", false, "Fall back to host-meta (RFC 6415) discovery if the server doesn't support WebFinger")
+	quiet := flag.Bool("quiet", false, "Don't print any messages to stderr, only results and the exit code")
 	flag.Parse()
 
-	if len(os.Args) < 2 {
-		log.Fatalln("wflookup requires at least one argument")
+	ui := cli.Output{Quiet: *quiet}
+
+	if *format != "json" && *format != "ndjson" {
+		ui.Exit(cli.ExitUsage, "--format must be json or ndjson")
+	}
+
+	if flag.NArg() < 1 && !*batch {
+		ui.Exit(cli.ExitUsage, "wflookup requires at least one argument")
 	}
 
-	res := os.Args[1]
+	wf := webfinger.Client{Timeout: *timeout, HostMetaFallback: *hostMeta}
+	if *trace {
+		wf.HTTPClient = &http.Client{
+			Transport: profilefed.TraceTransport{
+				Trace: func(msg string) { fmt.Fprintln(os.Stderr, msg) },
+			},
+		}
+	}
 
-	var desc *webfinger.Descriptor
-	var err error
-	if *server != "" {
-		desc, err = webfinger.Lookup(res, *server)
-	} else if strings.HasPrefix(res, "http") {
-		desc, err = webfinger.LookupURL(res)
-	} else if strings.HasPrefix(res, "acct:") || strings.Contains(res, "@") {
-		desc, err = webfinger.LookupAcct(res)
+	if *batch {
+		err := runBatch(os.Stdin, os.Stdout, *concurrency, *rate, func(res string) (any, error) {
+			return lookup(wf, res, *server)
+		})
+		if err != nil {
+			ui.Fatal("Error reading resources:", err)
+		}
+		return
 	}
 
+	desc, err := lookup(wf, flag.Arg(0), *server)
 	if err != nil {
-		log.Fatalln("Lookup error:", err)
+		ui.Fatal("Lookup error:", err)
 	}
 
 	enc := json.NewEncoder(os.Stdout)
-	enc.SetIndent("", "  ")
+	if *format == "json" {
+		enc.SetIndent("", "  ")
+	}
 	err = enc.Encode(desc)
 	if err != nil {
-		log.Fatalln("JSON encode error:", err)
+		ui.Fatal("JSON encode error:", err)
+	}
+}
+
+// lookup looks up the WebFinger descriptor for res, inferring how
+// to look it up from its format unless server is set.
+func lookup(wf webfinger.Client, res, server string) (*webfinger.Descriptor, error) {
+	switch {
+	case server != "":
+		return wf.Lookup(res, server)
+	case strings.HasPrefix(res, "http"):
+		return wf.LookupURL(res)
+	case strings.HasPrefix(res, "acct:") || strings.Contains(res, "@"):
+		return wf.LookupAcct(res)
+	default:
+		return nil, errors.New("can't infer server for resource, use --server")
 	}
 }
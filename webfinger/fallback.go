@@ -0,0 +1,105 @@
+package webfinger
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+var (
+	// ErrNotFound signifies that a resource doesn't exist. If a handler's
+	// DescriptorFunc returns it, the default error handler responds with
+	// 404 Not Found.
+	ErrNotFound = errors.New("resource not found")
+	// ErrBackendTimeout signifies that a [Backend] didn't respond in time.
+	ErrBackendTimeout = errors.New("webfinger backend timed out")
+)
+
+// Backend is a source of descriptors queried by a [FallbackResolver].
+type Backend struct {
+	// Name identifies the backend in errors.
+	Name string
+	// DescriptorFunc resolves resource strings to descriptors. It should
+	// return [ErrNotFound] if the backend doesn't know the resource.
+	DescriptorFunc func(resource string) (*Descriptor, error)
+	// Timeout is the maximum amount of time to wait for DescriptorFunc.
+	// If it's zero, there is no timeout.
+	Timeout time.Duration
+}
+
+// FallbackResolver resolves resources using several backends, which is
+// useful while migrating from one identity system to another. Each backend
+// is queried in order until one of them returns a descriptor.
+//
+// Use [FallbackResolver.DescriptorFunc] as the DescriptorFunc of a [Handler].
+type FallbackResolver struct {
+	// Backends contains the backends to query, starting with the primary one.
+	Backends []Backend
+}
+
+// DescriptorFunc returns the descriptor from the first backend that
+// knows the given resource. If a backend fails or times out, the next one
+// is tried. If none of them know the resource, [ErrNotFound] is returned.
+// Otherwise, the errors returned by the backends are joined together.
+func (fr FallbackResolver) DescriptorFunc(resource string) (*Descriptor, error) {
+	var errs []error
+	for _, backend := range fr.Backends {
+		desc, err := backend.resolve(resource)
+		if err == nil {
+			return desc, nil
+		} else if !errors.Is(err, ErrNotFound) {
+			errs = append(errs, fmt.Errorf("%s: %w", backend.Name, err))
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil, ErrNotFound
+	}
+	return nil, errors.Join(errs...)
+}
+
+// resolve calls the backend's DescriptorFunc, giving up once its timeout expires.
+func (b Backend) resolve(resource string) (*Descriptor, error) {
+	if b.Timeout == 0 {
+		return b.DescriptorFunc(resource)
+	}
+
+	type result struct {
+		desc *Descriptor
+		err  error
+	}
+
+	// The channel is buffered, so the goroutine doesn't
+	// leak if the backend responds after the timeout.
+	done := make(chan result, 1)
+	go func() {
+		desc, err := b.DescriptorFunc(resource)
+		done <- result{desc, err}
+	}()
+
+	timer := time.NewTimer(b.Timeout)
+	defer timer.Stop()
+
+	select {
+	case res := <-done:
+		return res.desc, res.err
+	case <-timer.C:
+		return nil, ErrBackendTimeout
+	}
+}
+
+// Resolver returns a function that resolves resources by looking them up
+// at the given server, which can be used as the DescriptorFunc of a
+// [Backend] that proxies to another WebFinger server. If the server
+// responds with 404 Not Found, the function returns [ErrNotFound].
+func (c Client) Resolver(server string, opts ...LookupOption) func(resource string) (*Descriptor, error) {
+	return func(resource string) (*Descriptor, error) {
+		desc, err := c.Lookup(resource, server, opts...)
+		var httpErr *HTTPError
+		if errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusNotFound {
+			return nil, ErrNotFound
+		}
+		return desc, err
+	}
+}
@@ -0,0 +1,78 @@
+package webfinger
+
+import (
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFallbackResolver(t *testing.T) {
+	legacy := httptest.NewServer(Handler{
+		DescriptorFunc: func(resource string) (*Descriptor, error) {
+			if resource != "acct:legacy@example.com" {
+				return nil, ErrNotFound
+			}
+			return &Descriptor{Subject: resource}, nil
+		},
+	})
+	defer legacy.Close()
+
+	fr := FallbackResolver{
+		Backends: []Backend{
+			{
+				Name: "primary",
+				DescriptorFunc: func(resource string) (*Descriptor, error) {
+					if resource != "acct:new@example.com" {
+						return nil, ErrNotFound
+					}
+					return &Descriptor{Subject: resource}, nil
+				},
+			},
+			{
+				Name: "slow",
+				DescriptorFunc: func(resource string) (*Descriptor, error) {
+					time.Sleep(time.Second)
+					return &Descriptor{Subject: "acct:slow@example.com"}, nil
+				},
+				Timeout: 10 * time.Millisecond,
+			},
+			{
+				Name:           "legacy",
+				DescriptorFunc: Client{}.Resolver(legacy.Listener.Addr().String()),
+			},
+		},
+	}
+
+	srv := httptest.NewServer(Handler{DescriptorFunc: fr.DescriptorFunc})
+	defer srv.Close()
+
+	for _, resource := range []string{"acct:new@example.com", "acct:legacy@example.com"} {
+		desc, err := Lookup(resource, srv.Listener.Addr().String())
+		if err != nil {
+			t.Fatalf("Lookup error: %s", err)
+		}
+
+		expected := &Descriptor{Subject: resource}
+		if !reflect.DeepEqual(desc, expected) {
+			t.Errorf("Descriptors are not equal:\n%#v\n\n%#v", desc, expected)
+		}
+	}
+
+	_, err := fr.DescriptorFunc("acct:missing@example.com")
+	if !errors.Is(err, ErrBackendTimeout) {
+		t.Errorf("Expected timeout error, got %v", err)
+	}
+
+	// Without the slow backend, missing resources should result in 404 Not Found
+	fr.Backends = []Backend{fr.Backends[0], fr.Backends[2]}
+	srv2 := httptest.NewServer(Handler{DescriptorFunc: fr.DescriptorFunc})
+	defer srv2.Close()
+
+	_, err = Lookup("acct:missing@example.com", srv2.Listener.Addr().String())
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != 404 {
+		t.Errorf("Expected 404 error, got %v", err)
+	}
+}
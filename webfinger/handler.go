@@ -1,8 +1,12 @@
 package webfinger
 
 import (
+	"crypto/ed25519"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"slices"
+	"time"
 )
 
 // Handler handles WebFinger requests to an HTTP server
@@ -13,34 +17,169 @@ type Handler struct {
 	DescriptorFunc func(resource string) (*Descriptor, error)
 
 	// ErrorHandler handles any errors that occur in the process of performing
-	// a WebFinger lookup. If not provided, a simple default handler is used.
+	// a WebFinger lookup. If not provided, a simple default handler is used,
+	// which responds with 404 Not Found for [ErrNotFound].
 	ErrorHandler func(err error, res http.ResponseWriter)
+
+	// AllowPost enables an extension to RFC 7033 that allows clients to send
+	// the resource parameter in a form-encoded POST body. This is used by
+	// clients when the resource is too long to fit in a URL.
+	AllowPost bool
+
+	// StrictSubject makes the handler respond with 404 Not Found whenever
+	// DescriptorFunc returns a descriptor whose subject differs from the
+	// requested resource and whose aliases don't include it. If false,
+	// the requested resource is added to the aliases automatically.
+	StrictSubject bool
+
+	// IgnoreRel disables filtering links by the rel query parameter.
+	// By default, if a request contains one or more rel parameters, only
+	// the links with one of the requested relation types are returned,
+	// as recommended by RFC 7033.
+	IgnoreRel bool
+
+	// SigningKey, if set, is used to sign responses with a JWS using the
+	// EdDSA algorithm. The JWS is sent detached in the [JWSHeader] header,
+	// unless the client accepts [JOSEContentType], in which case the whole
+	// response is a compact JWS.
+	SigningKey ed25519.PrivateKey
+	// KeyID is the key ID included in the header of JWS signatures.
+	KeyID string
+
+	// Stats, if set, is called after every request for a resource with
+	// whether a descriptor was found and how long the request took. It's
+	// called synchronously, so it should be fast. [ResourceStats.Observe]
+	// can be used to aggregate the statistics.
+	Stats func(resource string, found bool, duration time.Duration)
 }
 
 // ServeHTTP implements the http.Handler interface
 func (h Handler) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	start := time.Now()
+
 	if h.ErrorHandler == nil {
 		h.ErrorHandler = func(err error, res http.ResponseWriter) {
+			if errors.Is(err, ErrNotFound) {
+				http.Error(res, err.Error(), http.StatusNotFound)
+				return
+			}
 			http.Error(res, err.Error(), http.StatusInternalServerError)
 		}
 	}
 
-	descriptor, err := h.DescriptorFunc(req.URL.Query().Get("resource"))
+	query := req.URL.Query()
+	resource := query.Get("resource")
+	rels := query["rel"]
+	if req.Method == http.MethodPost {
+		if !h.AllowPost {
+			http.Error(res, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		err := req.ParseForm()
+		if err != nil {
+			http.Error(res, err.Error(), http.StatusBadRequest)
+			return
+		}
+		resource = req.PostForm.Get("resource")
+		rels = req.PostForm["rel"]
+	}
+
+	if resource == "" {
+		http.Error(res, "missing resource parameter", http.StatusBadRequest)
+		return
+	}
+
+	found := false
+	if h.Stats != nil {
+		defer func() { h.Stats(resource, found, time.Since(start)) }()
+	}
+
+	descriptor, err := h.DescriptorFunc(resource)
 	if err != nil {
 		h.ErrorHandler(err, res)
 		return
 	}
 
+	descriptor, found = h.canonicalize(resource, descriptor)
+	if !found {
+		http.Error(res, "descriptor subject does not match requested resource", http.StatusNotFound)
+		return
+	}
+
+	if len(rels) > 0 && !h.IgnoreRel {
+		descriptor = filterRels(descriptor, rels)
+	}
+
 	data, err := json.Marshal(descriptor)
 	if err != nil {
 		h.ErrorHandler(err, res)
 		return
 	}
 
+	// RFC 7033 requires WebFinger resources to be accessible from any origin
+	res.Header().Set("Access-Control-Allow-Origin", "*")
 	res.Header().Set("Content-Type", "application/jrd+json")
+
+	if h.SigningKey != nil {
+		if acceptsJOSE(req) {
+			jws, err := SignJWS(h.SigningKey, h.KeyID, data)
+			if err != nil {
+				h.ErrorHandler(err, res)
+				return
+			}
+			res.Header().Set("Content-Type", JOSEContentType)
+			data = []byte(jws)
+		} else {
+			jws, err := detachedJWS(h.SigningKey, h.KeyID, data)
+			if err != nil {
+				h.ErrorHandler(err, res)
+				return
+			}
+			res.Header().Set(JWSHeader, jws)
+		}
+	}
+
 	_, err = res.Write(data)
 	if err != nil {
 		h.ErrorHandler(err, res)
 		return
 	}
 }
+
+// canonicalize makes sure the requested resource is either the subject of
+// desc or one of its aliases, as RFC 7033 expects. If the subject is empty,
+// it's set to the resource. It returns false if the resource doesn't match
+// and StrictSubject is enabled. The returned descriptor is a copy, so the
+// one returned by DescriptorFunc is never modified.
+func (h Handler) canonicalize(resource string, desc *Descriptor) (*Descriptor, bool) {
+	if desc.Subject == resource || slices.Contains(desc.Aliases, resource) {
+		return desc, true
+	}
+
+	out := *desc
+	if out.Subject == "" {
+		out.Subject = resource
+		return &out, true
+	}
+
+	if h.StrictSubject {
+		return nil, false
+	}
+
+	out.Aliases = append(slices.Clip(out.Aliases), resource)
+	return &out, true
+}
+
+// filterRels returns a copy of desc that only contains
+// the links whose relation type is one of rels.
+func filterRels(desc *Descriptor, rels []string) *Descriptor {
+	out := *desc
+	out.Links = []Link{}
+	for _, link := range desc.Links {
+		if slices.Contains(rels, link.Rel) {
+			out.Links = append(out.Links, link)
+		}
+	}
+	return &out
+}
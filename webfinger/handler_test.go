@@ -1,10 +1,12 @@
 package webfinger
 
 import (
+	"encoding/json"
 	"errors"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -73,3 +75,102 @@ func TestHandler(t *testing.T) {
 		t.Fatalf("Expected error, got nil")
 	}
 }
+
+func TestHandlerPost(t *testing.T) {
+	resource := "did:example:" + strings.Repeat("a", 4096)
+
+	srv := httptest.NewServer(Handler{
+		DescriptorFunc: func(res string) (*Descriptor, error) {
+			if res != resource {
+				return nil, errors.New("descriptor not found")
+			}
+			return &Descriptor{Subject: resource}, nil
+		},
+		AllowPost: true,
+	})
+	defer srv.Close()
+
+	desc, err := Lookup(resource, srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Lookup error: %s", err)
+	}
+
+	if desc.Subject != resource {
+		t.Errorf("Unexpected subject: %q", desc.Subject)
+	}
+}
+
+func TestHandlerSubject(t *testing.T) {
+	h := Handler{
+		DescriptorFunc: func(resource string) (*Descriptor, error) {
+			return &Descriptor{Subject: "acct:user@example.com"}, nil
+		},
+	}
+
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	desc, err := Lookup("https://example.com/user", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Lookup error: %s", err)
+	}
+
+	if !reflect.DeepEqual(desc.Aliases, []string{"https://example.com/user"}) {
+		t.Errorf("Requested resource was not added to aliases: %q", desc.Aliases)
+	}
+
+	h.StrictSubject = true
+	strictSrv := httptest.NewServer(h)
+	defer strictSrv.Close()
+
+	_, err = Lookup("https://example.com/user", strictSrv.Listener.Addr().String())
+	if err == nil {
+		t.Fatalf("Expected error, got nil")
+	}
+}
+
+func TestHandlerRel(t *testing.T) {
+	h := Handler{
+		DescriptorFunc: func(resource string) (*Descriptor, error) {
+			return &Descriptor{
+				Subject: resource,
+				Links: []Link{
+					{Rel: "self", Type: "application/activity+json", Href: "https://example.com/users/user"},
+					{Rel: "http://webfinger.net/rel/profile-page", Href: "https://example.com/@user"},
+					{Rel: "http://webfinger.net/rel/avatar", Href: "https://example.com/user.png"},
+				},
+			}, nil
+		},
+	}
+
+	target := "/.well-known/webfinger?resource=acct:user@example.com&rel=self&rel=http://webfinger.net/rel/avatar"
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", target, nil))
+
+	desc := &Descriptor{}
+	if err := json.Unmarshal(rec.Body.Bytes(), desc); err != nil {
+		t.Fatalf("Unmarshal error: %s", err)
+	}
+
+	var rels []string
+	for _, link := range desc.Links {
+		rels = append(rels, link.Rel)
+	}
+
+	expected := []string{"self", "http://webfinger.net/rel/avatar"}
+	if !reflect.DeepEqual(rels, expected) {
+		t.Errorf("Unexpected links: %q", rels)
+	}
+
+	h.IgnoreRel = true
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", target, nil))
+	if err := json.Unmarshal(rec.Body.Bytes(), desc); err != nil {
+		t.Fatalf("Unmarshal error: %s", err)
+	}
+
+	if len(desc.Links) != 3 {
+		t.Errorf("Expected all links with IgnoreRel, got %d", len(desc.Links))
+	}
+}
@@ -0,0 +1,197 @@
+package webfinger
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// errNoHostMeta is returned by lookupHostMeta if the server
+// doesn't have a host-meta document with an LRDD template.
+var errNoHostMeta = errors.New("no host-meta lrdd template")
+
+// xrd is an Extensible Resource Descriptor, as used by host-meta documents
+// and LRDD responses. Its JSON form is used for JRD host-meta documents,
+// which can contain templates that [Descriptor] doesn't support.
+type xrd struct {
+	Subject    string        `xml:"Subject"`
+	Aliases    []string      `xml:"Alias"`
+	Expires    string        `xml:"Expires"`
+	Properties []xrdProperty `xml:"Property"`
+	Links      []xrdLink     `xml:"Link" json:"links"`
+}
+
+type xrdProperty struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+type xrdTitle struct {
+	Lang  string `xml:"http://www.w3.org/XML/1998/namespace lang,attr"`
+	Value string `xml:",chardata"`
+}
+
+type xrdLink struct {
+	Rel        string        `xml:"rel,attr" json:"rel"`
+	Type       string        `xml:"type,attr" json:"type"`
+	Href       string        `xml:"href,attr" json:"href"`
+	Template   string        `xml:"template,attr" json:"template"`
+	Titles     []xrdTitle    `xml:"Title" json:"-"`
+	Properties []xrdProperty `xml:"Property" json:"-"`
+}
+
+// lookupHostMeta looks up resource using the LRDD template in the host-meta
+// document of the server that wfURL points to, and returns the descriptor
+// along with the headers of the response it was decoded from. It returns
+// [errNoHostMeta] if there's no such template.
+func (c Client) lookupHostMeta(ctx context.Context, httpClient *http.Client, wfURL *url.URL, resource string) (*Descriptor, http.Header, error) {
+	hmURL := url.URL{Scheme: wfURL.Scheme, Host: wfURL.Host, Path: "/.well-known/host-meta"}
+	res, err := c.getXRD(ctx, httpClient, &hmURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, nil, errNoHostMeta
+	}
+
+	data, err := io.ReadAll(io.LimitReader(res.Body, maxResponseSize))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var hostMeta xrd
+	if isXML(res, data) {
+		err = xml.Unmarshal(data, &hostMeta)
+	} else {
+		err = json.Unmarshal(data, &hostMeta)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var template string
+	for _, link := range hostMeta.Links {
+		if link.Rel == "lrdd" && strings.Contains(link.Template, "{uri}") {
+			template = link.Template
+			break
+		}
+	}
+	if template == "" {
+		return nil, nil, errNoHostMeta
+	}
+
+	lrddURL, err := url.Parse(strings.ReplaceAll(template, "{uri}", url.QueryEscape(resource)))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The template must not downgrade the lookup to plain http
+	if lrddURL.Scheme != "https" && (lrddURL.Scheme != "http" || wfURL.Scheme != "http") {
+		return nil, nil, errors.New("webfinger: insecure lrdd template: " + template)
+	}
+
+	res, err = c.getXRD(ctx, httpClient, lrddURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer res.Body.Close()
+
+	if err := responseError(lrddURL, res); err != nil {
+		return nil, nil, err
+	}
+
+	data, err = io.ReadAll(io.LimitReader(res.Body, maxResponseSize))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	data, err = c.jrdPayload(wfURL.Host, res, data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var desc *Descriptor
+	if isXML(res, data) {
+		desc, err = decodeXRD(data)
+	} else {
+		desc, err = c.decode(bytes.NewReader(data))
+	}
+	return desc, res.Header, err
+}
+
+// getXRD sends a GET request for a document that may be either an XRD or a JRD.
+func (c Client) getXRD(ctx context.Context, httpClient *http.Client, u *url.URL) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/jrd+json, application/json;q=0.9, application/xrd+xml;q=0.8")
+	return c.do(httpClient, req)
+}
+
+// isXML reports whether the response with the given body is an XML document.
+func isXML(res *http.Response, data []byte) bool {
+	mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	if strings.HasSuffix(mediaType, "xml") {
+		return true
+	}
+	return bytes.HasPrefix(bytes.TrimSpace(data), []byte("<"))
+}
+
+// decodeXRD decodes an XRD document into a JRD, as described in RFC 6415.
+func decodeXRD(data []byte) (*Descriptor, error) {
+	var doc xrd
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	desc := &Descriptor{
+		Subject:    strings.TrimSpace(doc.Subject),
+		Expires:    strings.TrimSpace(doc.Expires),
+		Properties: xrdProperties(doc.Properties),
+	}
+	for _, alias := range doc.Aliases {
+		desc.Aliases = append(desc.Aliases, strings.TrimSpace(alias))
+	}
+
+	for _, xl := range doc.Links {
+		link := Link{
+			Rel:        xl.Rel,
+			Type:       xl.Type,
+			Href:       xl.Href,
+			Properties: xrdProperties(xl.Properties),
+		}
+		for _, title := range xl.Titles {
+			if link.Titles == nil {
+				link.Titles = map[string]string{}
+			}
+			link.Titles[cmp.Or(title.Lang, "und")] = strings.TrimSpace(title.Value)
+		}
+		desc.Links = append(desc.Links, link)
+	}
+
+	return desc, nil
+}
+
+// xrdProperties converts XRD properties to JRD properties.
+func xrdProperties(props []xrdProperty) map[string]string {
+	if len(props) == 0 {
+		return nil
+	}
+
+	out := make(map[string]string, len(props))
+	for _, prop := range props {
+		out[prop.Type] = strings.TrimSpace(prop.Value)
+	}
+	return out
+}
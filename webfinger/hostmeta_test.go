@@ -0,0 +1,52 @@
+package webfinger
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLookupHostMeta(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/host-meta", func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("Content-Type", "application/xrd+xml")
+		fmt.Fprintf(res, `<?xml version="1.0" encoding="UTF-8"?>
+<XRD xmlns="http://docs.oasis-open.org/ns/xri/xrd-1.0">
+  <Link rel="lrdd" type="application/xrd+xml" template="http://%s/lrdd?uri={uri}"/>
+</XRD>`, req.Host)
+	})
+	mux.HandleFunc("/lrdd", func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("Content-Type", "application/xrd+xml")
+		fmt.Fprintf(res, `<?xml version="1.0" encoding="UTF-8"?>
+<XRD xmlns="http://docs.oasis-open.org/ns/xri/xrd-1.0">
+  <Subject>%s</Subject>
+  <Alias>https://example.com/user</Alias>
+  <Link rel="self" type="application/activity+json" href="https://example.com/user">
+    <Title xml:lang="en">User</Title>
+  </Link>
+</XRD>`, req.URL.Query().Get("uri"))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	addr := srv.Listener.Addr().String()
+	if _, err := (Client{Scheme: "http"}).Lookup("acct:user@example.com", addr); err == nil {
+		t.Fatal("Expected lookup without host-meta fallback to fail")
+	}
+
+	c := Client{Scheme: "http", HostMetaFallback: true}
+	desc, err := c.Lookup("acct:user@example.com", addr)
+	if err != nil {
+		t.Fatalf("Lookup error: %s", err)
+	}
+
+	if desc.Subject != "acct:user@example.com" || len(desc.Aliases) != 1 {
+		t.Errorf("Unexpected descriptor: %+v", desc)
+	}
+
+	link, ok := desc.LinkByRel("self")
+	if !ok || link.Href != "https://example.com/user" || link.Titles["en"] != "User" {
+		t.Errorf("Unexpected self link: %+v", link)
+	}
+}
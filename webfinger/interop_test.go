@@ -0,0 +1,107 @@
+package webfinger
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+// TestInterop decodes JRDs captured from other implementations, both strictly
+// and leniently, and compares the re-encoded results to golden files.
+func TestInterop(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "interop", "*.jrd"))
+	if err != nil {
+		t.Fatalf("Glob error: %s", err)
+	}
+
+	for _, path := range paths {
+		name := strings.TrimSuffix(filepath.Base(path), ".jrd")
+		t.Run(name, func(t *testing.T) {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("ReadFile error: %s", err)
+			}
+
+			strict := &Descriptor{}
+			if err := json.Unmarshal(data, strict); err != nil {
+				t.Fatalf("Unmarshal error: %s", err)
+			}
+			checkGolden(t, strings.TrimSuffix(path, ".jrd")+".golden", strict)
+
+			lenient, err := DecodeLenient(data)
+			if err != nil {
+				t.Fatalf("DecodeLenient error: %s", err)
+			}
+			checkGolden(t, strings.TrimSuffix(path, ".jrd")+".lenient.golden", lenient)
+		})
+	}
+}
+
+func checkGolden(t *testing.T, path string, desc *Descriptor) {
+	t.Helper()
+
+	data, err := json.MarshalIndent(desc, "", "  ")
+	if err != nil {
+		t.Fatalf("MarshalIndent error: %s", err)
+	}
+	data = append(data, '\n')
+
+	if *update {
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatalf("WriteFile error: %s", err)
+		}
+		return
+	}
+
+	expected, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile error: %s", err)
+	}
+
+	if !bytes.Equal(data, expected) {
+		t.Errorf("Encoded JRD doesn't match %s:\n%s\n\n%s", path, data, expected)
+	}
+}
+
+func FuzzDecodeLenient(f *testing.F) {
+	paths, _ := filepath.Glob(filepath.Join("testdata", "interop", "*.jrd"))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			f.Fatalf("ReadFile error: %s", err)
+		}
+		f.Add(data)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		desc, err := DecodeLenient(data)
+		if err != nil {
+			return
+		}
+
+		first, err := json.Marshal(desc)
+		if err != nil {
+			t.Fatalf("Marshal error: %s", err)
+		}
+
+		desc, err = DecodeLenient(first)
+		if err != nil {
+			t.Fatalf("DecodeLenient error: %s", err)
+		}
+
+		second, err := json.Marshal(desc)
+		if err != nil {
+			t.Fatalf("Marshal error: %s", err)
+		}
+
+		if !bytes.Equal(first, second) {
+			t.Errorf("Lenient round trip is not stable:\n%s\n\n%s", first, second)
+		}
+	})
+}
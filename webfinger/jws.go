@@ -0,0 +1,145 @@
+package webfinger
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// JWSHeader is the response header containing the detached JWS of a signed JRD.
+const JWSHeader = "X-JRD-Signature"
+
+// JOSEContentType is the content type of compact JWS responses, which
+// handlers with a signing key send if the client accepts it.
+const JOSEContentType = "application/jose"
+
+var (
+	// ErrNoJWS signifies that a response that should have been signed with a
+	// JWS doesn't contain one.
+	ErrNoJWS = errors.New("webfinger: response contains no jws")
+	// ErrInvalidJWS signifies that the JWS of a response is malformed
+	// or doesn't match the expected key.
+	ErrInvalidJWS = errors.New("webfinger: invalid jws")
+)
+
+// jwsHeader is the protected header of a JWS.
+type jwsHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid,omitempty"`
+}
+
+// SignJWS signs payload using priv and returns it as a compact JWS using
+// the EdDSA algorithm. If kid isn't empty, it's included in the protected
+// header. To create a detached JWS, remove the payload between the dots,
+// as described in RFC 7515, Appendix F.
+func SignJWS(priv ed25519.PrivateKey, kid string, payload []byte) (string, error) {
+	header, err := json.Marshal(jwsHeader{Alg: "EdDSA", Kid: kid})
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	sig := ed25519.Sign(priv, []byte(signingInput))
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// VerifyJWS verifies a compact JWS signed using the EdDSA algorithm and
+// returns its payload. If the JWS is detached, meaning its payload is
+// empty, it's verified against payload instead. It returns [ErrInvalidJWS]
+// if the JWS is malformed or its signature doesn't match pub.
+func VerifyJWS(pub ed25519.PublicKey, jws string, payload []byte) ([]byte, error) {
+	parts := strings.Split(jws, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidJWS
+	}
+
+	headerData, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrInvalidJWS
+	}
+
+	var header jwsHeader
+	if err := json.Unmarshal(headerData, &header); err != nil || header.Alg != "EdDSA" {
+		return nil, ErrInvalidJWS
+	}
+
+	if parts[1] == "" {
+		parts[1] = base64.RawURLEncoding.EncodeToString(payload)
+	} else if payload, err = base64.RawURLEncoding.DecodeString(parts[1]); err != nil {
+		return nil, ErrInvalidJWS
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !ed25519.Verify(pub, []byte(parts[0]+"."+parts[1]), sig) {
+		return nil, ErrInvalidJWS
+	}
+	return payload, nil
+}
+
+// detachedJWS signs payload and returns the JWS with its payload removed.
+func detachedJWS(priv ed25519.PrivateKey, kid string, payload []byte) (string, error) {
+	jws, err := SignJWS(priv, kid, payload)
+	if err != nil {
+		return "", err
+	}
+
+	header, rest, _ := strings.Cut(jws, ".")
+	_, sig, _ := strings.Cut(rest, ".")
+	return header + ".." + sig, nil
+}
+
+// acceptsJOSE reports whether req accepts compact JWS responses.
+func acceptsJOSE(req *http.Request) bool {
+	for _, accept := range strings.Split(req.Header.Get("Accept"), ",") {
+		mediaType, _, _ := mime.ParseMediaType(strings.TrimSpace(accept))
+		if mediaType == JOSEContentType {
+			return true
+		}
+	}
+	return false
+}
+
+// jrdPayload returns the JRD contained in the response res with the given
+// body. Compact JWS responses are unwrapped. If the client knows a key for
+// server, the response has to be signed by it, either as a compact JWS or
+// using a detached JWS in the [JWSHeader] header.
+func (c Client) jrdPayload(server string, res *http.Response, data []byte) ([]byte, error) {
+	var pub ed25519.PublicKey
+	if c.JWSKey != nil {
+		var err error
+		pub, err = c.JWSKey(server)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	if mediaType == JOSEContentType {
+		jws := string(bytes.TrimSpace(data))
+		if pub != nil {
+			return VerifyJWS(pub, jws, nil)
+		}
+
+		// Without a key, the payload is only unwrapped
+		parts := strings.Split(jws, ".")
+		if len(parts) != 3 {
+			return nil, ErrInvalidJWS
+		}
+		return base64.RawURLEncoding.DecodeString(parts[1])
+	}
+
+	if pub == nil {
+		return data, nil
+	}
+
+	jws := res.Header.Get(JWSHeader)
+	if jws == "" {
+		return nil, ErrNoJWS
+	}
+	return VerifyJWS(pub, jws, data)
+}
@@ -0,0 +1,68 @@
+package webfinger
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestJWS(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey error: %s", err)
+	}
+	other, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey error: %s", err)
+	}
+
+	srv := httptest.NewServer(Handler{
+		SigningKey: priv,
+		KeyID:      "test",
+		DescriptorFunc: func(resource string) (*Descriptor, error) {
+			return &Descriptor{Subject: resource}, nil
+		},
+	})
+	defer srv.Close()
+
+	addr := srv.Listener.Addr().String()
+	c := Client{Scheme: "http", JWSKey: func(server string) (ed25519.PublicKey, error) {
+		return pub, nil
+	}}
+	desc, err := c.Lookup("acct:user@example.com", addr)
+	if err != nil {
+		t.Fatalf("Lookup error: %s", err)
+	}
+	if desc.Subject != "acct:user@example.com" {
+		t.Errorf("Unexpected subject: %q", desc.Subject)
+	}
+
+	c.JWSKey = func(server string) (ed25519.PublicKey, error) {
+		return other, nil
+	}
+	if _, err := c.Lookup("acct:user@example.com", addr); !errors.Is(err, ErrInvalidJWS) {
+		t.Errorf("Expected ErrInvalidJWS, got %v", err)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"/?resource=acct:user@example.com", nil)
+	if err != nil {
+		t.Fatalf("NewRequest error: %s", err)
+	}
+	req.Header.Set("Accept", JOSEContentType)
+	rec := httptest.NewRecorder()
+	Handler{
+		SigningKey: priv,
+		DescriptorFunc: func(resource string) (*Descriptor, error) {
+			return &Descriptor{Subject: resource}, nil
+		},
+	}.ServeHTTP(rec, req)
+
+	if ct := rec.Header().Get("Content-Type"); ct != JOSEContentType {
+		t.Fatalf("Unexpected content type: %q", ct)
+	}
+	if _, err := VerifyJWS(pub, rec.Body.String(), nil); err != nil {
+		t.Errorf("VerifyJWS error: %s", err)
+	}
+}
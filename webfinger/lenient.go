@@ -0,0 +1,138 @@
+package webfinger
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// knownMembers contains the names of the JRD members decoded by [DecodeLenient].
+var knownMembers = map[string]bool{
+	"subject":    true,
+	"aliases":    true,
+	"expires":    true,
+	"properties": true,
+	"links":      true,
+}
+
+// knownLinkMembers contains the names of the link members decoded by [DecodeLenient].
+var knownLinkMembers = map[string]bool{
+	"rel":        true,
+	"type":       true,
+	"href":       true,
+	"titles":     true,
+	"properties": true,
+}
+
+// DecodeLenient decodes a JRD that doesn't strictly follow RFC 7033, as many
+// real-world ones don't. Member names are matched case-insensitively, members
+// with unexpected types or null values are skipped, and unknown members are
+// kept in [Descriptor.Unknown], so that they survive a round trip.
+//
+// Unknown members of links are dropped, since [Link] can't hold them.
+func DecodeLenient(data []byte) (*Descriptor, error) {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(data, &members); err != nil {
+		return nil, err
+	}
+
+	desc := &Descriptor{}
+	for _, name := range memberNames(members, knownMembers) {
+		value := members[name]
+		switch strings.ToLower(name) {
+		case "subject":
+			_ = json.Unmarshal(value, &desc.Subject)
+		case "aliases":
+			_ = json.Unmarshal(value, &desc.Aliases)
+		case "expires":
+			_ = json.Unmarshal(value, &desc.Expires)
+		case "properties":
+			desc.Properties = decodePropertiesLenient(value)
+		case "links":
+			var links []json.RawMessage
+			if json.Unmarshal(value, &links) != nil {
+				continue
+			}
+
+			for _, linkData := range links {
+				if link, ok := decodeLinkLenient(linkData); ok {
+					desc.Links = append(desc.Links, link)
+				}
+			}
+		default:
+			if desc.Unknown == nil {
+				desc.Unknown = map[string]json.RawMessage{}
+			}
+			desc.Unknown[name] = value
+		}
+	}
+
+	return desc, nil
+}
+
+// decodeLinkLenient decodes a single JRD link, matching member names
+// case-insensitively. It returns false if the link isn't an object.
+func decodeLinkLenient(data []byte) (Link, bool) {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(data, &members); err != nil {
+		return Link{}, false
+	}
+
+	link := Link{}
+	for _, name := range memberNames(members, knownLinkMembers) {
+		value := members[name]
+		switch strings.ToLower(name) {
+		case "rel":
+			_ = json.Unmarshal(value, &link.Rel)
+		case "type":
+			_ = json.Unmarshal(value, &link.Type)
+		case "href":
+			_ = json.Unmarshal(value, &link.Href)
+		case "titles":
+			var titles map[string]string
+			if json.Unmarshal(value, &titles) == nil && len(titles) > 0 {
+				link.Titles = titles
+			}
+		case "properties":
+			link.Properties = decodePropertiesLenient(value)
+		}
+	}
+	return link, true
+}
+
+// decodePropertiesLenient decodes a JRD properties object. Null values,
+// which RFC 7033 allows, are decoded as empty strings. It returns nil if
+// the properties can't be decoded or are empty.
+func decodePropertiesLenient(data []byte) map[string]string {
+	var props map[string]*string
+	if json.Unmarshal(data, &props) != nil || len(props) == 0 {
+		return nil
+	}
+
+	out := make(map[string]string, len(props))
+	for key, val := range props {
+		if val != nil {
+			out[key] = *val
+		} else {
+			out[key] = ""
+		}
+	}
+	return out
+}
+
+// memberNames returns the names of members in sorted order, so that the result
+// of a lenient decode doesn't depend on map iteration order. Names that only
+// differ in case from a known member that's also present are left out, so
+// the exactly matching member takes precedence.
+func memberNames(members map[string]json.RawMessage, known map[string]bool) []string {
+	names := make([]string, 0, len(members))
+	for name := range members {
+		lower := strings.ToLower(name)
+		if _, ok := members[lower]; ok && lower != name && known[lower] {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
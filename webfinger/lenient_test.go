@@ -0,0 +1,43 @@
+package webfinger
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestDecodeLenient(t *testing.T) {
+	data := `{
+		"Subject": "acct:user@example.com",
+		"Expires": "2030-01-01T00:00:00Z",
+		"properties": {"http://example.com/ns/name": null},
+		"LINKS": [{"REL": "self", "Href": "https://example.com/users/user"}, "invalid"],
+		"x-custom": {"a": 1}
+	}`
+
+	desc, err := DecodeLenient([]byte(data))
+	if err != nil {
+		t.Fatalf("DecodeLenient error: %s", err)
+	}
+
+	if desc.Subject != "acct:user@example.com" || desc.Expires != "2030-01-01T00:00:00Z" {
+		t.Errorf("Unexpected subject or expiry: %#v", desc)
+	}
+
+	if val, ok := desc.Properties["http://example.com/ns/name"]; !ok || val != "" {
+		t.Errorf("Null property was not decoded: %#v", desc.Properties)
+	}
+
+	if len(desc.Links) != 1 || desc.Links[0].Rel != "self" {
+		t.Errorf("Unexpected links: %#v", desc.Links)
+	}
+
+	out, err := json.Marshal(desc)
+	if err != nil {
+		t.Fatalf("Marshal error: %s", err)
+	}
+
+	if !strings.Contains(string(out), `"x-custom":{"a":1}`) {
+		t.Errorf("Unknown member did not survive a round trip: %s", out)
+	}
+}
@@ -1,35 +1,282 @@
 package webfinger
 
 import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
 	"encoding/json"
 	"errors"
+	"io"
+	"net"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
+	"time"
 )
 
+// maxGetURLLength is the maximum length of a lookup URL before
+// Lookup falls back to sending the resource via POST.
+const maxGetURLLength = 2048
+
+// maxResponseSize is the maximum size of a WebFinger response.
+const maxResponseSize = 1 << 20
+
+// DefaultHTTPFallbackHosts contains the hosts for which lookups fall back to
+// plain http if a [Client]'s HTTPFallbackHosts is nil. They're local development
+// hosts and onion services, which usually don't have certificates, and whose
+// traffic doesn't cross the public internet unencrypted.
+var DefaultHTTPFallbackHosts = []string{"localhost", "*.localhost", "127.0.0.1", "::1", "*.onion", "*.internal"}
+
+// HTTPError is returned by lookups when the server responds with a status
+// other than 200 OK. A 404 status usually means the resource doesn't exist.
+// For 429 Too Many Requests, a [RateLimitedError] is returned instead.
+type HTTPError struct {
+	// URL is the URL of the lookup request.
+	URL string
+	// StatusCode is the status code of the response.
+	StatusCode int
+	// Status is the status line of the response, such as "404 Not Found".
+	Status string
+}
+
+func (e *HTTPError) Error() string {
+	return e.Status
+}
+
+// Client performs WebFinger lookups. The zero value is ready to use,
+// and behaves the same as the package-level lookup functions.
+type Client struct {
+	// HTTPClient is the client used to make requests. If nil,
+	// [http.DefaultClient] is used.
+	HTTPClient *http.Client
+	// Scheme is the URL scheme used for lookups. If empty, https is used,
+	// falling back to http for the hosts in HTTPFallbackHosts.
+	Scheme string
+	// HTTPFallbackHosts contains the hosts for which lookups are retried over
+	// plain http if the https request fails, which is only done if Scheme is
+	// empty. Entries starting with "*." match any subdomain. If nil,
+	// [DefaultHTTPFallbackHosts] is used. Set it to an empty slice to disable
+	// the fallback.
+	HTTPFallbackHosts []string
+	// Lenient makes the client decode responses using [DecodeLenient],
+	// which tolerates JRDs that don't strictly follow RFC 7033.
+	Lenient bool
+	// Timeout limits the time a lookup can take, including any fallback
+	// to plain http and reading the response. If zero, there's no limit
+	// other than the HTTP client's timeout.
+	Timeout time.Duration
+	// UserAgent is the User-Agent header sent with lookup requests.
+	// If empty, the HTTP client's default is used.
+	UserAgent string
+	// HostMetaFallback makes the client fall back to host-meta discovery as
+	// defined by RFC 6415 if the server responds to a lookup with 404 Not
+	// Found, for older servers that don't support WebFinger. The lookup is
+	// then made using the LRDD template in the server's host-meta document,
+	// whose response may be either a JRD or an XRD.
+	HostMetaFallback bool
+	// Cache, if set, stores responses for as long as their Cache-Control
+	// or Expires headers allow. Use [WithRefresh] to bypass it.
+	Cache Cache
+	// JWSKey, if set, returns the public key that responses from the given
+	// server, which may include a port, have to be signed with using a JWS.
+	// If it returns a nil key, responses from the server aren't verified.
+	// Responses without a valid JWS fail with [ErrNoJWS] or [ErrInvalidJWS].
+	JWSKey func(server string) (ed25519.PublicKey, error)
+	// AllowHost, if set, enables allowlist mode. Lookups on servers for
+	// which it returns false, including redirects and host-meta templates
+	// pointing to them, fail with a [HostNotAllowedError] before a
+	// connection is made. The HostAllowlist type of the profilefed package
+	// can load it from a file.
+	AllowHost func(host string) bool
+}
+
+// LookupOption overrides part of the client's configuration for a single lookup.
+type LookupOption func(*lookupOptions)
+
+type lookupOptions struct {
+	scheme  string
+	port    int
+	server  string
+	refresh bool
+}
+
+// WithScheme makes a lookup use the given URL scheme, such as http.
+func WithScheme(scheme string) LookupOption {
+	return func(lo *lookupOptions) {
+		lo.scheme = scheme
+	}
+}
+
+// WithPort makes a lookup contact the server on the given port
+// rather than the default port for the scheme.
+func WithPort(port int) LookupOption {
+	return func(lo *lookupOptions) {
+		lo.port = port
+	}
+}
+
+// WithServerOverride makes a lookup contact the given server rather than
+// the one inferred from the resource or passed to [Client.Lookup]. The
+// server may include a port, such as localhost:8080.
+func WithServerOverride(server string) LookupOption {
+	return func(lo *lookupOptions) {
+		lo.server = server
+	}
+}
+
 // Lookup looks up the given resource string at the given server.
 // The server parameter shouldn't contain a URL scheme.
-func Lookup(resource, server string) (desc *Descriptor, err error) {
+//
+// If the resulting lookup URL would be longer than 2048 characters, the
+// resource is sent in a form-encoded POST body instead. This is an extension
+// to RFC 7033, so the server has to support it (see [Handler.AllowPost]).
+func Lookup(resource, server string, opts ...LookupOption) (*Descriptor, error) {
+	return Client{}.Lookup(resource, server, opts...)
+}
+
+// LookupAcct looks up the given account ID. It uses the
+// server in the ID to do the lookup. For example, user@example.com
+// would use example.com as the server. The ID is parsed using [ParseAcct].
+func LookupAcct(id string, opts ...LookupOption) (*Descriptor, error) {
+	return Client{}.LookupAcct(id, opts...)
+}
+
+// LookupURL looks up the given resource URL. It uses the
+// URL host to do the lookup. For example, http://example.com/1
+// would use example.com as the server.
+func LookupURL(resource string, opts ...LookupOption) (*Descriptor, error) {
+	return Client{}.LookupURL(resource, opts...)
+}
+
+// Lookup is the same as the package-level [Lookup] function,
+// but it uses the client's configuration.
+func (c Client) Lookup(resource, server string, opts ...LookupOption) (desc *Descriptor, err error) {
+	lo := lookupOptions{scheme: c.Scheme}
+	for _, opt := range opts {
+		opt(&lo)
+	}
+
+	scheme := lo.scheme
+	if scheme == "" {
+		scheme = "https"
+	}
+
+	if lo.server != "" {
+		server = lo.server
+	}
+
+	if lo.port != 0 {
+		host, _, err := net.SplitHostPort(server)
+		if err != nil {
+			// The server doesn't contain a port
+			host = server
+		}
+		server = net.JoinHostPort(strings.Trim(host, "[]"), strconv.Itoa(lo.port))
+	}
+
+	if err := c.checkHost(server); err != nil {
+		return nil, err
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	httpClient = c.allowRedirects(httpClient)
+
 	u := url.URL{
-		Scheme:   "http",
+		Scheme:   scheme,
 		Host:     server,
 		Path:     "/.well-known/webfinger",
 		RawQuery: "resource=" + url.QueryEscape(resource),
 	}
 
-	res, err := http.Get(u.String())
+	cacheKey := u.String()
+	if c.Cache != nil && !lo.refresh {
+		if desc, ok := c.getCached(cacheKey); ok {
+			return desc, nil
+		}
+	}
+
+	ctx := context.Background()
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	res, err := c.get(ctx, httpClient, &u, resource)
+	if err != nil && lo.scheme == "" && ctx.Err() == nil && c.httpFallback(u.Hostname()) {
+		u.Scheme = "http"
+		res, err = c.get(ctx, httpClient, &u, resource)
+	}
 	if err != nil {
 		return nil, err
 	}
 	defer res.Body.Close()
 
-	if res.StatusCode != http.StatusOK {
-		return nil, errors.New(res.Status)
+	header := res.Header
+	if res.StatusCode == http.StatusNotFound && c.HostMetaFallback {
+		desc, header, err = c.lookupHostMeta(ctx, httpClient, &u, resource)
+		if !errors.Is(err, errNoHostMeta) && err != nil {
+			return nil, err
+		}
+	}
+
+	if desc == nil {
+		if err := responseError(&u, res); err != nil {
+			return nil, err
+		}
+
+		data, err := io.ReadAll(io.LimitReader(res.Body, maxResponseSize))
+		if err != nil {
+			return nil, err
+		}
+
+		data, err = c.jrdPayload(u.Host, res, data)
+		if err != nil {
+			return nil, err
+		}
+
+		desc, err = c.decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if c.Cache != nil {
+		c.putCached(cacheKey, desc, header)
+	}
+	return desc, nil
+}
+
+// responseError returns an error if the status of res isn't 200 OK.
+func responseError(u *url.URL, res *http.Response) error {
+	if res.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	httpErr := HTTPError{URL: u.String(), StatusCode: res.StatusCode, Status: res.Status}
+	if res.StatusCode == http.StatusTooManyRequests {
+		retryAfter, _ := ParseRetryAfter(res.Header.Get("Retry-After"), time.Now())
+		return &RateLimitedError{HTTPError: httpErr, RetryAfter: retryAfter}
+	}
+	return &httpErr
+}
+
+// decode decodes a JRD from r, leniently if the client is configured to.
+func (c Client) decode(r io.Reader) (*Descriptor, error) {
+	if c.Lenient {
+		data, err := io.ReadAll(io.LimitReader(r, maxResponseSize))
+		if err != nil {
+			return nil, err
+		}
+		return DecodeLenient(data)
 	}
 
-	desc = &Descriptor{}
-	err = json.NewDecoder(res.Body).Decode(desc)
+	desc := &Descriptor{}
+	err := json.NewDecoder(io.LimitReader(r, maxResponseSize)).Decode(desc)
 	if err != nil {
 		return nil, err
 	}
@@ -37,27 +284,80 @@ func Lookup(resource, server string) (desc *Descriptor, err error) {
 	return desc, nil
 }
 
-// LookupAcct looks up the given account ID. It uses the
-// server in the ID to do the lookup. For example, user@example.com
-// would use example.com as the server.
-func LookupAcct(id string) (*Descriptor, error) {
-	_, server, ok := strings.Cut(id, "@")
-	if !ok {
-		return nil, errors.New("invalid acct id")
+// get sends a lookup request for resource to u.
+func (c Client) get(ctx context.Context, httpClient *http.Client, u *url.URL, resource string) (*http.Response, error) {
+	var (
+		req *http.Request
+		err error
+	)
+	if len(u.String()) > maxGetURLLength {
+		// The URL is too long for some servers and proxies to handle,
+		// so send the resource in a POST body instead.
+		postURL := *u
+		postURL.RawQuery = ""
+		body := url.Values{"resource": {resource}}.Encode()
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, postURL.String(), strings.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+		if err != nil {
+			return nil, err
+		}
 	}
-	if !strings.HasPrefix(id, "acct:") {
-		id = "acct:" + id
+
+	return c.do(httpClient, req)
+}
+
+// do sends req, setting the client's User-Agent, unless its host isn't allowed.
+func (c Client) do(httpClient *http.Client, req *http.Request) (*http.Response, error) {
+	if err := c.checkHost(req.URL.Host); err != nil {
+		return nil, err
+	}
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
 	}
-	return Lookup(id, server)
+	return httpClient.Do(req)
 }
 
-// LookupURL looks up the given resource URL. It uses the
-// URL host to do the lookup. For example, http://example.com/1
-// would use example.com as the server.
-func LookupURL(resource string) (*Descriptor, error) {
+// httpFallback reports whether lookups on host may fall back to plain http.
+func (c Client) httpFallback(host string) bool {
+	hosts := c.HTTPFallbackHosts
+	if hosts == nil {
+		hosts = DefaultHTTPFallbackHosts
+	}
+
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, pattern := range hosts {
+		if suffix, ok := strings.CutPrefix(pattern, "*"); ok {
+			if strings.HasSuffix(host, suffix) {
+				return true
+			}
+		} else if host == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// LookupAcct is the same as the package-level [LookupAcct] function,
+// but it uses the client's configuration.
+func (c Client) LookupAcct(id string, opts ...LookupOption) (*Descriptor, error) {
+	acct, err := ParseAcct(id)
+	if err != nil {
+		return nil, err
+	}
+	return c.Lookup(acct.String(), acct.Host, opts...)
+}
+
+// LookupURL is the same as the package-level [LookupURL] function,
+// but it uses the client's configuration.
+func (c Client) LookupURL(resource string, opts ...LookupOption) (*Descriptor, error) {
 	u, err := url.ParseRequestURI(resource)
 	if err != nil {
 		return nil, err
 	}
-	return Lookup(resource, u.Host)
+	return c.Lookup(resource, u.Host, opts...)
 }
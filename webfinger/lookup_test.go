@@ -0,0 +1,113 @@
+package webfinger
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestLookupOptions(t *testing.T) {
+	srv := httptest.NewServer(Handler{
+		DescriptorFunc: func(resource string) (*Descriptor, error) {
+			return &Descriptor{Subject: resource}, nil
+		},
+	})
+	defer srv.Close()
+
+	addr := srv.Listener.Addr().String()
+	desc, err := LookupAcct("user@example.com", WithServerOverride(addr), WithScheme("http"))
+	if err != nil {
+		t.Fatalf("Lookup error: %s", err)
+	}
+
+	if desc.Subject != "acct:user@example.com" {
+		t.Errorf("Unexpected subject: %q", desc.Subject)
+	}
+
+	host, portStr, _ := net.SplitHostPort(addr)
+	port, _ := strconv.Atoi(portStr)
+	_, err = LookupAcct("user@"+host, WithPort(port))
+	if err != nil {
+		t.Fatalf("Lookup error: %s", err)
+	}
+}
+
+func TestLookupRateLimited(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("Retry-After", "30")
+		http.Error(res, "slow down", http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	_, err := Lookup("acct:user@example.com", srv.Listener.Addr().String())
+
+	var rle *RateLimitedError
+	if !errors.As(err, &rle) || rle.RetryAfter != 30*time.Second {
+		t.Fatalf("Expected RateLimitedError with 30s delay, got %v", err)
+	}
+
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("Expected RateLimitedError to unwrap to HTTPError, got %v", err)
+	}
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	d, ok := ParseRetryAfter(now.Add(time.Minute).Format(http.TimeFormat), now)
+	if !ok || d != time.Minute {
+		t.Errorf("Unexpected duration for HTTP date: %s", d)
+	}
+}
+
+func TestLookupHTTPFallback(t *testing.T) {
+	srv := httptest.NewServer(Handler{
+		DescriptorFunc: func(resource string) (*Descriptor, error) {
+			return &Descriptor{Subject: resource}, nil
+		},
+	})
+	defer srv.Close()
+
+	// The test server only speaks plain http, and 127.0.0.1 is allowed to fall back
+	addr := srv.Listener.Addr().String()
+	if _, err := Lookup("acct:user@example.com", addr); err != nil {
+		t.Fatalf("Lookup error: %s", err)
+	}
+
+	c := Client{HTTPFallbackHosts: []string{"*.onion"}}
+	if _, err := c.Lookup("acct:user@example.com", addr); err == nil {
+		t.Error("Expected https lookup on host without fallback to fail")
+	}
+
+	if !c.httpFallback("abc.onion.") || c.httpFallback("onion.example.com") {
+		t.Error("Unexpected fallback result for wildcard pattern")
+	}
+}
+
+func TestLookupTimeoutUserAgent(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if req.UserAgent() != "wftest/1.0" {
+			time.Sleep(300 * time.Millisecond)
+		}
+		Handler{
+			DescriptorFunc: func(resource string) (*Descriptor, error) {
+				return &Descriptor{Subject: resource}, nil
+			},
+		}.ServeHTTP(res, req)
+	}))
+	defer srv.Close()
+
+	addr := srv.Listener.Addr().String()
+	c := Client{Scheme: "http", Timeout: 100 * time.Millisecond, UserAgent: "wftest/1.0"}
+	if _, err := c.Lookup("acct:user@example.com", addr); err != nil {
+		t.Fatalf("Lookup error: %s", err)
+	}
+
+	c.UserAgent = ""
+	if _, err := c.Lookup("acct:user@example.com", addr); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected DeadlineExceeded, got %v", err)
+	}
+}
@@ -0,0 +1,123 @@
+package webfinger
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxProxyEntries is the amount of results a [ProxyResolver] caches
+// before it starts pruning expired ones.
+const maxProxyEntries = 10_000
+
+// ProxyResolver resolves resources by forwarding them to an upstream
+// WebFinger server, which is useful when fronting an existing identity
+// provider. To only forward resources that aren't known locally, use it
+// as a secondary backend of a [FallbackResolver].
+type ProxyResolver struct {
+	// Upstream is the upstream server, which may include a port,
+	// such as localhost:8080. It shouldn't contain a URL scheme.
+	Upstream string
+	// Client is the client used for lookups.
+	Client Client
+
+	// Rewrite maps prefixes of the link URLs returned by the upstream server
+	// to the prefixes they should be replaced with, such as an internal
+	// URL to a public one. If several prefixes match, the longest one wins.
+	Rewrite map[string]string
+
+	// CacheTTL is the amount of time results are cached for, including
+	// resources the upstream server doesn't know. Other errors are never
+	// cached. If it's zero, results aren't cached.
+	CacheTTL time.Duration
+
+	mtx   sync.Mutex
+	cache map[string]proxyEntry
+}
+
+type proxyEntry struct {
+	desc    *Descriptor
+	err     error
+	expires time.Time
+}
+
+// DescriptorFunc looks up the given resource at the upstream server and
+// rewrites the links in the result. If the upstream server doesn't know
+// the resource, it returns [ErrNotFound].
+func (pr *ProxyResolver) DescriptorFunc(resource string) (*Descriptor, error) {
+	if entry, ok := pr.cached(resource); ok {
+		return entry.desc, entry.err
+	}
+
+	desc, err := pr.Client.Resolver(pr.Upstream)(resource)
+	if err == nil {
+		desc = pr.rewrite(desc)
+	} else if !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+
+	pr.put(resource, proxyEntry{desc: desc, err: err})
+	return desc, err
+}
+
+// cached returns the cached result for resource, if it hasn't expired.
+func (pr *ProxyResolver) cached(resource string) (proxyEntry, bool) {
+	pr.mtx.Lock()
+	defer pr.mtx.Unlock()
+
+	entry, ok := pr.cache[resource]
+	if !ok || time.Now().After(entry.expires) {
+		return proxyEntry{}, false
+	}
+	return entry, true
+}
+
+// put caches the result for resource, if caching is enabled.
+func (pr *ProxyResolver) put(resource string, entry proxyEntry) {
+	if pr.CacheTTL == 0 {
+		return
+	}
+
+	pr.mtx.Lock()
+	defer pr.mtx.Unlock()
+
+	now := time.Now()
+	if pr.cache == nil {
+		pr.cache = map[string]proxyEntry{}
+	} else if len(pr.cache) >= maxProxyEntries {
+		for key, entry := range pr.cache {
+			if now.After(entry.expires) {
+				delete(pr.cache, key)
+			}
+		}
+	}
+
+	entry.expires = now.Add(pr.CacheTTL)
+	pr.cache[resource] = entry
+}
+
+// rewrite returns a copy of desc with its link URLs rewritten.
+func (pr *ProxyResolver) rewrite(desc *Descriptor) *Descriptor {
+	out := *desc
+	out.Links = slices.Clone(desc.Links)
+	for i, link := range out.Links {
+		out.Links[i].Href = pr.rewriteURL(link.Href)
+	}
+	return &out
+}
+
+// rewriteURL replaces the longest prefix of u that's in the Rewrite map.
+func (pr *ProxyResolver) rewriteURL(u string) string {
+	var match string
+	for prefix := range pr.Rewrite {
+		if strings.HasPrefix(u, prefix) && len(prefix) > len(match) {
+			match = prefix
+		}
+	}
+	if match == "" {
+		return u
+	}
+	return pr.Rewrite[match] + strings.TrimPrefix(u, match)
+}
@@ -0,0 +1,68 @@
+package webfinger
+
+import (
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestProxyResolver(t *testing.T) {
+	requests := 0
+	upstream := httptest.NewServer(Handler{
+		DescriptorFunc: func(resource string) (*Descriptor, error) {
+			requests++
+			if resource != "acct:user@example.com" {
+				return nil, ErrNotFound
+			}
+			return &Descriptor{
+				Subject: resource,
+				Links: []Link{
+					{Rel: "self", Href: "http://idp.internal/users/user"},
+					{Rel: "avatar", Href: "http://idp.internal/static/user.png"},
+					{Rel: "other", Href: "https://other.example.com/user"},
+				},
+			}, nil
+		},
+	})
+	defer upstream.Close()
+
+	pr := &ProxyResolver{
+		Upstream: upstream.Listener.Addr().String(),
+		Rewrite: map[string]string{
+			"http://idp.internal/":        "https://example.com/",
+			"http://idp.internal/static/": "https://static.example.com/",
+		},
+		CacheTTL: time.Minute,
+	}
+
+	expected := &Descriptor{
+		Subject: "acct:user@example.com",
+		Links: []Link{
+			{Rel: "self", Href: "https://example.com/users/user"},
+			{Rel: "avatar", Href: "https://static.example.com/user.png"},
+			{Rel: "other", Href: "https://other.example.com/user"},
+		},
+	}
+
+	for range 2 {
+		desc, err := pr.DescriptorFunc("acct:user@example.com")
+		if err != nil {
+			t.Fatalf("DescriptorFunc error: %s", err)
+		}
+
+		if !reflect.DeepEqual(desc, expected) {
+			t.Errorf("Descriptors are not equal:\n%#v\n\n%#v", desc, expected)
+		}
+
+		_, err = pr.DescriptorFunc("acct:missing@example.com")
+		if !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected ErrNotFound, got %v", err)
+		}
+	}
+
+	if requests != 2 {
+		t.Errorf("Expected 2 upstream requests, got %d", requests)
+	}
+}
@@ -0,0 +1,51 @@
+package webfinger
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RateLimitedError is returned by lookups when the server responds with
+// 429 Too Many Requests. It unwraps to the underlying [HTTPError].
+type RateLimitedError struct {
+	HTTPError
+	// RetryAfter is how long the server asked the client to wait before
+	// trying again, from the Retry-After header. It's zero if the
+	// server didn't say.
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitedError) Error() string {
+	if e.RetryAfter == 0 {
+		return e.Status
+	}
+	return fmt.Sprintf("%s (retry after %s)", e.Status, e.RetryAfter)
+}
+
+func (e *RateLimitedError) Unwrap() error {
+	return &e.HTTPError
+}
+
+// ParseRetryAfter parses the value of a Retry-After header, which can either
+// be a number of seconds or an HTTP date, and returns how long to wait from
+// now. It returns false if the value is empty or invalid. Dates in the past
+// result in a zero duration.
+func ParseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+
+	if secs, err := strconv.ParseUint(value, 10, 32); err == nil {
+		return time.Duration(secs) * time.Second, true
+	}
+
+	t, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	return max(t.Sub(now), 0), true
+}
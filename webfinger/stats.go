@@ -0,0 +1,132 @@
+package webfinger
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultMaxResources is the number of resources tracked by [ResourceStats]
+// if its MaxResources field is zero.
+const DefaultMaxResources = 10000
+
+// ResourceStats aggregates the statistics reported by [Handler.Stats] per
+// resource, so that operators can see which resources are queried the most,
+// which is useful for tuning caches and spotting scrapers. Its Observe method
+// can be used as a handler's Stats function. The zero value is ready to use.
+type ResourceStats struct {
+	// MaxResources is the maximum number of resources tracked individually,
+	// so that clients can't exhaust memory by querying random resources.
+	// Once it's reached, queries for new resources are only counted in the
+	// totals returned by [ResourceStats.Untracked]. If it's zero,
+	// [DefaultMaxResources] is used.
+	MaxResources int
+
+	mtx       sync.Mutex
+	counts    map[string]*ResourceCount
+	untracked ResourceCount
+}
+
+// ResourceCount contains the statistics of a single resource.
+type ResourceCount struct {
+	Resource string
+	// Found and NotFound are the number of queries for the
+	// resource that did and didn't return a descriptor.
+	Found    uint64
+	NotFound uint64
+	// TotalDuration and MaxDuration are the total and longest
+	// time taken to handle a query for the resource.
+	TotalDuration time.Duration
+	MaxDuration   time.Duration
+}
+
+// Queries returns the total number of queries for the resource.
+func (rc ResourceCount) Queries() uint64 {
+	return rc.Found + rc.NotFound
+}
+
+// MeanDuration returns the mean time taken to handle a query for the resource.
+func (rc ResourceCount) MeanDuration() time.Duration {
+	if rc.Queries() == 0 {
+		return 0
+	}
+	return rc.TotalDuration / time.Duration(rc.Queries())
+}
+
+// observe adds a query to the count.
+func (rc *ResourceCount) observe(found bool, duration time.Duration) {
+	if found {
+		rc.Found++
+	} else {
+		rc.NotFound++
+	}
+	rc.TotalDuration += duration
+	rc.MaxDuration = max(rc.MaxDuration, duration)
+}
+
+// Observe records a query for resource. Its signature matches [Handler.Stats].
+func (rs *ResourceStats) Observe(resource string, found bool, duration time.Duration) {
+	rs.mtx.Lock()
+	defer rs.mtx.Unlock()
+
+	if rs.counts == nil {
+		rs.counts = map[string]*ResourceCount{}
+	}
+
+	rc, ok := rs.counts[resource]
+	if !ok {
+		maxResources := rs.MaxResources
+		if maxResources <= 0 {
+			maxResources = DefaultMaxResources
+		}
+
+		if len(rs.counts) >= maxResources {
+			rs.untracked.observe(found, duration)
+			return
+		}
+
+		rc = &ResourceCount{Resource: resource}
+		rs.counts[resource] = rc
+	}
+	rc.observe(found, duration)
+}
+
+// Top returns the statistics of the n most queried resources, sorted
+// by their number of queries. If n is zero or negative, every tracked
+// resource is returned.
+func (rs *ResourceStats) Top(n int) []ResourceCount {
+	rs.mtx.Lock()
+	out := make([]ResourceCount, 0, len(rs.counts))
+	for _, rc := range rs.counts {
+		out = append(out, *rc)
+	}
+	rs.mtx.Unlock()
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Queries() != out[j].Queries() {
+			return out[i].Queries() > out[j].Queries()
+		}
+		return out[i].Resource < out[j].Resource
+	})
+
+	if n > 0 && n < len(out) {
+		out = out[:n]
+	}
+	return out
+}
+
+// Untracked returns the combined statistics of the queries that weren't
+// tracked individually because MaxResources was reached.
+func (rs *ResourceStats) Untracked() ResourceCount {
+	rs.mtx.Lock()
+	defer rs.mtx.Unlock()
+	return rs.untracked
+}
+
+// Reset clears all statistics, for example after a periodic report.
+func (rs *ResourceStats) Reset() {
+	rs.mtx.Lock()
+	defer rs.mtx.Unlock()
+	rs.counts = nil
+	rs.untracked = ResourceCount{}
+}
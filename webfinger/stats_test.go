@@ -0,0 +1,43 @@
+package webfinger
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestResourceStats(t *testing.T) {
+	stats := &ResourceStats{MaxResources: 2}
+	h := Handler{
+		DescriptorFunc: func(resource string) (*Descriptor, error) {
+			if resource != "acct:user@example.com" {
+				return nil, ErrNotFound
+			}
+			return &Descriptor{Subject: resource}, nil
+		},
+		Stats: stats.Observe,
+	}
+
+	for _, resource := range []string{
+		"acct:user@example.com",
+		"acct:user@example.com",
+		"acct:missing@example.com",
+		"acct:untracked@example.com",
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", "/.well-known/webfinger?resource="+url.QueryEscape(resource), nil))
+	}
+
+	top := stats.Top(1)
+	if len(top) != 1 || top[0].Resource != "acct:user@example.com" || top[0].Found != 2 || top[0].NotFound != 0 {
+		t.Errorf("Unexpected top resources: %#v", top)
+	}
+
+	if all := stats.Top(0); len(all) != 2 || all[1].NotFound != 1 {
+		t.Errorf("Unexpected resources: %#v", all)
+	}
+
+	if untracked := stats.Untracked(); untracked.Queries() != 1 {
+		t.Errorf("Unexpected untracked queries: %#v", untracked)
+	}
+}
@@ -1,11 +1,43 @@
 package webfinger
 
+import (
+	"encoding/json"
+	"maps"
+)
+
 // Descriptor represents a WebFinger JSON Resource Descriptor (JRD)
 type Descriptor struct {
 	Subject    string            `json:"subject"`
 	Aliases    []string          `json:"aliases"`
 	Properties map[string]string `json:"properties,omitempty"`
 	Links      []Link            `json:"links"`
+	// Expires is the time at which the descriptor expires, as used by
+	// some implementations of RFC 6415.
+	Expires string `json:"expires,omitempty"`
+
+	// Unknown contains members that aren't defined by RFC 7033. It's only
+	// filled by [DecodeLenient], and its members are included when the
+	// descriptor is encoded, so that they survive a round trip.
+	Unknown map[string]json.RawMessage `json:"-"`
+}
+
+// MarshalJSON implements the [json.Marshaler] interface
+func (d Descriptor) MarshalJSON() ([]byte, error) {
+	type descriptor Descriptor
+	data, err := json.Marshal(descriptor(d))
+	if err != nil || len(d.Unknown) == 0 {
+		return data, err
+	}
+
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(data, &members); err != nil {
+		return nil, err
+	}
+
+	// Known members take precedence over unknown ones with the same name
+	out := maps.Clone(d.Unknown)
+	maps.Copy(out, members)
+	return json.Marshal(out)
 }
 
 // Link represents a JRD link item
@@ -13,6 +45,22 @@ type Link struct {
 	Rel  string `json:"rel"`
 	Type string `json:"type,omitempty"`
 	Href string `json:"href"`
+	// Titles maps language tags, such as en-us, to human-readable
+	// titles of the link. The "und" tag is used for titles whose
+	// language is unknown.
+	Titles map[string]string `json:"titles,omitempty"`
+	// Properties contains additional information about the link.
+	// Properties with null values are decoded as empty strings.
+	Properties map[string]string `json:"properties,omitempty"`
+}
+
+// Equal reports whether l and other are the same link.
+func (l Link) Equal(other Link) bool {
+	return l.Rel == other.Rel &&
+		l.Type == other.Type &&
+		l.Href == other.Href &&
+		maps.Equal(l.Titles, other.Titles) &&
+		maps.Equal(l.Properties, other.Properties)
 }
 
 // LinkByType searches for a link with the given type. If found, it returns
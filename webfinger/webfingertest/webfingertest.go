@@ -0,0 +1,177 @@
+// Package webfingertest provides a conformance suite for WebFinger handlers,
+// so that custom DescriptorFunc implementations and third-party handlers
+// can be checked against the same scenarios as [webfinger.Handler].
+package webfingertest
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"slices"
+	"testing"
+
+	"queerdevs.org/profilefed/webfinger"
+)
+
+// MissingResource is the resource used to check how a handler responds to unknown
+// resources if none is provided. Handlers under test must not know about it.
+const MissingResource = "acct:webfingertest-missing@example.invalid"
+
+// Fixtures returns a set of descriptors that can be served by the handler under
+// test, mapped by resource. It contains an acct resource and a URL resource.
+func Fixtures() map[string]*webfinger.Descriptor {
+	return map[string]*webfinger.Descriptor{
+		"acct:user@example.com": {
+			Subject: "acct:user@example.com",
+			Aliases: []string{
+				"mailto:user@example.com",
+				"https://www.example.com/user",
+			},
+			Links: []webfinger.Link{
+				{
+					Rel:  "http://webfinger.net/rel/profile-page",
+					Type: "text/html",
+					Href: "https://www.example.com/user",
+				},
+				{
+					Rel:  "self",
+					Type: "application/x-pfd+json",
+					Href: "https://www.example.com/pfd/user",
+				},
+			},
+		},
+		"http://example.com/resource/1": {
+			Subject: "http://example.com/resource/1",
+			Properties: map[string]string{
+				"http://example.com/ns/example#publish-date": "2023-04-26",
+			},
+		},
+	}
+}
+
+// DescriptorFunc returns a descriptor function that serves the given fixtures,
+// and returns [ErrNotFound] for any other resource.
+func DescriptorFunc(fixtures map[string]*webfinger.Descriptor) func(resource string) (*webfinger.Descriptor, error) {
+	return func(resource string) (*webfinger.Descriptor, error) {
+		desc, ok := fixtures[resource]
+		if !ok {
+			return nil, ErrNotFound
+		}
+		return desc, nil
+	}
+}
+
+// ErrNotFound is returned by [DescriptorFunc] for unknown resources.
+// Handlers under test should respond to it with 404 Not Found.
+var ErrNotFound = errors.New("descriptor not found")
+
+// ErrorHandler is an error handler that responds to [ErrNotFound] with
+// 404 Not Found and to any other error with 500 Internal Server Error.
+func ErrorHandler(err error, res http.ResponseWriter) {
+	if errors.Is(err, ErrNotFound) {
+		http.Error(res, err.Error(), http.StatusNotFound)
+		return
+	}
+	http.Error(res, err.Error(), http.StatusInternalServerError)
+}
+
+// Run runs the conformance suite against h, which must serve the given fixtures.
+// Every scenario is run as a subtest of t. The suite checks that:
+//
+//   - every fixture is served with the expected subject, properties, and links
+//   - the JRD content type and the CORS header required by RFC 7033 are set
+//   - unknown resources get a 404 Not Found response
+//   - requests without a resource get a 400 Bad Request response
+//   - rel filtering never drops links with a requested rel
+func Run(t *testing.T, h http.Handler, fixtures map[string]*webfinger.Descriptor) {
+	for resource, expected := range fixtures {
+		t.Run("Resource="+resource, func(t *testing.T) {
+			res := serve(h, url.Values{"resource": {resource}})
+			if res.Code != http.StatusOK {
+				t.Fatalf("Unexpected status code: %d", res.Code)
+			}
+
+			if ct := res.Header().Get("Content-Type"); ct != "application/jrd+json" {
+				t.Errorf("Unexpected content type: %q", ct)
+			}
+
+			if cors := res.Header().Get("Access-Control-Allow-Origin"); cors != "*" {
+				t.Errorf("Unexpected Access-Control-Allow-Origin header: %q", cors)
+			}
+
+			desc := decode(t, res)
+			if desc.Subject != expected.Subject && !slices.Contains(desc.Aliases, resource) {
+				t.Errorf("Requested resource is neither the subject nor an alias: %q", desc.Subject)
+			}
+
+			if len(desc.Properties) != 0 || len(expected.Properties) != 0 {
+				if !reflect.DeepEqual(desc.Properties, expected.Properties) {
+					t.Errorf("Properties are not equal:\n%#v\n\n%#v", desc.Properties, expected.Properties)
+				}
+			}
+
+			if len(desc.Links) != 0 || len(expected.Links) != 0 {
+				if !reflect.DeepEqual(desc.Links, expected.Links) {
+					t.Errorf("Links are not equal:\n%#v\n\n%#v", desc.Links, expected.Links)
+				}
+			}
+		})
+
+		t.Run("Rel="+resource, func(t *testing.T) {
+			if len(expected.Links) == 0 {
+				t.Skip("fixture has no links")
+			}
+			rel := expected.Links[0].Rel
+
+			res := serve(h, url.Values{"resource": {resource}, "rel": {rel}})
+			if res.Code != http.StatusOK {
+				t.Fatalf("Unexpected status code: %d", res.Code)
+			}
+
+			// Servers may ignore the rel parameter, but if they
+			// don't, they must keep every link with a matching rel.
+			desc := decode(t, res)
+			for _, link := range expected.Links {
+				if link.Rel == rel && !slices.ContainsFunc(desc.Links, link.Equal) {
+					t.Errorf("Link with requested rel is missing: %#v", link)
+				}
+			}
+		})
+	}
+
+	t.Run("Missing", func(t *testing.T) {
+		res := serve(h, url.Values{"resource": {MissingResource}})
+		if res.Code != http.StatusNotFound {
+			t.Errorf("Unexpected status code: %d", res.Code)
+		}
+	})
+
+	t.Run("NoResource", func(t *testing.T) {
+		res := serve(h, url.Values{})
+		if res.Code != http.StatusBadRequest {
+			t.Errorf("Unexpected status code: %d", res.Code)
+		}
+	})
+}
+
+// serve sends a WebFinger request with the given query to h and records the response.
+func serve(h http.Handler, query url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/.well-known/webfinger?"+query.Encode(), nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+// decode decodes the JRD in res, failing the test if it's invalid.
+func decode(t *testing.T, res *httptest.ResponseRecorder) *webfinger.Descriptor {
+	t.Helper()
+
+	desc := &webfinger.Descriptor{}
+	if err := json.Unmarshal(res.Body.Bytes(), desc); err != nil {
+		t.Fatalf("Invalid JRD: %s", err)
+	}
+	return desc
+}
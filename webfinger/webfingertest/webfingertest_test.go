@@ -0,0 +1,15 @@
+package webfingertest
+
+import (
+	"testing"
+
+	"queerdevs.org/profilefed/webfinger"
+)
+
+func TestHandler(t *testing.T) {
+	fixtures := Fixtures()
+	Run(t, webfinger.Handler{
+		DescriptorFunc: DescriptorFunc(fixtures),
+		ErrorHandler:   ErrorHandler,
+	}, fixtures)
+}